@@ -0,0 +1,193 @@
+package activate
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/jpillora/backoff"
+
+	baetylctx "github.com/baetyl/baetyl-go/v2/context"
+	"github.com/baetyl/baetyl-go/v2/errors"
+	"github.com/baetyl/baetyl-go/v2/http"
+	"github.com/baetyl/baetyl-go/v2/json"
+	"github.com/baetyl/baetyl-go/v2/log"
+	v1 "github.com/baetyl/baetyl-go/v2/spec/v1"
+	"github.com/baetyl/baetyl-go/v2/utils"
+)
+
+var (
+	ErrCertificateNotSet = errors.New("failed to persist certificate, due to certificate is empty")
+)
+
+// Activator activates the node and persists the returned certificates
+type Activator struct {
+	cfg Config
+	cli *http.Client
+	log *log.Logger
+}
+
+// NewActivator creates a new activator, the defaults are applied to the fields not set
+func NewActivator(cfg Config) (*Activator, error) {
+	if err := utils.SetDefaults(&cfg); err != nil {
+		return nil, errors.Trace(err)
+	}
+	ops, err := cfg.Client.ToClientOptions()
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	return &Activator{
+		cfg: cfg,
+		cli: http.NewClient(ops),
+		log: log.With(log.Any("activate", "activator")),
+	}, nil
+}
+
+// Request builds the active request with the fingerprint
+func (a *Activator) Request() (*v1.ActiveRequest, error) {
+	fv, err := Fingerprint(a.cfg.Fingerprints)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	return &v1.ActiveRequest{
+		BatchName:        a.cfg.BatchName,
+		Namespace:        a.cfg.Namespace,
+		FingerprintValue: fv,
+		SecurityType:     a.cfg.SecurityType,
+		SecurityValue:    a.cfg.SecurityValue,
+		Mode:             a.cfg.Mode,
+		PenetrateData:    a.cfg.PenetrateData,
+	}, nil
+}
+
+// Activate posts the active request and retries with backoff until success,
+// the max attempts is reached or the context is done. The returned certificates are persisted.
+func (a *Activator) Activate(ctx context.Context) (*v1.ActiveResponse, error) {
+	req, err := a.Request()
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	data, err := json.Marshal(req)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+
+	bf := backoff.Backoff{
+		Min:    a.cfg.Retry.Min,
+		Max:    a.cfg.Retry.MaxGap,
+		Factor: a.cfg.Retry.Factor,
+		Jitter: true,
+	}
+	for {
+		var res *v1.ActiveResponse
+		res, err = a.activate(data)
+		if err == nil {
+			if err = a.Persist(res); err != nil {
+				return nil, errors.Trace(err)
+			}
+			a.log.Info("node is activated", log.Any("node", res.NodeName), log.Any("namespace", res.Namespace))
+			return res, nil
+		}
+		attempt := int(bf.Attempt()) + 1
+		if a.cfg.Retry.Max > 0 && attempt >= a.cfg.Retry.Max {
+			return nil, errors.Trace(err)
+		}
+		d := bf.Duration()
+		a.log.Warn("failed to activate, retry later", log.Any("attempt", attempt), log.Any("after", d), log.Error(err))
+		select {
+		case <-ctx.Done():
+			return nil, errors.Trace(ctx.Err())
+		case <-time.After(d):
+		}
+	}
+}
+
+func (a *Activator) activate(data []byte) (*v1.ActiveResponse, error) {
+	resp, err := a.cli.PostJSON(a.cfg.URL, data)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	res := new(v1.ActiveResponse)
+	if err = json.Unmarshal(resp, res); err != nil {
+		return nil, errors.Trace(err)
+	}
+	return res, nil
+}
+
+// Persist writes the certificates of the response into the system certificate layout.
+// Each file is replaced atomically, so readers never see a missing or partially written file.
+func (a *Activator) Persist(res *v1.ActiveResponse) error {
+	if res.Certificate.Cert == "" || res.Certificate.Key == "" {
+		return ErrCertificateNotSet
+	}
+	if err := writeCertificate(a.cfg.CertPath, res.Certificate); err != nil {
+		return errors.Trace(err)
+	}
+	if res.MqttCert.Cert == "" && res.MqttCert.Key == "" {
+		return nil
+	}
+	if a.cfg.MqttCertPath == "" {
+		a.log.Warn("mqtt certificate is not stored, due to mqtt cert path is not set")
+		return nil
+	}
+	return errors.Trace(writeCertificate(a.cfg.MqttCertPath, res.MqttCert))
+}
+
+// writeCertificate writes each PEM content of the certificate into a temporary file in the directory first,
+// then renames it to the target file, the files whose contents are absent are removed at last
+func writeCertificate(dir string, cert utils.Certificate) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return errors.Trace(err)
+	}
+	files := []struct {
+		name string
+		data string
+		perm os.FileMode
+	}{
+		{baetylctx.SystemCertCrt, cert.Cert, 0644},
+		{baetylctx.SystemCertKey, cert.Key, 0600},
+		{baetylctx.SystemCertCA, cert.CA, 0644},
+	}
+	for _, f := range files {
+		if f.data == "" {
+			continue
+		}
+		if err := writeFileAtomic(filepath.Join(dir, f.name), []byte(f.data), f.perm); err != nil {
+			return errors.Trace(err)
+		}
+	}
+	for _, f := range files {
+		if f.data != "" {
+			continue
+		}
+		if err := os.Remove(filepath.Join(dir, f.name)); err != nil && !os.IsNotExist(err) {
+			return errors.Trace(err)
+		}
+	}
+	return nil
+}
+
+func writeFileAtomic(name string, data []byte, perm os.FileMode) error {
+	tmp, err := ioutil.TempFile(filepath.Dir(name), "."+filepath.Base(name)+"-")
+	if err != nil {
+		return errors.Trace(err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err = tmp.Write(data); err != nil {
+		tmp.Close()
+		return errors.Trace(err)
+	}
+	if err = tmp.Sync(); err != nil {
+		tmp.Close()
+		return errors.Trace(err)
+	}
+	if err = tmp.Close(); err != nil {
+		return errors.Trace(err)
+	}
+	if err = os.Chmod(tmp.Name(), perm); err != nil {
+		return errors.Trace(err)
+	}
+	return errors.Trace(os.Rename(tmp.Name(), name))
+}
@@ -0,0 +1,161 @@
+package activate
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	baetylctx "github.com/baetyl/baetyl-go/v2/context"
+	"github.com/baetyl/baetyl-go/v2/mock"
+	v1 "github.com/baetyl/baetyl-go/v2/spec/v1"
+	"github.com/baetyl/baetyl-go/v2/utils"
+)
+
+const activeResponse = `{"nodeName":"node","namespace":"default","certificate":{"ca":"ca","cert":"crt","key":"key"},"mqttCert":{"ca":"mca","cert":"mcrt","key":"mkey"}}`
+
+func genConfig(t *testing.T, url string) Config {
+	var cfg Config
+	assert.NoError(t, utils.UnmarshalYAML(nil, &cfg))
+	dir := t.TempDir()
+	cfg.URL = url
+	cfg.CertPath = filepath.Join(dir, "system", "certs")
+	cfg.MqttCertPath = filepath.Join(dir, "system", "mqtt-certs")
+	cfg.Retry.Min = time.Millisecond
+	cfg.Retry.MaxGap = time.Millisecond
+	cfg.Fingerprints = []FingerprintSource{{Type: SourceInput, Value: "abc"}}
+	return cfg
+}
+
+func TestFingerprint(t *testing.T) {
+	_, err := Fingerprint(nil)
+	assert.Equal(t, ErrFingerprintNotSet, err)
+
+	sn := filepath.Join(t.TempDir(), "sn")
+	assert.NoError(t, ioutil.WriteFile(sn, []byte("SN001\n"), 0644))
+	host, err := os.Hostname()
+	assert.NoError(t, err)
+
+	fv, err := Fingerprint([]FingerprintSource{
+		{Type: SourceSN, SNPath: sn},
+		{Type: SourceHostname},
+		{Type: SourceInput, Value: "input"},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "SN001-"+host+"-input", fv)
+
+	_, err = Fingerprint([]FingerprintSource{{Type: SourceSN, SNPath: sn + "x"}})
+	assert.Error(t, err)
+	_, err = Fingerprint([]FingerprintSource{{Type: SourceInput}})
+	assert.Error(t, err)
+	_, err = Fingerprint([]FingerprintSource{{Type: "unknown"}})
+	assert.Error(t, err)
+	_, err = Fingerprint([]FingerprintSource{{Type: SourceMAC, Interface: "not-exist"}})
+	assert.Error(t, err)
+}
+
+func TestActivate(t *testing.T) {
+	ms := mock.NewServer(nil,
+		mock.NewResponse(500, []byte("unavailable")),
+		mock.NewResponse(200, []byte(activeResponse)),
+	)
+	defer ms.Close()
+
+	cfg := genConfig(t, ms.URL+"/v1/active")
+	a, err := NewActivator(cfg)
+	assert.NoError(t, err)
+
+	req, err := a.Request()
+	assert.NoError(t, err)
+	assert.Equal(t, &v1.ActiveRequest{FingerprintValue: "abc", Mode: "kube"}, req)
+
+	res, err := a.Activate(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, "node", res.NodeName)
+
+	for name, expect := range map[string]string{
+		filepath.Join(cfg.CertPath, "ca.pem"):      "ca",
+		filepath.Join(cfg.CertPath, "crt.pem"):     "crt",
+		filepath.Join(cfg.CertPath, "key.pem"):     "key",
+		filepath.Join(cfg.MqttCertPath, "ca.pem"):  "mca",
+		filepath.Join(cfg.MqttCertPath, "crt.pem"): "mcrt",
+		filepath.Join(cfg.MqttCertPath, "key.pem"): "mkey",
+	} {
+		data, err := ioutil.ReadFile(name)
+		assert.NoError(t, err)
+		assert.Equal(t, expect, string(data))
+	}
+	fi, err := os.Stat(filepath.Join(cfg.CertPath, "key.pem"))
+	assert.NoError(t, err)
+	assert.Equal(t, os.FileMode(0600), fi.Mode().Perm())
+
+	// certificates are replaced file by file, the stale files are removed
+	res.Certificate = utils.Certificate{Cert: "crt2", Key: "key2"}
+	res.MqttCert = utils.Certificate{}
+	assert.NoError(t, a.Persist(res))
+	assert.False(t, utils.FileExists(filepath.Join(cfg.CertPath, "ca.pem")))
+	data, err := ioutil.ReadFile(filepath.Join(cfg.CertPath, "crt.pem"))
+	assert.NoError(t, err)
+	assert.Equal(t, "crt2", string(data))
+	entries, err := ioutil.ReadDir(cfg.CertPath)
+	assert.NoError(t, err)
+	assert.Len(t, entries, 2)
+	data, err = ioutil.ReadFile(filepath.Join(cfg.MqttCertPath, "crt.pem"))
+	assert.NoError(t, err)
+	assert.Equal(t, "mcrt", string(data))
+
+	assert.Equal(t, ErrCertificateNotSet, a.Persist(&v1.ActiveResponse{}))
+}
+
+func TestActivatorDefaults(t *testing.T) {
+	a, err := NewActivator(Config{URL: "http://localhost"})
+	assert.NoError(t, err)
+	assert.Equal(t, baetylctx.SystemCertPath, a.cfg.CertPath)
+	assert.Equal(t, "", a.cfg.MqttCertPath)
+	assert.Equal(t, "kube", a.cfg.Mode)
+	assert.Equal(t, time.Second, a.cfg.Retry.Min)
+
+	// the mqtt certificate is not stored if the path is not set
+	dir := t.TempDir()
+	a.cfg.CertPath = filepath.Join(dir, "certs")
+	assert.NoError(t, a.Persist(&v1.ActiveResponse{
+		Certificate: utils.Certificate{Cert: "crt", Key: "key"},
+		MqttCert:    utils.Certificate{Cert: "mcrt", Key: "mkey"},
+	}))
+	entries, err := ioutil.ReadDir(dir)
+	assert.NoError(t, err)
+	assert.Len(t, entries, 1)
+}
+
+func TestActivateRetry(t *testing.T) {
+	ms := mock.NewServer(nil,
+		mock.NewResponse(500, []byte("unavailable")),
+		mock.NewResponse(500, []byte("unavailable")),
+		mock.NewResponse(200, []byte(activeResponse)),
+	)
+	defer ms.Close()
+
+	cfg := genConfig(t, ms.URL)
+	cfg.Retry.Max = 2
+	a, err := NewActivator(cfg)
+	assert.NoError(t, err)
+	_, err = a.Activate(context.Background())
+	assert.Error(t, err)
+	assert.False(t, utils.DirExists(cfg.CertPath))
+
+	// canceled
+	cfg.Retry.Max = 0
+	cfg.Retry.Min = time.Hour
+	cfg.Retry.MaxGap = time.Hour
+	a, err = NewActivator(cfg)
+	assert.NoError(t, err)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	ms.Close()
+	_, err = a.Activate(ctx)
+	assert.Error(t, err)
+}
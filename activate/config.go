@@ -0,0 +1,61 @@
+package activate
+
+import (
+	"time"
+
+	"github.com/baetyl/baetyl-go/v2/http"
+)
+
+// All fingerprint sources
+const (
+	SourceSN       = "sn"
+	SourceMAC      = "mac"
+	SourceHostname = "hostname"
+	SourceInput    = "input"
+	SourceMachine  = "machine"
+)
+
+// Config the config of activator
+type Config struct {
+	// specifies the url to post the active request to
+	URL string `yaml:"url" json:"url" binding:"required"`
+	// specifies the fields of the active request
+	BatchName     string            `yaml:"batchName" json:"batchName"`
+	Namespace     string            `yaml:"namespace" json:"namespace"`
+	SecurityType  string            `yaml:"securityType" json:"securityType"`
+	SecurityValue string            `yaml:"securityValue" json:"securityValue"`
+	Mode          string            `yaml:"mode" json:"mode" default:"kube"`
+	PenetrateData map[string]string `yaml:"penetrateData" json:"penetrateData"`
+	// specifies the sources of the fingerprint, values of all sources are joined in order
+	Fingerprints []FingerprintSource `yaml:"fingerprints" json:"fingerprints" binding:"dive"`
+	// specifies the directory to store the node certificate, which is the system certificate path of context
+	CertPath string `yaml:"certPath" json:"certPath" default:"var/lib/baetyl/system/certs"`
+	// specifies the directory to store the mqtt certificate, the mqtt certificate is not stored if empty
+	MqttCertPath string `yaml:"mqttCertPath" json:"mqttCertPath"`
+	// specifies the retry policy of the active request
+	Retry  RetryConfig       `yaml:"retry" json:"retry"`
+	Client http.ClientConfig `yaml:"client" json:"client"`
+}
+
+// FingerprintSource the source of fingerprint
+type FingerprintSource struct {
+	// specifies the type of source. sn | mac | hostname | input | machine
+	Type string `yaml:"type" json:"type" binding:"required"`
+	// specifies the file to read serial number from, only for sn
+	SNPath string `yaml:"snPath" json:"snPath"`
+	// specifies the network interface, the first non-loopback interface is used if empty, only for mac
+	Interface string `yaml:"interface" json:"interface"`
+	// specifies the value, only for input
+	Value string `yaml:"value" json:"value"`
+	// specifies the app id to protect the machine id, only for machine
+	AppID string `yaml:"appId" json:"appId"`
+}
+
+// RetryConfig the retry policy with exponential backoff
+type RetryConfig struct {
+	// specifies the max number of attempts, retry until success if 0
+	Max    int           `yaml:"max" json:"max"`
+	Min    time.Duration `yaml:"min" json:"min" default:"1s"`
+	MaxGap time.Duration `yaml:"maxGap" json:"maxGap" default:"1m"`
+	Factor float64       `yaml:"factor" json:"factor" default:"2"`
+}
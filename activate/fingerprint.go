@@ -0,0 +1,81 @@
+package activate
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"strings"
+
+	"github.com/baetyl/baetyl-go/v2/errors"
+	"github.com/baetyl/baetyl-go/v2/utils"
+)
+
+const fingerprintSeparator = "-"
+
+var (
+	ErrFingerprintNotSet = errors.New("failed to get fingerprint, due to no source is configured")
+	ErrMACNotFound       = errors.New("failed to get fingerprint, due to no mac address is found")
+)
+
+// Fingerprint builds the fingerprint value from the configured sources
+func Fingerprint(sources []FingerprintSource) (string, error) {
+	if len(sources) == 0 {
+		return "", ErrFingerprintNotSet
+	}
+	var values []string
+	for _, s := range sources {
+		v, err := fingerprint(s)
+		if err != nil {
+			return "", errors.Trace(err)
+		}
+		if v == "" {
+			return "", errors.Errorf("failed to get fingerprint, due to empty value of source (%s)", s.Type)
+		}
+		values = append(values, v)
+	}
+	return strings.Join(values, fingerprintSeparator), nil
+}
+
+func fingerprint(s FingerprintSource) (string, error) {
+	switch s.Type {
+	case SourceSN:
+		data, err := ioutil.ReadFile(s.SNPath)
+		if err != nil {
+			return "", errors.Trace(err)
+		}
+		return strings.TrimSpace(string(data)), nil
+	case SourceMAC:
+		return getMAC(s.Interface)
+	case SourceHostname:
+		name, err := os.Hostname()
+		return name, errors.Trace(err)
+	case SourceInput:
+		return s.Value, nil
+	case SourceMachine:
+		v, err := utils.GetFingerprint(s.AppID)
+		return v, errors.Trace(err)
+	default:
+		return "", errors.Errorf("failed to get fingerprint, due to unknown source (%s)", s.Type)
+	}
+}
+
+func getMAC(name string) (string, error) {
+	if name != "" {
+		ifi, err := net.InterfaceByName(name)
+		if err != nil {
+			return "", errors.Trace(err)
+		}
+		return ifi.HardwareAddr.String(), nil
+	}
+	ifis, err := net.Interfaces()
+	if err != nil {
+		return "", errors.Trace(err)
+	}
+	for _, ifi := range ifis {
+		if ifi.Flags&net.FlagLoopback != 0 || len(ifi.HardwareAddr) == 0 {
+			continue
+		}
+		return ifi.HardwareAddr.String(), nil
+	}
+	return "", ErrMACNotFound
+}
@@ -0,0 +1,276 @@
+package autoscale
+
+import (
+	"math"
+	"sync"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/resource"
+
+	"github.com/baetyl/baetyl-go/v2/errors"
+	v1 "github.com/baetyl/baetyl-go/v2/spec/v1"
+)
+
+var (
+	ErrAutoScaleNotSet = errors.New("failed to create calculator, due to autoscale config is not set")
+	ErrNoMetrics       = errors.New("failed to calculate replica, due to no metrics available")
+)
+
+// MetricResult the calculation result of a single metric
+type MetricResult struct {
+	Name       string `json:"name,omitempty" yaml:"name,omitempty"`
+	TargetType string `json:"targetType,omitempty" yaml:"targetType,omitempty"`
+	// Current the current usage, in milli units, or in percent for Utilization
+	Current int64 `json:"current" yaml:"current"`
+	// Target the target usage, in milli units, or in percent for Utilization
+	Target  int64 `json:"target" yaml:"target"`
+	Replica int   `json:"replica" yaml:"replica"`
+}
+
+// Result the calculation result of all metrics
+type Result struct {
+	// Replica the desired replica after bounding and stabilization
+	Replica int `json:"replica" yaml:"replica"`
+	// Recommended the desired replica before stabilization
+	Recommended int            `json:"recommended" yaml:"recommended"`
+	Current     int            `json:"current" yaml:"current"`
+	Metrics     []MetricResult `json:"metrics,omitempty" yaml:"metrics,omitempty"`
+}
+
+type metric struct {
+	name       string
+	targetType string
+	// target in milli units, or in percent for Utilization
+	target int64
+	// request the resource request of an instance in milli units, only for Utilization
+	request int64
+}
+
+type recommendation struct {
+	replica int
+	time    time.Time
+}
+
+// Calculator computes the desired replica of an application from the resource usage of its instances.
+// It only relies on the reported AppStats, so it works for both kube and native mode.
+type Calculator struct {
+	min, max   int
+	tolerance  float64
+	upWindow   time.Duration
+	downWindow time.Duration
+	metrics    []metric
+	history    []recommendation
+	lock       sync.Mutex
+}
+
+// NewCalculator creates a calculator from the autoscale config of the application.
+// The resource requests of all services are summed up as the request of an instance, which
+// Utilization targets are based on.
+func NewCalculator(app *v1.Application) (*Calculator, error) {
+	if app == nil || app.AutoScaleCfg == nil {
+		return nil, ErrAutoScaleNotSet
+	}
+	cfg := app.AutoScaleCfg
+	c := &Calculator{
+		min:        cfg.MinReplicas,
+		max:        cfg.MaxReplicas,
+		tolerance:  float64(cfg.TolerancePercent) / 100,
+		upWindow:   time.Duration(cfg.ScaleUpStabilizationSeconds) * time.Second,
+		downWindow: time.Duration(cfg.ScaleDownStabilizationSeconds) * time.Second,
+	}
+	if c.min < 1 {
+		c.min = 1
+	}
+	if c.max > 0 && c.max < c.min {
+		return nil, errors.Errorf("failed to create calculator, due to max replicas (%d) less than min replicas (%d)", c.max, c.min)
+	}
+	for _, spec := range cfg.Metrics {
+		if spec.Type != "" && spec.Type != v1.MetricTypeResource {
+			return nil, errors.Errorf("failed to create calculator, due to unsupported metric type (%s)", spec.Type)
+		}
+		if spec.Resource == nil || spec.Resource.Name == "" {
+			return nil, errors.New("failed to create calculator, due to resource metric is not set")
+		}
+		m, err := newMetric(spec.Resource, app.Services)
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+		c.metrics = append(c.metrics, *m)
+	}
+	if len(c.metrics) == 0 {
+		return nil, errors.New("failed to create calculator, due to no metrics configured")
+	}
+	return c, nil
+}
+
+// Calculate computes the desired replica from the app stats.
+// Only running instances which report the usage of a metric are taken into account.
+// Recommendations within the stabilization windows are kept to smooth the result.
+func (c *Calculator) Calculate(stats *v1.AppStats, current int, now time.Time) (*Result, error) {
+	if stats == nil {
+		return nil, ErrNoMetrics
+	}
+	res := &Result{Current: current}
+	desired := 0
+	for _, m := range c.metrics {
+		mr, ok, err := c.calculate(m, stats, current)
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+		if !ok {
+			continue
+		}
+		res.Metrics = append(res.Metrics, *mr)
+		if mr.Replica > desired {
+			desired = mr.Replica
+		}
+	}
+	if len(res.Metrics) == 0 {
+		return nil, ErrNoMetrics
+	}
+	res.Recommended = c.bound(desired)
+	res.Replica = c.stabilize(res.Recommended, current, now)
+	return res, nil
+}
+
+// Apply calculates the desired replica and sets it to the application, returns whether the replica changed
+func (c *Calculator) Apply(app *v1.Application, stats *v1.AppStats, now time.Time) (bool, error) {
+	res, err := c.Calculate(stats, app.Replica, now)
+	if err != nil {
+		return false, errors.Trace(err)
+	}
+	if res.Replica == app.Replica {
+		return false, nil
+	}
+	app.Replica = res.Replica
+	return true, nil
+}
+
+func (c *Calculator) calculate(m metric, stats *v1.AppStats, current int) (*MetricResult, bool, error) {
+	var total int64
+	ready := 0
+	for _, ins := range stats.InstanceStats {
+		if ins.Status != v1.Running {
+			continue
+		}
+		usg, ok := ins.Usage[m.name]
+		if !ok {
+			continue
+		}
+		q, err := resource.ParseQuantity(usg)
+		if err != nil {
+			return nil, false, errors.Trace(err)
+		}
+		total += q.MilliValue()
+		ready++
+	}
+	if ready == 0 {
+		return nil, false, nil
+	}
+
+	mr := &MetricResult{Name: m.name, TargetType: m.targetType, Target: m.target}
+	base := ready
+	switch m.targetType {
+	case v1.MetricTargetUtilization:
+		mr.Current = total * 100 / int64(ready) / m.request
+	case v1.MetricTargetAverage:
+		mr.Current = total / int64(ready)
+	case v1.MetricTargetValue:
+		mr.Current = total
+		base = current
+	}
+	ratio := float64(mr.Current) / float64(m.target)
+	if math.Abs(ratio-1) <= c.tolerance {
+		mr.Replica = current
+	} else {
+		mr.Replica = int(math.Ceil(ratio * float64(base)))
+	}
+	return mr, true, nil
+}
+
+func (c *Calculator) bound(replica int) int {
+	if replica < c.min {
+		return c.min
+	}
+	if c.max > 0 && replica > c.max {
+		return c.max
+	}
+	return replica
+}
+
+// stabilize scales up to the lowest and down to the highest recommendation within the windows
+func (c *Calculator) stabilize(recommended, current int, now time.Time) int {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.history = append(c.history, recommendation{replica: recommended, time: now})
+	up, down := recommended, recommended
+	keep := c.history[:0]
+	for _, r := range c.history {
+		age := now.Sub(r.time)
+		if age >= c.upWindow && age >= c.downWindow {
+			continue
+		}
+		keep = append(keep, r)
+		if age < c.upWindow && r.replica < up {
+			up = r.replica
+		}
+		if age < c.downWindow && r.replica > down {
+			down = r.replica
+		}
+	}
+	c.history = keep
+
+	res := current
+	if res < up {
+		res = up
+	}
+	if res > down {
+		res = down
+	}
+	return c.bound(res)
+}
+
+func newMetric(rm *v1.ResourceMetric, services []v1.Service) (*metric, error) {
+	m := &metric{name: rm.Name, targetType: rm.TargetType}
+	switch rm.TargetType {
+	case v1.MetricTargetUtilization:
+		if rm.AverageUtilization <= 0 {
+			return nil, errors.Errorf("failed to create calculator, due to invalid average utilization of resource (%s)", rm.Name)
+		}
+		m.target = int64(rm.AverageUtilization)
+		for _, svc := range services {
+			if svc.Resources == nil {
+				continue
+			}
+			req, ok := svc.Resources.Requests[rm.Name]
+			if !ok {
+				continue
+			}
+			q, err := resource.ParseQuantity(req)
+			if err != nil {
+				return nil, errors.Trace(err)
+			}
+			m.request += q.MilliValue()
+		}
+		if m.request <= 0 {
+			return nil, errors.Errorf("failed to create calculator, due to no request of resource (%s) for utilization", rm.Name)
+		}
+	case v1.MetricTargetValue, v1.MetricTargetAverage:
+		v := rm.Value
+		if rm.TargetType == v1.MetricTargetAverage {
+			v = rm.AverageValue
+		}
+		q, err := resource.ParseQuantity(v)
+		if err != nil {
+			return nil, errors.Errorf("failed to create calculator, due to invalid target of resource (%s): %s", rm.Name, err.Error())
+		}
+		m.target = q.MilliValue()
+		if m.target <= 0 {
+			return nil, errors.Errorf("failed to create calculator, due to non-positive target of resource (%s)", rm.Name)
+		}
+	default:
+		return nil, errors.Errorf("failed to create calculator, due to unsupported target type (%s)", rm.TargetType)
+	}
+	return m, nil
+}
@@ -0,0 +1,165 @@
+package autoscale
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	v1 "github.com/baetyl/baetyl-go/v2/spec/v1"
+)
+
+func genApp(cfg *v1.AutoScaleCfg) *v1.Application {
+	return &v1.Application{
+		Name:    "app",
+		Replica: 2,
+		Services: []v1.Service{
+			{Name: "a", Resources: &v1.Resources{Requests: map[string]string{"cpu": "200m", "memory": "64Mi"}}},
+			{Name: "b", Resources: &v1.Resources{Requests: map[string]string{"cpu": "300m"}}},
+		},
+		AutoScaleCfg: cfg,
+	}
+}
+
+func genStats(usages ...string) *v1.AppStats {
+	stats := &v1.AppStats{InstanceStats: map[string]v1.InstanceStats{}}
+	for i, u := range usages {
+		name := fmt.Sprintf("ins-%d", i)
+		stats.InstanceStats[name] = v1.InstanceStats{
+			Name:   name,
+			Status: v1.Running,
+			Usage:  map[string]string{"cpu": u},
+		}
+	}
+	return stats
+}
+
+func TestNewCalculator(t *testing.T) {
+	_, err := NewCalculator(nil)
+	assert.Equal(t, ErrAutoScaleNotSet, err)
+	_, err = NewCalculator(genApp(nil))
+	assert.Equal(t, ErrAutoScaleNotSet, err)
+
+	invalid := []*v1.AutoScaleCfg{
+		{MinReplicas: 3, MaxReplicas: 2, Metrics: []v1.MetricSpec{{Resource: &v1.ResourceMetric{Name: "cpu", TargetType: "Utilization", AverageUtilization: 50}}}},
+		{},
+		{Metrics: []v1.MetricSpec{{Type: "Pods"}}},
+		{Metrics: []v1.MetricSpec{{}}},
+		{Metrics: []v1.MetricSpec{{Resource: &v1.ResourceMetric{Name: "cpu", TargetType: "Unknown"}}}},
+		{Metrics: []v1.MetricSpec{{Resource: &v1.ResourceMetric{Name: "cpu", TargetType: "Utilization"}}}},
+		{Metrics: []v1.MetricSpec{{Resource: &v1.ResourceMetric{Name: "gpu", TargetType: "Utilization", AverageUtilization: 50}}}},
+		{Metrics: []v1.MetricSpec{{Resource: &v1.ResourceMetric{Name: "cpu", TargetType: "Value", Value: "x"}}}},
+		{Metrics: []v1.MetricSpec{{Resource: &v1.ResourceMetric{Name: "cpu", TargetType: "AverageValue", AverageValue: "0"}}}},
+	}
+	for i, cfg := range invalid {
+		_, err = NewCalculator(genApp(cfg))
+		assert.Error(t, err, i)
+	}
+}
+
+func TestCalculate(t *testing.T) {
+	app := genApp(&v1.AutoScaleCfg{
+		MinReplicas:      1,
+		MaxReplicas:      5,
+		TolerancePercent: 10,
+		Metrics: []v1.MetricSpec{
+			{Resource: &v1.ResourceMetric{Name: "cpu", TargetType: "Utilization", AverageUtilization: 50}},
+		},
+	})
+	c, err := NewCalculator(app)
+	assert.NoError(t, err)
+	now := time.Now()
+
+	// request 500m, target 250m per instance, usage 500m per instance
+	res, err := c.Calculate(genStats("500m", "500m"), 2, now)
+	assert.NoError(t, err)
+	assert.Equal(t, 4, res.Replica)
+	assert.Equal(t, int64(100), res.Metrics[0].Current)
+
+	// within tolerance
+	res, err = c.Calculate(genStats("260m", "260m"), 2, now)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, res.Replica)
+
+	// bounded by max replicas
+	res, err = c.Calculate(genStats("2", "2"), 2, now)
+	assert.NoError(t, err)
+	assert.Equal(t, 16, res.Metrics[0].Replica)
+	assert.Equal(t, 5, res.Replica)
+
+	// no running instance
+	stats := genStats("500m")
+	stats.InstanceStats["ins-0"] = v1.InstanceStats{Status: v1.Pending, Usage: map[string]string{"cpu": "1"}}
+	_, err = c.Calculate(stats, 2, now)
+	assert.Equal(t, ErrNoMetrics, err)
+	_, err = c.Calculate(nil, 2, now)
+	assert.Equal(t, ErrNoMetrics, err)
+
+	// invalid usage
+	_, err = c.Calculate(genStats("x"), 2, now)
+	assert.Error(t, err)
+}
+
+func TestCalculateMultiMetrics(t *testing.T) {
+	app := genApp(&v1.AutoScaleCfg{
+		MaxReplicas: 10,
+		Metrics: []v1.MetricSpec{
+			{Resource: &v1.ResourceMetric{Name: "cpu", TargetType: "AverageValue", AverageValue: "100m"}},
+			{Resource: &v1.ResourceMetric{Name: "cpu", TargetType: "Value", Value: "1"}},
+		},
+	})
+	c, err := NewCalculator(app)
+	assert.NoError(t, err)
+
+	// average 150m -> 3 replicas, total 300m with 2 replicas -> 1 replica, the max wins
+	res, err := c.Calculate(genStats("100m", "200m"), 2, time.Now())
+	assert.NoError(t, err)
+	assert.Len(t, res.Metrics, 2)
+	assert.Equal(t, 3, res.Metrics[0].Replica)
+	assert.Equal(t, 1, res.Metrics[1].Replica)
+	assert.Equal(t, 3, res.Replica)
+}
+
+func TestStabilization(t *testing.T) {
+	app := genApp(&v1.AutoScaleCfg{
+		MaxReplicas:                   10,
+		ScaleUpStabilizationSeconds:   60,
+		ScaleDownStabilizationSeconds: 300,
+		Metrics: []v1.MetricSpec{
+			{Resource: &v1.ResourceMetric{Name: "cpu", TargetType: "AverageValue", AverageValue: "100m"}},
+		},
+	})
+	c, err := NewCalculator(app)
+	assert.NoError(t, err)
+	now := time.Now()
+
+	// the first recommendation is applied
+	changed, err := c.Apply(app, genStats("200m", "200m"), now)
+	assert.NoError(t, err)
+	assert.True(t, changed)
+	assert.Equal(t, 4, app.Replica)
+
+	// scale up limited by the lowest recommendation within the up window
+	changed, err = c.Apply(app, genStats("400m", "400m", "400m", "400m"), now.Add(30*time.Second))
+	assert.NoError(t, err)
+	assert.False(t, changed)
+	assert.Equal(t, 4, app.Replica)
+
+	// scale down limited by the highest recommendation within the down window
+	changed, err = c.Apply(app, genStats("50m", "50m", "50m", "50m"), now.Add(90*time.Second))
+	assert.NoError(t, err)
+	assert.False(t, changed)
+	assert.Equal(t, 4, app.Replica)
+
+	// scale up is still limited by the low recommendation within the up window
+	res, err := c.Calculate(genStats("400m", "400m", "400m", "400m"), 4, now.Add(100*time.Second))
+	assert.NoError(t, err)
+	assert.Equal(t, 4, res.Replica)
+
+	// all windows passed
+	changed, err = c.Apply(app, genStats("50m", "50m", "50m", "50m"), now.Add(time.Hour))
+	assert.NoError(t, err)
+	assert.True(t, changed)
+	assert.Equal(t, 2, app.Replica)
+}
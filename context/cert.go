@@ -0,0 +1,168 @@
+package context
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"sync"
+	"time"
+
+	"github.com/baetyl/baetyl-go/v2/errors"
+	"github.com/baetyl/baetyl-go/v2/log"
+	"github.com/baetyl/baetyl-go/v2/utils"
+)
+
+var (
+	ErrCertMonitorStarted = errors.New("cert monitor has been started")
+)
+
+// CertRotator rotates the system certificate, which is implemented by the context created by NewContext
+type CertRotator interface {
+	// OnSystemCertExpiring registers a hook to renew the system certificate when it is about to expire.
+	// The clients created by context reload the certificate from disk on change without restart.
+	OnSystemCertExpiring(hook CertRenewHook)
+	// SystemCertificate returns the latest system certificate, which is reloaded if the file is changed.
+	SystemCertificate() (*x509.Certificate, error)
+	// StartCertMonitor starts to check the expiry of system certificate periodically, and calls renewal hooks
+	// if it is about to expire. It is started by Run if cert rotation is enabled in system config,
+	// and is stopped during shutdown.
+	StartCertMonitor() error
+}
+
+// CertRenewHook renews the certificate which is about to expire, such as requesting a new one and writing it to disk.
+// The certificate is reloaded from disk after all hooks are called.
+type CertRenewHook func(cert *x509.Certificate) error
+
+type certRotation struct {
+	// the reloaders of key pairs, keyed by files
+	reloaders map[string]*utils.CertReloader
+	hooks     []CertRenewHook
+	monitor   *utils.Tomb
+	mut       sync.Mutex
+}
+
+func (r *certRotation) reloader(cert utils.Certificate) (*utils.CertReloader, error) {
+	key := cert.Cert + ":" + cert.Key
+	r.mut.Lock()
+	defer r.mut.Unlock()
+	if cr, ok := r.reloaders[key]; ok {
+		return cr, nil
+	}
+	cr, err := utils.NewCertReloader(cert.Cert, cert.Key, cert.Passphrase)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	if r.reloaders == nil {
+		r.reloaders = map[string]*utils.CertReloader{}
+	}
+	r.reloaders[key] = cr
+	return cr, nil
+}
+
+// reloadClientCert makes the tls config reload the client certificate from disk on change,
+// so that the clients pick up the rotated certificate on the next connection
+func (r *certRotation) reloadClientCert(tc *tls.Config, cert utils.Certificate) error {
+	if tc == nil || cert.Cert == "" || cert.Key == "" {
+		return nil
+	}
+	cr, err := r.reloader(cert)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	utils.SetClientCertReloader(tc, cr)
+	return nil
+}
+
+func (c *ctx) OnSystemCertExpiring(hook CertRenewHook) {
+	c.certRotation.mut.Lock()
+	defer c.certRotation.mut.Unlock()
+	c.certRotation.hooks = append(c.certRotation.hooks, hook)
+}
+
+func (c *ctx) SystemCertificate() (*x509.Certificate, error) {
+	cr, err := c.certRotation.reloader(c.SystemConfig().Certificate)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	return cr.Leaf(), nil
+}
+
+func (c *ctx) StartCertMonitor() error {
+	c.certRotation.mut.Lock()
+	defer c.certRotation.mut.Unlock()
+	if c.certRotation.monitor != nil {
+		return errors.Trace(ErrCertMonitorStarted)
+	}
+	t := new(utils.Tomb)
+	t.Go(c.monitoringCert)
+	c.certRotation.monitor = t
+	c.RegisterCloser("cert monitor", CloserFunc(func() error {
+		t.Kill(nil)
+		return errors.Trace(t.Wait())
+	}))
+	return nil
+}
+
+func (c *ctx) monitoringCert() error {
+	cfg := c.SystemConfig().CertRotation
+	c.log.Info("cert monitor starts", log.Any("interval", cfg.Interval), log.Any("renewBefore", cfg.RenewBefore))
+	defer c.log.Info("cert monitor has stopped")
+
+	ticker := time.NewTicker(cfg.Interval)
+	defer ticker.Stop()
+	for {
+		if err := c.rotateSystemCert(); err != nil {
+			c.log.Warn("failed to rotate system certificate", log.Error(err))
+		}
+		select {
+		case <-ticker.C:
+		case <-c.certRotation.monitor.Dying():
+			return nil
+		}
+	}
+}
+
+// rotateSystemCert reloads the system certificate, and calls renewal hooks if it is about to expire
+func (c *ctx) rotateSystemCert() error {
+	cr, err := c.certRotation.reloader(c.SystemConfig().Certificate)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	if err = cr.Reload(); err != nil {
+		c.log.Warn("failed to reload system certificate, to use the last one", log.Error(err))
+	}
+	leaf := cr.Leaf()
+	metricCertExpiry.Set(float64(leaf.NotAfter.Unix()))
+	remaining := time.Until(leaf.NotAfter)
+	if remaining > c.SystemConfig().CertRotation.RenewBefore {
+		return nil
+	}
+	if remaining <= 0 {
+		c.log.Error("system certificate has expired", log.Any("notAfter", leaf.NotAfter))
+	} else {
+		c.log.Warn("system certificate is about to expire", log.Any("notAfter", leaf.NotAfter))
+	}
+
+	c.certRotation.mut.Lock()
+	hooks := make([]CertRenewHook, len(c.certRotation.hooks))
+	copy(hooks, c.certRotation.hooks)
+	c.certRotation.mut.Unlock()
+	if len(hooks) == 0 {
+		return nil
+	}
+	for _, hook := range hooks {
+		if err = hook(leaf); err != nil {
+			return errors.Trace(err)
+		}
+	}
+	if err = cr.Reload(); err != nil {
+		return errors.Trace(err)
+	}
+	renewed := cr.Leaf()
+	metricCertExpiry.Set(float64(renewed.NotAfter.Unix()))
+	if renewed.Equal(leaf) {
+		c.log.Warn("system certificate is not renewed by hooks", log.Any("notAfter", leaf.NotAfter))
+		return nil
+	}
+	c.log.Info("system certificate is renewed", log.Any("notAfter", renewed.NotAfter))
+	return nil
+}
@@ -0,0 +1,80 @@
+package context
+
+import (
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/baetyl/baetyl-go/v2/errors"
+	"github.com/baetyl/baetyl-go/v2/pki"
+)
+
+func TestCertRotation(t *testing.T) {
+	pwd, err := os.Getwd()
+	assert.NoError(t, err)
+	defer os.Chdir(pwd)
+	dir := initCert(t)
+	defer os.RemoveAll(dir)
+
+	cli, err := pki.NewPKIClient()
+	assert.NoError(t, err)
+	info := &x509.CertificateRequest{Subject: pkix.Name{CommonName: "svc", OrganizationalUnit: []string{KeyBaetyl}}}
+	// about to expire
+	old, err := cli.CreateSelfSignedRootCert(info, 1)
+	assert.NoError(t, err)
+
+	c := newContext("")
+	cfg := c.SystemConfig().Certificate
+	assert.NoError(t, ioutil.WriteFile(cfg.Cert, old.Crt, 0600))
+	assert.NoError(t, ioutil.WriteFile(cfg.Key, old.Key, 0600))
+
+	cert, err := c.SystemCertificate()
+	assert.NoError(t, err)
+	assert.True(t, time.Until(cert.NotAfter) < 48*time.Hour)
+	hc, err := c.NewCoreHttpsClient()
+	assert.NoError(t, err)
+	assert.NotNil(t, hc)
+
+	// no hook
+	assert.NoError(t, c.rotateSystemCert())
+
+	var renewing *x509.Certificate
+	c.OnSystemCertExpiring(func(cert *x509.Certificate) error {
+		renewing = cert
+		renewed, err := cli.CreateSelfSignedRootCert(info, 365)
+		if err != nil {
+			return err
+		}
+		if err = ioutil.WriteFile(cfg.Key, renewed.Key, 0600); err != nil {
+			return err
+		}
+		later := time.Now().Add(time.Second)
+		if err = ioutil.WriteFile(cfg.Cert, renewed.Crt, 0600); err != nil {
+			return err
+		}
+		return os.Chtimes(cfg.Cert, later, later)
+	})
+	assert.NoError(t, c.rotateSystemCert())
+	assert.True(t, cert.Equal(renewing))
+
+	renewed, err := c.SystemCertificate()
+	assert.NoError(t, err)
+	assert.False(t, renewed.Equal(cert))
+	assert.True(t, time.Until(renewed.NotAfter) > 300*24*time.Hour)
+	assert.NoError(t, c.CheckSystemCert())
+
+	// not expiring any more
+	renewing = nil
+	assert.NoError(t, c.rotateSystemCert())
+	assert.Nil(t, renewing)
+	assert.Equal(t, float64(renewed.NotAfter.Unix()), metricCertExpiry.Value())
+
+	assert.NoError(t, c.StartCertMonitor())
+	assert.Equal(t, ErrCertMonitorStarted, errors.Cause(c.StartCertMonitor()))
+	assert.NoError(t, c.Shutdown(0))
+}
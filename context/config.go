@@ -1,6 +1,8 @@
 package context
 
 import (
+	"time"
+
 	"github.com/baetyl/baetyl-go/v2/http"
 	"github.com/baetyl/baetyl-go/v2/log"
 	"github.com/baetyl/baetyl-go/v2/mqtt"
@@ -16,9 +18,62 @@ const (
 
 // SystemConfig config of baetyl system
 type SystemConfig struct {
+	// specifies the namespace of tenant, which scopes config paths, topics and logs of services
+	Namespace   string            `yaml:"namespace,omitempty" json:"namespace,omitempty"`
 	Certificate utils.Certificate `yaml:"cert,omitempty" json:"cert,omitempty" default:"{\"ca\":\"var/lib/baetyl/system/certs/ca.pem\",\"key\":\"var/lib/baetyl/system/certs/key.pem\",\"cert\":\"var/lib/baetyl/system/certs/crt.pem\"}"`
 	Function    http.ClientConfig `yaml:"function,omitempty" json:"function,omitempty"`
 	Core        http.ClientConfig `yaml:"core,omitempty" json:"core,omitempty"`
 	Broker      mqtt.ClientConfig `yaml:"broker,omitempty" json:"broker,omitempty"`
 	Logger      log.Config        `yaml:"logger,omitempty" json:"logger,omitempty"`
+	Health      HealthConfig      `yaml:"health,omitempty" json:"health,omitempty"`
+	// specifies the rotation of system certificate
+	CertRotation CertRotationConfig `yaml:"certRotation,omitempty" json:"certRotation,omitempty"`
+	// specifies the discovery of services
+	Discovery DiscoveryConfig `yaml:"discovery,omitempty" json:"discovery,omitempty"`
+	// specifies the providers of secrets, which resolve the secret references in config
+	Secret SecretConfig `yaml:"secret,omitempty" json:"secret,omitempty"`
+	// specifies the deadline to call stop hooks and close closers during shutdown
+	ShutdownTimeout time.Duration `yaml:"shutdownTimeout,omitempty" json:"shutdownTimeout,omitempty" default:"30s"`
+}
+
+// HealthConfig config of health server
+type HealthConfig struct {
+	// specifies whether to start the health server in Run
+	Enable bool `yaml:"enable" json:"enable"`
+	// specifies the address of the health server, which serves /healthz and /readyz
+	Address string `yaml:"address" json:"address" default:":8081"`
+	// specifies the timeout of each health check
+	Timeout time.Duration `yaml:"timeout" json:"timeout" default:"5s"`
+}
+
+// CertRotationConfig config of system certificate rotation
+type CertRotationConfig struct {
+	// specifies whether to start the cert monitor in Run
+	Enable bool `yaml:"enable" json:"enable"`
+	// specifies the interval to check the expiry of system certificate
+	Interval time.Duration `yaml:"interval" json:"interval" default:"1h"`
+	// specifies the remaining validity under which the renewal hooks are called
+	RenewBefore time.Duration `yaml:"renewBefore" json:"renewBefore" default:"720h"`
+}
+
+// DiscoveryConfig config of service discovery
+type DiscoveryConfig struct {
+	// specifies the static endpoints of services, which take precedence over environment variables and run mode
+	Static map[string][]Endpoint `yaml:"static" json:"static"`
+	// specifies whether to resolve services from the environment variables injected by kubernetes,
+	// which are the cluster IPs of services, so the certificates of services must cover them
+	Env bool `yaml:"env" json:"env"`
+	// specifies the time to cache resolved endpoints, which is the interval to refresh watched services as well
+	CacheTTL time.Duration `yaml:"cacheTTL" json:"cacheTTL" default:"30s"`
+}
+
+// SecretConfig config of secret providers, secrets are looked up in environment variables,
+// the directory of mounted secrets and the encrypted file in order
+type SecretConfig struct {
+	// specifies the directory of mounted secrets, in which the value of each key is kept in <dir>/<name>/<key>
+	Dir string `yaml:"dir" json:"dir" default:"var/lib/baetyl/secrets"`
+	// specifies the encrypted file of secrets, which is disabled if empty
+	File string `yaml:"file" json:"file"`
+	// specifies the file of encryption key, the key is read from environment variable BAETYL_SECRET_KEY if empty
+	KeyFile string `yaml:"keyFile" json:"keyFile"`
 }
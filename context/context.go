@@ -4,12 +4,15 @@ import (
 	"io/ioutil"
 	"os"
 	"os/signal"
+	"path/filepath"
 	"sync"
 	"syscall"
+	"time"
 
 	"github.com/baetyl/baetyl-go/v2/errors"
 	"github.com/baetyl/baetyl-go/v2/http"
 	"github.com/baetyl/baetyl-go/v2/log"
+	"github.com/baetyl/baetyl-go/v2/metrics"
 	"github.com/baetyl/baetyl-go/v2/mqtt"
 	"github.com/baetyl/baetyl-go/v2/pki"
 	"github.com/baetyl/baetyl-go/v2/utils"
@@ -20,7 +23,10 @@ var (
 	ErrSystemCertNotFound = errors.New("system certificate is not found")
 )
 
-// Context of service
+// Context of service.
+// The context created by NewContext implements the optional interfaces as well, which are asserted from it,
+// such as ctx.(Lifecycle), see Lifecycle, HealthReporter, MetricsProvider, CertRotator, Discoverer,
+// SecretResolver, CustomConfigWatcher and Tenant.
 type Context interface {
 	// NodeName returns node name from data.
 	NodeName() string
@@ -61,6 +67,7 @@ type Context interface {
 	// LoadCustomConfig loads custom config.
 	// If 'files' is empty, will load config from default path,
 	// else the first file path will be used to load config from.
+	// If the namespace is set, the file scoped by namespace is preferred if it exists.
 	LoadCustomConfig(cfg interface{}, files ...string) error
 	// NewFunctionHttpClient creates a new function http client.
 	NewFunctionHttpClient() (*http.Client, error)
@@ -74,19 +81,54 @@ type Context interface {
 	NewBrokerClient(mqtt.ClientConfig) (*mqtt.Client, error)
 	// NewSystemBrokerClient creates a new system broker client.
 	NewSystemBrokerClient([]mqtt.QOSTopic) (*mqtt.Client, error)
+	// GetGatewayHost returns the host of gateway resolved by discovery.
 	GetGatewayHost() string
 
 	Done()
 }
 
+// Tenant the context scoped by the namespace of tenant, so that multiple tenants run side by side on one node
+type Tenant interface {
+	// Namespace returns the namespace of tenant from data, which is empty if not multi-tenant.
+	Namespace() string
+	// NamespacePath returns the path scoped by namespace, such as etc/baetyl/<namespace>/service.yml for etc/baetyl/service.yml.
+	// The path is returned as it is if the namespace is empty.
+	NamespacePath(p string) string
+	// TopicVars returns the variables to process topics, such as Namespace and NodeName.
+	TopicVars() map[string]interface{}
+	// ProcessTopic processes the topic template with topic variables, such as "$baetyl/{{.Namespace}}/{{.NodeName}}/report".
+	ProcessTopic(topic string) (string, error)
+}
+
+var (
+	_ Context             = &ctx{}
+	_ Lifecycle           = &ctx{}
+	_ HealthReporter      = &ctx{}
+	_ MetricsProvider     = &ctx{}
+	_ CertRotator         = &ctx{}
+	_ Discoverer          = &ctx{}
+	_ SecretResolver      = &ctx{}
+	_ CustomConfigWatcher = &ctx{}
+	_ Tenant              = &ctx{}
+)
+
 type ctx struct {
 	sync.Map // global cache
-	log      *log.Logger
-	sig      chan os.Signal
+	lifecycle
+	health
+	certRotation
+	discovery *Discovery
+	secrets   SecretProvider
+	log       *log.Logger
+	sig       chan os.Signal
 }
 
 // NewContext creates a new context
 func NewContext(confFile string) Context {
+	return newContext(confFile)
+}
+
+func newContext(confFile string) *ctx {
 	if confFile == "" {
 		confFile = os.Getenv(KeyConfFile)
 	}
@@ -111,17 +153,33 @@ func NewContext(confFile string) Context {
 	c.log = log.With(lfs...)
 	c.log.Info("to load config file", log.Any("file", c.ConfFile()))
 
+	// secrets of system config are resolved after logged
 	sc := &SystemConfig{}
 	err := c.LoadCustomConfig(sc)
 	if err != nil {
 		c.log.Error("failed to load system config, to use default config", log.Error(err))
 		utils.UnmarshalYAML(nil, sc)
 	}
+	c.secrets, err = NewSecretProvider(sc.Secret)
+	if err != nil {
+		c.log.Error("failed to create secret provider, to use environment variables and mounted secrets only", log.Error(err))
+		c.secrets = ChainSecretProvider{EnvSecretProvider{}, DirSecretProvider(sc.Secret.Dir)}
+	}
+
+	if sc.Namespace == "" {
+		sc.Namespace = os.Getenv(KeyNodeNamespace)
+	}
+	c.Store(KeyNodeNamespace, sc.Namespace)
+	if sc.Namespace != "" {
+		lfs = append(lfs, log.Any("namespace", sc.Namespace))
+	}
+
 	// populate configuration
-	// if not set in config file, to use value from env.
-	// if not set in env, to use default value.
+	// if not set in config file, to use the endpoint overridden in discovery config.
+	// if not overridden, to use default value, which is covered by system certificate.
+	overrides := overrideResolver(sc.Discovery)
 	if sc.Function.Address == "" {
-		sc.Function.Address = getFunctionAddress()
+		sc.Function.Address = resolveAddress(overrides, "https", ServiceFunction, getFunctionAddress())
 	}
 	if sc.Function.CA == "" {
 		sc.Function.CA = sc.Certificate.CA
@@ -134,7 +192,7 @@ func NewContext(confFile string) Context {
 	}
 
 	if sc.Core.Address == "" {
-		sc.Core.Address = getCoreAddress()
+		sc.Core.Address = resolveAddress(overrides, "https", ServiceCore, getCoreAddress())
 	}
 	if sc.Core.CA == "" {
 		sc.Core.CA = sc.Certificate.CA
@@ -147,7 +205,7 @@ func NewContext(confFile string) Context {
 	}
 
 	if sc.Broker.Address == "" {
-		sc.Broker.Address = getBrokerAddress()
+		sc.Broker.Address = resolveAddress(overrides, "ssl", ServiceBroker, getBrokerAddress())
 	}
 	// auto subscribe link topic for service if service name not nil.
 	if sc.Broker.Subscriptions == nil {
@@ -156,6 +214,10 @@ func NewContext(confFile string) Context {
 	if c.ServiceName() != "" {
 		if sc.Broker.ClientID == "" {
 			sc.Broker.ClientID = "baetyl-link-" + c.AppName()
+			// apps of different tenants may have the same name on one node
+			if sc.Namespace != "" {
+				sc.Broker.ClientID = "baetyl-link-" + sc.Namespace + "-" + c.AppName()
+			}
 		}
 		sc.Broker.Subscriptions = append(sc.Broker.Subscriptions, mqtt.QOSTopic{QOS: 1, Topic: "$link/" + c.ServiceName()})
 	}
@@ -175,7 +237,12 @@ func NewContext(confFile string) Context {
 		c.log.Error("failed to init logger", log.Error(err))
 	}
 	c.log = _log
+	c.discovery = NewDiscovery(NewResolver(sc.Discovery), sc.Discovery.CacheTTL, c.log)
+	c.RegisterCloser("discovery", c.discovery)
 	c.log.Debug("context is created", log.Any("file", confFile), log.Any("conf", sc))
+	if err = c.ResolveSecrets(sc); err != nil {
+		c.log.Error("failed to resolve secrets of system config", log.Error(err))
+	}
 
 	sig := make(chan os.Signal, 1)
 	signal.Notify(sig, syscall.SIGTERM, syscall.SIGINT)
@@ -192,6 +259,14 @@ func (c *ctx) NodeName() string {
 	return v.(string)
 }
 
+func (c *ctx) Namespace() string {
+	v, ok := c.Load(KeyNodeNamespace)
+	if !ok {
+		return ""
+	}
+	return v.(string)
+}
+
 func (c *ctx) AppName() string {
 	v, ok := c.Load(KeyAppName)
 	if !ok {
@@ -237,7 +312,9 @@ func (c *ctx) Log() *log.Logger {
 }
 
 func (c *ctx) Wait() {
+	c.MarkReady()
 	<-c.sig
+	c.setState(StateStopping)
 }
 
 func (c *ctx) WaitChan() <-chan os.Signal {
@@ -267,17 +344,62 @@ func (c *ctx) CheckSystemCert() error {
 	return nil
 }
 
-func (c *ctx) LoadCustomConfig(cfg interface{}, files ...string) error {
+func (c *ctx) NamespacePath(p string) string {
+	ns := c.Namespace()
+	if ns == "" {
+		return p
+	}
+	return filepath.Join(filepath.Dir(p), ns, filepath.Base(p))
+}
+
+func (c *ctx) TopicVars() map[string]interface{} {
+	return map[string]interface{}{
+		"Namespace":   c.Namespace(),
+		"NodeName":    c.NodeName(),
+		"AppName":     c.AppName(),
+		"ServiceName": c.ServiceName(),
+	}
+}
+
+func (c *ctx) ProcessTopic(topic string) (string, error) {
+	res, err := mqtt.ProcessTopic(topic, c.TopicVars())
+	return res, errors.Trace(err)
+}
+
+// configFile returns the config file to load, the file scoped by namespace is preferred if it exists
+func (c *ctx) configFile(files []string) string {
 	f := c.ConfFile()
 	if len(files) > 0 && len(files[0]) > 0 {
 		f = files[0]
 	}
+	if p := c.NamespacePath(f); p != f && utils.FileExists(p) {
+		return p
+	}
+	return f
+}
+
+func (c *ctx) LoadCustomConfig(cfg interface{}, files ...string) error {
+	f := c.configFile(files)
 	if utils.FileExists(f) {
 		return errors.Trace(utils.LoadYAML(f, cfg))
 	}
 	return errors.Trace(utils.UnmarshalYAML(nil, cfg))
 }
 
+func (c *ctx) WatchCustomConfig(cfg interface{}, files ...string) (*ConfigWatcher, error) {
+	f := c.configFile(files)
+	w, err := NewConfigWatcher(cfg, f, c.log)
+	return w, errors.Trace(err)
+}
+
+func (c *ctx) Secrets() SecretProvider {
+	return c.secrets
+}
+
+func (c *ctx) ResolveSecrets(cfg interface{}) error {
+	return errors.Trace(ResolveSecrets(cfg, c.secrets))
+}
+
 func (c *ctx) NewFunctionHttpClient() (*http.Client, error) {
 	err := c.CheckSystemCert()
 	if err != nil {
@@ -287,6 +409,10 @@ func (c *ctx) NewFunctionHttpClient() (*http.Client, error) {
 	if err != nil {
 		return nil, errors.Trace(err)
 	}
+	err = c.reloadClientCert(ops.TLSConfig, c.SystemConfig().Function.Certificate)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
 	return http.NewClient(ops), nil
 }
 
@@ -308,6 +434,10 @@ func (c *ctx) NewBrokerClient(config mqtt.ClientConfig) (*mqtt.Client, error) {
 	if err != nil {
 		return nil, errors.Trace(err)
 	}
+	err = c.reloadClientCert(ops.TLSConfig, config.Certificate)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
 	return mqtt.NewClient(ops), nil
 }
 
@@ -335,17 +465,44 @@ func (c *ctx) NewCoreHttpsClient() (*http.Client, error) {
 	if err != nil {
 		return nil, errors.Trace(err)
 	}
+	err = c.reloadClientCert(ops.TLSConfig, c.SystemConfig().Core.Certificate)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
 	return http.NewClient(ops), nil
 }
 
 func (c *ctx) NewCoreHttpClient() (*http.Client, error) {
 	ops := http.NewClientOptions()
-	ops.Address = getCoreInscureAdddress()
+	ops.Address = c.discovery.Address("http", ServiceCore, getCoreInscureAdddress())
 	return http.NewClient(ops), nil
 }
 
 func (c *ctx) GetGatewayHost() string {
-	return GatewayHost()
+	eps, err := c.discovery.Resolve(ServiceGateway)
+	if err != nil || len(eps) == 0 {
+		return GatewayHost()
+	}
+	return eps[0].Host
+}
+
+func (c *ctx) Discovery() *Discovery {
+	return c.discovery
+}
+
+func (c *ctx) MarkReady() {
+	c.markReady(c.log)
+}
+
+func (c *ctx) Shutdown(timeout time.Duration) error {
+	if timeout == 0 {
+		timeout = c.SystemConfig().ShutdownTimeout
+	}
+	return c.shutdown(timeout, c.log)
+}
+
+func (c *ctx) Metrics() *metrics.Registry {
+	return metrics.DefaultRegistry
 }
 
 func (c *ctx) Done() {
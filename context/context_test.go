@@ -5,7 +5,9 @@ import (
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 
@@ -90,6 +92,11 @@ func TestContext(t *testing.T) {
 			EncodeTime:  "",
 			EncodeLevel: "",
 		},
+		Health:          HealthConfig{Address: ":8081", Timeout: 5 * time.Second},
+		CertRotation:    CertRotationConfig{Interval: time.Hour, RenewBefore: 720 * time.Hour},
+		Discovery:       DiscoveryConfig{CacheTTL: 30 * time.Second},
+		Secret:          SecretConfig{Dir: "var/lib/baetyl/secrets"},
+		ShutdownTimeout: 30 * time.Second,
 	}
 
 	ctx := NewContext("")
@@ -115,12 +122,21 @@ func TestContext(t *testing.T) {
 	expected.Broker.Subscriptions = append(expected.Broker.Subscriptions, mqtt.QOSTopic{QOS: 1, Topic: "$link/service"})
 	assert.Equal(t, expected, ctx.SystemConfig())
 
-	ctx = NewContext("../example/etc/baetyl/service.yml")
+	// the log file of example config is written into the temp dir
+	dir := t.TempDir()
+	data, err := ioutil.ReadFile("../example/etc/baetyl/service.yml")
+	assert.NoError(t, err)
+	logFile := filepath.Join(dir, "service.log")
+	data = []byte(strings.Replace(string(data), "var/log/service.log", logFile, 1))
+	conf := filepath.Join(dir, "service.yml")
+	assert.NoError(t, ioutil.WriteFile(conf, data, 0644))
+
+	ctx = NewContext(conf)
 	assert.Equal(t, "node", ctx.NodeName())
 	assert.Equal(t, "app", ctx.AppName())
 	assert.Equal(t, "v1", ctx.AppVersion())
 	assert.Equal(t, "service", ctx.ServiceName())
-	assert.Equal(t, "../example/etc/baetyl/service.yml", ctx.ConfFile())
+	assert.Equal(t, conf, ctx.ConfFile())
 	expected.Certificate.CA = "example/var/lib/baetyl/testcert/ca.pem"
 	expected.Certificate.Key = "example/var/lib/baetyl/testcert/client.key"
 	expected.Certificate.Cert = "example/var/lib/baetyl/testcert/client.pem"
@@ -135,7 +151,7 @@ func TestContext(t *testing.T) {
 	expected.Broker.CA = expected.Certificate.CA
 	expected.Broker.Key = expected.Certificate.Key
 	expected.Broker.Cert = expected.Certificate.Cert
-	expected.Logger.Filename = "var/log/service.log"
+	expected.Logger.Filename = logFile
 	expected.Logger.Level = "debug"
 	expected.Logger.Encoding = "console"
 	assert.Equal(t, expected, ctx.SystemConfig())
@@ -0,0 +1,220 @@
+package contexttest
+
+import (
+	"sync"
+
+	"github.com/baetyl/baetyl-go/v2/errors"
+	"github.com/baetyl/baetyl-go/v2/mqtt"
+)
+
+// Message the message published to the fake broker
+type Message struct {
+	ClientID string
+	Topic    string
+	QOS      mqtt.QOS
+	Payload  []byte
+	Retain   bool
+}
+
+// Broker a fake mqtt broker in memory, which records published messages
+// and forwards them to subscribed clients as a real broker does
+type Broker struct {
+	server   mqtt.Server
+	messages []Message
+	notify   chan struct{}
+	subs     *mqtt.Trie
+	conns    map[*brokerConn]struct{}
+	wg       sync.WaitGroup
+	mut      sync.Mutex
+}
+
+type brokerConn struct {
+	id   string
+	conn mqtt.Connection
+	mut  sync.Mutex
+}
+
+func (c *brokerConn) send(pkt mqtt.Packet) error {
+	c.mut.Lock()
+	defer c.mut.Unlock()
+	return c.conn.Send(pkt, false)
+}
+
+// NewBroker creates a new fake broker listening on a random local port
+func NewBroker() (*Broker, error) {
+	server, err := mqtt.NewLauncher(nil).Launch("tcp://127.0.0.1:0")
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	b := &Broker{
+		server: server,
+		notify: make(chan struct{}),
+		subs:   mqtt.NewTrie(),
+		conns:  map[*brokerConn]struct{}{},
+	}
+	b.wg.Add(1)
+	go b.accepting()
+	return b, nil
+}
+
+// Address returns the address of broker, such as tcp://127.0.0.1:1883
+func (b *Broker) Address() string {
+	return "tcp://" + b.server.Addr().String()
+}
+
+// Messages returns the messages published by clients in order
+func (b *Broker) Messages() []Message {
+	b.mut.Lock()
+	defer b.mut.Unlock()
+	res := make([]Message, len(b.messages))
+	copy(res, b.messages)
+	return res
+}
+
+// Published returns the messages published to the topic in order
+func (b *Broker) Published(topic string) []Message {
+	var res []Message
+	for _, msg := range b.Messages() {
+		if msg.Topic == topic {
+			res = append(res, msg)
+		}
+	}
+	return res
+}
+
+// Publish sends a message to the clients which subscribe the topic, such as a delta of device
+func (b *Broker) Publish(topic string, qos mqtt.QOS, payload []byte) error {
+	b.mut.Lock()
+	var conns []*brokerConn
+	for _, v := range b.subs.Match(topic) {
+		conns = append(conns, v.(*brokerConn))
+	}
+	b.mut.Unlock()
+	for _, c := range conns {
+		pkt := mqtt.NewPublish()
+		pkt.Message.Topic = topic
+		pkt.Message.QOS = qos
+		pkt.Message.Payload = payload
+		if qos > 0 {
+			pkt.ID = 1
+		}
+		if err := c.send(pkt); err != nil {
+			return errors.Trace(err)
+		}
+	}
+	return nil
+}
+
+// Reset clears the recorded messages
+func (b *Broker) Reset() {
+	b.mut.Lock()
+	defer b.mut.Unlock()
+	b.messages = nil
+}
+
+// Close closes the broker and all connections
+func (b *Broker) Close() error {
+	err := b.server.Close()
+	b.mut.Lock()
+	for c := range b.conns {
+		c.conn.Close()
+	}
+	b.mut.Unlock()
+	b.wg.Wait()
+	return errors.Trace(err)
+}
+
+// changed returns a channel which is closed once a message is published
+func (b *Broker) changed() <-chan struct{} {
+	b.mut.Lock()
+	defer b.mut.Unlock()
+	return b.notify
+}
+
+func (b *Broker) accepting() {
+	defer b.wg.Done()
+	for {
+		conn, err := b.server.Accept()
+		if err != nil {
+			return
+		}
+		c := &brokerConn{conn: conn}
+		b.mut.Lock()
+		b.conns[c] = struct{}{}
+		b.mut.Unlock()
+		b.wg.Add(1)
+		go b.serving(c)
+	}
+}
+
+func (b *Broker) serving(c *brokerConn) {
+	defer b.wg.Done()
+	defer func() {
+		b.mut.Lock()
+		b.subs.Clear(c)
+		delete(b.conns, c)
+		b.mut.Unlock()
+		c.conn.Close()
+	}()
+	for {
+		pkt, err := c.conn.Receive()
+		if err != nil {
+			return
+		}
+		switch p := pkt.(type) {
+		case *mqtt.Connect:
+			c.id = p.ClientID
+			err = c.send(mqtt.NewConnack())
+		case *mqtt.Subscribe:
+			ack := mqtt.NewSuback()
+			ack.ID = p.ID
+			b.mut.Lock()
+			for _, s := range p.Subscriptions {
+				b.subs.Add(s.Topic, c)
+				ack.ReturnCodes = append(ack.ReturnCodes, s.QOS)
+			}
+			b.mut.Unlock()
+			err = c.send(ack)
+		case *mqtt.Unsubscribe:
+			b.mut.Lock()
+			for _, topic := range p.Topics {
+				b.subs.Remove(topic, c)
+			}
+			b.mut.Unlock()
+			ack := mqtt.NewUnsuback()
+			ack.ID = p.ID
+			err = c.send(ack)
+		case *mqtt.Publish:
+			b.record(Message{
+				ClientID: c.id,
+				Topic:    p.Message.Topic,
+				QOS:      p.Message.QOS,
+				Payload:  p.Message.Payload,
+				Retain:   p.Message.Retain,
+			})
+			if p.Message.QOS > 0 {
+				ack := mqtt.NewPuback()
+				ack.ID = p.ID
+				err = c.send(ack)
+			}
+			if err == nil {
+				err = b.Publish(p.Message.Topic, p.Message.QOS, p.Message.Payload)
+			}
+		case *mqtt.Pingreq:
+			err = c.send(mqtt.NewPingresp())
+		case *mqtt.Disconnect:
+			return
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+func (b *Broker) record(msg Message) {
+	b.mut.Lock()
+	defer b.mut.Unlock()
+	b.messages = append(b.messages, msg)
+	close(b.notify)
+	b.notify = make(chan struct{})
+}
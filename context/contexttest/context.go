@@ -0,0 +1,260 @@
+// Package contexttest provides a context for unit-testing services without env vars, config files and system certs.
+package contexttest
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/baetyl/baetyl-go/v2/context"
+	"github.com/baetyl/baetyl-go/v2/errors"
+	"github.com/baetyl/baetyl-go/v2/http"
+	"github.com/baetyl/baetyl-go/v2/mqtt"
+	"github.com/baetyl/baetyl-go/v2/utils"
+)
+
+// DefaultTimeout the default timeout to wait for published messages
+var DefaultTimeout = 3 * time.Second
+
+var (
+	_ context.Context             = &Context{}
+	_ context.Lifecycle           = &Context{}
+	_ context.CustomConfigWatcher = &Context{}
+)
+
+// full the context created by context.NewContext, which implements the optional interfaces as well
+type full interface {
+	context.Context
+	context.Lifecycle
+	context.HealthReporter
+	context.MetricsProvider
+	context.CertRotator
+	context.Discoverer
+	context.SecretResolver
+	context.CustomConfigWatcher
+	context.Tenant
+}
+
+// Context a context for unit tests, which implements context.Context and its optional interfaces.
+// The system config points to the fake broker and fake servers of core and function,
+// the custom config is kept in a temporary directory, and the system certificate is not required.
+type Context struct {
+	full
+	Broker   *Broker
+	Core     *Server
+	Function *Server
+	dir      string
+	files    map[string]string
+	certErr  error
+	mut      sync.Mutex
+}
+
+// NewContext creates a new context for test, which is shut down when the test finishes
+func NewContext(t testing.TB) *Context {
+	dir := t.TempDir()
+	broker, err := NewBroker()
+	if err != nil {
+		t.Fatalf("failed to start fake broker: %s", err.Error())
+	}
+	c := &Context{
+		full:     context.NewContext(filepath.Join(dir, "service.yml")).(full),
+		Broker:   broker,
+		Core:     NewServer(),
+		Function: NewServer(),
+		dir:      dir,
+		files:    map[string]string{},
+	}
+
+	sc := c.full.SystemConfig()
+	sc.Certificate = utils.Certificate{}
+	sc.Broker.Address = broker.Address()
+	sc.Broker.Certificate = utils.Certificate{}
+	sc.Broker.ClientID = "contexttest"
+	sc.Core.Address = c.Core.URL
+	sc.Core.Certificate = utils.Certificate{}
+	sc.Function.Address = c.Function.URL
+	sc.Function.Certificate = utils.Certificate{}
+	sc.ShutdownTimeout = 5 * time.Second
+
+	t.Cleanup(func() {
+		c.Shutdown(0)
+		c.Core.Close()
+		c.Function.Close()
+		c.Broker.Close()
+	})
+	return c
+}
+
+// SetNodeName sets the node name
+func (c *Context) SetNodeName(name string) {
+	c.Store(context.KeyNodeName, name)
+}
+
+// SetNamespace sets the namespace of tenant
+func (c *Context) SetNamespace(ns string) {
+	c.Store(context.KeyNodeNamespace, ns)
+}
+
+// SetAppName sets the app name
+func (c *Context) SetAppName(name string) {
+	c.Store(context.KeyAppName, name)
+}
+
+// SetAppVersion sets the app version
+func (c *Context) SetAppVersion(version string) {
+	c.Store(context.KeyAppVersion, version)
+}
+
+// SetServiceName sets the service name
+func (c *Context) SetServiceName(name string) {
+	c.Store(context.KeySvcName, name)
+}
+
+// SetConfig sets the content of the default config file, which is loaded by LoadCustomConfig without files
+func (c *Context) SetConfig(data []byte) error {
+	return errors.Trace(ioutil.WriteFile(c.ConfFile(), data, 0644))
+}
+
+// SetConfigFile sets the content of a config file, which is loaded by LoadCustomConfig with the file
+func (c *Context) SetConfigFile(file string, data []byte) error {
+	c.mut.Lock()
+	p, ok := c.files[file]
+	if !ok {
+		p = filepath.Join(c.dir, fmt.Sprintf("config-%d.yml", len(c.files)))
+		c.files[file] = p
+	}
+	c.mut.Unlock()
+	return errors.Trace(ioutil.WriteFile(p, data, 0644))
+}
+
+// SetSystemCertError sets the error returned by CheckSystemCert, such as context.ErrSystemCertNotFound
+func (c *Context) SetSystemCertError(err error) {
+	c.mut.Lock()
+	defer c.mut.Unlock()
+	c.certErr = err
+}
+
+func (c *Context) CheckSystemCert() error {
+	c.mut.Lock()
+	defer c.mut.Unlock()
+	return c.certErr
+}
+
+func (c *Context) LoadCustomConfig(cfg interface{}, files ...string) error {
+	return errors.Trace(c.full.LoadCustomConfig(cfg, c.mapFiles(files)...))
+}
+
+func (c *Context) WatchCustomConfig(cfg interface{}, files ...string) (*context.ConfigWatcher, error) {
+	w, err := c.full.WatchCustomConfig(cfg, c.mapFiles(files)...)
+	return w, errors.Trace(err)
+}
+
+func (c *Context) NewFunctionHttpClient() (*http.Client, error) {
+	if err := c.CheckSystemCert(); err != nil {
+		return nil, errors.Trace(err)
+	}
+	ops, err := c.SystemConfig().Function.ToClientOptions()
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	return http.NewClient(ops), nil
+}
+
+func (c *Context) NewCoreHttpClient() (*http.Client, error) {
+	ops, err := c.SystemConfig().Core.ToClientOptions()
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	return http.NewClient(ops), nil
+}
+
+func (c *Context) NewCoreHttpsClient() (*http.Client, error) {
+	if err := c.CheckSystemCert(); err != nil {
+		return nil, errors.Trace(err)
+	}
+	return c.NewCoreHttpClient()
+}
+
+func (c *Context) NewSystemBrokerClientConfig() (mqtt.ClientConfig, error) {
+	if err := c.CheckSystemCert(); err != nil {
+		return mqtt.ClientConfig{}, errors.Trace(err)
+	}
+	config := c.SystemConfig().Broker
+	config.CleanSession = true
+	config.Subscriptions = append([]mqtt.QOSTopic{}, c.SystemConfig().Broker.Subscriptions...)
+	return config, nil
+}
+
+func (c *Context) NewSystemBrokerClient(subTopics []mqtt.QOSTopic) (*mqtt.Client, error) {
+	config, err := c.NewSystemBrokerClientConfig()
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	config.Subscriptions = append(config.Subscriptions, subTopics...)
+	cli, err := c.NewBrokerClient(config)
+	return cli, errors.Trace(err)
+}
+
+// WaitPublished waits for the nth message (starts from 1) published to the topic in the timeout
+func (c *Context) WaitPublished(topic string, n int, timeout time.Duration) (*Message, error) {
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	for {
+		changed := c.Broker.changed()
+		if msgs := c.Broker.Published(topic); len(msgs) >= n {
+			return &msgs[n-1], nil
+		}
+		select {
+		case <-changed:
+		case <-timer.C:
+			return nil, errors.Errorf("%d message(s) are not published to topic (%s) in %s", n, topic, timeout)
+		}
+	}
+}
+
+// AssertPublished asserts that a message with the payload is published to the topic in DefaultTimeout
+func (c *Context) AssertPublished(t assert.TestingT, topic string, payload []byte) bool {
+	timer := time.NewTimer(DefaultTimeout)
+	defer timer.Stop()
+	for {
+		changed := c.Broker.changed()
+		for _, msg := range c.Broker.Published(topic) {
+			if bytes.Equal(msg.Payload, payload) {
+				return true
+			}
+		}
+		select {
+		case <-changed:
+		case <-timer.C:
+			return assert.Fail(t, fmt.Sprintf("message (%s) is not published to topic (%s)", payload, topic),
+				"published: %v", c.Broker.Published(topic))
+		}
+	}
+}
+
+// AssertNotPublished asserts that no message is published to the topic in the duration
+func (c *Context) AssertNotPublished(t assert.TestingT, topic string, d time.Duration) bool {
+	time.Sleep(d)
+	if msgs := c.Broker.Published(topic); len(msgs) != 0 {
+		return assert.Fail(t, fmt.Sprintf("%d message(s) are published to topic (%s)", len(msgs), topic))
+	}
+	return true
+}
+
+func (c *Context) mapFiles(files []string) []string {
+	if len(files) == 0 || files[0] == "" {
+		return files
+	}
+	c.mut.Lock()
+	defer c.mut.Unlock()
+	if p, ok := c.files[files[0]]; ok {
+		return []string{p}
+	}
+	return files
+}
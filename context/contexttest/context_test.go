@@ -0,0 +1,135 @@
+package contexttest
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/baetyl/baetyl-go/v2/context"
+	"github.com/baetyl/baetyl-go/v2/errors"
+	"github.com/baetyl/baetyl-go/v2/mqtt"
+)
+
+type mockObserver struct {
+	pkts chan *mqtt.Publish
+}
+
+func (o *mockObserver) OnPublish(pkt *mqtt.Publish) error {
+	o.pkts <- pkt
+	return nil
+}
+
+func (o *mockObserver) OnPuback(*mqtt.Puback) error {
+	return nil
+}
+
+func (o *mockObserver) OnError(error) {}
+
+func TestContext(t *testing.T) {
+	c := NewContext(t)
+	c.SetNodeName("node")
+	c.SetAppName("app")
+	c.SetAppVersion("v1")
+	c.SetServiceName("svc")
+	assert.Equal(t, "node", c.NodeName())
+	assert.Equal(t, "app", c.AppName())
+	assert.Equal(t, "v1", c.AppVersion())
+	assert.Equal(t, "svc", c.ServiceName())
+	c.SetNamespace("tenant-a")
+	assert.Equal(t, "tenant-a", c.Namespace())
+	topic, err := c.ProcessTopic("$baetyl/{{.Namespace}}/{{.NodeName}}/{{.AppName}}")
+	assert.NoError(t, err)
+	assert.Equal(t, "$baetyl/tenant-a/node/app", topic)
+	c.SetNamespace("")
+
+	type config struct {
+		Name    string        `yaml:"name"`
+		Timeout time.Duration `yaml:"timeout" default:"1s"`
+	}
+	var cfg config
+	assert.NoError(t, c.LoadCustomConfig(&cfg))
+	assert.Equal(t, config{Timeout: time.Second}, cfg)
+	assert.NoError(t, c.SetConfig([]byte("name: a")))
+	assert.NoError(t, c.LoadCustomConfig(&cfg))
+	assert.Equal(t, config{Name: "a", Timeout: time.Second}, cfg)
+	assert.NoError(t, c.SetConfigFile("etc/baetyl/b.yml", []byte("name: b")))
+	assert.NoError(t, c.LoadCustomConfig(&cfg, "etc/baetyl/b.yml"))
+	assert.Equal(t, "b", cfg.Name)
+
+	assert.NoError(t, c.CheckSystemCert())
+	c.SetSystemCertError(context.ErrSystemCertNotFound)
+	_, err = c.NewCoreHttpsClient()
+	assert.Equal(t, context.ErrSystemCertNotFound, errors.Cause(err))
+	c.SetSystemCertError(nil)
+
+	// inherited from the underlying context
+	c.MarkReady()
+	assert.Equal(t, context.StateReady, c.State())
+	assert.True(t, c.Readiness().OK())
+}
+
+func TestBroker(t *testing.T) {
+	c := NewContext(t)
+	cli, err := c.NewSystemBrokerClient([]mqtt.QOSTopic{{QOS: 1, Topic: "delta/#"}})
+	assert.NoError(t, err)
+	defer cli.Close()
+	obs := &mockObserver{pkts: make(chan *mqtt.Publish, 10)}
+	assert.NoError(t, cli.Start(obs))
+
+	assert.NoError(t, cli.Publish(1, "report", []byte("r1"), 0, false, false))
+	assert.NoError(t, cli.Publish(0, "report", []byte("r2"), 0, false, false))
+	c.AssertPublished(t, "report", []byte("r2"))
+	msg, err := c.WaitPublished("report", 1, DefaultTimeout)
+	assert.NoError(t, err)
+	assert.Equal(t, Message{ClientID: "contexttest", Topic: "report", QOS: 1, Payload: []byte("r1")}, *msg)
+	_, err = c.WaitPublished("report", 3, 50*time.Millisecond)
+	assert.Error(t, err)
+	c.AssertNotPublished(t, "event", 50*time.Millisecond)
+
+	// wait until subscribed
+	for i := 0; i < 100 && !cli.Connected(); i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	assert.NoError(t, c.Broker.Publish("delta/dev1", 1, []byte("d1")))
+	select {
+	case pkt := <-obs.pkts:
+		assert.Equal(t, "delta/dev1", pkt.Message.Topic)
+		assert.Equal(t, []byte("d1"), pkt.Message.Payload)
+	case <-time.After(DefaultTimeout):
+		assert.FailNow(t, "message is not delivered")
+	}
+
+	c.Broker.Reset()
+	assert.Len(t, c.Broker.Messages(), 0)
+}
+
+func TestServer(t *testing.T) {
+	c := NewContext(t)
+	c.Core.Handle("GET", "/v1/node", 200, []byte(`{"name":"node"}`))
+	cli, err := c.NewCoreHttpsClient()
+	assert.NoError(t, err)
+	data, err := cli.GetJSON(c.Core.URL + "/v1/node?x=1")
+	assert.NoError(t, err)
+	assert.Equal(t, `{"name":"node"}`, string(data))
+	_, err = cli.PostJSON(c.Core.URL+"/v1/report", []byte("{}"))
+	assert.Error(t, err)
+
+	req := c.Core.AssertRequested(t, "GET", "/v1/node")
+	assert.Equal(t, "x=1", req.Query)
+	req = c.Core.AssertRequested(t, "POST", "/v1/report")
+	assert.Equal(t, []byte("{}"), req.Body)
+	assert.Len(t, c.Core.Requests(), 2)
+
+	fc, err := c.NewFunctionHttpClient()
+	assert.NoError(t, err)
+	_, err = fc.Call("app/func", []byte("{}"))
+	assert.Error(t, err)
+	c.Function.AssertRequested(t, "POST", "/app/func")
+
+	mt := new(testing.T)
+	assert.Nil(t, c.Core.AssertRequested(mt, "PUT", "/v1/node"))
+	assert.True(t, mt.Failed())
+	c.Core.Reset()
+	assert.Len(t, c.Core.Requests(), 0)
+}
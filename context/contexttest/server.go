@@ -0,0 +1,100 @@
+package contexttest
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	gohttp "net/http"
+	"net/http/httptest"
+	"sync"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Request the http request received by the fake server
+type Request struct {
+	Method string
+	Path   string
+	Query  string
+	Header gohttp.Header
+	Body   []byte
+}
+
+// Server a fake http server, such as baetyl-core or baetyl-function, which records requests
+// and responds with the registered handlers. The request not handled is responded with 404.
+type Server struct {
+	*httptest.Server
+	requests []Request
+	handlers map[string]gohttp.HandlerFunc
+	mut      sync.Mutex
+}
+
+// NewServer creates a new fake http server listening on a random local port
+func NewServer() *Server {
+	s := &Server{handlers: map[string]gohttp.HandlerFunc{}}
+	s.Server = httptest.NewServer(gohttp.HandlerFunc(s.serve))
+	return s
+}
+
+// Handle responds the requests of method and path with the status and body
+func (s *Server) Handle(method, path string, status int, body []byte) {
+	s.HandleFunc(method, path, func(w gohttp.ResponseWriter, _ *gohttp.Request) {
+		w.WriteHeader(status)
+		w.Write(body)
+	})
+}
+
+// HandleFunc handles the requests of method and path with fn
+func (s *Server) HandleFunc(method, path string, fn gohttp.HandlerFunc) {
+	s.mut.Lock()
+	defer s.mut.Unlock()
+	s.handlers[method+" "+path] = fn
+}
+
+// Requests returns the received requests in order
+func (s *Server) Requests() []Request {
+	s.mut.Lock()
+	defer s.mut.Unlock()
+	res := make([]Request, len(s.requests))
+	copy(res, s.requests)
+	return res
+}
+
+// Reset clears the recorded requests
+func (s *Server) Reset() {
+	s.mut.Lock()
+	defer s.mut.Unlock()
+	s.requests = nil
+}
+
+// AssertRequested asserts that the server has received a request of method and path, returns the last one
+func (s *Server) AssertRequested(t assert.TestingT, method, path string) *Request {
+	reqs := s.Requests()
+	for i := len(reqs) - 1; i >= 0; i-- {
+		if reqs[i].Method == method && reqs[i].Path == path {
+			return &reqs[i]
+		}
+	}
+	assert.Fail(t, fmt.Sprintf("request (%s %s) is not received", method, path), "received: %v", reqs)
+	return nil
+}
+
+func (s *Server) serve(w gohttp.ResponseWriter, r *gohttp.Request) {
+	body, _ := ioutil.ReadAll(r.Body)
+	r.Body = ioutil.NopCloser(bytes.NewReader(body))
+	s.mut.Lock()
+	s.requests = append(s.requests, Request{
+		Method: r.Method,
+		Path:   r.URL.Path,
+		Query:  r.URL.RawQuery,
+		Header: r.Header.Clone(),
+		Body:   body,
+	})
+	fn, ok := s.handlers[r.Method+" "+r.URL.Path]
+	s.mut.Unlock()
+	if !ok {
+		gohttp.NotFound(w, r)
+		return
+	}
+	fn(w, r)
+}
@@ -0,0 +1,336 @@
+package context
+
+import (
+	"net"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/baetyl/baetyl-go/v2/errors"
+	"github.com/baetyl/baetyl-go/v2/log"
+	"github.com/baetyl/baetyl-go/v2/utils"
+)
+
+// All names of system services
+const (
+	ServiceBroker   = "baetyl-broker"
+	ServiceCore     = "baetyl-core"
+	ServiceFunction = "baetyl-function"
+	ServiceGateway  = "baetyl-gateway"
+)
+
+var (
+	ErrServiceNotFound = errors.New("service is not found")
+)
+
+// Discoverer provides the service discovery, which is implemented by the context created by NewContext
+type Discoverer interface {
+	// Discovery returns the service discovery, which resolves system services and peers by name.
+	// Services are resolved from static config, environment variables if enabled and run mode in order by default.
+	Discovery() *Discovery
+}
+
+// Endpoint the address of a service instance, the port is 0 if unknown
+type Endpoint struct {
+	Host string `yaml:"host" json:"host" binding:"required"`
+	Port int    `yaml:"port" json:"port"`
+}
+
+// String returns host:port, or host if the port is unknown
+func (e Endpoint) String() string {
+	if e.Port == 0 {
+		return e.Host
+	}
+	return net.JoinHostPort(e.Host, strconv.Itoa(e.Port))
+}
+
+// Resolver resolves the endpoints of a service by name,
+// returns ErrServiceNotFound if the service is unknown to the resolver.
+type Resolver interface {
+	Resolve(name string) ([]Endpoint, error)
+}
+
+// StaticResolver resolves services from the static endpoints, such as the endpoints in config
+type StaticResolver map[string][]Endpoint
+
+// Resolve resolves the endpoints of a service
+func (r StaticResolver) Resolve(name string) ([]Endpoint, error) {
+	eps, ok := r[name]
+	if !ok || len(eps) == 0 {
+		return nil, errors.Trace(ErrServiceNotFound)
+	}
+	return eps, nil
+}
+
+// EnvResolver resolves services from environment variables as kubernetes injects,
+// that is <NAME>_SERVICE_HOST and <NAME>_SERVICE_PORT, such as BAETYL_BROKER_SERVICE_HOST for baetyl-broker.
+type EnvResolver struct{}
+
+// Resolve resolves the endpoints of a service
+func (EnvResolver) Resolve(name string) ([]Endpoint, error) {
+	prefix := strings.ToUpper(strings.NewReplacer("-", "_", ".", "_").Replace(name))
+	host := os.Getenv(prefix + "_SERVICE_HOST")
+	if host == "" {
+		return nil, errors.Trace(ErrServiceNotFound)
+	}
+	ep := Endpoint{Host: host}
+	if v := os.Getenv(prefix + "_SERVICE_PORT"); v != "" {
+		port, err := strconv.Atoi(v)
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+		ep.Port = port
+	}
+	return []Endpoint{ep}, nil
+}
+
+// KubeResolver resolves services by the DNS names of kubernetes, which are <name>.<namespace>.
+// The name with a namespace, such as baetyl-broker.baetyl-edge-system, is resolved as it is.
+type KubeResolver struct {
+	// the namespace of services without a namespace
+	Namespace string
+	// the ports of services, the port is 0 if not found
+	Ports map[string]int
+}
+
+// Resolve resolves the endpoints of a service
+func (r *KubeResolver) Resolve(name string) ([]Endpoint, error) {
+	svc, host := name, name
+	if i := strings.Index(name, "."); i > 0 {
+		svc = name[:i]
+	} else if r.Namespace != "" {
+		host = name + "." + r.Namespace
+	}
+	return []Endpoint{{Host: host, Port: r.Ports[svc]}}, nil
+}
+
+// ChainResolver tries resolvers in order until a service is found
+type ChainResolver []Resolver
+
+// Resolve resolves the endpoints of a service
+func (r ChainResolver) Resolve(name string) ([]Endpoint, error) {
+	for _, resolver := range r {
+		eps, err := resolver.Resolve(name)
+		if err == nil {
+			return eps, nil
+		}
+		if errors.Cause(err) != ErrServiceNotFound {
+			return nil, errors.Trace(err)
+		}
+	}
+	return nil, errors.Trace(ErrServiceNotFound)
+}
+
+// NewResolver creates the resolver of discovery config, services are resolved from the static endpoints,
+// the environment variables if enabled and run mode in order
+func NewResolver(cfg DiscoveryConfig) Resolver {
+	return append(overrideResolver(cfg), NewSystemResolver())
+}
+
+// overrideResolver returns the resolvers configured to override the default addresses of system services
+func overrideResolver(cfg DiscoveryConfig) ChainResolver {
+	r := ChainResolver{StaticResolver(cfg.Static)}
+	if cfg.Env {
+		r = append(r, EnvResolver{})
+	}
+	return r
+}
+
+func resolveAddress(r Resolver, scheme, name, fallback string) string {
+	eps, err := r.Resolve(name)
+	if err != nil || len(eps) == 0 {
+		return fallback
+	}
+	if scheme == "" {
+		return eps[0].String()
+	}
+	return scheme + "://" + eps[0].String()
+}
+
+// NewSystemResolver creates the resolver of system services in run mode,
+// system services are resolved by kubernetes DNS in kube mode, and on localhost in native mode.
+func NewSystemResolver() Resolver {
+	ports := map[string]int{}
+	for name, port := range map[string]string{
+		ServiceBroker:   BrokerPort(),
+		ServiceFunction: FunctionHttpPort(),
+		ServiceCore:     CoreHttpPort(),
+	} {
+		ports[name], _ = strconv.Atoi(port)
+	}
+	if RunMode() == RunModeNative {
+		static := StaticResolver{ServiceGateway: {{Host: localHost}}}
+		for name, port := range ports {
+			static[name] = []Endpoint{{Host: localHost, Port: port}}
+		}
+		return static
+	}
+	return &KubeResolver{Namespace: EdgeSystemNamespace(), Ports: ports}
+}
+
+// Discovery resolves services with caching, and notifies watchers of endpoint changes
+type Discovery struct {
+	resolver Resolver
+	ttl      time.Duration
+	cache    map[string]*discoveryEntry
+	watchers map[string]map[int]func([]Endpoint)
+	seq      int
+	log      *log.Logger
+	tomb     *utils.Tomb
+	mut      sync.Mutex
+}
+
+type discoveryEntry struct {
+	endpoints []Endpoint
+	expiry    time.Time
+}
+
+// NewDiscovery creates a new discovery, the resolved endpoints are cached in ttl,
+// and watched services are refreshed in the interval of ttl.
+func NewDiscovery(resolver Resolver, ttl time.Duration, logger *log.Logger) *Discovery {
+	if logger == nil {
+		logger = log.L()
+	}
+	return &Discovery{
+		resolver: resolver,
+		ttl:      ttl,
+		cache:    map[string]*discoveryEntry{},
+		watchers: map[string]map[int]func([]Endpoint){},
+		log:      logger.With(log.Any("discovery", "service")),
+	}
+}
+
+// Resolver returns the resolver, which can be chained with another resolver
+func (d *Discovery) Resolver() Resolver {
+	d.mut.Lock()
+	defer d.mut.Unlock()
+	return d.resolver
+}
+
+// SetResolver replaces the resolver and expires the cache, such as to use the native services mapping.
+// Watched services are resolved again at once.
+func (d *Discovery) SetResolver(resolver Resolver) {
+	d.mut.Lock()
+	d.resolver = resolver
+	for _, e := range d.cache {
+		e.expiry = time.Time{}
+	}
+	d.mut.Unlock()
+	d.Refresh()
+}
+
+// Resolve resolves the endpoints of a service, the cached endpoints are returned if not expired
+func (d *Discovery) Resolve(name string) ([]Endpoint, error) {
+	d.mut.Lock()
+	if e, ok := d.cache[name]; ok && time.Now().Before(e.expiry) {
+		d.mut.Unlock()
+		return e.endpoints, nil
+	}
+	d.mut.Unlock()
+	eps, err := d.resolve(name)
+	return eps, errors.Trace(err)
+}
+
+// Address returns the address of the first endpoint of a service with the scheme, such as ssl://host:port.
+// The fallback is returned if failed to resolve the service.
+func (d *Discovery) Address(scheme, name, fallback string) string {
+	return resolveAddress(d, scheme, name, fallback)
+}
+
+// Watch calls fn once the endpoints of a service are changed, or are resolved for the first time,
+// returns a function to stop watching. Watched services are refreshed periodically until the discovery is closed.
+func (d *Discovery) Watch(name string, fn func([]Endpoint)) func() {
+	d.mut.Lock()
+	defer d.mut.Unlock()
+	d.seq++
+	id := d.seq
+	if d.watchers[name] == nil {
+		d.watchers[name] = map[int]func([]Endpoint){}
+	}
+	d.watchers[name][id] = fn
+	if d.tomb == nil && d.ttl > 0 {
+		d.tomb = new(utils.Tomb)
+		d.tomb.Go(d.refreshing)
+	}
+	return func() {
+		d.mut.Lock()
+		defer d.mut.Unlock()
+		delete(d.watchers[name], id)
+		if len(d.watchers[name]) == 0 {
+			delete(d.watchers, name)
+		}
+	}
+}
+
+// Refresh resolves watched services at once, and notifies watchers of changes
+func (d *Discovery) Refresh() {
+	d.mut.Lock()
+	names := make([]string, 0, len(d.watchers))
+	for name := range d.watchers {
+		names = append(names, name)
+	}
+	d.mut.Unlock()
+	for _, name := range names {
+		if _, err := d.resolve(name); err != nil {
+			d.log.Debug("failed to refresh service", log.Any("name", name), log.Error(err))
+		}
+	}
+}
+
+// Close stops refreshing watched services
+func (d *Discovery) Close() error {
+	d.mut.Lock()
+	t := d.tomb
+	d.mut.Unlock()
+	if t == nil {
+		return nil
+	}
+	t.Kill(nil)
+	return errors.Trace(t.Wait())
+}
+
+func (d *Discovery) resolve(name string) ([]Endpoint, error) {
+	d.mut.Lock()
+	resolver := d.resolver
+	d.mut.Unlock()
+	eps, err := resolver.Resolve(name)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+
+	d.mut.Lock()
+	old, ok := d.cache[name]
+	d.cache[name] = &discoveryEntry{endpoints: eps, expiry: time.Now().Add(d.ttl)}
+	changed := !ok || !reflect.DeepEqual(old.endpoints, eps)
+	var fns []func([]Endpoint)
+	if changed {
+		for _, fn := range d.watchers[name] {
+			fns = append(fns, fn)
+		}
+	}
+	d.mut.Unlock()
+
+	if changed && ok {
+		d.log.Info("endpoints of service are changed", log.Any("name", name), log.Any("endpoints", eps))
+	}
+	for _, fn := range fns {
+		fn(eps)
+	}
+	return eps, nil
+}
+
+func (d *Discovery) refreshing() error {
+	ticker := time.NewTicker(d.ttl)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			d.Refresh()
+		case <-d.tomb.Dying():
+			return nil
+		}
+	}
+}
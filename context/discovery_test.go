@@ -0,0 +1,180 @@
+package context
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/baetyl/baetyl-go/v2/errors"
+)
+
+func TestResolvers(t *testing.T) {
+	static := StaticResolver{"a": {{Host: "10.0.0.1", Port: 80}}, "empty": {}}
+	eps, err := static.Resolve("a")
+	assert.NoError(t, err)
+	assert.Equal(t, "10.0.0.1:80", eps[0].String())
+	_, err = static.Resolve("empty")
+	assert.Equal(t, ErrServiceNotFound, errors.Cause(err))
+
+	env := EnvResolver{}
+	_, err = env.Resolve("test-svc")
+	assert.Equal(t, ErrServiceNotFound, errors.Cause(err))
+	os.Setenv("TEST_SVC_SERVICE_HOST", "10.0.0.2")
+	defer os.Unsetenv("TEST_SVC_SERVICE_HOST")
+	eps, err = env.Resolve("test-svc")
+	assert.NoError(t, err)
+	assert.Equal(t, []Endpoint{{Host: "10.0.0.2"}}, eps)
+	assert.Equal(t, "10.0.0.2", eps[0].String())
+	os.Setenv("TEST_SVC_SERVICE_PORT", "x")
+	defer os.Unsetenv("TEST_SVC_SERVICE_PORT")
+	_, err = env.Resolve("test-svc")
+	assert.Error(t, err)
+	os.Setenv("TEST_SVC_SERVICE_PORT", "8080")
+	eps, err = env.Resolve("test-svc")
+	assert.NoError(t, err)
+	assert.Equal(t, []Endpoint{{Host: "10.0.0.2", Port: 8080}}, eps)
+
+	kube := &KubeResolver{Namespace: "ns", Ports: map[string]int{"b": 443}}
+	eps, err = kube.Resolve("b")
+	assert.NoError(t, err)
+	assert.Equal(t, []Endpoint{{Host: "b.ns", Port: 443}}, eps)
+	eps, err = kube.Resolve("b.other")
+	assert.NoError(t, err)
+	assert.Equal(t, []Endpoint{{Host: "b.other", Port: 443}}, eps)
+
+	chain := ChainResolver{static, env}
+	eps, err = chain.Resolve("a")
+	assert.NoError(t, err)
+	assert.Equal(t, 80, eps[0].Port)
+	_, err = chain.Resolve("c")
+	assert.Equal(t, ErrServiceNotFound, errors.Cause(err))
+	// stop at the error other than not found
+	os.Setenv("TEST_SVC_SERVICE_PORT", "x")
+	_, err = ChainResolver{env, kube}.Resolve("test-svc")
+	assert.Error(t, err)
+	assert.NotEqual(t, ErrServiceNotFound, errors.Cause(err))
+}
+
+func TestSystemResolver(t *testing.T) {
+	mode := os.Getenv(KeyRunMode)
+	defer os.Setenv(KeyRunMode, mode)
+
+	os.Setenv(KeyRunMode, RunModeKube)
+	eps, err := NewSystemResolver().Resolve(ServiceBroker)
+	assert.NoError(t, err)
+	assert.Equal(t, []Endpoint{{Host: "baetyl-broker.baetyl-edge-system", Port: 50010}}, eps)
+	eps, err = NewSystemResolver().Resolve(ServiceCore)
+	assert.NoError(t, err)
+	assert.Equal(t, "baetyl-core.baetyl-edge-system:443", eps[0].String())
+
+	os.Setenv(KeyRunMode, RunModeNative)
+	eps, err = NewSystemResolver().Resolve(ServiceCore)
+	assert.NoError(t, err)
+	assert.Equal(t, "127.0.0.1:8443", eps[0].String())
+	eps, err = NewSystemResolver().Resolve(ServiceGateway)
+	assert.NoError(t, err)
+	assert.Equal(t, "127.0.0.1", eps[0].String())
+	_, err = NewSystemResolver().Resolve("unknown")
+	assert.Equal(t, ErrServiceNotFound, errors.Cause(err))
+}
+
+type countResolver struct {
+	count     int
+	endpoints []Endpoint
+	mut       sync.Mutex
+}
+
+func (r *countResolver) Resolve(name string) ([]Endpoint, error) {
+	r.mut.Lock()
+	defer r.mut.Unlock()
+	r.count++
+	if r.endpoints == nil {
+		return nil, errors.Trace(ErrServiceNotFound)
+	}
+	return r.endpoints, nil
+}
+
+func (r *countResolver) set(eps []Endpoint) {
+	r.mut.Lock()
+	defer r.mut.Unlock()
+	r.endpoints = eps
+}
+
+func TestDiscovery(t *testing.T) {
+	r := &countResolver{endpoints: []Endpoint{{Host: "h1", Port: 1}}}
+	d := NewDiscovery(r, 200*time.Millisecond, nil)
+	defer d.Close()
+
+	eps, err := d.Resolve("svc")
+	assert.NoError(t, err)
+	assert.Equal(t, []Endpoint{{Host: "h1", Port: 1}}, eps)
+	// cached
+	_, err = d.Resolve("svc")
+	assert.NoError(t, err)
+	assert.Equal(t, 1, r.count)
+	assert.Equal(t, "ssl://h1:1", d.Address("ssl", "svc", "fallback"))
+	assert.Equal(t, "h1:1", d.Address("", "svc", "fallback"))
+
+	changes := make(chan []Endpoint, 10)
+	stop := d.Watch("svc", func(eps []Endpoint) { changes <- eps })
+	r.set([]Endpoint{{Host: "h2", Port: 2}})
+	select {
+	case eps = <-changes:
+		assert.Equal(t, []Endpoint{{Host: "h2", Port: 2}}, eps)
+	case <-time.After(3 * time.Second):
+		assert.FailNow(t, "change is not notified")
+	}
+
+	// not notified if not changed
+	d.Refresh()
+	assert.Len(t, changes, 0)
+
+	// the last endpoints are kept if the service disappears
+	r.set(nil)
+	d.Refresh()
+	assert.Equal(t, "ssl://h2:2", d.Address("ssl", "svc", "fallback"))
+	time.Sleep(250 * time.Millisecond)
+	assert.Equal(t, "fallback", d.Address("ssl", "svc", "fallback"))
+
+	r2 := StaticResolver{"svc": {{Host: "h3", Port: 3}}}
+	d.SetResolver(ChainResolver{r2, d.Resolver()})
+	eps = <-changes
+	assert.Equal(t, []Endpoint{{Host: "h3", Port: 3}}, eps)
+
+	stop()
+	d.SetResolver(StaticResolver{"svc": {{Host: "h4", Port: 4}}})
+	assert.Len(t, changes, 0)
+	assert.NoError(t, d.Close())
+}
+
+func TestContextDiscovery(t *testing.T) {
+	os.Setenv(KeyRunMode, "")
+	os.Setenv("BAETYL_BROKER_SERVICE_HOST", "10.0.0.1")
+	os.Setenv("BAETYL_BROKER_SERVICE_PORT", "8883")
+	defer os.Unsetenv("BAETYL_BROKER_SERVICE_HOST")
+	defer os.Unsetenv("BAETYL_BROKER_SERVICE_PORT")
+
+	os.Setenv("BAETYL_GATEWAY_SERVICE_HOST", "10.0.0.3")
+	defer os.Unsetenv("BAETYL_GATEWAY_SERVICE_HOST")
+
+	// the cluster IPs in environment variables are ignored by default
+	ctx := NewContext(filepath.Join(t.TempDir(), "service.yml"))
+	assert.Equal(t, getBrokerAddress(), ctx.SystemConfig().Broker.Address)
+	assert.Equal(t, ctx.SystemConfig().Broker.Address, ctx.(Discoverer).Discovery().Address("ssl", ServiceBroker, ""))
+	assert.Equal(t, "baetyl-gateway.baetyl-edge-system", ctx.GetGatewayHost())
+
+	conf := filepath.Join(t.TempDir(), "service.yml")
+	data := "discovery:\n  env: true\n  static:\n    baetyl-core:\n    - host: 10.0.0.2\n      port: 443\n"
+	assert.NoError(t, ioutil.WriteFile(conf, []byte(data), 0644))
+	ctx = NewContext(conf)
+	assert.Equal(t, "ssl://10.0.0.1:8883", ctx.SystemConfig().Broker.Address)
+	assert.Equal(t, "https://10.0.0.2:443", ctx.SystemConfig().Core.Address)
+	assert.Equal(t, getFunctionAddress(), ctx.SystemConfig().Function.Address)
+	assert.Equal(t, ctx.SystemConfig().Broker.Address, ctx.(Discoverer).Discovery().Address("ssl", ServiceBroker, ""))
+	assert.Equal(t, "10.0.0.3", ctx.GetGatewayHost())
+}
@@ -13,6 +13,7 @@ const (
 	KeyBaetyl             = "BAETYL"
 	KeyConfFile           = "BAETYL_CONF_FILE"
 	KeyNodeName           = "BAETYL_NODE_NAME"
+	KeyNodeNamespace      = "BAETYL_NODE_NAMESPACE"
 	KeyAppName            = "BAETYL_APP_NAME"
 	KeyAppVersion         = "BAETYL_APP_VERSION"
 	KeySvcName            = "BAETYL_SERVICE_NAME"
@@ -20,6 +21,7 @@ const (
 	KeyRunMode            = "BAETYL_RUN_MODE"
 	KeyServiceDynamicPort = "BAETYL_SERVICE_DYNAMIC_PORT"
 	KeyBaetylHostPathLib  = "BAETYL_HOST_PATH_LIB"
+	KeySecretKey          = "BAETYL_SECRET_KEY"
 )
 
 const (
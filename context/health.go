@@ -0,0 +1,271 @@
+package context
+
+import (
+	gohttp "net/http"
+	"sort"
+	"sync"
+	"time"
+
+	routing "github.com/qiangxue/fasthttp-routing"
+
+	"github.com/baetyl/baetyl-go/v2/errors"
+	"github.com/baetyl/baetyl-go/v2/http"
+	"github.com/baetyl/baetyl-go/v2/json"
+	"github.com/baetyl/baetyl-go/v2/log"
+	"github.com/baetyl/baetyl-go/v2/mqtt"
+)
+
+// All paths of health server
+const (
+	HealthPathLiveness  = "/healthz"
+	HealthPathReadiness = "/readyz"
+	HealthPathMetrics   = "/metrics"
+)
+
+// All status of health
+const (
+	HealthStatusOK     = "ok"
+	HealthStatusFailed = "failed"
+)
+
+var (
+	ErrHealthCheckTimeout  = errors.New("health check timeout")
+	ErrBrokerDisconnected  = errors.New("broker client is disconnected")
+	ErrServiceNotReady     = errors.New("service is not ready")
+	ErrServiceStopped      = errors.New("service is stopped")
+	ErrHealthServerStarted = errors.New("health server has been started")
+)
+
+// HealthReporter reports the health of service, which is implemented by the context created by NewContext
+type HealthReporter interface {
+	// AddLivenessCheck adds a check to the liveness report, the check with the same name is replaced.
+	AddLivenessCheck(name string, check HealthCheck)
+	// AddReadinessCheck adds a check to the readiness report, such as the check of broker client or core client.
+	AddReadinessCheck(name string, check HealthCheck)
+	// Liveness runs liveness checks, the service is alive until it is stopped and all checks pass.
+	Liveness() *HealthReport
+	// Readiness runs readiness checks, the service is ready if it is marked ready and all checks pass.
+	Readiness() *HealthReport
+	// StartHealthServer starts the health server which serves /healthz and /readyz with the report of checks,
+	// and /metrics with metrics of the registry. It is started by Run if health is enabled in system config,
+	// and is closed during shutdown.
+	StartHealthServer() error
+}
+
+// HealthCheck checks a component, returns an error if the component is unhealthy
+type HealthCheck func() error
+
+// HealthReport the report of health checks
+type HealthReport struct {
+	Status string                 `json:"status"`
+	State  string                 `json:"state"`
+	Error  string                 `json:"error,omitempty"`
+	Checks map[string]CheckResult `json:"checks,omitempty"`
+}
+
+// CheckResult the result of a health check
+type CheckResult struct {
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+// OK returns whether the service is healthy
+func (r *HealthReport) OK() bool {
+	return r.Status == HealthStatusOK
+}
+
+// BrokerClientCheck checks whether the broker client is connected
+func BrokerClientCheck(cli *mqtt.Client) HealthCheck {
+	return func() error {
+		if !cli.Connected() {
+			return ErrBrokerDisconnected
+		}
+		return nil
+	}
+}
+
+// HTTPClientCheck checks whether the url responds successfully, such as the core client
+func HTTPClientCheck(cli *http.Client, url string) HealthCheck {
+	return func() error {
+		resp, err := cli.GetURL(url)
+		if err != nil {
+			return errors.Trace(err)
+		}
+		_, err = http.HandleResponse(resp)
+		return errors.Trace(err)
+	}
+}
+
+type health struct {
+	liveness  map[string]HealthCheck
+	readiness map[string]HealthCheck
+	server    *http.Server
+	mut       sync.RWMutex
+}
+
+func (h *health) AddLivenessCheck(name string, check HealthCheck) {
+	h.mut.Lock()
+	defer h.mut.Unlock()
+	if h.liveness == nil {
+		h.liveness = map[string]HealthCheck{}
+	}
+	h.liveness[name] = check
+}
+
+func (h *health) AddReadinessCheck(name string, check HealthCheck) {
+	h.mut.Lock()
+	defer h.mut.Unlock()
+	if h.readiness == nil {
+		h.readiness = map[string]HealthCheck{}
+	}
+	h.readiness[name] = check
+}
+
+// livenessChecks returns a copy of liveness checks, which are run without holding the lock
+func (h *health) livenessChecks() map[string]HealthCheck {
+	h.mut.RLock()
+	defer h.mut.RUnlock()
+	return copyChecks(h.liveness)
+}
+
+// readinessChecks returns a copy of readiness checks, which are run without holding the lock
+func (h *health) readinessChecks() map[string]HealthCheck {
+	h.mut.RLock()
+	defer h.mut.RUnlock()
+	return copyChecks(h.readiness)
+}
+
+func copyChecks(checks map[string]HealthCheck) map[string]HealthCheck {
+	res := make(map[string]HealthCheck, len(checks))
+	for name, check := range checks {
+		res[name] = check
+	}
+	return res
+}
+
+// runChecks runs checks concurrently, each check fails if it does not return in the timeout
+func runChecks(state State, err error, checks map[string]HealthCheck, timeout time.Duration) *HealthReport {
+	names := make([]string, 0, len(checks))
+	fns := make([]HealthCheck, 0, len(checks))
+	for name := range checks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fns = append(fns, checks[name])
+	}
+
+	report := &HealthReport{Status: HealthStatusOK, State: state.String()}
+	if err != nil {
+		report.Status = HealthStatusFailed
+		report.Error = err.Error()
+	}
+	if len(names) == 0 {
+		return report
+	}
+
+	results := make([]error, len(fns))
+	var wg sync.WaitGroup
+	for i, fn := range fns {
+		wg.Add(1)
+		go func(i int, fn HealthCheck) {
+			defer wg.Done()
+			results[i] = runCheck(fn, timeout)
+		}(i, fn)
+	}
+	wg.Wait()
+
+	report.Checks = map[string]CheckResult{}
+	for i, name := range names {
+		if results[i] != nil {
+			report.Status = HealthStatusFailed
+			report.Checks[name] = CheckResult{Status: HealthStatusFailed, Error: results[i].Error()}
+			continue
+		}
+		report.Checks[name] = CheckResult{Status: HealthStatusOK}
+	}
+	return report
+}
+
+func runCheck(fn HealthCheck, timeout time.Duration) error {
+	res := make(chan error, 1)
+	go func() {
+		defer func() {
+			if r := recover(); r != nil {
+				res <- errors.Errorf("health check panic: %v", r)
+			}
+		}()
+		res <- fn()
+	}()
+	var timer <-chan time.Time
+	if timeout > 0 {
+		timer = time.After(timeout)
+	}
+	select {
+	case err := <-res:
+		return err
+	case <-timer:
+		return ErrHealthCheckTimeout
+	}
+}
+
+func (c *ctx) Liveness() *HealthReport {
+	var err error
+	state := c.State()
+	if state == StateStopped {
+		err = ErrServiceStopped
+	}
+	return runChecks(state, err, c.health.livenessChecks(), c.SystemConfig().Health.Timeout)
+}
+
+func (c *ctx) Readiness() *HealthReport {
+	var err error
+	state := c.State()
+	if state != StateReady {
+		err = ErrServiceNotReady
+	}
+	return runChecks(state, err, c.health.readinessChecks(), c.SystemConfig().Health.Timeout)
+}
+
+func (c *ctx) StartHealthServer() error {
+	c.health.mut.Lock()
+	defer c.health.mut.Unlock()
+	if c.health.server != nil {
+		return errors.Trace(ErrHealthServerStarted)
+	}
+
+	router := routing.New()
+	router.Get(HealthPathLiveness, func(rc *routing.Context) error {
+		respondHealth(rc, c.Liveness())
+		return nil
+	})
+	router.Get(HealthPathReadiness, func(rc *routing.Context) error {
+		respondHealth(rc, c.Readiness())
+		return nil
+	})
+	handler := c.Metrics().Handler()
+	router.Get(HealthPathMetrics, func(rc *routing.Context) error {
+		handler(rc.RequestCtx)
+		return nil
+	})
+	var cfg http.ServerConfig
+	cfg.Address = c.SystemConfig().Health.Address
+	svr := http.NewServer(cfg, router.HandleRequest)
+	svr.Start()
+	c.health.server = svr
+	c.RegisterCloser("health server", CloserFunc(func() error {
+		svr.Close()
+		return nil
+	}))
+	c.log.Info("health server is started", log.Any("address", cfg.Address))
+	return nil
+}
+
+func respondHealth(rc *routing.Context, report *HealthReport) {
+	code := gohttp.StatusOK
+	if !report.OK() {
+		code = gohttp.StatusServiceUnavailable
+	}
+	data, _ := json.Marshal(report)
+	http.Respond(rc, code, data)
+}
@@ -0,0 +1,125 @@
+package context
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net"
+	gohttp "net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/baetyl/baetyl-go/v2/errors"
+	"github.com/baetyl/baetyl-go/v2/http"
+	"github.com/baetyl/baetyl-go/v2/json"
+	"github.com/baetyl/baetyl-go/v2/metrics"
+	"github.com/baetyl/baetyl-go/v2/mock"
+	"github.com/baetyl/baetyl-go/v2/mqtt"
+)
+
+func TestHealth(t *testing.T) {
+	c := newContext("")
+	c.SystemConfig().Health.Timeout = 50 * time.Millisecond
+
+	report := c.Liveness()
+	assert.True(t, report.OK())
+	assert.Equal(t, "starting", report.State)
+	report = c.Readiness()
+	assert.False(t, report.OK())
+	assert.Equal(t, ErrServiceNotReady.Error(), report.Error)
+
+	var fail error
+	c.AddLivenessCheck("custom", func() error { return fail })
+	c.AddReadinessCheck("slow", func() error {
+		time.Sleep(time.Second)
+		return nil
+	})
+	c.AddReadinessCheck("broker", BrokerClientCheck(mqtt.NewClient(mqtt.NewClientOptions())))
+	c.MarkReady()
+
+	report = c.Readiness()
+	assert.Equal(t, &HealthReport{
+		Status: HealthStatusFailed,
+		State:  "ready",
+		Checks: map[string]CheckResult{
+			"broker": {Status: HealthStatusFailed, Error: ErrBrokerDisconnected.Error()},
+			"slow":   {Status: HealthStatusFailed, Error: ErrHealthCheckTimeout.Error()},
+		},
+	}, report)
+
+	fail = errors.New("custom failure")
+	report = c.Liveness()
+	assert.False(t, report.OK())
+	assert.Equal(t, CheckResult{Status: HealthStatusFailed, Error: "custom failure"}, report.Checks["custom"])
+	fail = nil
+
+	assert.NoError(t, c.Shutdown(0))
+	report = c.Liveness()
+	assert.False(t, report.OK())
+	assert.Equal(t, ErrServiceStopped.Error(), report.Error)
+}
+
+func TestHealthServer(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	addr := ln.Addr().String()
+	ln.Close()
+
+	ms := mock.NewServer(nil, mock.NewResponse(200, []byte("{}")), mock.NewResponse(500, []byte("error")))
+	defer ms.Close()
+	ops := http.NewClientOptions()
+	ops.Address = ms.URL
+
+	c := newContext("")
+	c.SystemConfig().Health.Address = addr
+	c.AddReadinessCheck("core", HTTPClientCheck(http.NewClient(ops), "health"))
+	assert.NoError(t, c.StartHealthServer())
+	assert.Equal(t, ErrHealthServerStarted, errors.Cause(c.StartHealthServer()))
+	c.MarkReady()
+
+	get := func(path string) (int, *HealthReport) {
+		var resp *gohttp.Response
+		for i := 0; i < 50; i++ {
+			resp, err = gohttp.Get(fmt.Sprintf("http://%s%s", addr, path))
+			if err == nil {
+				break
+			}
+			time.Sleep(20 * time.Millisecond)
+		}
+		assert.NoError(t, err)
+		defer resp.Body.Close()
+		data, err := ioutil.ReadAll(resp.Body)
+		assert.NoError(t, err)
+		report := new(HealthReport)
+		assert.NoError(t, json.Unmarshal(data, report))
+		return resp.StatusCode, report
+	}
+
+	code, report := get(HealthPathLiveness)
+	assert.Equal(t, gohttp.StatusOK, code)
+	assert.Equal(t, &HealthReport{Status: HealthStatusOK, State: "ready"}, report)
+
+	code, report = get(HealthPathReadiness)
+	assert.Equal(t, gohttp.StatusOK, code)
+	assert.Equal(t, HealthStatusOK, report.Checks["core"].Status)
+
+	code, report = get(HealthPathReadiness)
+	assert.Equal(t, gohttp.StatusServiceUnavailable, code)
+	assert.Equal(t, CheckResult{Status: HealthStatusFailed, Error: "[500] error"}, report.Checks["core"])
+
+	c.Metrics().NewCounter("test_health_server_total", "").Inc()
+	resp, err := gohttp.Get(fmt.Sprintf("http://%s%s", addr, HealthPathMetrics))
+	assert.NoError(t, err)
+	data, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	assert.NoError(t, err)
+	assert.Equal(t, metrics.ContentType, resp.Header.Get("Content-Type"))
+	assert.Contains(t, string(data), "\ntest_health_server_total 1\n")
+	assert.Contains(t, string(data), "# TYPE baetyl_http_client_request_duration_seconds histogram\n")
+
+	// the health server is closed during shutdown
+	assert.NoError(t, c.Shutdown(0))
+	_, err = gohttp.Get(fmt.Sprintf("http://%s%s", addr, HealthPathLiveness))
+	assert.Error(t, err)
+}
@@ -0,0 +1,225 @@
+package context
+
+import (
+	"io"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/baetyl/baetyl-go/v2/errors"
+	"github.com/baetyl/baetyl-go/v2/log"
+)
+
+// State the state of service lifecycle
+type State int32
+
+// All states
+const (
+	StateStarting State = iota
+	StateReady
+	StateStopping
+	StateStopped
+)
+
+// String returns the name of state
+func (s State) String() string {
+	switch s {
+	case StateStarting:
+		return "starting"
+	case StateReady:
+		return "ready"
+	case StateStopping:
+		return "stopping"
+	case StateStopped:
+		return "stopped"
+	default:
+		return "unknown"
+	}
+}
+
+// Exit codes reported by Run
+const (
+	ExitCodeOK      = 0
+	ExitCodeError   = 1
+	ExitCodeTimeout = 2
+)
+
+var (
+	ErrShutdownTimeout = errors.New("failed to shutdown in time")
+)
+
+// Lifecycle the lifecycle of service run by Run, which is implemented by the context created by NewContext
+type Lifecycle interface {
+	// OnStart registers a hook called by Run before the handler, hooks with lower priority are called first.
+	// If a start hook fails, the service is shut down without calling the handler.
+	OnStart(priority int, hook Hook)
+	// OnReady registers a hook called once the service is ready, hooks with lower priority are called first.
+	OnReady(priority int, hook Hook)
+	// OnStop registers a hook called during shutdown, hooks with higher priority are called first,
+	// so that hooks are called in the reverse order of start hooks with the same priorities.
+	OnStop(priority int, hook Hook)
+	// RegisterCloser registers a closer, such as mqtt client, http server or plugin,
+	// which is closed after stop hooks during shutdown, in the reverse order of registration.
+	RegisterCloser(name string, closer io.Closer)
+	// MarkReady marks the service ready and calls ready hooks, Wait marks the service ready as well.
+	MarkReady()
+	// State returns the lifecycle state of service.
+	State() State
+	// Shutdown calls stop hooks and closes closers in the timeout, only the first call takes effect.
+	// If timeout is 0, to use the shutdown timeout of system config.
+	Shutdown(timeout time.Duration) error
+}
+
+// Hook the function called at a stage of service lifecycle
+type Hook func() error
+
+// CloserFunc adapts a function to io.Closer, such as the Close of http server
+type CloserFunc func() error
+
+// Close calls the function
+func (f CloserFunc) Close() error {
+	return f()
+}
+
+type hook struct {
+	priority int
+	fn       Hook
+}
+
+type closer struct {
+	name string
+	io.Closer
+}
+
+type lifecycle struct {
+	state   int32
+	starts  []hook
+	readies []hook
+	stops   []hook
+	closers []closer
+	err     error
+	ready   sync.Once
+	closing sync.Once
+	mut     sync.Mutex
+}
+
+func (l *lifecycle) OnStart(priority int, fn Hook) {
+	l.mut.Lock()
+	l.starts = append(l.starts, hook{priority: priority, fn: fn})
+	l.mut.Unlock()
+}
+
+func (l *lifecycle) OnReady(priority int, fn Hook) {
+	l.mut.Lock()
+	l.readies = append(l.readies, hook{priority: priority, fn: fn})
+	l.mut.Unlock()
+}
+
+func (l *lifecycle) OnStop(priority int, fn Hook) {
+	l.mut.Lock()
+	l.stops = append(l.stops, hook{priority: priority, fn: fn})
+	l.mut.Unlock()
+}
+
+func (l *lifecycle) RegisterCloser(name string, c io.Closer) {
+	l.mut.Lock()
+	l.closers = append(l.closers, closer{name: name, Closer: c})
+	l.mut.Unlock()
+}
+
+func (l *lifecycle) State() State {
+	return State(atomic.LoadInt32(&l.state))
+}
+
+func (l *lifecycle) setState(s State) {
+	atomic.StoreInt32(&l.state, int32(s))
+}
+
+// sorted returns hooks sorted by priority, hooks of the same priority keep the order of registration
+func (l *lifecycle) sorted(hs []hook) []hook {
+	l.mut.Lock()
+	res := make([]hook, len(hs))
+	copy(res, hs)
+	l.mut.Unlock()
+	sort.SliceStable(res, func(i, j int) bool {
+		return res[i].priority < res[j].priority
+	})
+	return res
+}
+
+func (l *lifecycle) start() error {
+	for _, h := range l.sorted(l.starts) {
+		if err := h.fn(); err != nil {
+			return errors.Trace(err)
+		}
+	}
+	return nil
+}
+
+func (l *lifecycle) markReady(logger *log.Logger) {
+	l.ready.Do(func() {
+		if !atomic.CompareAndSwapInt32(&l.state, int32(StateStarting), int32(StateReady)) {
+			return
+		}
+		for _, h := range l.sorted(l.readies) {
+			if err := h.fn(); err != nil {
+				logger.Warn("failed to call ready hook", log.Error(err))
+			}
+		}
+		logger.Info("service is ready")
+	})
+}
+
+// stop calls stop hooks in the reverse order of start hooks, then closes closers in the reverse order of registration.
+// All of them are called even if some of them fail, the first error is returned.
+func (l *lifecycle) stop(logger *log.Logger) error {
+	hs := l.sorted(l.stops)
+	l.mut.Lock()
+	cs := make([]closer, len(l.closers))
+	copy(cs, l.closers)
+	l.mut.Unlock()
+
+	var first error
+	for i := len(hs) - 1; i >= 0; i-- {
+		if err := hs[i].fn(); err != nil {
+			logger.Warn("failed to call stop hook", log.Any("priority", hs[i].priority), log.Error(err))
+			if first == nil {
+				first = err
+			}
+		}
+	}
+	for i := len(cs) - 1; i >= 0; i-- {
+		if err := cs[i].Close(); err != nil {
+			logger.Warn("failed to close", log.Any("name", cs[i].name), log.Error(err))
+			if first == nil {
+				first = err
+			}
+			continue
+		}
+		logger.Debug("closed", log.Any("name", cs[i].name))
+	}
+	return errors.Trace(first)
+}
+
+func (l *lifecycle) shutdown(timeout time.Duration, logger *log.Logger) error {
+	l.closing.Do(func() {
+		l.setState(StateStopping)
+		done := make(chan error, 1)
+		go func() {
+			done <- l.stop(logger)
+		}()
+		var timer <-chan time.Time
+		if timeout > 0 {
+			timer = time.After(timeout)
+		}
+		select {
+		case l.err = <-done:
+			l.setState(StateStopped)
+		case <-timer:
+			logger.Error("failed to shutdown in time", log.Any("timeout", timeout))
+			l.err = errors.Trace(ErrShutdownTimeout)
+		}
+	})
+	return l.err
+}
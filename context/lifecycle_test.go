@@ -0,0 +1,99 @@
+package context
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/baetyl/baetyl-go/v2/errors"
+)
+
+func TestLifecycle(t *testing.T) {
+	c := newContext("")
+	var calls []string
+	record := func(name string, err error) Hook {
+		return func() error {
+			calls = append(calls, name)
+			return err
+		}
+	}
+	c.OnStart(1, record("start-1", nil))
+	c.OnStart(0, record("start-0", nil))
+	c.OnStart(1, record("start-1b", nil))
+	c.OnReady(0, record("ready", errors.New("ignored")))
+	c.OnStop(1, record("stop-1", errors.New("stop failed")))
+	c.OnStop(0, record("stop-0", nil))
+	c.OnStop(1, record("stop-1b", nil))
+	c.RegisterCloser("first", CloserFunc(func() error {
+		calls = append(calls, "close-first")
+		return nil
+	}))
+	c.RegisterCloser("second", CloserFunc(func() error {
+		calls = append(calls, "close-second")
+		return nil
+	}))
+	assert.Equal(t, StateStarting, c.State())
+
+	err := serve(c, func(ctx Context) error {
+		go ctx.Done()
+		ctx.Wait()
+		assert.Equal(t, StateStopping, ctx.(Lifecycle).State())
+		return nil
+	})
+	assert.NoError(t, err)
+	err = c.Shutdown(0)
+	assert.EqualError(t, errors.Cause(err), "stop failed")
+	assert.Equal(t, StateStopped, c.State())
+	assert.Equal(t, []string{
+		"start-0", "start-1", "start-1b",
+		"ready",
+		"stop-1b", "stop-1", "stop-0",
+		"close-second", "close-first",
+	}, calls)
+
+	// only the first shutdown takes effect
+	assert.Equal(t, err, c.Shutdown(0))
+	assert.Len(t, calls, 9)
+	assert.Equal(t, "stopped", c.State().String())
+}
+
+func TestLifecycleStartFailure(t *testing.T) {
+	c := newContext("")
+	var stopped bool
+	c.OnStart(0, func() error {
+		return errors.New("start failed")
+	})
+	c.OnStop(0, func() error {
+		stopped = true
+		return nil
+	})
+	err := serve(c, func(ctx Context) error {
+		t.Fatal("handler is called")
+		return nil
+	})
+	assert.EqualError(t, errors.Cause(err), "start failed")
+	assert.NoError(t, c.Shutdown(0))
+	assert.True(t, stopped)
+
+	// panic
+	err = serve(newContext(""), func(ctx Context) error {
+		panic("it is a panic")
+	})
+	assert.EqualError(t, err, "service is stopped with panic: it is a panic")
+}
+
+func TestLifecycleShutdownTimeout(t *testing.T) {
+	c := newContext("")
+	block := make(chan struct{})
+	defer close(block)
+	c.RegisterCloser("block", CloserFunc(func() error {
+		<-block
+		return nil
+	}))
+	c.MarkReady()
+	assert.Equal(t, StateReady, c.State())
+	err := c.Shutdown(10 * time.Millisecond)
+	assert.Equal(t, ErrShutdownTimeout, errors.Cause(err))
+	assert.Equal(t, StateStopping, c.State())
+}
@@ -0,0 +1,15 @@
+package context
+
+import (
+	"github.com/baetyl/baetyl-go/v2/metrics"
+)
+
+// MetricsProvider provides the metrics registry, which is implemented by the context created by NewContext
+type MetricsProvider interface {
+	// Metrics returns the metrics registry, which holds metrics of the instrumented subsystems as well.
+	Metrics() *metrics.Registry
+}
+
+var (
+	metricCertExpiry = metrics.DefaultRegistry.NewGauge("baetyl_system_cert_expiry_timestamp_seconds", "The expiry time of system certificate in unix seconds.")
+)
@@ -0,0 +1,67 @@
+package context
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestContextNamespace(t *testing.T) {
+	t.Setenv(KeyNodeName, "node")
+	t.Setenv(KeyAppName, "app")
+	t.Setenv(KeySvcName, "service")
+	t.Setenv(KeyNodeNamespace, "")
+
+	dir := t.TempDir()
+	conf := filepath.Join(dir, "service.yml")
+	assert.NoError(t, ioutil.WriteFile(conf, []byte("name: shared"), 0644))
+
+	// without namespace
+	c := newContext(conf)
+	defer c.Shutdown(0)
+	assert.Equal(t, "", c.Namespace())
+	assert.Equal(t, conf, c.NamespacePath(conf))
+	topic, err := c.ProcessTopic("$baetyl/{{.NodeName}}/{{.AppName}}/report")
+	assert.NoError(t, err)
+	assert.Equal(t, "$baetyl/node/app/report", topic)
+
+	var cfg struct {
+		Name string `yaml:"name"`
+	}
+	assert.NoError(t, c.LoadCustomConfig(&cfg))
+	assert.Equal(t, "shared", cfg.Name)
+
+	// with namespace from env
+	t.Setenv(KeyNodeNamespace, "tenant-a")
+	c = newContext(conf)
+	defer c.Shutdown(0)
+	assert.Equal(t, "tenant-a", c.Namespace())
+	assert.Equal(t, "tenant-a", c.SystemConfig().Namespace)
+	assert.Equal(t, "baetyl-link-tenant-a-app", c.SystemConfig().Broker.ClientID)
+	assert.Equal(t, filepath.Join(dir, "tenant-a", "service.yml"), c.NamespacePath(conf))
+	assert.Equal(t, map[string]interface{}{
+		"Namespace":   "tenant-a",
+		"NodeName":    "node",
+		"AppName":     "app",
+		"ServiceName": "service",
+	}, c.TopicVars())
+	topic, err = c.ProcessTopic("$baetyl/{{.Namespace}}/{{.NodeName}}/report")
+	assert.NoError(t, err)
+	assert.Equal(t, "$baetyl/tenant-a/node/report", topic)
+	_, err = c.ProcessTopic("{{.Namespace")
+	assert.Error(t, err)
+
+	// the shared config is loaded if the namespaced one does not exist
+	cfg.Name = ""
+	assert.NoError(t, c.LoadCustomConfig(&cfg))
+	assert.Equal(t, "shared", cfg.Name)
+
+	// the namespaced config is preferred
+	assert.NoError(t, os.MkdirAll(filepath.Join(dir, "tenant-a"), 0755))
+	assert.NoError(t, ioutil.WriteFile(c.NamespacePath(conf), []byte("name: tenant-a"), 0644))
+	assert.NoError(t, c.LoadCustomConfig(&cfg))
+	assert.Equal(t, "tenant-a", cfg.Name)
+}
@@ -5,12 +5,20 @@ import (
 	"os"
 	"runtime/debug"
 
+	"github.com/baetyl/baetyl-go/v2/errors"
 	"github.com/baetyl/baetyl-go/v2/log"
 	"github.com/baetyl/baetyl-go/v2/utils"
 )
 
-// Run service
+// Run service.
+// Start hooks are called before the handler. After the handler returns, stop hooks are called
+// and closers are closed in the shutdown timeout of system config.
 func Run(handle func(Context) error) {
+	RunWithExitCode(handle)
+}
+
+// RunWithExitCode runs service as Run does, returns the exit code, such as to pass it to os.Exit.
+func RunWithExitCode(handle func(Context) error) int {
 	utils.PrintVersion()
 
 	var h bool
@@ -20,22 +28,50 @@ func Run(handle func(Context) error) {
 	flag.Parse()
 	if h {
 		flag.Usage()
-		return
+		return ExitCodeOK
 	}
 
-	ctx := NewContext(c)
-	defer func() {
-		if r := recover(); r != nil {
-			ctx.Log().Error("service is stopped with panic", log.Any("panic", r), log.Any("stack", string(debug.Stack())))
-		}
-	}()
-
+	ctx := newContext(c)
 	pwd, _ := os.Getwd()
 	ctx.Log().Info("service starting", log.Any("args", os.Args), log.Any("pwd", pwd))
-	err := handle(ctx)
+	if ctx.SystemConfig().Health.Enable {
+		if err := ctx.StartHealthServer(); err != nil {
+			ctx.Log().Error("failed to start health server", log.Error(err))
+		}
+	}
+	if ctx.SystemConfig().CertRotation.Enable {
+		if err := ctx.StartCertMonitor(); err != nil {
+			ctx.Log().Error("failed to start cert monitor", log.Error(err))
+		}
+	}
+
+	code := ExitCodeOK
+	err := serve(ctx, handle)
 	if err != nil {
+		code = ExitCodeError
 		ctx.Log().Error("service has stopped with error", log.Error(err))
 	} else {
 		ctx.Log().Info("service has stopped")
 	}
+	err = ctx.Shutdown(0)
+	if errors.Cause(err) == ErrShutdownTimeout {
+		code = ExitCodeTimeout
+	} else if err != nil && code == ExitCodeOK {
+		code = ExitCodeError
+	}
+	ctx.Log().Info("service has exited", log.Any("code", code))
+	return code
+}
+
+func serve(c *ctx, handle func(Context) error) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			c.Log().Error("service is stopped with panic", log.Any("panic", r), log.Any("stack", string(debug.Stack())))
+			err = errors.Errorf("service is stopped with panic: %v", r)
+		}
+	}()
+	if err = c.start(); err != nil {
+		return errors.Trace(err)
+	}
+	return handle(c)
 }
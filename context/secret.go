@@ -0,0 +1,289 @@
+package context
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+
+	"github.com/baetyl/baetyl-go/v2/errors"
+	"github.com/baetyl/baetyl-go/v2/utils"
+)
+
+// All schemes of secret references in config
+const (
+	// SchemeSecret refers to a key of a secret, such as secret://broker/password
+	SchemeSecret = "secret://"
+	// SchemeFile refers to the content of a file, such as file:///var/lib/baetyl/password
+	SchemeFile = "file://"
+)
+
+var (
+	ErrSecretNotFound   = errors.New("secret is not found")
+	ErrSecretReference  = errors.New("secret reference must be secret://<name>/<key>")
+	ErrSecretCiphertext = errors.New("ciphertext of secrets is too short")
+)
+
+// SecretResolver resolves secret references in config, which is implemented by the context created by NewContext
+type SecretResolver interface {
+	// Secrets returns the provider of secrets, which looks up environment variables, mounted secrets and the encrypted file.
+	Secrets() SecretProvider
+	// ResolveSecrets resolves secret references in cfg, such as secret://<name>/<key> and file://<path>.
+	// The references are resolved in system config only, custom config is resolved if this is called after loaded.
+	// Resolved values are never logged.
+	ResolveSecrets(cfg interface{}) error
+}
+
+// SecretProvider looks up the value of a key in a secret,
+// returns ErrSecretNotFound if the secret or the key is unknown to the provider.
+type SecretProvider interface {
+	Lookup(name, key string) ([]byte, error)
+}
+
+// EnvSecretProvider looks up secrets in environment variables named BAETYL_SECRET_<NAME>_<KEY>,
+// such as BAETYL_SECRET_BROKER_PASSWORD for secret://broker/password.
+type EnvSecretProvider struct{}
+
+// Lookup looks up the value of a key in a secret
+func (EnvSecretProvider) Lookup(name, key string) ([]byte, error) {
+	env := strings.ToUpper(strings.NewReplacer("-", "_", ".", "_").Replace("BAETYL_SECRET_" + name + "_" + key))
+	v, ok := os.LookupEnv(env)
+	if !ok {
+		return nil, errors.Trace(ErrSecretNotFound)
+	}
+	return []byte(v), nil
+}
+
+// DirSecretProvider looks up secrets in a directory, in which secrets are mounted as v1.Secret,
+// that is the value of each key is kept in the file <dir>/<name>/<key>.
+type DirSecretProvider string
+
+// Lookup looks up the value of a key in a secret
+func (p DirSecretProvider) Lookup(name, key string) ([]byte, error) {
+	if strings.Contains(name, "..") || strings.Contains(key, "..") {
+		return nil, errors.Trace(ErrSecretReference)
+	}
+	data, err := ioutil.ReadFile(filepath.Join(string(p), name, key))
+	if os.IsNotExist(err) {
+		return nil, errors.Trace(ErrSecretNotFound)
+	}
+	return data, errors.Trace(err)
+}
+
+// FileSecretProvider looks up secrets in a file encrypted by EncryptSecrets
+type FileSecretProvider struct {
+	secrets map[string]map[string]string
+}
+
+// NewFileSecretProvider decrypts the file of secrets with the key
+func NewFileSecretProvider(file string, key []byte) (*FileSecretProvider, error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	plain, err := decryptSecrets(data, key)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	p := &FileSecretProvider{secrets: map[string]map[string]string{}}
+	if err = yaml.Unmarshal(plain, &p.secrets); err != nil {
+		return nil, errors.Trace(err)
+	}
+	return p, nil
+}
+
+// Lookup looks up the value of a key in a secret
+func (p *FileSecretProvider) Lookup(name, key string) ([]byte, error) {
+	v, ok := p.secrets[name][key]
+	if !ok {
+		return nil, errors.Trace(ErrSecretNotFound)
+	}
+	return []byte(v), nil
+}
+
+// EncryptSecrets encrypts secrets with the key by AES-256-GCM, the result can be loaded by NewFileSecretProvider.
+// The key can be of any length, the SHA-256 digest of which is used as the cipher key.
+func EncryptSecrets(secrets map[string]map[string]string, key []byte) ([]byte, error) {
+	plain, err := yaml.Marshal(secrets)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	gcm, err := newSecretCipher(key)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err = io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, errors.Trace(err)
+	}
+	return gcm.Seal(nonce, nonce, plain, nil), nil
+}
+
+func decryptSecrets(data, key []byte) ([]byte, error) {
+	gcm, err := newSecretCipher(key)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	if len(data) < gcm.NonceSize() {
+		return nil, errors.Trace(ErrSecretCiphertext)
+	}
+	plain, err := gcm.Open(nil, data[:gcm.NonceSize()], data[gcm.NonceSize():], nil)
+	return plain, errors.Trace(err)
+}
+
+func newSecretCipher(key []byte) (cipher.AEAD, error) {
+	sum := sha256.Sum256(key)
+	block, err := aes.NewCipher(sum[:])
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	gcm, err := cipher.NewGCM(block)
+	return gcm, errors.Trace(err)
+}
+
+// ChainSecretProvider tries providers in order until a secret is found
+type ChainSecretProvider []SecretProvider
+
+// Lookup looks up the value of a key in a secret
+func (p ChainSecretProvider) Lookup(name, key string) ([]byte, error) {
+	for _, provider := range p {
+		v, err := provider.Lookup(name, key)
+		if err == nil {
+			return v, nil
+		}
+		if errors.Cause(err) != ErrSecretNotFound {
+			return nil, errors.Trace(err)
+		}
+	}
+	return nil, errors.Trace(ErrSecretNotFound)
+}
+
+// NewSecretProvider creates the chain of secret providers by config,
+// which looks up secrets in environment variables, the directory of mounted secrets and the encrypted file in order.
+func NewSecretProvider(cfg SecretConfig) (SecretProvider, error) {
+	chain := ChainSecretProvider{EnvSecretProvider{}}
+	if cfg.Dir != "" {
+		chain = append(chain, DirSecretProvider(cfg.Dir))
+	}
+	if cfg.File != "" {
+		key := []byte(os.Getenv(KeySecretKey))
+		if cfg.KeyFile != "" {
+			var err error
+			if key, err = ioutil.ReadFile(cfg.KeyFile); err != nil {
+				return nil, errors.Trace(err)
+			}
+		}
+		p, err := NewFileSecretProvider(cfg.File, key)
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+		chain = append(chain, p)
+	}
+	return chain, nil
+}
+
+// ResolveSecret resolves a secret reference, such as secret://<name>/<key> or file://<path>.
+// The value is returned as it is if it is not a reference. The trailing newline of a file is trimmed.
+// Errors never contain the resolved value.
+func ResolveSecret(value string, provider SecretProvider) (string, error) {
+	switch {
+	case strings.HasPrefix(value, SchemeSecret):
+		ref := strings.TrimPrefix(value, SchemeSecret)
+		i := strings.Index(ref, "/")
+		if i <= 0 || i == len(ref)-1 {
+			return "", errors.Trace(ErrSecretReference)
+		}
+		v, err := provider.Lookup(ref[:i], ref[i+1:])
+		if err != nil {
+			return "", errors.Errorf("failed to resolve secret (%s): %s", value, err.Error())
+		}
+		return string(v), nil
+	case strings.HasPrefix(value, SchemeFile):
+		p := strings.TrimPrefix(value, SchemeFile)
+		if !utils.FileExists(p) {
+			return "", errors.Errorf("failed to resolve secret (%s): file is not found", value)
+		}
+		v, err := ioutil.ReadFile(p)
+		if err != nil {
+			return "", errors.Trace(err)
+		}
+		return strings.TrimRight(string(v), "\r\n"), nil
+	}
+	return value, nil
+}
+
+// ResolveSecrets resolves all secret references of the string values in cfg, which must be a pointer,
+// including the values in nested structs, slices and maps.
+func ResolveSecrets(cfg interface{}, provider SecretProvider) error {
+	rv := reflect.ValueOf(cfg)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() {
+		return errors.Trace(ErrConfigNotPointer)
+	}
+	return errors.Trace(resolveSecrets(rv.Elem(), provider))
+}
+
+func resolveSecrets(rv reflect.Value, provider SecretProvider) error {
+	switch rv.Kind() {
+	case reflect.String:
+		v, err := ResolveSecret(rv.String(), provider)
+		if err != nil {
+			return errors.Trace(err)
+		}
+		if v != rv.String() && rv.CanSet() {
+			rv.SetString(v)
+		}
+	case reflect.Ptr:
+		if !rv.IsNil() {
+			return resolveSecrets(rv.Elem(), provider)
+		}
+	case reflect.Interface:
+		if rv.IsNil() || !rv.CanSet() {
+			return nil
+		}
+		// the value in an interface is not addressable, so it is resolved in a copy
+		v := reflect.New(rv.Elem().Type()).Elem()
+		v.Set(rv.Elem())
+		if err := resolveSecrets(v, provider); err != nil {
+			return err
+		}
+		rv.Set(v)
+	case reflect.Struct:
+		for i := 0; i < rv.NumField(); i++ {
+			if rv.Type().Field(i).PkgPath != "" {
+				continue
+			}
+			if err := resolveSecrets(rv.Field(i), provider); err != nil {
+				return err
+			}
+		}
+	case reflect.Slice, reflect.Array:
+		if rv.Type().Elem().Kind() == reflect.Uint8 {
+			return nil
+		}
+		for i := 0; i < rv.Len(); i++ {
+			if err := resolveSecrets(rv.Index(i), provider); err != nil {
+				return err
+			}
+		}
+	case reflect.Map:
+		iter := rv.MapRange()
+		for iter.Next() {
+			// the value in a map is not addressable, so it is resolved in a copy
+			v := reflect.New(iter.Value().Type()).Elem()
+			v.Set(iter.Value())
+			if err := resolveSecrets(v, provider); err != nil {
+				return err
+			}
+			rv.SetMapIndex(iter.Key(), v)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,180 @@
+package context
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/baetyl/baetyl-go/v2/errors"
+)
+
+func TestSecretProviders(t *testing.T) {
+	env := EnvSecretProvider{}
+	_, err := env.Lookup("test-broker", "password")
+	assert.Equal(t, ErrSecretNotFound, errors.Cause(err))
+	t.Setenv("BAETYL_SECRET_TEST_BROKER_PASSWORD", "env-pwd")
+	v, err := env.Lookup("test-broker", "password")
+	assert.NoError(t, err)
+	assert.Equal(t, "env-pwd", string(v))
+
+	dir := t.TempDir()
+	assert.NoError(t, os.MkdirAll(filepath.Join(dir, "mqtt"), 0755))
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, "mqtt", "password"), []byte("dir-pwd"), 0644))
+	mounted := DirSecretProvider(dir)
+	v, err = mounted.Lookup("mqtt", "password")
+	assert.NoError(t, err)
+	assert.Equal(t, "dir-pwd", string(v))
+	_, err = mounted.Lookup("mqtt", "username")
+	assert.Equal(t, ErrSecretNotFound, errors.Cause(err))
+	_, err = mounted.Lookup("..", "passwd")
+	assert.Equal(t, ErrSecretReference, errors.Cause(err))
+
+	data, err := EncryptSecrets(map[string]map[string]string{"db": {"password": "file-pwd"}}, []byte("key"))
+	assert.NoError(t, err)
+	assert.NotContains(t, string(data), "file-pwd")
+	file := filepath.Join(dir, "secrets.enc")
+	assert.NoError(t, ioutil.WriteFile(file, data, 0600))
+	encrypted, err := NewFileSecretProvider(file, []byte("key"))
+	assert.NoError(t, err)
+	v, err = encrypted.Lookup("db", "password")
+	assert.NoError(t, err)
+	assert.Equal(t, "file-pwd", string(v))
+	_, err = encrypted.Lookup("db", "username")
+	assert.Equal(t, ErrSecretNotFound, errors.Cause(err))
+	_, err = NewFileSecretProvider(file, []byte("wrong"))
+	assert.Error(t, err)
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, "short.enc"), []byte("x"), 0600))
+	_, err = NewFileSecretProvider(filepath.Join(dir, "short.enc"), []byte("key"))
+	assert.Equal(t, ErrSecretCiphertext, errors.Cause(err))
+
+	// the key is read from env if the key file is not set
+	t.Setenv(KeySecretKey, "key")
+	chain, err := NewSecretProvider(SecretConfig{Dir: dir, File: file})
+	assert.NoError(t, err)
+	for name, expected := range map[string]string{"test-broker": "env-pwd", "mqtt": "dir-pwd", "db": "file-pwd"} {
+		v, err = chain.Lookup(name, "password")
+		assert.NoError(t, err)
+		assert.Equal(t, expected, string(v))
+	}
+	_, err = chain.Lookup("unknown", "password")
+	assert.Equal(t, ErrSecretNotFound, errors.Cause(err))
+	// stop at the error other than not found
+	_, err = ChainSecretProvider{mounted, env}.Lookup("..", "password")
+	assert.Equal(t, ErrSecretReference, errors.Cause(err))
+
+	keyFile := filepath.Join(dir, "key")
+	assert.NoError(t, ioutil.WriteFile(keyFile, []byte("wrong"), 0600))
+	_, err = NewSecretProvider(SecretConfig{Dir: dir, File: file, KeyFile: keyFile})
+	assert.Error(t, err)
+}
+
+func TestResolveSecrets(t *testing.T) {
+	dir := t.TempDir()
+	pwdFile := filepath.Join(dir, "password")
+	assert.NoError(t, ioutil.WriteFile(pwdFile, []byte("file-pwd\n"), 0644))
+	provider := staticSecrets{"mqtt": {"password": "mqtt-pwd"}}
+
+	v, err := ResolveSecret("plain", provider)
+	assert.NoError(t, err)
+	assert.Equal(t, "plain", v)
+	v, err = ResolveSecret("secret://mqtt/password", provider)
+	assert.NoError(t, err)
+	assert.Equal(t, "mqtt-pwd", v)
+	v, err = ResolveSecret("file://"+pwdFile, provider)
+	assert.NoError(t, err)
+	assert.Equal(t, "file-pwd", v)
+	for _, ref := range []string{"secret://mqtt", "secret:///password", "secret://mqtt/"} {
+		_, err = ResolveSecret(ref, provider)
+		assert.Equal(t, ErrSecretReference, errors.Cause(err), ref)
+	}
+	_, err = ResolveSecret("secret://mqtt/username", provider)
+	assert.EqualError(t, err, "failed to resolve secret (secret://mqtt/username): secret is not found")
+	_, err = ResolveSecret("file://"+filepath.Join(dir, "none"), provider)
+	assert.Error(t, err)
+
+	type auth struct {
+		Username string `yaml:"username"`
+		Password string `yaml:"password"`
+	}
+	type config struct {
+		Auth    auth                   `yaml:"auth"`
+		Ptr     *auth                  `yaml:"ptr"`
+		List    []string               `yaml:"list"`
+		Map     map[string]string      `yaml:"map"`
+		Any     map[string]interface{} `yaml:"any"`
+		Data    []byte                 `yaml:"data"`
+		private string
+	}
+	cfg := &config{
+		Auth:    auth{Username: "admin", Password: "secret://mqtt/password"},
+		Ptr:     &auth{Password: "file://" + pwdFile},
+		List:    []string{"a", "secret://mqtt/password"},
+		Map:     map[string]string{"k": "secret://mqtt/password"},
+		Any:     map[string]interface{}{"k": "secret://mqtt/password", "n": 1, "l": []interface{}{"file://" + pwdFile}},
+		Data:    []byte("secret://mqtt/password"),
+		private: "secret://mqtt/password",
+	}
+	assert.NoError(t, ResolveSecrets(cfg, provider))
+	assert.Equal(t, &config{
+		Auth:    auth{Username: "admin", Password: "mqtt-pwd"},
+		Ptr:     &auth{Password: "file-pwd"},
+		List:    []string{"a", "mqtt-pwd"},
+		Map:     map[string]string{"k": "mqtt-pwd"},
+		Any:     map[string]interface{}{"k": "mqtt-pwd", "n": 1, "l": []interface{}{"file-pwd"}},
+		Data:    []byte("secret://mqtt/password"),
+		private: "secret://mqtt/password",
+	}, cfg)
+	assert.Equal(t, ErrConfigNotPointer, errors.Cause(ResolveSecrets(*cfg, provider)))
+	assert.Error(t, ResolveSecrets(&config{List: []string{"secret://mqtt/username"}}, provider))
+}
+
+func TestContextSecrets(t *testing.T) {
+	dir := t.TempDir()
+	assert.NoError(t, os.MkdirAll(filepath.Join(dir, "secrets", "broker"), 0755))
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, "secrets", "broker", "password"), []byte("broker-pwd"), 0644))
+	t.Setenv("BAETYL_SECRET_APP_TOKEN", "app-token")
+
+	conf := filepath.Join(dir, "service.yml")
+	assert.NoError(t, ioutil.WriteFile(conf, []byte(`
+secret:
+  dir: `+filepath.Join(dir, "secrets")+`
+broker:
+  password: secret://broker/password
+token: secret://app/token
+`), 0644))
+	c := newContext(conf)
+	defer c.Shutdown(0)
+	assert.Equal(t, "broker-pwd", c.SystemConfig().Broker.Password)
+
+	var cfg struct {
+		Token string `yaml:"token"`
+	}
+	// custom config is not resolved unless requested
+	assert.NoError(t, c.LoadCustomConfig(&cfg))
+	assert.Equal(t, "secret://app/token", cfg.Token)
+	assert.NoError(t, c.ResolveSecrets(&cfg))
+	assert.Equal(t, "app-token", cfg.Token)
+	v, err := c.Secrets().Lookup("broker", "password")
+	assert.NoError(t, err)
+	assert.Equal(t, "broker-pwd", string(v))
+
+	cfg.Token = ""
+	w, err := c.WatchCustomConfig(&cfg)
+	assert.NoError(t, err)
+	defer w.Close()
+	assert.Equal(t, "secret://app/token", cfg.Token)
+}
+
+// staticSecrets a secret provider in memory for test
+type staticSecrets map[string]map[string]string
+
+func (p staticSecrets) Lookup(name, key string) ([]byte, error) {
+	v, ok := p[name][key]
+	if !ok {
+		return nil, errors.Trace(ErrSecretNotFound)
+	}
+	return []byte(v), nil
+}
@@ -0,0 +1,261 @@
+package context
+
+import (
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+
+	"github.com/baetyl/baetyl-go/v2/errors"
+	"github.com/baetyl/baetyl-go/v2/log"
+	"github.com/baetyl/baetyl-go/v2/utils"
+)
+
+// the delay to reload after the last file event, since one update of a file
+// or a mounted configuration usually produces a burst of events
+const configReloadDelay = 100 * time.Millisecond
+
+var (
+	ErrConfigNotPointer = errors.New("config must be a non-nil pointer")
+)
+
+// CustomConfigWatcher watches custom config, which is implemented by the context created by NewContext
+type CustomConfigWatcher interface {
+	// WatchCustomConfig loads custom config as LoadCustomConfig does, and watches the file to reload it on changes.
+	// The returned watcher holds the latest good config and notifies subscribers of changes.
+	WatchCustomConfig(cfg interface{}, files ...string) (*ConfigWatcher, error)
+}
+
+// ConfigChange the change of config, Old and New are pointers of the same type as the watched config
+type ConfigChange struct {
+	Old interface{}
+	New interface{}
+	// Fields the changed top-level fields named by yaml tags, or the changed keys if config is a map
+	Fields []string
+}
+
+// ConfigHandler handles the change of config
+type ConfigHandler func(*ConfigChange)
+
+// ConfigWatcher watches a config file and reloads it on changes.
+// The file is re-parsed into a new value each time, with env templating, defaults and validation,
+// so values returned by Value are never modified. If the new content fails to load,
+// the last good value is kept.
+type ConfigWatcher struct {
+	file     string
+	typ      reflect.Type
+	value    interface{}
+	err      error
+	handlers []*configHandler
+	log      *log.Logger
+	tomb     utils.Tomb
+	mut      sync.RWMutex
+}
+
+type configHandler struct {
+	fn ConfigHandler
+}
+
+// NewConfigWatcher loads the file into cfg and starts to watch it.
+// The directory of the file is watched instead of the file itself,
+// in order to receive the updates of a mounted configuration, which are done by replacing symlinks.
+// The file is not watched if its directory is not found, and the config keeps the defaults.
+func NewConfigWatcher(cfg interface{}, file string, logger *log.Logger) (*ConfigWatcher, error) {
+	rv := reflect.ValueOf(cfg)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() {
+		return nil, errors.Trace(ErrConfigNotPointer)
+	}
+	if logger == nil {
+		logger = log.L()
+	}
+	file = filepath.Clean(file)
+	if utils.FileExists(file) {
+		if err := utils.LoadYAML(file, cfg); err != nil {
+			return nil, errors.Trace(err)
+		}
+	} else if err := utils.UnmarshalYAML(nil, cfg); err != nil {
+		return nil, errors.Trace(err)
+	}
+
+	w := &ConfigWatcher{
+		file:  file,
+		typ:   rv.Elem().Type(),
+		value: cfg,
+		log:   logger.With(log.Any("config", file)),
+	}
+	// the defaults are kept as LoadCustomConfig does
+	dir := filepath.Dir(file)
+	if !utils.DirExists(dir) {
+		w.log.Warn("config directory is not found, not to watch config file", log.Any("dir", dir))
+		return w, nil
+	}
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	if err = watcher.Add(dir); err != nil {
+		watcher.Close()
+		return nil, errors.Trace(err)
+	}
+	w.tomb.Go(func() error {
+		return w.watching(watcher)
+	})
+	return w, nil
+}
+
+// Value returns the current config
+func (w *ConfigWatcher) Value() interface{} {
+	w.mut.RLock()
+	defer w.mut.RUnlock()
+	return w.value
+}
+
+// Error returns the error of the last reload, nil if succeeded
+func (w *ConfigWatcher) Error() error {
+	w.mut.RLock()
+	defer w.mut.RUnlock()
+	return w.err
+}
+
+// Subscribe adds a handler called after config is changed, returns a function to unsubscribe.
+// Handlers are called in order of subscription in the watching goroutine.
+func (w *ConfigWatcher) Subscribe(fn ConfigHandler) func() {
+	h := &configHandler{fn: fn}
+	w.mut.Lock()
+	w.handlers = append(w.handlers, h)
+	w.mut.Unlock()
+	return func() {
+		w.mut.Lock()
+		defer w.mut.Unlock()
+		for i, v := range w.handlers {
+			if v == h {
+				w.handlers = append(w.handlers[:i:i], w.handlers[i+1:]...)
+				return
+			}
+		}
+	}
+}
+
+// Reload loads the file again, and notifies subscribers if config is changed
+func (w *ConfigWatcher) Reload() error {
+	cfg := reflect.New(w.typ).Interface()
+	err := utils.LoadYAML(w.file, cfg)
+
+	w.mut.Lock()
+	w.err = err
+	if err != nil {
+		w.mut.Unlock()
+		w.log.Warn("failed to reload config, to keep the last good one", log.Error(err))
+		return errors.Trace(err)
+	}
+	old := w.value
+	if reflect.DeepEqual(old, cfg) {
+		w.mut.Unlock()
+		w.log.Debug("config is not changed")
+		return nil
+	}
+	w.value = cfg
+	handlers := make([]*configHandler, len(w.handlers))
+	copy(handlers, w.handlers)
+	w.mut.Unlock()
+
+	change := &ConfigChange{Old: old, New: cfg, Fields: diffFields(old, cfg)}
+	w.log.Info("config is reloaded", log.Any("fields", change.Fields))
+	for _, h := range handlers {
+		h.fn(change)
+	}
+	return nil
+}
+
+// Close stops watching
+func (w *ConfigWatcher) Close() error {
+	w.tomb.Kill(nil)
+	return w.tomb.Wait()
+}
+
+func (w *ConfigWatcher) watching(watcher *fsnotify.Watcher) error {
+	defer watcher.Close()
+	w.log.Info("start to watch config file")
+	defer w.log.Info("stop to watch config file")
+
+	timer := time.NewTimer(configReloadDelay)
+	if !timer.Stop() {
+		<-timer.C
+	}
+	defer timer.Stop()
+
+	name := filepath.Base(w.file)
+	for {
+		select {
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return nil
+			}
+			w.log.Debug("received a file event", log.Any("eventName", event.Name), log.Any("eventOp", event.Op))
+			base := filepath.Base(event.Name)
+			// a mounted configuration is updated by replacing the symlink '..data'
+			if base != name && !strings.HasPrefix(base, "..") {
+				continue
+			}
+			timer.Reset(configReloadDelay)
+		case <-timer.C:
+			w.Reload()
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return nil
+			}
+			w.log.Warn("failed to watch config file", log.Error(err))
+		case <-w.tomb.Dying():
+			return nil
+		}
+	}
+}
+
+// diffFields returns the changed top-level fields of two configs of the same type
+func diffFields(old, new interface{}) []string {
+	ov, nv := reflect.Indirect(reflect.ValueOf(old)), reflect.Indirect(reflect.ValueOf(new))
+	var fields []string
+	switch nv.Kind() {
+	case reflect.Struct:
+		for i := 0; i < nv.NumField(); i++ {
+			f := nv.Type().Field(i)
+			if f.PkgPath != "" {
+				continue
+			}
+			if reflect.DeepEqual(ov.Field(i).Interface(), nv.Field(i).Interface()) {
+				continue
+			}
+			fields = append(fields, fieldName(f))
+		}
+	case reflect.Map:
+		keys := map[string]struct{}{}
+		for _, k := range ov.MapKeys() {
+			if nk := nv.MapIndex(k); !nk.IsValid() || !reflect.DeepEqual(ov.MapIndex(k).Interface(), nk.Interface()) {
+				keys[fmt.Sprint(k.Interface())] = struct{}{}
+			}
+		}
+		for _, k := range nv.MapKeys() {
+			if !ov.MapIndex(k).IsValid() {
+				keys[fmt.Sprint(k.Interface())] = struct{}{}
+			}
+		}
+		for k := range keys {
+			fields = append(fields, k)
+		}
+		sort.Strings(fields)
+	}
+	return fields
+}
+
+func fieldName(f reflect.StructField) string {
+	if tag := strings.Split(f.Tag.Get("yaml"), ",")[0]; tag != "" && tag != "-" {
+		return tag
+	}
+	return f.Name
+}
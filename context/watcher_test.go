@@ -0,0 +1,105 @@
+package context
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type watchedConfig struct {
+	Name    string        `yaml:"name" validate:"required"`
+	Timeout time.Duration `yaml:"timeout" default:"10s"`
+	Tags    []string      `yaml:"tags"`
+}
+
+func TestConfigWatcher(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "service.yml")
+	assert.NoError(t, ioutil.WriteFile(file, []byte("name: a\n"), 0644))
+
+	_, err := NewConfigWatcher(watchedConfig{}, file, nil)
+	assert.Equal(t, ErrConfigNotPointer, err)
+
+	var cfg watchedConfig
+	w, err := newContext("").WatchCustomConfig(&cfg, file)
+	assert.NoError(t, err)
+	defer w.Close()
+	assert.Equal(t, watchedConfig{Name: "a", Timeout: 10 * time.Second}, cfg)
+	assert.Equal(t, &cfg, w.Value())
+
+	changes := make(chan *ConfigChange, 10)
+	w.Subscribe(func(c *ConfigChange) {
+		changes <- c
+	})
+
+	os.Setenv("TEST_WATCHED_NAME", "b")
+	defer os.Unsetenv("TEST_WATCHED_NAME")
+	assert.NoError(t, ioutil.WriteFile(file, []byte("name: '{{.TEST_WATCHED_NAME}}'\ntags: [x]\n"), 0644))
+	select {
+	case c := <-changes:
+		assert.Equal(t, &watchedConfig{Name: "a", Timeout: 10 * time.Second}, c.Old)
+		assert.Equal(t, &watchedConfig{Name: "b", Timeout: 10 * time.Second, Tags: []string{"x"}}, c.New)
+		assert.Equal(t, []string{"name", "tags"}, c.Fields)
+	case <-time.After(5 * time.Second):
+		t.Fatal("no change is notified")
+	}
+	// the value loaded at first is not modified
+	assert.Equal(t, "a", cfg.Name)
+
+	// invalid config is rejected and the last good one is kept
+	assert.NoError(t, ioutil.WriteFile(file, []byte("timeout: 1s\n"), 0644))
+	assert.Error(t, w.Reload())
+	assert.Error(t, w.Error())
+	assert.Equal(t, "b", w.Value().(*watchedConfig).Name)
+
+	// no change
+	assert.NoError(t, ioutil.WriteFile(file, []byte("tags: [x]\nname: b\n"), 0644))
+	assert.NoError(t, w.Reload())
+	assert.NoError(t, w.Error())
+	assert.Len(t, changes, 0)
+
+	// the mounted configuration is updated by replacing the symlink
+	assert.NoError(t, os.MkdirAll(filepath.Join(dir, "v2"), 0755))
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, "v2", "service.yml"), []byte("name: c\ntags: [x]\ntimeout: 1s\n"), 0644))
+	assert.NoError(t, os.Symlink("v2", filepath.Join(dir, "..data_tmp")))
+	assert.NoError(t, os.Remove(file))
+	assert.NoError(t, os.Symlink(filepath.Join("..data", "service.yml"), file))
+	assert.NoError(t, os.Rename(filepath.Join(dir, "..data_tmp"), filepath.Join(dir, "..data")))
+	select {
+	case c := <-changes:
+		assert.Equal(t, "c", c.New.(*watchedConfig).Name)
+		assert.Equal(t, []string{"name", "timeout"}, c.Fields)
+	case <-time.After(5 * time.Second):
+		t.Fatal("no change is notified")
+	}
+}
+
+func TestConfigWatcherDirNotFound(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "none", "service.yml")
+	type config struct {
+		Timeout time.Duration `yaml:"timeout" default:"10s"`
+	}
+
+	// the defaults are kept as LoadCustomConfig does
+	var loaded config
+	c := newContext("")
+	assert.NoError(t, c.LoadCustomConfig(&loaded, file))
+	var cfg config
+	w, err := c.WatchCustomConfig(&cfg, file)
+	assert.NoError(t, err)
+	assert.Equal(t, loaded, cfg)
+	assert.Equal(t, &cfg, w.Value())
+	assert.NoError(t, w.Close())
+}
+
+func TestDiffFields(t *testing.T) {
+	assert.Equal(t, []string{"b", "c"}, diffFields(
+		&map[string]int{"a": 1, "b": 2},
+		&map[string]int{"a": 1, "b": 3, "c": 4},
+	))
+	assert.Nil(t, diffFields(&watchedConfig{Name: "a"}, &watchedConfig{Name: "a"}))
+}
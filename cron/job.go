@@ -0,0 +1,328 @@
+package cron
+
+import (
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/baetyl/baetyl-go/v2/errors"
+	v1 "github.com/baetyl/baetyl-go/v2/spec/v1"
+)
+
+const (
+	// maxCatchUp limits the number of missed runs started at once by the CatchUp policy
+	maxCatchUp = 100
+)
+
+var (
+	ErrJobConfigNil = errors.New("failed to create job scheduler, due to job config is nil")
+	ErrRunNotFound  = errors.New("failed to finish run, due to run not found")
+)
+
+// RunStatus status of a job run
+type RunStatus string
+
+const (
+	RunActive    RunStatus = "Active"
+	RunSucceeded RunStatus = "Succeeded"
+	RunFailed    RunStatus = "Failed"
+	RunSkipped   RunStatus = "Skipped"
+	RunReplaced  RunStatus = "Replaced"
+)
+
+// Run a single run of a job
+type Run struct {
+	ID            string    `json:"id,omitempty" yaml:"id,omitempty"`
+	ScheduledTime time.Time `json:"scheduledTime,omitempty" yaml:"scheduledTime,omitempty"`
+	StartTime     time.Time `json:"startTime,omitempty" yaml:"startTime,omitempty"`
+	FinishTime    time.Time `json:"finishTime,omitempty" yaml:"finishTime,omitempty"`
+	Status        RunStatus `json:"status,omitempty" yaml:"status,omitempty"`
+	Message       string    `json:"message,omitempty" yaml:"message,omitempty"`
+}
+
+// Decision result of evaluating the schedule
+type Decision struct {
+	// Start runs to start, the caller starts the job once for each of them
+	Start []*Run
+	// Replace active runs to stop before starting the new one, only for Replace concurrency policy
+	Replace []*Run
+	// Skipped runs which are due but not started
+	Skipped []*Run
+	// Next the next activation time, zero if the schedule never activates again.
+	// It is not after the evaluated time if there are missed runs left to catch up.
+	Next time.Time
+}
+
+// JobScheduler evaluates the schedule of an AppJobConfig and tracks its run history
+type JobScheduler struct {
+	cfg      v1.AppJobConfig
+	schedule Schedule
+	// last the latest scheduled time which has been evaluated
+	last    time.Time
+	history []*Run
+	lock    sync.Mutex
+}
+
+// NewJobScheduler creates a scheduler of the job config.
+// The last argument is the latest scheduled time handled before, such as Application.CronTime
+// restored from a report. If it is zero, the scheduler starts from now and no run is considered missed.
+// ErrEmptySpec is returned if the schedule is empty, such a job runs only once and is not scheduled.
+func NewJobScheduler(cfg *v1.AppJobConfig, last time.Time) (*JobScheduler, error) {
+	if cfg == nil {
+		return nil, ErrJobConfigNil
+	}
+	loc := time.Local
+	if cfg.TimeZone != "" {
+		var err error
+		loc, err = time.LoadLocation(cfg.TimeZone)
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+	}
+	s, err := ParseInLocation(cfg.Schedule, loc)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	switch cfg.MissedRunPolicy {
+	case "", v1.MissedRunSkip, v1.MissedRunOnce, v1.MissedRunCatchUp:
+	default:
+		return nil, errors.Errorf("failed to create job scheduler, due to unknown missed run policy (%s)", cfg.MissedRunPolicy)
+	}
+	switch cfg.ConcurrencyPolicy {
+	case "", v1.ConcurrencyAllow, v1.ConcurrencyForbid, v1.ConcurrencyReplace:
+	default:
+		return nil, errors.Errorf("failed to create job scheduler, due to unknown concurrency policy (%s)", cfg.ConcurrencyPolicy)
+	}
+	if last.IsZero() {
+		last = time.Now()
+	}
+	return &JobScheduler{
+		cfg:      *cfg,
+		schedule: s,
+		last:     last,
+	}, nil
+}
+
+// Next returns the next activation time after the latest evaluated time
+func (s *JobScheduler) Next() time.Time {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.schedule.Next(s.last)
+}
+
+// Evaluate computes the runs due at the given time according to the missed run and concurrency policies.
+// Runs to start are recorded as active in the history, the caller must report their outcome by Finish.
+//   - Skip starts the latest due run if it is within the starting deadline, the others are skipped
+//   - RunOnce starts the latest due run regardless of the starting deadline, the others are skipped
+//   - CatchUp starts the due runs in order, at most maxCatchUp runs at once, the rest are left to the next evaluation
+//
+// At most maxCatchUp missed runs are recorded as skipped, so that a long downtime of a frequent schedule
+// does not flood the history.
+func (s *JobScheduler) Evaluate(now time.Time) *Decision {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	d := &Decision{}
+	var starts []time.Time
+	switch s.cfg.MissedRunPolicy {
+	case v1.MissedRunCatchUp:
+		starts = s.due(s.last, now, maxCatchUp)
+		if len(starts) > 0 {
+			s.last = starts[len(starts)-1]
+		}
+	default:
+		latest := s.latest(s.last, now)
+		if latest.IsZero() {
+			break
+		}
+		for _, t := range s.due(s.last, latest.Add(-time.Nanosecond), maxCatchUp) {
+			d.Skipped = append(d.Skipped, s.record(t, now, RunSkipped, "missed"))
+		}
+		s.last = latest
+		deadline := time.Duration(s.cfg.StartingDeadlineSeconds) * time.Second
+		if s.cfg.MissedRunPolicy != v1.MissedRunOnce && deadline > 0 && now.Sub(latest) > deadline {
+			d.Skipped = append(d.Skipped, s.record(latest, now, RunSkipped, "missed starting deadline"))
+			break
+		}
+		starts = []time.Time{latest}
+	}
+	d.Next = s.schedule.Next(s.last)
+
+	// the runs due at once replace each other, only the latest one is started
+	if s.cfg.ConcurrencyPolicy == v1.ConcurrencyReplace && len(starts) > 1 {
+		for _, t := range starts[:len(starts)-1] {
+			d.Skipped = append(d.Skipped, s.record(t, now, RunSkipped, "replaced by a later run"))
+		}
+		starts = starts[len(starts)-1:]
+	}
+	for _, t := range starts {
+		active := s.active()
+		if len(active) > 0 {
+			switch s.cfg.ConcurrencyPolicy {
+			case v1.ConcurrencyForbid:
+				d.Skipped = append(d.Skipped, s.record(t, now, RunSkipped, "forbidden by concurrency policy"))
+				continue
+			case v1.ConcurrencyReplace:
+				for _, r := range active {
+					r.Status = RunReplaced
+					r.FinishTime = now
+					d.Replace = append(d.Replace, r)
+				}
+			}
+		}
+		d.Start = append(d.Start, s.record(t, now, RunActive, ""))
+	}
+	s.prune()
+	return d
+}
+
+// due returns the activation times in (after, until] in order, at most limit times
+func (s *JobScheduler) due(after, until time.Time, limit int) []time.Time {
+	var res []time.Time
+	for t := s.schedule.Next(after); !t.IsZero() && !t.After(until) && len(res) < limit; t = s.schedule.Next(t) {
+		res = append(res, t)
+	}
+	return res
+}
+
+// latest returns the latest activation time in (after, now], zero if there is none.
+// The window before now is doubled until an activation time is found, instead of walking through
+// all activation times since after, which are too many for a frequent schedule after a long downtime.
+func (s *JobScheduler) latest(after, now time.Time) time.Time {
+	if t := s.schedule.Next(after); t.IsZero() || t.After(now) {
+		return time.Time{}
+	}
+	for window := time.Second; ; window *= 2 {
+		from := now.Add(-window)
+		if from.Before(after) {
+			from = after
+		}
+		t := s.schedule.Next(from)
+		if t.IsZero() || t.After(now) {
+			continue
+		}
+		for n := s.schedule.Next(t); !n.IsZero() && !n.After(now); n = s.schedule.Next(n) {
+			t = n
+		}
+		return t
+	}
+}
+
+// Finish records the outcome of an active run
+func (s *JobScheduler) Finish(id string, finish time.Time, err error) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	for _, r := range s.history {
+		if r.ID != id {
+			continue
+		}
+		if r.Status != RunActive {
+			return nil
+		}
+		r.FinishTime = finish
+		r.Status = RunSucceeded
+		if err != nil {
+			r.Status = RunFailed
+			r.Message = err.Error()
+		}
+		s.prune()
+		return nil
+	}
+	return errors.Trace(ErrRunNotFound)
+}
+
+// Active returns the runs which are still active
+func (s *JobScheduler) Active() []Run {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	var res []Run
+	for _, r := range s.active() {
+		res = append(res, *r)
+	}
+	return res
+}
+
+// History returns all recorded runs, the oldest first
+func (s *JobScheduler) History() []Run {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	res := make([]Run, 0, len(s.history))
+	for _, r := range s.history {
+		res = append(res, *r)
+	}
+	return res
+}
+
+// UpdateStatus updates the cron status of the application.
+// The status is CronWait with CronTime set to the next activation time,
+// or CronFinished once the schedule never activates again and no run is active.
+func (s *JobScheduler) UpdateStatus(app *v1.Application) {
+	if app == nil {
+		return
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	next := s.schedule.Next(s.last)
+	if next.IsZero() {
+		if len(s.active()) == 0 {
+			app.CronStatus = v1.CronFinished
+		}
+		return
+	}
+	app.CronStatus = v1.CronWait
+	app.CronTime = next
+}
+
+func (s *JobScheduler) record(scheduled, now time.Time, status RunStatus, msg string) *Run {
+	r := &Run{
+		ID:            uuid.New().String(),
+		ScheduledTime: scheduled,
+		StartTime:     now,
+		Status:        status,
+		Message:       msg,
+	}
+	if status != RunActive {
+		r.StartTime = time.Time{}
+		r.FinishTime = now
+	}
+	s.history = append(s.history, r)
+	return r
+}
+
+func (s *JobScheduler) active() []*Run {
+	var res []*Run
+	for _, r := range s.history {
+		if r.Status == RunActive {
+			res = append(res, r)
+		}
+	}
+	return res
+}
+
+// prune drops the oldest finished runs beyond the history limit, active runs are always kept
+func (s *JobScheduler) prune() {
+	limit := s.cfg.HistoryLimit
+	if limit <= 0 {
+		return
+	}
+	finished := 0
+	for _, r := range s.history {
+		if r.Status != RunActive {
+			finished++
+		}
+	}
+	if finished <= limit {
+		return
+	}
+	drop := finished - limit
+	res := make([]*Run, 0, len(s.history)-drop)
+	for _, r := range s.history {
+		if drop > 0 && r.Status != RunActive {
+			drop--
+			continue
+		}
+		res = append(res, r)
+	}
+	s.history = res
+}
@@ -0,0 +1,238 @@
+package cron
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/baetyl/baetyl-go/v2/errors"
+	v1 "github.com/baetyl/baetyl-go/v2/spec/v1"
+)
+
+var base = time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+
+func TestNewJobScheduler(t *testing.T) {
+	_, err := NewJobScheduler(nil, base)
+	assert.Equal(t, ErrJobConfigNil, err)
+	_, err = NewJobScheduler(&v1.AppJobConfig{Schedule: "* * *"}, base)
+	assert.Error(t, err)
+	_, err = NewJobScheduler(&v1.AppJobConfig{Schedule: "* * * * *", TimeZone: "Unknown/Zone"}, base)
+	assert.Error(t, err)
+	_, err = NewJobScheduler(&v1.AppJobConfig{Schedule: "* * * * *", MissedRunPolicy: "unknown"}, base)
+	assert.Error(t, err)
+	_, err = NewJobScheduler(&v1.AppJobConfig{Schedule: "* * * * *", ConcurrencyPolicy: "unknown"}, base)
+	assert.Error(t, err)
+
+	s, err := NewJobScheduler(&v1.AppJobConfig{Schedule: "0 8 * * *", TimeZone: "Asia/Shanghai"}, base)
+	assert.NoError(t, err)
+	assert.Equal(t, time.Date(2021, 1, 2, 0, 0, 0, 0, time.UTC).Unix(), s.Next().Unix())
+}
+
+func TestJobSchedulerMissedRuns(t *testing.T) {
+	now := base.Add(time.Hour + 30*time.Second)
+
+	// skip without deadline, only the latest run is started
+	s, err := NewJobScheduler(&v1.AppJobConfig{Schedule: "*/10 * * * *", MissedRunPolicy: v1.MissedRunSkip}, base)
+	assert.NoError(t, err)
+	d := s.Evaluate(now)
+	assert.Len(t, d.Start, 1)
+	assert.Equal(t, base.Add(time.Hour), d.Start[0].ScheduledTime)
+	assert.Len(t, d.Skipped, 5)
+	assert.Equal(t, base.Add(70*time.Minute), d.Next)
+
+	// skip with deadline, runs older than the deadline are skipped
+	s, err = NewJobScheduler(&v1.AppJobConfig{Schedule: "*/10 * * * *", StartingDeadlineSeconds: 10}, base)
+	assert.NoError(t, err)
+	d = s.Evaluate(now)
+	assert.Len(t, d.Start, 0)
+	assert.Len(t, d.Skipped, 6)
+
+	// run once
+	s, err = NewJobScheduler(&v1.AppJobConfig{Schedule: "*/10 * * * *", MissedRunPolicy: v1.MissedRunOnce, StartingDeadlineSeconds: 10}, base)
+	assert.NoError(t, err)
+	d = s.Evaluate(now)
+	assert.Len(t, d.Start, 1)
+	assert.Len(t, d.Skipped, 5)
+
+	// catch up
+	s, err = NewJobScheduler(&v1.AppJobConfig{Schedule: "*/10 * * * *", MissedRunPolicy: v1.MissedRunCatchUp}, base)
+	assert.NoError(t, err)
+	d = s.Evaluate(now)
+	assert.Len(t, d.Start, 6)
+	assert.Len(t, d.Skipped, 0)
+	assert.Len(t, s.Active(), 6)
+
+	// evaluated runs are not due again
+	d = s.Evaluate(now)
+	assert.Len(t, d.Start, 0)
+}
+
+func TestJobSchedulerLongDowntime(t *testing.T) {
+	// a frequent schedule after a year of downtime, the missed runs are not walked through one by one
+	now := base.AddDate(1, 0, 0).Add(500 * time.Millisecond)
+
+	// skip with the default deadline starts the latest run only
+	s, err := NewJobScheduler(&v1.AppJobConfig{Schedule: "@every 1s", StartingDeadlineSeconds: 60}, base)
+	assert.NoError(t, err)
+	d := s.Evaluate(now)
+	assert.Len(t, d.Start, 1)
+	assert.Equal(t, base.AddDate(1, 0, 0), d.Start[0].ScheduledTime)
+	assert.Len(t, d.Skipped, maxCatchUp)
+	assert.Equal(t, base.AddDate(1, 0, 0).Add(time.Second), d.Next)
+
+	// run once
+	s, err = NewJobScheduler(&v1.AppJobConfig{Schedule: "@every 1s", MissedRunPolicy: v1.MissedRunOnce}, base)
+	assert.NoError(t, err)
+	d = s.Evaluate(now)
+	assert.Len(t, d.Start, 1)
+	assert.Equal(t, base.AddDate(1, 0, 0), d.Start[0].ScheduledTime)
+
+	// catch up starts the oldest runs at most maxCatchUp at once, the rest are due immediately
+	s, err = NewJobScheduler(&v1.AppJobConfig{Schedule: "@every 1s", MissedRunPolicy: v1.MissedRunCatchUp}, base)
+	assert.NoError(t, err)
+	d = s.Evaluate(now)
+	assert.Len(t, d.Start, maxCatchUp)
+	assert.Equal(t, base.Add(time.Second), d.Start[0].ScheduledTime)
+	assert.Equal(t, base.Add(maxCatchUp*time.Second), d.Start[maxCatchUp-1].ScheduledTime)
+	assert.False(t, d.Next.After(now))
+	d = s.Evaluate(now)
+	assert.Len(t, d.Start, maxCatchUp)
+	assert.Equal(t, base.Add((maxCatchUp+1)*time.Second), d.Start[0].ScheduledTime)
+}
+
+func TestJobSchedulerSkipDeadline(t *testing.T) {
+	// several missed runs within the deadline, only the latest is started
+	s, err := NewJobScheduler(&v1.AppJobConfig{Schedule: "@every 10s", StartingDeadlineSeconds: 60}, base)
+	assert.NoError(t, err)
+	d := s.Evaluate(base.Add(55 * time.Second))
+	assert.Len(t, d.Start, 1)
+	assert.Equal(t, base.Add(50*time.Second), d.Start[0].ScheduledTime)
+	assert.Len(t, d.Skipped, 4)
+	for _, r := range d.Skipped {
+		assert.Equal(t, RunSkipped, r.Status)
+		assert.Equal(t, "missed", r.Message)
+	}
+
+	// nothing due
+	d = s.Evaluate(base.Add(55 * time.Second))
+	assert.Len(t, d.Start, 0)
+	assert.Len(t, d.Skipped, 0)
+	assert.Equal(t, base.Add(60*time.Second), d.Next)
+
+	// the latest run is out of the deadline
+	s, err = NewJobScheduler(&v1.AppJobConfig{Schedule: "@every 10s", StartingDeadlineSeconds: 5}, base)
+	assert.NoError(t, err)
+	d = s.Evaluate(base.Add(58 * time.Second))
+	assert.Len(t, d.Start, 0)
+	assert.Len(t, d.Skipped, 5)
+	assert.Equal(t, base.Add(50*time.Second), d.Skipped[4].ScheduledTime)
+	assert.Equal(t, "missed starting deadline", d.Skipped[4].Message)
+}
+func TestJobSchedulerCatchUpConcurrency(t *testing.T) {
+	cfg := &v1.AppJobConfig{Schedule: "*/10 * * * *", MissedRunPolicy: v1.MissedRunCatchUp, ConcurrencyPolicy: v1.ConcurrencyReplace}
+	s, err := NewJobScheduler(cfg, base)
+	assert.NoError(t, err)
+	d := s.Evaluate(base.Add(10 * time.Minute))
+	assert.Len(t, d.Start, 1)
+	first := d.Start[0]
+
+	// the runs due at once do not replace each other, the latest one replaces the active run
+	d = s.Evaluate(base.Add(40 * time.Minute))
+	assert.Len(t, d.Start, 1)
+	assert.Equal(t, base.Add(40*time.Minute), d.Start[0].ScheduledTime)
+	assert.Len(t, d.Skipped, 2)
+	assert.Equal(t, "replaced by a later run", d.Skipped[0].Message)
+	assert.Len(t, d.Replace, 1)
+	assert.Equal(t, first.ID, d.Replace[0].ID)
+	for _, r := range d.Replace {
+		assert.NotEqual(t, d.Start[0].ID, r.ID)
+	}
+	assert.Len(t, s.Active(), 1)
+
+	// forbid starts the oldest run, the others are skipped
+	cfg.ConcurrencyPolicy = v1.ConcurrencyForbid
+	s, err = NewJobScheduler(cfg, base)
+	assert.NoError(t, err)
+	d = s.Evaluate(base.Add(30 * time.Minute))
+	assert.Len(t, d.Start, 1)
+	assert.Equal(t, base.Add(10*time.Minute), d.Start[0].ScheduledTime)
+	assert.Len(t, d.Skipped, 2)
+	assert.Len(t, d.Replace, 0)
+
+	// allow starts all
+	cfg.ConcurrencyPolicy = v1.ConcurrencyAllow
+	s, err = NewJobScheduler(cfg, base)
+	assert.NoError(t, err)
+	d = s.Evaluate(base.Add(30 * time.Minute))
+	assert.Len(t, d.Start, 3)
+	assert.Len(t, s.Active(), 3)
+}
+
+func TestJobSchedulerConcurrency(t *testing.T) {
+	cfg := &v1.AppJobConfig{Schedule: "* * * * *", ConcurrencyPolicy: v1.ConcurrencyForbid}
+	s, err := NewJobScheduler(cfg, base)
+	assert.NoError(t, err)
+	d := s.Evaluate(base.Add(time.Minute))
+	assert.Len(t, d.Start, 1)
+	first := d.Start[0]
+	d = s.Evaluate(base.Add(2 * time.Minute))
+	assert.Len(t, d.Start, 0)
+	assert.Len(t, d.Skipped, 1)
+	assert.NoError(t, s.Finish(first.ID, base.Add(2*time.Minute), nil))
+	d = s.Evaluate(base.Add(3 * time.Minute))
+	assert.Len(t, d.Start, 1)
+
+	cfg.ConcurrencyPolicy = v1.ConcurrencyReplace
+	s, err = NewJobScheduler(cfg, base)
+	assert.NoError(t, err)
+	d = s.Evaluate(base.Add(time.Minute))
+	first = d.Start[0]
+	d = s.Evaluate(base.Add(2 * time.Minute))
+	assert.Len(t, d.Start, 1)
+	assert.Len(t, d.Replace, 1)
+	assert.Equal(t, first.ID, d.Replace[0].ID)
+	assert.Equal(t, RunReplaced, d.Replace[0].Status)
+	assert.Len(t, s.Active(), 1)
+
+	cfg.ConcurrencyPolicy = v1.ConcurrencyAllow
+	s, err = NewJobScheduler(cfg, base)
+	assert.NoError(t, err)
+	s.Evaluate(base.Add(time.Minute))
+	s.Evaluate(base.Add(2 * time.Minute))
+	assert.Len(t, s.Active(), 2)
+}
+
+func TestJobSchedulerHistory(t *testing.T) {
+	s, err := NewJobScheduler(&v1.AppJobConfig{Schedule: "* * * * *", HistoryLimit: 2}, base)
+	assert.NoError(t, err)
+	for i := 1; i <= 4; i++ {
+		now := base.Add(time.Duration(i) * time.Minute)
+		d := s.Evaluate(now)
+		assert.Len(t, d.Start, 1)
+		var e error
+		if i%2 == 0 {
+			e = errors.New("exit 1")
+		}
+		assert.NoError(t, s.Finish(d.Start[0].ID, now.Add(time.Second), e))
+	}
+	h := s.History()
+	assert.Len(t, h, 2)
+	assert.Equal(t, RunSucceeded, h[0].Status)
+	assert.Equal(t, base.Add(3*time.Minute), h[0].ScheduledTime)
+	assert.Equal(t, RunFailed, h[1].Status)
+	assert.Equal(t, "exit 1", h[1].Message)
+
+	err = s.Finish("unknown", base, nil)
+	assert.Error(t, err)
+
+	app := &v1.Application{}
+	s.UpdateStatus(app)
+	assert.Equal(t, v1.CronWait, app.CronStatus)
+	assert.Equal(t, base.Add(5*time.Minute), app.CronTime)
+
+	s, err = NewJobScheduler(&v1.AppJobConfig{Schedule: "0 0 30 2 *"}, base)
+	assert.NoError(t, err)
+	s.UpdateStatus(app)
+	assert.Equal(t, v1.CronFinished, app.CronStatus)
+}
@@ -0,0 +1,230 @@
+package cron
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/baetyl/baetyl-go/v2/errors"
+)
+
+const (
+	prefixTimeZone  = "TZ="
+	prefixCronZone  = "CRON_TZ="
+	descriptorEvery = "@every "
+)
+
+var (
+	ErrEmptySpec = errors.New("failed to parse cron expression, due to empty spec")
+)
+
+type bounds struct {
+	min, max uint
+	names    map[string]uint
+}
+
+var (
+	seconds = bounds{0, 59, nil}
+	minutes = bounds{0, 59, nil}
+	hours   = bounds{0, 23, nil}
+	doms    = bounds{1, 31, nil}
+	months  = bounds{1, 12, map[string]uint{
+		"jan": 1, "feb": 2, "mar": 3, "apr": 4, "may": 5, "jun": 6,
+		"jul": 7, "aug": 8, "sep": 9, "oct": 10, "nov": 11, "dec": 12,
+	}}
+	// 7 is accepted as sunday as well
+	dows = bounds{0, 7, map[string]uint{
+		"sun": 0, "mon": 1, "tue": 2, "wed": 3, "thu": 4, "fri": 5, "sat": 6,
+	}}
+)
+
+var descriptors = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+// Parse parses a cron expression in local time zone, see ParseInLocation
+func Parse(spec string) (Schedule, error) {
+	return ParseInLocation(spec, time.Local)
+}
+
+// ParseInLocation parses a cron expression, the schedule is evaluated in the given location.
+// Standard 5-field expressions (minute hour dom month dow) and 6-field expressions with a leading
+// second field are supported, as well as descriptors such as @daily and @every <duration>.
+// A "CRON_TZ=" or "TZ=" prefix overrides the given location.
+func ParseInLocation(spec string, loc *time.Location) (Schedule, error) {
+	spec = strings.TrimSpace(spec)
+	if spec == "" {
+		return nil, ErrEmptySpec
+	}
+
+	if strings.HasPrefix(spec, prefixTimeZone) || strings.HasPrefix(spec, prefixCronZone) {
+		i := strings.Index(spec, " ")
+		if i < 0 {
+			return nil, errors.Errorf("failed to parse cron expression (%s), due to missing fields", spec)
+		}
+		name := spec[strings.Index(spec, "=")+1 : i]
+		var err error
+		loc, err = time.LoadLocation(name)
+		if err != nil {
+			return nil, errors.Errorf("failed to parse cron expression (%s), due to invalid time zone: %s", spec, err.Error())
+		}
+		spec = strings.TrimSpace(spec[i:])
+	}
+	if loc == nil {
+		loc = time.Local
+	}
+
+	if strings.HasPrefix(spec, "@") {
+		if strings.HasPrefix(spec, descriptorEvery) {
+			d, err := time.ParseDuration(strings.TrimSpace(spec[len(descriptorEvery):]))
+			if err != nil {
+				return nil, errors.Errorf("failed to parse cron expression (%s): %s", spec, err.Error())
+			}
+			if d < time.Second {
+				return nil, errors.Errorf("failed to parse cron expression (%s), due to duration less than one second", spec)
+			}
+			return &delaySchedule{delay: d}, nil
+		}
+		expanded, ok := descriptors[strings.ToLower(spec)]
+		if !ok {
+			return nil, errors.Errorf("failed to parse cron expression (%s), due to unknown descriptor", spec)
+		}
+		spec = expanded
+	}
+
+	fields := strings.Fields(spec)
+	switch len(fields) {
+	case 5:
+		fields = append([]string{"0"}, fields...)
+	case 6:
+	default:
+		return nil, errors.Errorf("failed to parse cron expression (%s), due to expected 5 or 6 fields but found %d", spec, len(fields))
+	}
+
+	s := &specSchedule{location: loc}
+	var err error
+	if s.second, err = parseField(fields[0], seconds); err != nil {
+		return nil, errors.Trace(err)
+	}
+	if s.minute, err = parseField(fields[1], minutes); err != nil {
+		return nil, errors.Trace(err)
+	}
+	if s.hour, err = parseField(fields[2], hours); err != nil {
+		return nil, errors.Trace(err)
+	}
+	if s.dom, err = parseField(fields[3], doms); err != nil {
+		return nil, errors.Trace(err)
+	}
+	if s.month, err = parseField(fields[4], months); err != nil {
+		return nil, errors.Trace(err)
+	}
+	if s.dow, err = parseField(fields[5], dows); err != nil {
+		return nil, errors.Trace(err)
+	}
+	// fold sunday written as 7 into 0
+	if s.dow&(1<<7) > 0 {
+		s.dow = s.dow&^(1<<7) | 1
+	}
+	s.domStar = isStar(fields[3])
+	s.dowStar = isStar(fields[5])
+	return s, nil
+}
+
+// parseField parses a comma separated list of ranges into a bit set
+func parseField(field string, b bounds) (uint64, error) {
+	var bits uint64
+	for _, expr := range strings.Split(field, ",") {
+		r, err := parseRange(expr, b)
+		if err != nil {
+			return 0, errors.Trace(err)
+		}
+		bits |= r
+	}
+	return bits, nil
+}
+
+// parseRange parses an expression of the form: number | name | * | ? | start-end, optionally followed by /step
+func parseRange(expr string, b bounds) (uint64, error) {
+	var start, end, step uint
+	rangeAndStep := strings.Split(expr, "/")
+	lowAndHigh := strings.Split(rangeAndStep[0], "-")
+	singleDigit := len(lowAndHigh) == 1
+
+	if lowAndHigh[0] == "*" || lowAndHigh[0] == "?" {
+		if !singleDigit {
+			return 0, errors.Errorf("failed to parse cron field (%s), due to invalid range", expr)
+		}
+		start, end = b.min, b.max
+	} else {
+		var err error
+		start, err = parseValue(lowAndHigh[0], b)
+		if err != nil {
+			return 0, errors.Trace(err)
+		}
+		switch len(lowAndHigh) {
+		case 1:
+			end = start
+		case 2:
+			end, err = parseValue(lowAndHigh[1], b)
+			if err != nil {
+				return 0, errors.Trace(err)
+			}
+		default:
+			return 0, errors.Errorf("failed to parse cron field (%s), due to too many hyphens", expr)
+		}
+	}
+
+	switch len(rangeAndStep) {
+	case 1:
+		step = 1
+	case 2:
+		n, err := strconv.ParseUint(rangeAndStep[1], 10, 32)
+		if err != nil || n == 0 {
+			return 0, errors.Errorf("failed to parse cron field (%s), due to invalid step", expr)
+		}
+		step = uint(n)
+		// "N/step" means "N-max/step"
+		if singleDigit && lowAndHigh[0] != "*" && lowAndHigh[0] != "?" {
+			end = b.max
+		}
+	default:
+		return 0, errors.Errorf("failed to parse cron field (%s), due to too many slashes", expr)
+	}
+
+	if start < b.min || end > b.max {
+		return 0, errors.Errorf("failed to parse cron field (%s), due to value out of range [%d, %d]", expr, b.min, b.max)
+	}
+	if start > end {
+		return 0, errors.Errorf("failed to parse cron field (%s), due to start beyond end", expr)
+	}
+
+	var bits uint64
+	for i := start; i <= end; i += step {
+		bits |= 1 << i
+	}
+	return bits, nil
+}
+
+func parseValue(v string, b bounds) (uint, error) {
+	if b.names != nil {
+		if n, ok := b.names[strings.ToLower(v)]; ok {
+			return n, nil
+		}
+	}
+	n, err := strconv.ParseUint(v, 10, 32)
+	if err != nil {
+		return 0, errors.Errorf("failed to parse cron field value (%s), due to not a number", v)
+	}
+	return uint(n), nil
+}
+
+// isStar reports whether a day field is unrestricted, "*/2" counts as unrestricted as in vixie cron
+func isStar(field string) bool {
+	return strings.HasPrefix(field, "*") || strings.HasPrefix(field, "?")
+}
@@ -0,0 +1,80 @@
+package cron
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		spec string
+		from string
+		next string
+	}{
+		{"* * * * *", "2021-01-01T00:00:00Z", "2021-01-01T00:01:00Z"},
+		{"*/15 * * * *", "2021-01-01T00:07:00Z", "2021-01-01T00:15:00Z"},
+		{"30 8 * * mon-fri", "2021-01-01T09:00:00Z", "2021-01-04T08:30:00Z"},
+		{"0 0 1 jan *", "2021-01-01T00:00:00Z", "2022-01-01T00:00:00Z"},
+		{"0 0 29 2 *", "2021-01-01T00:00:00Z", "2024-02-29T00:00:00Z"},
+		{"0 0 13 * 5", "2021-01-01T00:00:00Z", "2021-01-08T00:00:00Z"},
+		{"0 0 * * 7", "2021-01-01T00:00:00Z", "2021-01-03T00:00:00Z"},
+		{"5 1,2 * * *", "2021-01-01T01:05:00Z", "2021-01-01T02:05:00Z"},
+		{"10/20 * * * * *", "2021-01-01T00:00:00Z", "2021-01-01T00:00:10Z"},
+		{"@daily", "2021-01-01T12:00:00Z", "2021-01-02T00:00:00Z"},
+		{"@hourly", "2021-01-01T12:00:00Z", "2021-01-01T13:00:00Z"},
+		{"@every 10m", "2021-01-01T12:03:00Z", "2021-01-01T12:10:00Z"},
+		{"CRON_TZ=Asia/Shanghai 0 8 * * *", "2021-01-01T00:00:00Z", "2021-01-02T00:00:00Z"},
+		{"0 0 30 2 *", "2021-01-01T00:00:00Z", "0001-01-01T00:00:00Z"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.spec, func(t *testing.T) {
+			s, err := ParseInLocation(tt.spec, time.UTC)
+			assert.NoError(t, err)
+			from, _ := time.Parse(time.RFC3339, tt.from)
+			expect, _ := time.Parse(time.RFC3339, tt.next)
+			assert.True(t, expect.Equal(s.Next(from)), "expect %s, actual %s", expect, s.Next(from))
+		})
+	}
+}
+
+func TestParseInvalid(t *testing.T) {
+	specs := []string{
+		"",
+		"* * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * * 13 *",
+		"* * * * 8",
+		"5-1 * * * *",
+		"*/0 * * * *",
+		"a * * * *",
+		"1-2-3 * * * *",
+		"@unknown",
+		"@every 1ms",
+		"TZ=Unknown/Zone * * * * *",
+	}
+	for _, spec := range specs {
+		_, err := Parse(spec)
+		assert.Error(t, err, spec)
+	}
+}
+
+func TestScheduleTimeZone(t *testing.T) {
+	loc, err := time.LoadLocation("America/New_York")
+	assert.NoError(t, err)
+	s, err := ParseInLocation("0 2 * * *", loc)
+	assert.NoError(t, err)
+
+	// 2021-03-14 02:00 does not exist in New York, the next run is on the following day
+	from := time.Date(2021, 3, 13, 3, 0, 0, 0, loc)
+	assert.Equal(t, time.Date(2021, 3, 15, 2, 0, 0, 0, loc).Unix(), s.Next(from).Unix())
+
+	// result keeps the location of the given time
+	from = time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	next := s.Next(from)
+	assert.Equal(t, time.UTC, next.Location())
+	assert.Equal(t, time.Date(2021, 1, 1, 7, 0, 0, 0, time.UTC), next)
+}
@@ -0,0 +1,129 @@
+package cron
+
+import (
+	"time"
+)
+
+// Schedule describes the activation times of a job
+type Schedule interface {
+	// Next returns the next activation time later than the given time.
+	// A zero time is returned if no activation time can be found.
+	Next(time.Time) time.Time
+}
+
+// specSchedule schedule parsed from a cron expression, each field is a bit set of the allowed values
+type specSchedule struct {
+	second, minute, hour, dom, month, dow uint64
+	// domStar and dowStar record whether day of month and day of week are unrestricted
+	domStar, dowStar bool
+	location         *time.Location
+}
+
+// Next returns the next time matching the schedule.
+// The search gives up after five years, which only happens for impossible expressions such as "0 0 30 2 *".
+func (s *specSchedule) Next(t time.Time) time.Time {
+	orig := t.Location()
+	loc := s.location
+	if loc == nil {
+		loc = orig
+	}
+	t = t.In(loc)
+
+	// start at the earliest possible time, the upcoming second
+	t = t.Add(time.Second - time.Duration(t.Nanosecond())*time.Nanosecond)
+
+	// whether a field has been incremented, lower fields are reset to their minimum once this happens
+	added := false
+	yearLimit := t.Year() + 5
+
+WRAP:
+	if t.Year() > yearLimit {
+		return time.Time{}
+	}
+
+	for 1<<uint(t.Month())&s.month == 0 {
+		if !added {
+			added = true
+			t = time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, loc)
+		}
+		t = t.AddDate(0, 1, 0)
+		if t.Month() == time.January {
+			goto WRAP
+		}
+	}
+
+	for !s.dayMatches(t) {
+		if !added {
+			added = true
+			t = time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, loc)
+		}
+		t = t.AddDate(0, 0, 1)
+		// midnight may be skipped by a daylight saving transition
+		if h := t.Hour(); h != 0 {
+			if h > 12 {
+				t = t.Add(time.Duration(24-h) * time.Hour)
+			} else {
+				t = t.Add(time.Duration(-h) * time.Hour)
+			}
+		}
+		if t.Day() == 1 {
+			goto WRAP
+		}
+	}
+
+	for 1<<uint(t.Hour())&s.hour == 0 {
+		if !added {
+			added = true
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), 0, 0, 0, loc)
+		}
+		t = t.Add(time.Hour)
+		if t.Hour() == 0 {
+			goto WRAP
+		}
+	}
+
+	for 1<<uint(t.Minute())&s.minute == 0 {
+		if !added {
+			added = true
+			t = t.Truncate(time.Minute)
+		}
+		t = t.Add(time.Minute)
+		if t.Minute() == 0 {
+			goto WRAP
+		}
+	}
+
+	for 1<<uint(t.Second())&s.second == 0 {
+		if !added {
+			added = true
+			t = t.Truncate(time.Second)
+		}
+		t = t.Add(time.Second)
+		if t.Second() == 0 {
+			goto WRAP
+		}
+	}
+
+	return t.In(orig)
+}
+
+// dayMatches follows the behavior of vixie cron,
+// if either day of month or day of week is unrestricted both must match, otherwise either matches
+func (s *specSchedule) dayMatches(t time.Time) bool {
+	domMatch := 1<<uint(t.Day())&s.dom > 0
+	dowMatch := 1<<uint(t.Weekday())&s.dow > 0
+	if s.domStar || s.dowStar {
+		return domMatch && dowMatch
+	}
+	return domMatch || dowMatch
+}
+
+// delaySchedule schedule which activates once every fixed duration
+type delaySchedule struct {
+	delay time.Duration
+}
+
+// Next returns the next time aligned to the delay
+func (s *delaySchedule) Next(t time.Time) time.Time {
+	return t.Truncate(s.delay).Add(s.delay)
+}
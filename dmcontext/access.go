@@ -6,6 +6,9 @@ import (
 	"github.com/baetyl/baetyl-go/v2/errors"
 )
 
+// DefaultPollInterval the interval to poll the device whose access config has no interval
+const DefaultPollInterval = 10 * time.Second
+
 var (
 	ErrUnknownPropertyID     = errors.New("unknown property id")
 	ErrConfigIDNotExist      = errors.New("config id not exist")
@@ -140,6 +143,29 @@ func (a *AccessConfig) UnmarshalYAML(unmarshal func(any) error) error {
 	return nil
 }
 
+// Interval returns the interval to poll the device, DefaultPollInterval is returned if not set
+func (a *AccessConfig) Interval() time.Duration {
+	var d time.Duration
+	switch {
+	case a == nil:
+	case a.Modbus != nil:
+		d = a.Modbus.Interval
+	case a.Opcua != nil:
+		d = a.Opcua.Interval
+	case a.Opcda != nil:
+		// the interval of opcda is in seconds
+		d = time.Duration(a.Opcda.Interval) * time.Second
+	case a.Bacnet != nil:
+		d = a.Bacnet.Interval
+	case a.IEC104 != nil:
+		d = a.IEC104.Interval
+	}
+	if d <= 0 {
+		return DefaultPollInterval
+	}
+	return d
+}
+
 func GetMappingName(id string, template *AccessTemplate) (string, error) {
 	var name string
 
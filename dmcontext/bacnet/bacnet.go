@@ -0,0 +1,153 @@
+// Package bacnet implements a BACnet/IP client to access the properties of objects by dmcontext.BacnetVisitor,
+// with ReadProperty, ReadPropertyMultiple, WriteProperty and Who-Is/I-Am discovery.
+// Only devices on the local network are supported, without segmentation.
+package bacnet
+
+import (
+	"fmt"
+
+	"github.com/baetyl/baetyl-go/v2/errors"
+)
+
+// DefaultPort the default udp port of BACnet/IP
+const DefaultPort = 0xBAC0
+
+// The object types used
+const (
+	ObjectAnalogInput      uint16 = 0
+	ObjectAnalogOutput     uint16 = 1
+	ObjectAnalogValue      uint16 = 2
+	ObjectBinaryInput      uint16 = 3
+	ObjectBinaryOutput     uint16 = 4
+	ObjectBinaryValue      uint16 = 5
+	ObjectDevice           uint16 = 8
+	ObjectMultiStateInput  uint16 = 13
+	ObjectMultiStateOutput uint16 = 14
+	ObjectMultiStateValue  uint16 = 19
+	maxObjectType                 = 0x3FF
+	maxObjectInstance             = 0x3FFFFF
+	propertyArrayIndexNone        = 0xFFFFFFFF
+)
+
+// The property identifiers used
+const (
+	PropertyObjectIdentifier uint32 = 75
+	PropertyObjectName       uint32 = 77
+	PropertyObjectType       uint32 = 79
+	PropertyPresentValue     uint32 = 85
+	PropertyStatusFlags      uint32 = 111
+	PropertyUnits            uint32 = 117
+)
+
+// The application tag numbers of primitive values
+const (
+	TagNull            byte = 0
+	TagBoolean         byte = 1
+	TagUnsigned        byte = 2
+	TagSigned          byte = 3
+	TagReal            byte = 4
+	TagDouble          byte = 5
+	TagOctetString     byte = 6
+	TagCharacterString byte = 7
+	TagBitString       byte = 8
+	TagEnumerated      byte = 9
+	TagDate            byte = 10
+	TagTime            byte = 11
+	TagObjectID        byte = 12
+)
+
+// The pdu types of apdu
+const (
+	pduConfirmedRequest   byte = 0x00
+	pduUnconfirmedRequest byte = 0x10
+	pduSimpleAck          byte = 0x20
+	pduComplexAck         byte = 0x30
+	pduSegmentAck         byte = 0x40
+	pduError              byte = 0x50
+	pduReject             byte = 0x60
+	pduAbort              byte = 0x70
+)
+
+// The services used
+const (
+	serviceReadProperty         byte = 12
+	serviceReadPropertyMultiple byte = 14
+	serviceWriteProperty        byte = 15
+	serviceIAm                  byte = 0
+	serviceWhoIs                byte = 8
+)
+
+// The error classes and codes used
+const (
+	ErrorClassObject           uint32 = 1
+	ErrorClassProperty         uint32 = 2
+	ErrorClassServices         uint32 = 5
+	ErrorCodeInvalidDataType   uint32 = 9
+	ErrorCodeUnknownObject     uint32 = 31
+	ErrorCodeUnknownProperty   uint32 = 32
+	ErrorCodeWriteAccessDenied uint32 = 40
+	ErrorCodeValueOutOfRange   uint32 = 37
+)
+
+// The reject and abort reasons used
+const (
+	RejectUnrecognizedService     byte = 9
+	AbortSegmentationNotSupported byte = 4
+)
+
+var (
+	ErrInvalidMessage           = errors.New("invalid bacnet message")
+	ErrInvalidAddress           = errors.New("invalid bacnet address")
+	ErrAccessConfigInvalid      = errors.New("bacnet access config is invalid")
+	ErrTypeNotSupported         = errors.New("bacnet application tag not supported")
+	ErrSegmentationNotSupported = errors.New("bacnet segmentation not supported")
+	ErrClientClosed             = errors.New("bacnet client is closed")
+	ErrTimeout                  = errors.New("bacnet request timeout")
+	ErrDeviceNotFound           = errors.New("bacnet device not found")
+)
+
+// ObjectID the identifier of an object
+type ObjectID struct {
+	Type     uint16
+	Instance uint32
+}
+
+func (o ObjectID) String() string {
+	return fmt.Sprintf("%d:%d", o.Type, o.Instance)
+}
+
+func (o ObjectID) encode() uint32 {
+	return uint32(o.Type)<<22 | o.Instance&maxObjectInstance
+}
+
+func decodeObjectID(v uint32) ObjectID {
+	return ObjectID{Type: uint16(v >> 22), Instance: v & maxObjectInstance}
+}
+
+// Error the error responded by the device with error class and code
+type Error struct {
+	Class uint32
+	Code  uint32
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("bacnet error class %d code %d", e.Class, e.Code)
+}
+
+// RejectError the request is rejected by the device with the reason
+type RejectError struct {
+	Reason byte
+}
+
+func (e *RejectError) Error() string {
+	return fmt.Sprintf("bacnet request rejected with reason %d", e.Reason)
+}
+
+// AbortError the request is aborted by the device with the reason
+type AbortError struct {
+	Reason byte
+}
+
+func (e *AbortError) Error() string {
+	return fmt.Sprintf("bacnet request aborted with reason %d", e.Reason)
+}
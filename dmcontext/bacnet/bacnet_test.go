@@ -0,0 +1,424 @@
+package bacnet
+
+import (
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/baetyl/baetyl-go/v2/dmcontext"
+	"github.com/baetyl/baetyl-go/v2/dmcontext/dmcontexttest"
+	"github.com/baetyl/baetyl-go/v2/errors"
+)
+
+var (
+	analogInput  = ObjectID{Type: ObjectAnalogInput, Instance: 1}
+	analogOutput = ObjectID{Type: ObjectAnalogOutput, Instance: 2}
+	binaryValue  = ObjectID{Type: ObjectBinaryValue, Instance: 3}
+	multiState   = ObjectID{Type: ObjectMultiStateValue, Instance: 4}
+)
+
+func TestCodec(t *testing.T) {
+	cases := []struct {
+		tag   byte
+		value any
+	}{
+		{TagNull, nil},
+		{TagBoolean, true},
+		{TagBoolean, false},
+		{TagUnsigned, uint64(0)},
+		{TagUnsigned, uint64(0x1FFFF)},
+		{TagUnsigned, uint64(1<<64 - 1)},
+		{TagSigned, int64(-1)},
+		{TagSigned, int64(-129)},
+		{TagSigned, int64(0x7FFFFF)},
+		{TagReal, float32(-25.5)},
+		{TagDouble, 1e100},
+		{TagOctetString, []byte{1, 2, 3, 4, 5, 6}},
+		{TagCharacterString, "温度"},
+		{TagCharacterString, strings.Repeat("x", 300)},
+		{TagBitString, []bool{true, false, false, true, true, false, false, false, true}},
+		{TagEnumerated, uint32(1)},
+		{TagObjectID, ObjectID{Type: ObjectDevice, Instance: maxObjectInstance}},
+	}
+	for _, c := range cases {
+		var e encoder
+		assert.NoError(t, e.value(c.tag, c.value), c.value)
+		d := &decoder{buf: e.buf}
+		tag, v := d.value()
+		assert.NoError(t, d.err)
+		assert.True(t, d.empty())
+		assert.Equal(t, c.tag, tag)
+		assert.Equal(t, c.value, v)
+	}
+
+	var e encoder
+	assert.Error(t, e.value(TagReal, 1.5))
+	assert.Equal(t, ErrTypeNotSupported, errors.Cause(e.value(TagDate, nil)))
+	e.unsigned(TagUnsigned, false, 3)
+	assert.Equal(t, []byte{0x21, 0x03}, e.buf)
+	e = encoder{}
+	e.objectID(0, true, ObjectID{Type: ObjectAnalogInput, Instance: 1})
+	e.opening(3)
+	e.closing(3)
+	assert.Equal(t, []byte{0x0C, 0x00, 0x00, 0x00, 0x01, 0x3E, 0x3F}, e.buf)
+
+	// the values in a list are decoded as a slice
+	e = encoder{}
+	e.opening(3)
+	assert.NoError(t, e.value(TagUnsigned, uint64(1)))
+	assert.NoError(t, e.value(TagReal, float32(2)))
+	e.closing(3)
+	d := &decoder{buf: e.buf}
+	d.opening(3)
+	assert.Equal(t, []any{uint64(1), float32(2)}, d.values(3))
+	assert.NoError(t, d.err)
+
+	for _, b := range [][]byte{{0x21}, {0x44, 0x00}, {0x75, 0x02}, {0x91}, {0x82, 0x08, 0x00}} {
+		d := &decoder{buf: b}
+		d.value()
+		assert.Error(t, d.err, b)
+	}
+	d = &decoder{buf: []byte{0x73, 0x04, 'a', 'b'}}
+	d.value()
+	assert.Equal(t, ErrTypeNotSupported, errors.Cause(d.err))
+}
+
+func TestFrame(t *testing.T) {
+	a := confirmedRequest(7, serviceReadProperty, []byte{1, 2})
+	frame := encodeFrame(false, true, a)
+	assert.Equal(t, []byte{0x81, 0x0A, 0x00, 0x0C, 0x01, 0x04, 0x00, 0x05, 0x07, 0x0C, 0x01, 0x02}, frame)
+	res, err := decodeFrame(frame)
+	assert.NoError(t, err)
+	assert.Equal(t, &apdu{typ: pduConfirmedRequest, invokeID: 7, service: serviceReadProperty, data: []byte{1, 2}}, res)
+
+	// the forwarded npdu with a source network
+	frame = []byte{0x81, 0x04, 0x00, 0x14, 192, 168, 1, 2, 0xBA, 0xC0, 0x01, 0x08, 0x00, 0x02, 0x01, 0x09, 0x20, 0x05, 0x0C, 0x01}
+	res, err = decodeFrame(frame)
+	assert.NoError(t, err)
+	assert.Equal(t, &apdu{typ: pduSimpleAck, invokeID: 5, service: serviceReadProperty, data: []byte{0x01}}, res)
+
+	// the network layer message is ignored
+	res, err = decodeFrame([]byte{0x81, 0x0B, 0x00, 0x07, 0x01, 0x80, 0x00})
+	assert.NoError(t, err)
+	assert.Nil(t, res)
+
+	for _, b := range [][]byte{
+		{0x81, 0x0A, 0x00},
+		{0x82, 0x0A, 0x00, 0x06, 0x01, 0x00},
+		{0x81, 0x0A, 0x00, 0x07, 0x01, 0x00},
+		{0x81, 0x0A, 0x00, 0x06, 0x02, 0x00},
+		{0x81, 0x0A, 0x00, 0x08, 0x01, 0x00, 0x30, 0x01},
+		{0x81, 0x0A, 0x00, 0x08, 0x01, 0x20, 0x00, 0x01},
+	} {
+		_, err := decodeFrame(b)
+		assert.Equal(t, ErrInvalidMessage, errors.Cause(err), b)
+	}
+
+	assert.Equal(t, &Error{Class: ErrorClassObject, Code: ErrorCodeUnknownObject},
+		decodeError(errorPDU(1, serviceReadProperty, ErrorClassObject, ErrorCodeUnknownObject)[3:]))
+	assert.Equal(t, "bacnet error class 1 code 31", (&Error{Class: 1, Code: 31}).Error())
+	assert.Equal(t, "0:1", analogInput.String())
+	assert.Equal(t, analogInput, decodeObjectID(analogInput.encode()))
+}
+
+func newDevice(t *testing.T) *simulator {
+	sim := startSimulator(t, 1234)
+	sim.SetProperty(analogInput, PropertyPresentValue, TagReal, float32(25.5))
+	sim.SetProperty(analogInput, PropertyObjectName, TagCharacterString, "temp")
+	sim.SetProperty(analogInput, PropertyStatusFlags, TagBitString, []bool{false, false, false, false})
+	sim.SetProperty(analogOutput, PropertyPresentValue, TagReal, float32(0))
+	sim.SetProperty(binaryValue, PropertyPresentValue, TagEnumerated, uint32(1))
+	sim.SetProperty(multiState, PropertyPresentValue, TagUnsigned, uint64(2))
+	return sim
+}
+
+func newClient(t *testing.T, sim *simulator) *Client {
+	cli, err := NewClient(&dmcontext.BacnetAccessConfig{DeviceID: 1234, Address: "127.0.0.1", Port: sim.Port()})
+	assert.NoError(t, err)
+	cli.timeout = 200 * time.Millisecond
+	return cli
+}
+
+func TestClient(t *testing.T) {
+	sim := newDevice(t)
+
+	_, err := NewClient(nil)
+	assert.Equal(t, ErrAccessConfigInvalid, errors.Cause(err))
+	_, err = NewClient(&dmcontext.BacnetAccessConfig{DeviceID: maxObjectInstance + 1})
+	assert.Equal(t, ErrAccessConfigInvalid, errors.Cause(err))
+	_, err = NewClient(&dmcontext.BacnetAccessConfig{Port: 70000})
+	assert.Equal(t, ErrInvalidAddress, errors.Cause(err))
+
+	cli := newClient(t, sim)
+	defer cli.Close()
+	_, err = cli.ReadProperty(analogInput, PropertyPresentValue)
+	assert.Equal(t, ErrClientClosed, errors.Cause(err))
+	assert.NoError(t, cli.Connect())
+	assert.NoError(t, cli.Connect())
+	assert.True(t, cli.Connected())
+
+	v, err := cli.ReadProperty(analogInput, PropertyPresentValue)
+	assert.NoError(t, err)
+	assert.Equal(t, float32(25.5), v)
+	v, err = cli.ReadProperty(analogInput, PropertyStatusFlags)
+	assert.NoError(t, err)
+	assert.Equal(t, []bool{false, false, false, false}, v)
+	v, err = cli.ReadProperty(ObjectID{Type: ObjectDevice, Instance: 1234}, PropertyObjectName)
+	assert.NoError(t, err)
+	assert.Equal(t, "simulator", v)
+	_, err = cli.ReadProperty(ObjectID{Type: ObjectAnalogInput, Instance: 99}, PropertyPresentValue)
+	assert.Equal(t, &Error{Class: ErrorClassObject, Code: ErrorCodeUnknownObject}, errors.Cause(err))
+	_, err = cli.ReadProperty(analogInput, PropertyUnits)
+	assert.Equal(t, &Error{Class: ErrorClassProperty, Code: ErrorCodeUnknownProperty}, errors.Cause(err))
+
+	results, err := cli.ReadPropertyMultiple([]PropertyRef{
+		{Object: analogInput, Property: PropertyPresentValue},
+		{Object: analogInput, Property: PropertyObjectName},
+		{Object: analogInput, Property: PropertyUnits},
+		{Object: binaryValue, Property: PropertyPresentValue},
+		{Object: ObjectID{Type: ObjectBinaryValue, Instance: 99}, Property: PropertyPresentValue},
+		{Object: multiState, Property: PropertyPresentValue},
+	})
+	assert.NoError(t, err)
+	assert.Len(t, results, 6)
+	assert.Equal(t, float32(25.5), results[0].Value)
+	assert.Equal(t, "temp", results[1].Value)
+	assert.Equal(t, &Error{Class: ErrorClassProperty, Code: ErrorCodeUnknownProperty}, results[2].Err)
+	assert.Equal(t, uint32(1), results[3].Value)
+	assert.Equal(t, &Error{Class: ErrorClassObject, Code: ErrorCodeUnknownObject}, results[4].Err)
+	assert.Equal(t, uint64(2), results[5].Value)
+	assert.Nil(t, results[5].Err)
+
+	assert.NoError(t, cli.WriteProperty(analogOutput, PropertyPresentValue, TagReal, float32(12.5), 8))
+	assert.Equal(t, float32(12.5), sim.Property(analogOutput, PropertyPresentValue))
+	err = cli.WriteProperty(analogOutput, PropertyPresentValue, TagUnsigned, uint64(1), 0)
+	assert.Equal(t, &Error{Class: ErrorClassProperty, Code: ErrorCodeInvalidDataType}, errors.Cause(err))
+	err = cli.WriteProperty(analogOutput, PropertyUnits, TagEnumerated, uint32(62), 0)
+	assert.Equal(t, &Error{Class: ErrorClassProperty, Code: ErrorCodeUnknownProperty}, errors.Cause(err))
+	device := ObjectID{Type: ObjectDevice, Instance: 1234}
+	err = cli.WriteProperty(device, PropertyObjectIdentifier, TagObjectID, device, 0)
+	assert.Equal(t, &Error{Class: ErrorClassProperty, Code: ErrorCodeWriteAccessDenied}, errors.Cause(err))
+	assert.Error(t, cli.WriteProperty(analogOutput, PropertyPresentValue, TagReal, 1.5, 0))
+
+	// the response exceeding the max apdu is aborted since segmentation is not supported
+	sim.SetProperty(analogInput, PropertyObjectName, TagCharacterString, strings.Repeat("x", maxAPDULength))
+	_, err = cli.ReadProperty(analogInput, PropertyObjectName)
+	assert.Equal(t, &AbortError{Reason: AbortSegmentationNotSupported}, errors.Cause(err))
+
+	// the device not supporting ReadPropertyMultiple rejects it
+	sim.mut.Lock()
+	sim.noRPM = true
+	sim.mut.Unlock()
+	_, err = cli.ReadPropertyMultiple([]PropertyRef{{Object: analogInput, Property: PropertyPresentValue}})
+	assert.Equal(t, &RejectError{Reason: RejectUnrecognizedService}, errors.Cause(err))
+
+	assert.NoError(t, cli.Close())
+	assert.False(t, cli.Connected())
+	assert.NoError(t, cli.Close())
+	_, err = cli.ReadProperty(analogInput, PropertyPresentValue)
+	assert.Equal(t, ErrClientClosed, errors.Cause(err))
+
+	// reconnect
+	assert.NoError(t, cli.Connect())
+	v, err = cli.ReadProperty(analogOutput, PropertyPresentValue)
+	assert.NoError(t, err)
+	assert.Equal(t, float32(12.5), v)
+}
+
+func TestClientDiscovery(t *testing.T) {
+	sim := newDevice(t)
+
+	newDiscoveryClient := func(deviceID uint32) *Client {
+		cli, err := NewClient(&dmcontext.BacnetAccessConfig{DeviceID: deviceID})
+		assert.NoError(t, err)
+		cli.timeout = 200 * time.Millisecond
+		cli.broadcast = sim.Addr()
+		return cli
+	}
+	cli := newDiscoveryClient(1234)
+	defer cli.Close()
+	assert.NoError(t, cli.Connect())
+	v, err := cli.ReadProperty(analogInput, PropertyPresentValue)
+	assert.NoError(t, err)
+	assert.Equal(t, float32(25.5), v)
+
+	devices, err := cli.WhoIs(0, maxObjectInstance)
+	assert.NoError(t, err)
+	assert.Len(t, devices, 1)
+	assert.Equal(t, uint32(1234), devices[0].Instance)
+	assert.Equal(t, uint32(maxAPDULength), devices[0].MaxAPDU)
+	assert.Equal(t, uint32(segmentationNone), devices[0].Segmentation)
+	assert.Equal(t, sim.Port(), devices[0].Address.Port)
+	devices, err = cli.WhoIs(0, 1000)
+	assert.NoError(t, err)
+	assert.Empty(t, devices)
+
+	other := newDiscoveryClient(4321)
+	defer other.Close()
+	assert.Equal(t, ErrDeviceNotFound, errors.Cause(other.Connect()))
+	assert.False(t, other.Connected())
+}
+
+func TestClientTimeout(t *testing.T) {
+	// the udp socket never responding
+	conn, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	assert.NoError(t, err)
+	defer conn.Close()
+	received := make(chan struct{}, 10)
+	go func() {
+		buf := make([]byte, maxDatagramSize)
+		for {
+			if _, _, err := conn.ReadFromUDP(buf); err != nil {
+				return
+			}
+			received <- struct{}{}
+		}
+	}()
+
+	cli, err := NewClient(&dmcontext.BacnetAccessConfig{Address: "127.0.0.1", Port: conn.LocalAddr().(*net.UDPAddr).Port})
+	assert.NoError(t, err)
+	defer cli.Close()
+	cli.timeout = 50 * time.Millisecond
+	assert.NoError(t, cli.Connect())
+	_, err = cli.ReadProperty(analogInput, PropertyPresentValue)
+	assert.Equal(t, ErrTimeout, errors.Cause(err))
+	// the request is sent once and retried twice
+	assert.Len(t, received, DefaultRetries+1)
+}
+
+func TestValue(t *testing.T) {
+	for _, c := range []struct {
+		typ   string
+		value any
+		res   any
+	}{
+		{"", uint32(1), uint32(1)},
+		{dmcontext.TypeFloat32, float32(1.5), float32(1.5)},
+		{dmcontext.TypeFloat64, float32(1.5), 1.5},
+		{dmcontext.TypeBool, uint32(1), true},
+		{dmcontext.TypeBool, uint32(0), false},
+		{dmcontext.TypeBool, true, true},
+		{dmcontext.TypeInt32, uint64(2), int32(2)},
+		{dmcontext.TypeString, "temp", "temp"},
+		{dmcontext.TypeString, analogInput, "0:1"},
+	} {
+		res, err := ToValue(c.typ, c.value)
+		assert.NoError(t, err, c.value)
+		assert.Equal(t, c.res, res, c.value)
+	}
+
+	for _, c := range []struct {
+		tag   byte
+		value any
+		res   any
+	}{
+		{TagNull, 1, nil},
+		{TagBoolean, "true", true},
+		{TagUnsigned, 3, uint64(3)},
+		{TagSigned, "-3", int64(-3)},
+		{TagReal, 12.5, float32(12.5)},
+		{TagDouble, float32(1.5), 1.5},
+		{TagCharacterString, 12, "12"},
+		{TagEnumerated, true, uint32(1)},
+		{TagEnumerated, false, uint32(0)},
+		{TagEnumerated, 2, uint32(2)},
+	} {
+		res, err := FromValue(c.tag, c.value)
+		assert.NoError(t, err, c.value)
+		assert.Equal(t, c.res, res, c.value)
+	}
+	_, err := FromValue(TagReal, "x")
+	assert.Error(t, err)
+	_, err = FromValue(TagDate, "2023-01-01")
+	assert.Equal(t, ErrTypeNotSupported, errors.Cause(err))
+
+	assert.Equal(t, TagReal, DefaultTag(ObjectAnalogValue))
+	assert.Equal(t, TagEnumerated, DefaultTag(ObjectBinaryOutput))
+	assert.Equal(t, TagUnsigned, DefaultTag(ObjectMultiStateInput))
+	assert.Equal(t, TagNull, DefaultTag(ObjectDevice))
+}
+
+func TestDriver(t *testing.T) {
+	sim := newDevice(t)
+
+	ctx := dmcontexttest.NewContext(t)
+	visitor := func(objectType uint16, address uint, valueType string, tag byte) dmcontext.PropertyVisitor {
+		return dmcontext.PropertyVisitor{Bacnet: &dmcontext.BacnetVisitor{
+			Type:                 valueType,
+			BacnetType:           uint(objectType),
+			BacnetAddress:        address,
+			ApplicationTagNumber: tag,
+		}}
+	}
+	err := ctx.SetDriverConfig("bacnet", dmcontexttest.DriverConfig{
+		Devices: []dmcontext.DeviceInfo{{
+			Name:           "dev1",
+			AccessTemplate: "tpl1",
+			AccessConfig: &dmcontext.AccessConfig{Bacnet: &dmcontext.BacnetAccessConfig{
+				DeviceID:      1234,
+				Address:       "127.0.0.1",
+				Port:          sim.Port(),
+				AddressOffset: 1,
+			}},
+		}},
+		AccessTemplates: map[string]dmcontext.AccessTemplate{
+			"tpl1": {Properties: []dmcontext.DeviceProperty{
+				{ID: "1", Name: "temp", Type: dmcontext.TypeFloat32, Visitor: visitor(ObjectAnalogInput, 0, dmcontext.TypeFloat32, 0)},
+				{ID: "2", Name: "target", Type: dmcontext.TypeFloat64, Visitor: visitor(ObjectAnalogOutput, 1, dmcontext.TypeFloat64, TagReal)},
+				{ID: "3", Name: "switch", Type: dmcontext.TypeBool, Visitor: visitor(ObjectBinaryValue, 2, dmcontext.TypeBool, 0)},
+				{ID: "4", Name: "mode", Type: dmcontext.TypeInt32, Visitor: visitor(ObjectMultiStateValue, 3, "", 0)},
+				{ID: "5", Name: "missing", Type: dmcontext.TypeFloat32, Visitor: visitor(ObjectAnalogInput, 98, dmcontext.TypeFloat32, 0)},
+				{ID: "6", Name: "invalid", Type: dmcontext.TypeFloat32, Visitor: visitor(maxObjectType+1, 0, dmcontext.TypeFloat32, 0)},
+				{ID: "7", Name: "device", Type: dmcontext.TypeString, Visitor: visitor(ObjectDevice, 1233, dmcontext.TypeString, 0)},
+			}},
+		},
+	})
+	assert.NoError(t, err)
+	dev, err := ctx.GetDevice("bacnet", "dev1")
+	assert.NoError(t, err)
+	tpl, err := ctx.GetAccessTemplates("bacnet", "tpl1")
+	assert.NoError(t, err)
+	expected := map[string]any{
+		"1": float32(25.5),
+		"2": float64(0),
+		"3": true,
+		"4": uint64(2),
+	}
+
+	d := NewDriver(ctx, "bacnet")
+	_, err = d.Read(dev, tpl.Properties)
+	assert.Equal(t, ErrClientClosed, errors.Cause(err))
+	assert.NoError(t, d.Connect(dev))
+	values, err := d.Read(dev, tpl.Properties)
+	assert.NoError(t, err)
+	assert.Equal(t, expected, values)
+
+	assert.NoError(t, d.Write(dev, map[string]any{"2": 12.5, "3": false, "4": "3"}))
+	assert.Equal(t, float32(12.5), sim.Property(analogOutput, PropertyPresentValue))
+	assert.Equal(t, uint32(0), sim.Property(binaryValue, PropertyPresentValue))
+	assert.Equal(t, uint64(3), sim.Property(multiState, PropertyPresentValue))
+	expected["2"], expected["3"], expected["4"] = 12.5, false, uint64(3)
+
+	// the device not supporting ReadPropertyMultiple is read by ReadProperty
+	sim.mut.Lock()
+	sim.noRPM = true
+	sim.mut.Unlock()
+	values, err = d.Read(dev, tpl.Properties)
+	assert.NoError(t, err)
+	assert.Equal(t, expected, values)
+	d.mut.Lock()
+	assert.True(t, d.devices["dev1"].single)
+	d.mut.Unlock()
+
+	assert.Equal(t, dmcontext.ErrUnknownPropertyID, errors.Cause(d.Write(dev, map[string]any{"8": 1})))
+	assert.Error(t, d.Write(dev, map[string]any{"6": 1}))
+	assert.EqualError(t, d.Write(dev, map[string]any{"7": "dev"}), "bacnet application tag number of object (8:1234) is not set")
+	err = d.Write(dev, map[string]any{"5": 1})
+	assert.Equal(t, &Error{Class: ErrorClassObject, Code: ErrorCodeUnknownObject}, errors.Cause(err))
+
+	assert.NoError(t, d.Close(dev))
+	assert.NoError(t, d.Close(dev))
+}
@@ -0,0 +1,500 @@
+package bacnet
+
+import (
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/baetyl/baetyl-go/v2/dmcontext"
+	"github.com/baetyl/baetyl-go/v2/errors"
+)
+
+const (
+	// DefaultTimeout the default timeout of a request to be responded
+	DefaultTimeout = 3 * time.Second
+	// DefaultRetries the default number of retries of a request which is timeout
+	DefaultRetries = 2
+	// maxDatagramSize the max size of udp datagram received
+	maxDatagramSize = 1 << 11
+	// segmentationNone the segmentation supported of no-segmentation
+	segmentationNone = 3
+)
+
+// Client the BACnet/IP client of a device, which is safe for concurrent use.
+// The device is discovered by Who-Is if the address is not configured.
+type Client struct {
+	deviceID uint32
+	// address the address of device configured, nil to discover
+	address   *net.UDPAddr
+	broadcast *net.UDPAddr
+	timeout   time.Duration
+	retries   int
+
+	conn     *net.UDPConn
+	device   *net.UDPAddr
+	invokeID byte
+	pending  map[byte]chan *apdu
+	// discovering the channels receiving the devices announced by I-Am
+	discovering map[chan Device]struct{}
+	done        chan struct{}
+	err         error
+	wg          sync.WaitGroup
+	// mut protects the states of connection, cmut serializes connecting and closing
+	mut  sync.Mutex
+	cmut sync.Mutex
+}
+
+// Device the device announced by I-Am
+type Device struct {
+	Instance     uint32
+	Address      *net.UDPAddr
+	MaxAPDU      uint32
+	Segmentation uint32
+	VendorID     uint32
+}
+
+// PropertyRef the reference to a property of object
+type PropertyRef struct {
+	Object   ObjectID
+	Property uint32
+}
+
+// PropertyResult the result of a property read by ReadPropertyMultiple, the value is nil if failed
+type PropertyResult struct {
+	PropertyRef
+	Value any
+	Err   error
+}
+
+// NewClient creates a new client by the bacnet access config
+func NewClient(cfg *dmcontext.BacnetAccessConfig) (*Client, error) {
+	if cfg == nil || cfg.DeviceID > maxObjectInstance {
+		return nil, errors.Trace(ErrAccessConfigInvalid)
+	}
+	port := cfg.Port
+	if port == 0 {
+		port = DefaultPort
+	}
+	if port < 0 || port > 0xFFFF {
+		return nil, errors.Trace(ErrInvalidAddress)
+	}
+	c := &Client{
+		deviceID:    cfg.DeviceID,
+		broadcast:   &net.UDPAddr{IP: net.IPv4bcast, Port: port},
+		timeout:     DefaultTimeout,
+		retries:     DefaultRetries,
+		pending:     map[byte]chan *apdu{},
+		discovering: map[chan Device]struct{}{},
+	}
+	if cfg.Address != "" {
+		addr, err := net.ResolveUDPAddr("udp4", net.JoinHostPort(cfg.Address, strconv.Itoa(port)))
+		if err != nil {
+			return nil, errors.Trace(ErrInvalidAddress)
+		}
+		c.address = addr
+	}
+	return c, nil
+}
+
+// Connected returns whether the client is connected
+func (c *Client) Connected() bool {
+	c.mut.Lock()
+	defer c.mut.Unlock()
+	return c.connected()
+}
+
+func (c *Client) connected() bool {
+	if c.conn == nil {
+		return false
+	}
+	select {
+	case <-c.done:
+		return false
+	default:
+		return true
+	}
+}
+
+// Connect opens the udp socket if not connected, and discovers the device if its address is not configured
+func (c *Client) Connect() error {
+	c.cmut.Lock()
+	defer c.cmut.Unlock()
+	if c.Connected() {
+		return nil
+	}
+	c.closeConn()
+
+	conn, err := net.ListenUDP("udp4", &net.UDPAddr{})
+	if err != nil {
+		return errors.Trace(err)
+	}
+	done := make(chan struct{})
+	c.mut.Lock()
+	c.conn, c.done, c.err, c.device = conn, done, nil, c.address
+	c.mut.Unlock()
+	c.wg.Add(1)
+	go c.reading(conn, done)
+
+	if c.address != nil {
+		return nil
+	}
+	devices, err := c.WhoIs(c.deviceID, c.deviceID)
+	if err == nil && len(devices) == 0 {
+		err = ErrDeviceNotFound
+	}
+	if err != nil {
+		c.closeConn()
+		return errors.Trace(err)
+	}
+	c.mut.Lock()
+	c.device = devices[0].Address
+	c.mut.Unlock()
+	return nil
+}
+
+// Close closes the udp socket
+func (c *Client) Close() error {
+	c.cmut.Lock()
+	defer c.cmut.Unlock()
+	c.closeConn()
+	return nil
+}
+
+func (c *Client) closeConn() {
+	c.mut.Lock()
+	if c.conn == nil {
+		c.mut.Unlock()
+		return
+	}
+	select {
+	case <-c.done:
+	default:
+		c.err = ErrClientClosed
+		close(c.done)
+	}
+	c.conn.Close()
+	c.mut.Unlock()
+	c.wg.Wait()
+	c.mut.Lock()
+	c.conn = nil
+	c.mut.Unlock()
+}
+
+func (c *Client) lastErr() error {
+	c.mut.Lock()
+	defer c.mut.Unlock()
+	if c.err != nil {
+		return c.err
+	}
+	return ErrClientClosed
+}
+
+func (c *Client) reading(conn *net.UDPConn, done chan struct{}) {
+	defer c.wg.Done()
+	buf := make([]byte, maxDatagramSize)
+	for {
+		n, addr, err := conn.ReadFromUDP(buf)
+		if err != nil {
+			c.mut.Lock()
+			select {
+			case <-done:
+			default:
+				c.err = err
+				close(done)
+			}
+			c.mut.Unlock()
+			return
+		}
+		// the invalid message is ignored, since anyone is able to send to the socket
+		a, err := decodeFrame(append([]byte{}, buf[:n]...))
+		if err != nil || a == nil {
+			continue
+		}
+		switch a.typ {
+		case pduUnconfirmedRequest:
+			if a.service == serviceIAm {
+				c.announced(a, addr)
+			}
+		case pduSimpleAck, pduComplexAck, pduError, pduReject, pduAbort:
+			c.mut.Lock()
+			ch, ok := c.pending[a.invokeID]
+			if ok && c.device != nil && c.device.IP.Equal(addr.IP) && c.device.Port == addr.Port {
+				delete(c.pending, a.invokeID)
+				ch <- a
+			}
+			c.mut.Unlock()
+		}
+	}
+}
+
+// announced passes the device announced by I-Am to the discovering
+func (c *Client) announced(a *apdu, addr *net.UDPAddr) {
+	d := &decoder{buf: a.data}
+	_, id := d.value()
+	_, maxAPDU := d.value()
+	_, segmentation := d.value()
+	_, vendorID := d.value()
+	if d.err != nil {
+		return
+	}
+	obj, ok := id.(ObjectID)
+	if !ok || obj.Type != ObjectDevice {
+		return
+	}
+	dev := Device{Instance: obj.Instance, Address: addr}
+	if v, ok := maxAPDU.(uint64); ok {
+		dev.MaxAPDU = uint32(v)
+	}
+	if v, ok := segmentation.(uint32); ok {
+		dev.Segmentation = v
+	}
+	if v, ok := vendorID.(uint64); ok {
+		dev.VendorID = uint32(v)
+	}
+	c.mut.Lock()
+	defer c.mut.Unlock()
+	for ch := range c.discovering {
+		select {
+		case ch <- dev:
+		default:
+		}
+	}
+}
+
+// WhoIs sends Who-Is with the range of device instances, to the address of device if configured,
+// otherwise to the local broadcast address. It collects the devices announced by I-Am until timeout,
+// or returns once the device is found if the range is a single instance.
+func (c *Client) WhoIs(low, high uint32) ([]Device, error) {
+	ch := make(chan Device, 16)
+	c.mut.Lock()
+	if !c.connected() {
+		c.mut.Unlock()
+		return nil, errors.Trace(ErrClientClosed)
+	}
+	c.discovering[ch] = struct{}{}
+	conn, done := c.conn, c.done
+	target := c.address
+	if target == nil {
+		target = c.broadcast
+	}
+	c.mut.Unlock()
+	defer func() {
+		c.mut.Lock()
+		delete(c.discovering, ch)
+		c.mut.Unlock()
+	}()
+
+	var e encoder
+	e.unsigned(0, true, uint64(low))
+	e.unsigned(1, true, uint64(high))
+	msg := encodeFrame(target.IP.Equal(net.IPv4bcast), false, unconfirmedRequest(serviceWhoIs, e.buf))
+	if _, err := conn.WriteToUDP(msg, target); err != nil {
+		return nil, errors.Trace(err)
+	}
+	var res []Device
+	found := map[uint32]bool{}
+	timer := time.NewTimer(c.timeout)
+	defer timer.Stop()
+	for {
+		select {
+		case dev := <-ch:
+			if dev.Instance < low || dev.Instance > high || found[dev.Instance] {
+				continue
+			}
+			found[dev.Instance] = true
+			res = append(res, dev)
+			if low == high {
+				return res, nil
+			}
+		case <-done:
+			return nil, errors.Trace(c.lastErr())
+		case <-timer.C:
+			return res, nil
+		}
+	}
+}
+
+// request sends a confirmed request to the device, and retries if timeout
+func (c *Client) request(service byte, data []byte) (*apdu, error) {
+	c.mut.Lock()
+	if !c.connected() {
+		c.mut.Unlock()
+		return nil, errors.Trace(ErrClientClosed)
+	}
+	if len(c.pending) > 0xFF {
+		c.mut.Unlock()
+		return nil, errors.New("bacnet too many pending requests")
+	}
+	id := c.invokeID
+	for {
+		if _, ok := c.pending[id]; !ok {
+			break
+		}
+		id++
+	}
+	c.invokeID = id + 1
+	ch := make(chan *apdu, 1)
+	c.pending[id] = ch
+	conn, device, done := c.conn, c.device, c.done
+	c.mut.Unlock()
+	defer func() {
+		c.mut.Lock()
+		delete(c.pending, id)
+		c.mut.Unlock()
+	}()
+
+	msg := encodeFrame(false, true, confirmedRequest(id, service, data))
+	if len(msg) > maxAPDULength+bvlcHeaderLength+2 {
+		return nil, errors.Trace(ErrSegmentationNotSupported)
+	}
+	timer := time.NewTimer(c.timeout)
+	defer timer.Stop()
+	for i := 0; i <= c.retries; i++ {
+		if _, err := conn.WriteToUDP(msg, device); err != nil {
+			return nil, errors.Trace(err)
+		}
+		if i > 0 {
+			timer.Reset(c.timeout)
+		}
+		select {
+		case a := <-ch:
+			return checkResponse(a, service)
+		case <-done:
+			return nil, errors.Trace(c.lastErr())
+		case <-timer.C:
+		}
+	}
+	return nil, errors.Trace(ErrTimeout)
+}
+
+// checkResponse returns the error of the response if it is not an acknowledgement of the service
+func checkResponse(a *apdu, service byte) (*apdu, error) {
+	switch a.typ {
+	case pduSimpleAck, pduComplexAck:
+		if a.service != service {
+			return nil, errors.Trace(ErrInvalidMessage)
+		}
+		if a.flags&segmented != 0 {
+			return nil, errors.Trace(ErrSegmentationNotSupported)
+		}
+		return a, nil
+	case pduError:
+		return nil, errors.Trace(decodeError(a.data))
+	case pduReject:
+		return nil, errors.Trace(&RejectError{Reason: a.reason})
+	case pduAbort:
+		return nil, errors.Trace(&AbortError{Reason: a.reason})
+	}
+	return nil, errors.Trace(ErrInvalidMessage)
+}
+
+// ReadProperty reads the property of object, the value is a slice if the property is a list
+func (c *Client) ReadProperty(obj ObjectID, prop uint32) (any, error) {
+	var e encoder
+	e.objectID(0, true, obj)
+	e.unsigned(1, true, uint64(prop))
+	a, err := c.request(serviceReadProperty, e.buf)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	if a.typ != pduComplexAck {
+		return nil, errors.Trace(ErrInvalidMessage)
+	}
+	d := &decoder{buf: a.data}
+	d.contextObjectID(0)
+	d.contextUnsigned(1)
+	d.optionalUnsigned(2)
+	d.opening(3)
+	v := d.values(3)
+	if d.err != nil {
+		return nil, errors.Trace(d.err)
+	}
+	return v, nil
+}
+
+// ReadPropertyMultiple reads the properties in one request, returns the results in the order of refs.
+// The error of a property is returned in its result.
+func (c *Client) ReadPropertyMultiple(refs []PropertyRef) ([]PropertyResult, error) {
+	if len(refs) == 0 {
+		return nil, nil
+	}
+	var e encoder
+	for i, ref := range refs {
+		if i == 0 || ref.Object != refs[i-1].Object {
+			if i > 0 {
+				e.closing(1)
+			}
+			e.objectID(0, true, ref.Object)
+			e.opening(1)
+		}
+		e.unsigned(0, true, uint64(ref.Property))
+	}
+	e.closing(1)
+	a, err := c.request(serviceReadPropertyMultiple, e.buf)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	if a.typ != pduComplexAck {
+		return nil, errors.Trace(ErrInvalidMessage)
+	}
+
+	results := map[PropertyRef]PropertyResult{}
+	d := &decoder{buf: a.data}
+	for !d.empty() {
+		obj := d.contextObjectID(0)
+		d.opening(1)
+		for d.err == nil {
+			if h := d.peek(); h.closing && h.num == 1 {
+				d.closing(1)
+				break
+			}
+			ref := PropertyRef{Object: obj, Property: uint32(d.contextUnsigned(2))}
+			d.optionalUnsigned(3)
+			res := PropertyResult{PropertyRef: ref}
+			if h := d.peek(); h.opening && h.num == 5 {
+				d.opening(5)
+				_, class := d.value()
+				_, code := d.value()
+				d.closing(5)
+				errClass, _ := class.(uint32)
+				errCode, _ := code.(uint32)
+				res.Err = &Error{Class: errClass, Code: errCode}
+			} else {
+				d.opening(4)
+				res.Value = d.values(4)
+			}
+			results[ref] = res
+		}
+	}
+	if d.err != nil {
+		return nil, errors.Trace(d.err)
+	}
+	res := make([]PropertyResult, len(refs))
+	for i, ref := range refs {
+		r, ok := results[ref]
+		if !ok {
+			r = PropertyResult{PropertyRef: ref, Err: ErrInvalidMessage}
+		}
+		res[i] = r
+	}
+	return res, nil
+}
+
+// WriteProperty writes the value with the application tag to the property of object, see FromValue for the go type
+// of value. The priority is from 1 to 16 for commandable properties, or 0 to omit.
+func (c *Client) WriteProperty(obj ObjectID, prop uint32, tag byte, value any, priority byte) error {
+	var e encoder
+	e.objectID(0, true, obj)
+	e.unsigned(1, true, uint64(prop))
+	e.opening(3)
+	if err := e.value(tag, value); err != nil {
+		return errors.Trace(err)
+	}
+	e.closing(3)
+	if priority > 0 {
+		e.unsigned(4, true, uint64(priority))
+	}
+	_, err := c.request(serviceWriteProperty, e.buf)
+	return errors.Trace(err)
+}
@@ -0,0 +1,430 @@
+package bacnet
+
+import (
+	"encoding/binary"
+	"math"
+	"unicode/utf8"
+
+	"github.com/baetyl/baetyl-go/v2/errors"
+)
+
+const (
+	tagClassContext = 0x08
+	tagOpening      = 6
+	tagClosing      = 7
+	charsetUTF8     = 0
+)
+
+type encoder struct {
+	buf []byte
+}
+
+// tag encodes the tag with the number, class and length or value
+func (e *encoder) tag(num byte, context bool, length int) {
+	b := byte(0)
+	if context {
+		b |= tagClassContext
+	}
+	var ext []byte
+	if num < 15 {
+		b |= num << 4
+	} else {
+		b |= 0xF0
+		ext = append(ext, num)
+	}
+	switch {
+	case length < 5:
+		b |= byte(length)
+	case length < 254:
+		b |= 5
+		ext = append(ext, byte(length))
+	case length < 1<<16:
+		b |= 5
+		ext = append(ext, 254, byte(length>>8), byte(length))
+	default:
+		b |= 5
+		ext = append(ext, 255, byte(length>>24), byte(length>>16), byte(length>>8), byte(length))
+	}
+	e.buf = append(e.buf, b)
+	e.buf = append(e.buf, ext...)
+}
+
+func (e *encoder) opening(num byte) {
+	e.tagLVT(num, tagOpening)
+}
+
+func (e *encoder) closing(num byte) {
+	e.tagLVT(num, tagClosing)
+}
+
+func (e *encoder) tagLVT(num, lvt byte) {
+	if num < 15 {
+		e.buf = append(e.buf, num<<4|tagClassContext|lvt)
+	} else {
+		e.buf = append(e.buf, 0xF0|tagClassContext|lvt, num)
+	}
+}
+
+func appendUint32(buf []byte, v uint32) []byte {
+	return append(buf, byte(v>>24), byte(v>>16), byte(v>>8), byte(v))
+}
+
+func unsignedBytes(v uint64) []byte {
+	n := 1
+	for n < 8 && v>>(8*n) != 0 {
+		n++
+	}
+	res := make([]byte, n)
+	for i := 0; i < n; i++ {
+		res[n-1-i] = byte(v >> (8 * i))
+	}
+	return res
+}
+
+func signedBytes(v int64) []byte {
+	n := 1
+	for n < 8 && (v < -(1<<(8*n-1)) || v >= 1<<(8*n-1)) {
+		n++
+	}
+	res := make([]byte, n)
+	for i := 0; i < n; i++ {
+		res[n-1-i] = byte(v >> (8 * i))
+	}
+	return res
+}
+
+func (e *encoder) unsigned(num byte, context bool, v uint64) {
+	b := unsignedBytes(v)
+	e.tag(num, context, len(b))
+	e.buf = append(e.buf, b...)
+}
+
+func (e *encoder) objectID(num byte, context bool, o ObjectID) {
+	e.tag(num, context, 4)
+	e.buf = appendUint32(e.buf, o.encode())
+}
+
+// value encodes an application tagged value, the go type of value must match the tag:
+// nil for null, bool for boolean, uint64 for unsigned, int64 for signed, float32 for real, float64 for double,
+// []byte for octet string, string for character string, []bool for bit string, uint32 for enumerated,
+// and ObjectID for object identifier
+func (e *encoder) value(tag byte, v any) error {
+	switch tag {
+	case TagNull:
+		e.tag(TagNull, false, 0)
+		return nil
+	case TagBoolean:
+		if b, ok := v.(bool); ok {
+			if b {
+				e.tag(TagBoolean, false, 1)
+			} else {
+				e.tag(TagBoolean, false, 0)
+			}
+			return nil
+		}
+	case TagUnsigned:
+		if u, ok := v.(uint64); ok {
+			e.unsigned(TagUnsigned, false, u)
+			return nil
+		}
+	case TagSigned:
+		if i, ok := v.(int64); ok {
+			b := signedBytes(i)
+			e.tag(TagSigned, false, len(b))
+			e.buf = append(e.buf, b...)
+			return nil
+		}
+	case TagReal:
+		if f, ok := v.(float32); ok {
+			e.tag(TagReal, false, 4)
+			e.buf = appendUint32(e.buf, math.Float32bits(f))
+			return nil
+		}
+	case TagDouble:
+		if f, ok := v.(float64); ok {
+			e.tag(TagDouble, false, 8)
+			e.buf = appendUint32(e.buf, uint32(math.Float64bits(f)>>32))
+			e.buf = appendUint32(e.buf, uint32(math.Float64bits(f)))
+			return nil
+		}
+	case TagOctetString:
+		if b, ok := v.([]byte); ok {
+			e.tag(TagOctetString, false, len(b))
+			e.buf = append(e.buf, b...)
+			return nil
+		}
+	case TagCharacterString:
+		if s, ok := v.(string); ok {
+			e.tag(TagCharacterString, false, len(s)+1)
+			e.buf = append(e.buf, charsetUTF8)
+			e.buf = append(e.buf, s...)
+			return nil
+		}
+	case TagBitString:
+		if bits, ok := v.([]bool); ok {
+			n := (len(bits) + 7) / 8
+			buf := make([]byte, n+1)
+			buf[0] = byte(n*8 - len(bits))
+			for i, bit := range bits {
+				if bit {
+					buf[1+i/8] |= 0x80 >> (i % 8)
+				}
+			}
+			e.tag(TagBitString, false, len(buf))
+			e.buf = append(e.buf, buf...)
+			return nil
+		}
+	case TagEnumerated:
+		if u, ok := v.(uint32); ok {
+			e.unsigned(TagEnumerated, false, uint64(u))
+			return nil
+		}
+	case TagObjectID:
+		if o, ok := v.(ObjectID); ok {
+			e.objectID(TagObjectID, false, o)
+			return nil
+		}
+	default:
+		return errors.Trace(ErrTypeNotSupported)
+	}
+	return errors.Errorf("bacnet value (%v) does not match application tag (%d)", v, tag)
+}
+
+// tagHeader the decoded header of a tag
+type tagHeader struct {
+	num     byte
+	context bool
+	opening bool
+	closing bool
+	// length the length of content, or the value of application boolean
+	length int
+}
+
+// decoder decodes the tags in order, the first error is kept and the following decoding is skipped
+type decoder struct {
+	buf []byte
+	err error
+}
+
+func (d *decoder) fail() {
+	if d.err == nil {
+		d.err = errors.Trace(ErrInvalidMessage)
+	}
+	d.buf = nil
+}
+
+func (d *decoder) read(n int) []byte {
+	if d.err != nil || n < 0 || len(d.buf) < n {
+		d.fail()
+		return make([]byte, n&0xFFFF)
+	}
+	res := d.buf[:n]
+	d.buf = d.buf[n:]
+	return res
+}
+
+func (d *decoder) empty() bool {
+	return d.err != nil || len(d.buf) == 0
+}
+
+// peek decodes the header of next tag without consuming it
+func (d *decoder) peek() tagHeader {
+	saved := d.buf
+	h := d.header()
+	if d.err == nil {
+		d.buf = saved
+	}
+	return h
+}
+
+func (d *decoder) header() tagHeader {
+	b := d.read(1)[0]
+	h := tagHeader{num: b >> 4, context: b&tagClassContext != 0}
+	if h.num == 15 {
+		h.num = d.read(1)[0]
+	}
+	lvt := b & 0x07
+	switch {
+	case h.context && lvt == tagOpening:
+		h.opening = true
+	case h.context && lvt == tagClosing:
+		h.closing = true
+	case lvt == 5:
+		n := int(d.read(1)[0])
+		switch n {
+		case 254:
+			n = int(binary.BigEndian.Uint16(d.read(2)))
+		case 255:
+			n = int(binary.BigEndian.Uint32(d.read(4)))
+		}
+		h.length = n
+	default:
+		h.length = int(lvt)
+	}
+	return h
+}
+
+func decodeUnsigned(b []byte) uint64 {
+	var v uint64
+	for _, c := range b {
+		v = v<<8 | uint64(c)
+	}
+	return v
+}
+
+func decodeSigned(b []byte) int64 {
+	if len(b) == 0 {
+		return 0
+	}
+	v := int64(int8(b[0]))
+	for _, c := range b[1:] {
+		v = v<<8 | int64(c)
+	}
+	return v
+}
+
+// expect decodes the header of a context tag, which must be the number
+func (d *decoder) expect(num byte) tagHeader {
+	h := d.header()
+	if !h.context || h.num != num {
+		d.fail()
+	}
+	return h
+}
+
+func (d *decoder) opening(num byte) {
+	if h := d.expect(num); !h.opening {
+		d.fail()
+	}
+}
+
+func (d *decoder) closing(num byte) {
+	if h := d.expect(num); !h.closing {
+		d.fail()
+	}
+}
+
+// contextUnsigned decodes a context tagged unsigned
+func (d *decoder) contextUnsigned(num byte) uint64 {
+	h := d.expect(num)
+	if h.opening || h.closing || h.length > 8 {
+		d.fail()
+		return 0
+	}
+	return decodeUnsigned(d.read(h.length))
+}
+
+// contextObjectID decodes a context tagged object identifier
+func (d *decoder) contextObjectID(num byte) ObjectID {
+	h := d.expect(num)
+	if h.length != 4 {
+		d.fail()
+	}
+	return decodeObjectID(binary.BigEndian.Uint32(d.read(4)))
+}
+
+// optionalUnsigned decodes a context tagged unsigned if the next tag is the number
+func (d *decoder) optionalUnsigned(num byte) (uint64, bool) {
+	if d.empty() {
+		return 0, false
+	}
+	if h := d.peek(); !h.context || h.num != num || h.opening || h.closing {
+		return 0, false
+	}
+	return d.contextUnsigned(num), true
+}
+
+// value decodes an application tagged value, see encoder.value for the go types
+func (d *decoder) value() (byte, any) {
+	h := d.header()
+	if d.err != nil {
+		return 0, nil
+	}
+	if h.context {
+		d.fail()
+		return 0, nil
+	}
+	if h.num == TagBoolean {
+		return TagBoolean, h.length != 0
+	}
+	b := d.read(h.length)
+	if d.err != nil {
+		return 0, nil
+	}
+	switch h.num {
+	case TagNull:
+		return TagNull, nil
+	case TagUnsigned, TagEnumerated:
+		if len(b) == 0 || len(b) > 8 {
+			d.fail()
+			return 0, nil
+		}
+		if h.num == TagEnumerated {
+			return h.num, uint32(decodeUnsigned(b))
+		}
+		return h.num, decodeUnsigned(b)
+	case TagSigned:
+		if len(b) == 0 || len(b) > 8 {
+			d.fail()
+			return 0, nil
+		}
+		return h.num, decodeSigned(b)
+	case TagReal:
+		if len(b) != 4 {
+			d.fail()
+			return 0, nil
+		}
+		return h.num, math.Float32frombits(binary.BigEndian.Uint32(b))
+	case TagDouble:
+		if len(b) != 8 {
+			d.fail()
+			return 0, nil
+		}
+		return h.num, math.Float64frombits(binary.BigEndian.Uint64(b))
+	case TagOctetString:
+		return h.num, append([]byte{}, b...)
+	case TagCharacterString:
+		// only utf-8 is supported, which covers ansi x3.4
+		if len(b) == 0 || b[0] != charsetUTF8 || !utf8.Valid(b[1:]) {
+			d.err = errors.Trace(ErrTypeNotSupported)
+			return 0, nil
+		}
+		return h.num, string(b[1:])
+	case TagBitString:
+		if len(b) == 0 || b[0] > 7 || len(b) == 1 && b[0] != 0 {
+			d.fail()
+			return 0, nil
+		}
+		bits := make([]bool, (len(b)-1)*8-int(b[0]))
+		for i := range bits {
+			bits[i] = b[1+i/8]&(0x80>>(i%8)) != 0
+		}
+		return h.num, bits
+	case TagObjectID:
+		if len(b) != 4 {
+			d.fail()
+			return 0, nil
+		}
+		return h.num, decodeObjectID(binary.BigEndian.Uint32(b))
+	}
+	d.err = errors.Trace(ErrTypeNotSupported)
+	return 0, nil
+}
+
+// values decodes the application tagged values until the closing tag of number, which is consumed.
+// The value is returned if there is only one value, otherwise a slice of values is returned.
+func (d *decoder) values(num byte) any {
+	var res []any
+	for d.err == nil {
+		if h := d.peek(); h.context && h.closing && h.num == num {
+			d.closing(num)
+			break
+		}
+		_, v := d.value()
+		res = append(res, v)
+	}
+	if len(res) == 1 {
+		return res[0]
+	}
+	return res
+}
@@ -0,0 +1,210 @@
+package bacnet
+
+import (
+	"sync"
+
+	"github.com/baetyl/baetyl-go/v2/dmcontext"
+	"github.com/baetyl/baetyl-go/v2/errors"
+	"github.com/baetyl/baetyl-go/v2/log"
+)
+
+// maxPropertiesPerRequest the max number of properties read by one ReadPropertyMultiple,
+// to keep the response in an apdu without segmentation
+const maxPropertiesPerRequest = 32
+
+// Driver implements dmcontext.Driver for BACnet/IP devices, it keeps a client per device.
+// The present values of objects are read by ReadPropertyMultiple, which falls back to ReadProperty
+// if the device does not support it, and written by WriteProperty.
+type Driver struct {
+	ctx        dmcontext.Context
+	driverName string
+	devices    map[string]*driverDevice
+	log        *log.Logger
+	mut        sync.Mutex
+}
+
+type driverDevice struct {
+	client *Client
+	// single whether to read by ReadProperty, since ReadPropertyMultiple is not supported
+	single bool
+}
+
+// NewDriver creates a new bacnet driver, which is run by dmcontext.Runtime
+func NewDriver(ctx dmcontext.Context, driverName string) *Driver {
+	return &Driver{
+		ctx:        ctx,
+		driverName: driverName,
+		devices:    map[string]*driverDevice{},
+		log:        log.L().With(log.Any("driver", driverName)),
+	}
+}
+
+func (d *Driver) device(dev *dmcontext.DeviceInfo) (*driverDevice, error) {
+	d.mut.Lock()
+	defer d.mut.Unlock()
+	if res, ok := d.devices[dev.Name]; ok {
+		return res, nil
+	}
+	if dev.AccessConfig == nil {
+		return nil, errors.Trace(ErrAccessConfigInvalid)
+	}
+	cli, err := NewClient(dev.AccessConfig.Bacnet)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	res := &driverDevice{client: cli}
+	d.devices[dev.Name] = res
+	return res, nil
+}
+
+// ObjectOf returns the object visited, whose instance is the address of visitor plus the address offset of access config
+func ObjectOf(cfg *dmcontext.BacnetAccessConfig, v *dmcontext.BacnetVisitor) (ObjectID, error) {
+	instance := uint64(cfg.AddressOffset) + uint64(v.BacnetAddress)
+	if v.BacnetType > maxObjectType || instance > maxObjectInstance {
+		return ObjectID{}, errors.Errorf("bacnet object (%d:%d) is out of range", v.BacnetType, instance)
+	}
+	return ObjectID{Type: uint16(v.BacnetType), Instance: uint32(instance)}, nil
+}
+
+// Connect connects to the device
+func (d *Driver) Connect(dev *dmcontext.DeviceInfo) error {
+	device, err := d.device(dev)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	return errors.Trace(device.client.Connect())
+}
+
+// Read reads the present values of the objects which have bacnet visitors. The property responded
+// with an error is skipped, since it is misconfigured rather than the device is offline.
+func (d *Driver) Read(dev *dmcontext.DeviceInfo, props []dmcontext.DeviceProperty) (map[string]any, error) {
+	device, err := d.device(dev)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	var refs []PropertyRef
+	var visited []dmcontext.DeviceProperty
+	for _, p := range props {
+		if p.Visitor.Bacnet == nil {
+			continue
+		}
+		obj, err := ObjectOf(dev.AccessConfig.Bacnet, p.Visitor.Bacnet)
+		if err != nil {
+			d.log.Warn("property has invalid object", log.Any("device", dev.Name), log.Any("property", p.Name), log.Error(err))
+			continue
+		}
+		refs = append(refs, PropertyRef{Object: obj, Property: PropertyPresentValue})
+		visited = append(visited, p)
+	}
+	results, err := d.read(device, refs)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	res := map[string]any{}
+	for i, r := range results {
+		p := visited[i]
+		if r.Err != nil {
+			d.log.Warn("failed to read property", log.Any("device", dev.Name), log.Any("property", p.Name), log.Error(r.Err))
+			continue
+		}
+		if res[p.ID], err = ToValue(p.Visitor.Bacnet.Type, r.Value); err != nil {
+			return nil, errors.Trace(err)
+		}
+	}
+	return res, nil
+}
+
+func (d *Driver) read(device *driverDevice, refs []PropertyRef) ([]PropertyResult, error) {
+	var res []PropertyResult
+	for len(refs) > 0 && !device.single {
+		n := len(refs)
+		if n > maxPropertiesPerRequest {
+			n = maxPropertiesPerRequest
+		}
+		results, err := device.client.ReadPropertyMultiple(refs[:n])
+		if err != nil {
+			if !unsupported(err) {
+				return nil, errors.Trace(err)
+			}
+			d.log.Info("ReadPropertyMultiple is not supported, to read by ReadProperty", log.Error(err))
+			device.single = true
+			break
+		}
+		res = append(res, results...)
+		refs = refs[n:]
+	}
+	for _, ref := range refs {
+		v, err := device.client.ReadProperty(ref.Object, ref.Property)
+		if err != nil {
+			if _, ok := errors.Cause(err).(*Error); !ok {
+				return nil, errors.Trace(err)
+			}
+		}
+		res = append(res, PropertyResult{PropertyRef: ref, Value: v, Err: err})
+	}
+	return res, nil
+}
+
+// unsupported returns whether the error is that the service is not supported by the device
+func unsupported(err error) bool {
+	switch e := errors.Cause(err).(type) {
+	case *RejectError:
+		return e.Reason == RejectUnrecognizedService
+	case *Error:
+		return e.Class == ErrorClassServices
+	}
+	return false
+}
+
+// Write writes the values keyed by the property ids of access template to the present values of objects.
+// The value is encoded by the application tag number of visitor, or the tag of the standard object type if not set.
+func (d *Driver) Write(dev *dmcontext.DeviceInfo, values map[string]any) error {
+	device, err := d.device(dev)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	tpl, err := d.ctx.GetAccessTemplates(d.driverName, dev.AccessTemplate)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	visitors := map[string]*dmcontext.BacnetVisitor{}
+	for _, p := range tpl.Properties {
+		visitors[p.ID] = p.Visitor.Bacnet
+	}
+	for id, val := range values {
+		v, ok := visitors[id]
+		if !ok || v == nil {
+			return errors.Trace(dmcontext.ErrUnknownPropertyID)
+		}
+		obj, err := ObjectOf(dev.AccessConfig.Bacnet, v)
+		if err != nil {
+			return errors.Trace(err)
+		}
+		tag := v.ApplicationTagNumber
+		if tag == TagNull {
+			if tag = DefaultTag(obj.Type); tag == TagNull {
+				return errors.Errorf("bacnet application tag number of object (%s) is not set", obj)
+			}
+		}
+		value, err := FromValue(tag, val)
+		if err != nil {
+			return errors.Trace(err)
+		}
+		if err = device.client.WriteProperty(obj, PropertyPresentValue, tag, value, 0); err != nil {
+			return errors.Trace(err)
+		}
+	}
+	return nil
+}
+
+// Close closes the client of device
+func (d *Driver) Close(dev *dmcontext.DeviceInfo) error {
+	d.mut.Lock()
+	device, ok := d.devices[dev.Name]
+	delete(d.devices, dev.Name)
+	d.mut.Unlock()
+	if !ok {
+		return nil
+	}
+	return errors.Trace(device.client.Close())
+}
@@ -0,0 +1,189 @@
+package bacnet
+
+import (
+	"encoding/binary"
+
+	"github.com/baetyl/baetyl-go/v2/errors"
+)
+
+const (
+	bvlcType              = 0x81
+	bvlcForwardedNPDU     = 0x04
+	bvlcOriginalUnicast   = 0x0A
+	bvlcOriginalBroadcast = 0x0B
+	bvlcHeaderLength      = 4
+	npduVersion           = 0x01
+	npduNetworkMessage    = 0x80
+	npduDestination       = 0x20
+	npduSource            = 0x08
+	npduExpectingReply    = 0x04
+	// maxAPDULength the max length of apdu accepted over BACnet/IP, which is encoded as 5
+	maxAPDULength = 1476
+	maxAPDUCode   = 0x05
+	segmented     = 0x08
+)
+
+// apdu the application protocol data unit decoded
+type apdu struct {
+	typ      byte
+	flags    byte
+	invokeID byte
+	service  byte
+	// reason the reason of reject and abort
+	reason byte
+	data   []byte
+}
+
+// encodeFrame encodes the apdu into a message of BACnet Virtual Link Control, with a local npdu
+func encodeFrame(broadcast, expectingReply bool, a []byte) []byte {
+	buf := make([]byte, bvlcHeaderLength, bvlcHeaderLength+2+len(a))
+	buf[0] = bvlcType
+	buf[1] = bvlcOriginalUnicast
+	if broadcast {
+		buf[1] = bvlcOriginalBroadcast
+	}
+	control := byte(0)
+	if expectingReply {
+		control = npduExpectingReply
+	}
+	buf = append(buf, npduVersion, control)
+	buf = append(buf, a...)
+	binary.BigEndian.PutUint16(buf[2:], uint16(len(buf)))
+	return buf
+}
+
+// decodeFrame decodes the apdu in the message, nil is returned if it has no apdu such as a network layer message
+func decodeFrame(buf []byte) (*apdu, error) {
+	if len(buf) < bvlcHeaderLength || buf[0] != bvlcType || int(binary.BigEndian.Uint16(buf[2:])) != len(buf) {
+		return nil, errors.Trace(ErrInvalidMessage)
+	}
+	switch buf[1] {
+	case bvlcOriginalUnicast, bvlcOriginalBroadcast:
+		buf = buf[bvlcHeaderLength:]
+	case bvlcForwardedNPDU:
+		// the b/ip address of the original source is skipped
+		if len(buf) < bvlcHeaderLength+6 {
+			return nil, errors.Trace(ErrInvalidMessage)
+		}
+		buf = buf[bvlcHeaderLength+6:]
+	default:
+		return nil, nil
+	}
+	if len(buf) < 2 || buf[0] != npduVersion {
+		return nil, errors.Trace(ErrInvalidMessage)
+	}
+	control := buf[1]
+	if control&npduNetworkMessage != 0 {
+		return nil, nil
+	}
+	buf = buf[2:]
+	skip := func(n int) bool {
+		if len(buf) < n {
+			return false
+		}
+		buf = buf[n:]
+		return true
+	}
+	if control&npduDestination != 0 && (len(buf) < 3 || !skip(3+int(buf[2]))) {
+		return nil, errors.Trace(ErrInvalidMessage)
+	}
+	if control&npduSource != 0 && (len(buf) < 3 || !skip(3+int(buf[2]))) {
+		return nil, errors.Trace(ErrInvalidMessage)
+	}
+	// the hop count
+	if control&npduDestination != 0 && !skip(1) {
+		return nil, errors.Trace(ErrInvalidMessage)
+	}
+	return decodeAPDU(buf)
+}
+
+func decodeAPDU(buf []byte) (*apdu, error) {
+	if len(buf) < 2 {
+		return nil, errors.Trace(ErrInvalidMessage)
+	}
+	a := &apdu{typ: buf[0] & 0xF0, flags: buf[0] & 0x0F}
+	var n int
+	switch a.typ {
+	case pduConfirmedRequest:
+		n = 4
+		if a.flags&segmented != 0 {
+			n = 6
+		}
+		if len(buf) < n {
+			return nil, errors.Trace(ErrInvalidMessage)
+		}
+		a.invokeID, a.service = buf[2], buf[n-1]
+	case pduUnconfirmedRequest:
+		n = 2
+		a.service = buf[1]
+	case pduSimpleAck, pduError:
+		n = 3
+		if len(buf) < n {
+			return nil, errors.Trace(ErrInvalidMessage)
+		}
+		a.invokeID, a.service = buf[1], buf[2]
+	case pduComplexAck:
+		n = 3
+		if a.flags&segmented != 0 {
+			n = 5
+		}
+		if len(buf) < n {
+			return nil, errors.Trace(ErrInvalidMessage)
+		}
+		a.invokeID, a.service = buf[1], buf[n-1]
+	case pduReject, pduAbort:
+		n = 3
+		if len(buf) < n {
+			return nil, errors.Trace(ErrInvalidMessage)
+		}
+		a.invokeID, a.reason = buf[1], buf[2]
+	case pduSegmentAck:
+		n = len(buf)
+	default:
+		return nil, errors.Trace(ErrInvalidMessage)
+	}
+	a.data = buf[n:]
+	return a, nil
+}
+
+func confirmedRequest(invokeID, service byte, data []byte) []byte {
+	return append([]byte{pduConfirmedRequest, maxAPDUCode, invokeID, service}, data...)
+}
+
+func unconfirmedRequest(service byte, data []byte) []byte {
+	return append([]byte{pduUnconfirmedRequest, service}, data...)
+}
+
+func simpleAck(invokeID, service byte) []byte {
+	return []byte{pduSimpleAck, invokeID, service}
+}
+
+func complexAck(invokeID, service byte, data []byte) []byte {
+	return append([]byte{pduComplexAck, invokeID, service}, data...)
+}
+
+func errorPDU(invokeID, service byte, class, code uint32) []byte {
+	e := encoder{buf: []byte{pduError, invokeID, service}}
+	e.unsigned(TagEnumerated, false, uint64(class))
+	e.unsigned(TagEnumerated, false, uint64(code))
+	return e.buf
+}
+
+func rejectPDU(invokeID, reason byte) []byte {
+	return []byte{pduReject, invokeID, reason}
+}
+
+// abortPDU returns an abort sent by server
+func abortPDU(invokeID, reason byte) []byte {
+	return []byte{pduAbort | 0x01, invokeID, reason}
+}
+
+// decodeError decodes the error class and code of an error pdu
+func decodeError(data []byte) *Error {
+	d := &decoder{buf: data}
+	_, class := d.value()
+	_, code := d.value()
+	c1, _ := class.(uint32)
+	c2, _ := code.(uint32)
+	return &Error{Class: c1, Code: c2}
+}
@@ -0,0 +1,262 @@
+package bacnet
+
+import (
+	"net"
+	"sync"
+	"testing"
+
+	"github.com/baetyl/baetyl-go/v2/errors"
+	"github.com/baetyl/baetyl-go/v2/utils"
+)
+
+// simulator an in-process BACnet/IP device for test, which answers Who-Is, ReadProperty,
+// ReadPropertyMultiple and WriteProperty with the properties set
+type simulator struct {
+	conn       *net.UDPConn
+	deviceID   uint32
+	properties map[ObjectID]map[uint32]*simulatorProperty
+	// noRPM rejects ReadPropertyMultiple as an unrecognized service
+	noRPM bool
+	tomb  utils.Tomb
+	mut   sync.Mutex
+}
+
+type simulatorProperty struct {
+	tag   byte
+	value any
+}
+
+// startSimulator starts a simulator of the device instance on localhost, which is closed when the test finishes
+func startSimulator(t testing.TB, deviceID uint32) *simulator {
+	addr, err := net.ResolveUDPAddr("udp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to start simulator: %s", err)
+	}
+	conn, err := net.ListenUDP("udp4", addr)
+	if err != nil {
+		t.Fatalf("failed to start simulator: %s", err)
+	}
+	s := &simulator{
+		conn:       conn,
+		deviceID:   deviceID,
+		properties: map[ObjectID]map[uint32]*simulatorProperty{},
+	}
+	device := ObjectID{Type: ObjectDevice, Instance: deviceID}
+	s.SetProperty(device, PropertyObjectIdentifier, TagObjectID, device)
+	s.SetProperty(device, PropertyObjectName, TagCharacterString, "simulator")
+	s.tomb.Go(s.serve)
+	t.Cleanup(func() { s.Close() })
+	return s
+}
+
+// Addr returns the udp address of simulator
+func (s *simulator) Addr() *net.UDPAddr {
+	return s.conn.LocalAddr().(*net.UDPAddr)
+}
+
+// Port returns the udp port of simulator
+func (s *simulator) Port() int {
+	return s.Addr().Port
+}
+
+// SetProperty sets the property of object with the application tag, see encoder.value for the go type of value.
+// The object is created if not exists.
+func (s *simulator) SetProperty(obj ObjectID, prop uint32, tag byte, value any) {
+	s.mut.Lock()
+	defer s.mut.Unlock()
+	props, ok := s.properties[obj]
+	if !ok {
+		props = map[uint32]*simulatorProperty{}
+		s.properties[obj] = props
+	}
+	props[prop] = &simulatorProperty{tag: tag, value: value}
+}
+
+// Property returns the value of the property of object
+func (s *simulator) Property(obj ObjectID, prop uint32) any {
+	s.mut.Lock()
+	defer s.mut.Unlock()
+	if p, ok := s.properties[obj][prop]; ok {
+		return p.value
+	}
+	return nil
+}
+
+// Close stops serving
+func (s *simulator) Close() error {
+	s.tomb.Kill(nil)
+	err := s.conn.Close()
+	s.tomb.Wait()
+	return errors.Trace(err)
+}
+
+func (s *simulator) serve() error {
+	buf := make([]byte, maxDatagramSize)
+	for {
+		n, addr, err := s.conn.ReadFromUDP(buf)
+		if err != nil {
+			if !s.tomb.Alive() {
+				return nil
+			}
+			return errors.Trace(err)
+		}
+		a, err := decodeFrame(append([]byte{}, buf[:n]...))
+		if err != nil || a == nil {
+			continue
+		}
+		var res []byte
+		switch a.typ {
+		case pduUnconfirmedRequest:
+			if a.service == serviceWhoIs {
+				res = s.whoIs(a.data)
+			}
+		case pduConfirmedRequest:
+			res = s.confirmed(a)
+		}
+		if res != nil {
+			s.conn.WriteToUDP(encodeFrame(false, false, res), addr)
+		}
+	}
+}
+
+// whoIs returns I-Am if the device is in the range of instances
+func (s *simulator) whoIs(data []byte) []byte {
+	d := &decoder{buf: data}
+	low, ok := d.optionalUnsigned(0)
+	high, _ := d.optionalUnsigned(1)
+	if d.err != nil || ok && (uint64(s.deviceID) < low || uint64(s.deviceID) > high) {
+		return nil
+	}
+	var e encoder
+	e.objectID(TagObjectID, false, ObjectID{Type: ObjectDevice, Instance: s.deviceID})
+	e.unsigned(TagUnsigned, false, maxAPDULength)
+	e.unsigned(TagEnumerated, false, segmentationNone)
+	e.unsigned(TagUnsigned, false, 0)
+	return unconfirmedRequest(serviceIAm, e.buf)
+}
+
+func (s *simulator) confirmed(a *apdu) []byte {
+	if a.flags&segmented != 0 {
+		return abortPDU(a.invokeID, AbortSegmentationNotSupported)
+	}
+	s.mut.Lock()
+	noRPM := s.noRPM
+	s.mut.Unlock()
+	var res []byte
+	switch {
+	case a.service == serviceReadProperty:
+		res = s.readProperty(a)
+	case a.service == serviceReadPropertyMultiple && !noRPM:
+		res = s.readPropertyMultiple(a)
+	case a.service == serviceWriteProperty:
+		res = s.writeProperty(a)
+	default:
+		return rejectPDU(a.invokeID, RejectUnrecognizedService)
+	}
+	if len(res) > maxAPDULength {
+		return abortPDU(a.invokeID, AbortSegmentationNotSupported)
+	}
+	return res
+}
+
+// property returns the property, or the error class and code if not found
+func (s *simulator) property(obj ObjectID, prop uint32) (*simulatorProperty, *Error) {
+	s.mut.Lock()
+	defer s.mut.Unlock()
+	props, ok := s.properties[obj]
+	if !ok {
+		return nil, &Error{Class: ErrorClassObject, Code: ErrorCodeUnknownObject}
+	}
+	p, ok := props[prop]
+	if !ok {
+		return nil, &Error{Class: ErrorClassProperty, Code: ErrorCodeUnknownProperty}
+	}
+	return &simulatorProperty{tag: p.tag, value: p.value}, nil
+}
+
+func (s *simulator) readProperty(a *apdu) []byte {
+	d := &decoder{buf: a.data}
+	obj := d.contextObjectID(0)
+	prop := uint32(d.contextUnsigned(1))
+	_, indexed := d.optionalUnsigned(2)
+	if d.err != nil || !d.empty() || indexed {
+		return rejectPDU(a.invokeID, 0)
+	}
+	p, perr := s.property(obj, prop)
+	if perr != nil {
+		return errorPDU(a.invokeID, a.service, perr.Class, perr.Code)
+	}
+	var e encoder
+	e.objectID(0, true, obj)
+	e.unsigned(1, true, uint64(prop))
+	e.opening(3)
+	if err := e.value(p.tag, p.value); err != nil {
+		return errorPDU(a.invokeID, a.service, ErrorClassProperty, ErrorCodeInvalidDataType)
+	}
+	e.closing(3)
+	return complexAck(a.invokeID, a.service, e.buf)
+}
+
+func (s *simulator) readPropertyMultiple(a *apdu) []byte {
+	var e encoder
+	d := &decoder{buf: a.data}
+	for !d.empty() {
+		obj := d.contextObjectID(0)
+		d.opening(1)
+		e.objectID(0, true, obj)
+		e.opening(1)
+		for d.err == nil {
+			if h := d.peek(); h.closing && h.num == 1 {
+				d.closing(1)
+				break
+			}
+			prop := uint32(d.contextUnsigned(0))
+			d.optionalUnsigned(1)
+			e.unsigned(2, true, uint64(prop))
+			p, perr := s.property(obj, prop)
+			if perr == nil {
+				e.opening(4)
+				if err := e.value(p.tag, p.value); err != nil {
+					return errorPDU(a.invokeID, a.service, ErrorClassProperty, ErrorCodeInvalidDataType)
+				}
+				e.closing(4)
+				continue
+			}
+			e.opening(5)
+			e.unsigned(TagEnumerated, false, uint64(perr.Class))
+			e.unsigned(TagEnumerated, false, uint64(perr.Code))
+			e.closing(5)
+		}
+		e.closing(1)
+	}
+	if d.err != nil {
+		return rejectPDU(a.invokeID, 0)
+	}
+	return complexAck(a.invokeID, a.service, e.buf)
+}
+
+func (s *simulator) writeProperty(a *apdu) []byte {
+	d := &decoder{buf: a.data}
+	obj := d.contextObjectID(0)
+	prop := uint32(d.contextUnsigned(1))
+	_, indexed := d.optionalUnsigned(2)
+	d.opening(3)
+	tag, value := d.value()
+	d.closing(3)
+	d.optionalUnsigned(4)
+	if d.err != nil || !d.empty() || indexed {
+		return rejectPDU(a.invokeID, 0)
+	}
+	p, perr := s.property(obj, prop)
+	if perr != nil {
+		return errorPDU(a.invokeID, a.service, perr.Class, perr.Code)
+	}
+	if prop == PropertyObjectIdentifier || prop == PropertyObjectType {
+		return errorPDU(a.invokeID, a.service, ErrorClassProperty, ErrorCodeWriteAccessDenied)
+	}
+	if tag != p.tag {
+		return errorPDU(a.invokeID, a.service, ErrorClassProperty, ErrorCodeInvalidDataType)
+	}
+	s.SetProperty(obj, prop, tag, value)
+	return simpleAck(a.invokeID, a.service)
+}
@@ -0,0 +1,76 @@
+package bacnet
+
+import (
+	"github.com/spf13/cast"
+
+	"github.com/baetyl/baetyl-go/v2/dmcontext"
+	"github.com/baetyl/baetyl-go/v2/errors"
+)
+
+// ToValue converts the value read into the dmcontext type, the value is returned as it is if typ is empty.
+// The enumerated value of binary objects is converted to bool, which is active if not zero.
+func ToValue(typ string, v any) (any, error) {
+	if typ == "" {
+		return v, nil
+	}
+	switch val := v.(type) {
+	case ObjectID:
+		v = val.String()
+	case uint32:
+		if typ == dmcontext.TypeBool {
+			v = val != 0
+		}
+	case uint64:
+		if typ == dmcontext.TypeBool {
+			v = val != 0
+		}
+	}
+	res, err := dmcontext.ParseValue(typ, v, nil)
+	return res, errors.Trace(err)
+}
+
+// FromValue converts the value into the go type of the application tag to write
+func FromValue(tag byte, v any) (any, error) {
+	var res any
+	var err error
+	switch tag {
+	case TagNull:
+		return nil, nil
+	case TagBoolean:
+		res, err = cast.ToBoolE(v)
+	case TagUnsigned:
+		res, err = cast.ToUint64E(v)
+	case TagSigned:
+		res, err = cast.ToInt64E(v)
+	case TagReal:
+		res, err = cast.ToFloat32E(v)
+	case TagDouble:
+		res, err = cast.ToFloat64E(v)
+	case TagCharacterString:
+		res, err = cast.ToStringE(v)
+	case TagEnumerated:
+		if b, ok := v.(bool); ok {
+			v = 0
+			if b {
+				v = 1
+			}
+		}
+		res, err = cast.ToUint32E(v)
+	default:
+		return nil, errors.Trace(ErrTypeNotSupported)
+	}
+	return res, errors.Trace(err)
+}
+
+// DefaultTag returns the application tag of the present value of standard objects, 0 is returned if unknown
+func DefaultTag(objectType uint16) byte {
+	switch objectType {
+	case ObjectAnalogInput, ObjectAnalogOutput, ObjectAnalogValue:
+		return TagReal
+	case ObjectBinaryInput, ObjectBinaryOutput, ObjectBinaryValue:
+		return TagEnumerated
+	case ObjectMultiStateInput, ObjectMultiStateOutput, ObjectMultiStateValue:
+		return TagUnsigned
+	}
+	return 0
+}
@@ -1,10 +1,12 @@
 package dmcontext
 
 import (
+	"net/http"
 	"time"
 
 	"github.com/google/uuid"
 
+	"github.com/baetyl/baetyl-go/v2/errors"
 	v1 "github.com/baetyl/baetyl-go/v2/spec/v1"
 )
 
@@ -14,8 +16,11 @@ const (
 	MethodEventReport    = "thing.event.post"
 	MethodPropertyGet    = "thing.property.get"
 	MethodLifecyclePost  = "thing.lifecycle.post"
-	DefaultVersion       = "1.0"
-	KeyOnlineState       = "online_state"
+	// MethodServiceInvokePrefix the service is invoked by thing.service.{id} and replied by thing.service.{id}.reply
+	MethodServiceInvokePrefix = "thing.service."
+	MethodServiceReplySuffix  = ".reply"
+	DefaultVersion            = "1.0"
+	KeyOnlineState            = "online_state"
 )
 
 type MsgBlink struct {
@@ -33,6 +38,8 @@ type DataBlink struct {
 	Properties any            `yaml:"properties,omitempty" json:"properties,omitempty"`
 	Events     map[string]any `yaml:"events,omitempty" json:"events,omitempty"`
 	Params     map[string]any `yaml:"params,omitempty" json:"params,omitempty"`
+	Code       int            `yaml:"code,omitempty" json:"code,omitempty"`
+	Message    string         `yaml:"message,omitempty" json:"message,omitempty"`
 }
 
 func (b *MsgBlink) GenDeltaBlinkData(properties map[string]interface{}) v1.LazyValue {
@@ -105,6 +112,49 @@ func (b *MsgBlink) GenLifecycleReportData(online bool) v1.LazyValue {
 	}
 }
 
+// GenServiceInvokeData generates the invoke of service with the input params
+func (b *MsgBlink) GenServiceInvokeData(service string, params map[string]any) v1.LazyValue {
+	return v1.LazyValue{
+		Value: ContentBlink{
+			Blink: DataBlink{
+				ReqID:     uuid.New().String(),
+				Method:    ServiceMethod(service),
+				Version:   DefaultVersion,
+				Timestamp: getCurrentTimestamp(),
+				Params:    params,
+			},
+		},
+	}
+}
+
+// GenServiceReplyData generates the reply of the invoke reqID with the output params,
+// the code is 200 if err is nil, 404 if the service not exist, 400 if the params are invalid, otherwise 500
+func (b *MsgBlink) GenServiceReplyData(reqID, service string, output map[string]any, err error) v1.LazyValue {
+	data := DataBlink{
+		ReqID:     reqID,
+		Method:    ServiceReplyMethod(service),
+		Version:   DefaultVersion,
+		Timestamp: getCurrentTimestamp(),
+		Params:    output,
+		Code:      http.StatusOK,
+	}
+	if err != nil {
+		cause := errors.Cause(err)
+		_, invalid := cause.(*ValueError)
+		switch {
+		case cause == ErrServiceNotExist:
+			data.Code = http.StatusNotFound
+		case invalid:
+			data.Code = http.StatusBadRequest
+		default:
+			data.Code = http.StatusInternalServerError
+		}
+		data.Params = nil
+		data.Message = err.Error()
+	}
+	return v1.LazyValue{Value: ContentBlink{Blink: data}}
+}
+
 func getCurrentTimestamp() int64 {
 	return time.Now().UnixNano() / 1e6
 }
@@ -11,12 +11,17 @@ import (
 	"github.com/baetyl/baetyl-go/v2/log"
 )
 
-var _ Context = &DmCtx{}
+var (
+	_ Context      = &DmCtx{}
+	_ ServiceModel = &DmCtx{}
+)
 
 const (
 	DefaultSubDeviceConf      = "sub_devices.yml"
 	DefaultDeviceModelConf    = "models.yml"
 	DefaultAccessTemplateConf = "access_template.yml"
+	DefaultDeviceServiceConf  = "services.yml"
+	DefaultDeviceEventConf    = "events.yml"
 )
 
 var (
@@ -42,6 +47,15 @@ type Context interface {
 	GetDriverConfig() string
 }
 
+// ServiceModel the services and events of device models, which is implemented by DmCtx,
+// such as ctx.(ServiceModel)
+type ServiceModel interface {
+	GetDeviceServices(driverName string, device *DeviceInfo) ([]DeviceService, error)
+	GetDeviceEvents(driverName string, device *DeviceInfo) ([]DeviceEvent, error)
+	ParseServiceInput(driverName string, device *DeviceInfo, service string, params map[string]any) (map[string]any, error)
+	ParseEventOutput(driverName string, device *DeviceInfo, event string, params map[string]any) (map[string]any, error)
+}
+
 type DmCtx struct {
 	context.Context
 	log             *log.Logger
@@ -49,12 +63,20 @@ type DmCtx struct {
 	devices         map[string]map[string]DeviceInfo
 	deviceModels    map[string]map[string][]DeviceProperty
 	accessTemplates map[string]map[string]AccessTemplate
+	deviceServices  map[string]map[string][]DeviceService
+	deviceEvents    map[string]map[string][]DeviceEvent
 	driverConfig    string
 }
 
 func NewContext(confFile string) Context {
+	return WrapContext(context.NewContext(confFile))
+}
+
+// WrapContext creates a new context of device management based on the service context,
+// such as the context for test
+func WrapContext(ctx context.Context) Context {
 	var c = new(DmCtx)
-	c.Context = context.NewContext(confFile)
+	c.Context = ctx
 
 	var lfs []log.Field
 	if c.NodeName() != "" {
@@ -69,6 +91,8 @@ func NewContext(confFile string) Context {
 	c.log = log.With(lfs...)
 	c.deviceModels = make(map[string]map[string][]DeviceProperty)
 	c.accessTemplates = make(map[string]map[string]AccessTemplate)
+	c.deviceServices = make(map[string]map[string][]DeviceService)
+	c.deviceEvents = make(map[string]map[string][]DeviceEvent)
 	c.devices = make(map[string]map[string]DeviceInfo)
 	c.deviceDriverMap = make(map[string]string)
 	return c
@@ -94,6 +118,21 @@ func (c *DmCtx) LoadDriverConfig(path, driverName string) error {
 		c.accessTemplates[driverName][name] = tpl
 	}
 
+	// the services and events are optional
+	deviceService := make(map[string][]DeviceService)
+	if err := unmarshalYAML(filepath.Join(path, DefaultDeviceServiceConf), deviceService); err != nil && !os.IsNotExist(err) {
+		c.log.Error("failed to load device service", log.Error(err))
+		return err
+	}
+	c.deviceServices[driverName] = deviceService
+
+	deviceEvent := make(map[string][]DeviceEvent)
+	if err := unmarshalYAML(filepath.Join(path, DefaultDeviceEventConf), deviceEvent); err != nil && !os.IsNotExist(err) {
+		c.log.Error("failed to load device event", log.Error(err))
+		return err
+	}
+	c.deviceEvents[driverName] = deviceEvent
+
 	var dCfg driverConfig
 	if err := unmarshalYAML(filepath.Join(path, DefaultSubDeviceConf), &dCfg); err != nil {
 		c.log.Error("failed to load device config", log.Error(err))
@@ -3,7 +3,6 @@ package dmcontext
 import (
 	"bytes"
 	"encoding/json"
-	"strconv"
 
 	"github.com/baetyl/baetyl-go/v2/errors"
 	"github.com/baetyl/baetyl-go/v2/mqtt"
@@ -107,6 +106,8 @@ type driverConfig struct {
 	Driver  string       `yaml:"driver,omitempty" json:"driver,omitempty"`
 }
 
+// ParsePropertyValues validates the values of properties against the device model and converts them into their types,
+// see ValidateValue
 func (c *DmCtx) ParsePropertyValues(driverName string, device *DeviceInfo, props map[string]any) (map[string]any, error) {
 	res := make(map[string]any)
 	vals, ok := c.deviceModels[driverName][device.DeviceModel]
@@ -119,7 +120,7 @@ func (c *DmCtx) ParsePropertyValues(driverName string, device *DeviceInfo, props
 	}
 	for key, val := range props {
 		if cfg, ok := cfgs[key]; ok {
-			pVal, err := parsePropertyValue(cfg.Type, val)
+			pVal, err := ValidateValue(key, cfg.Spec(), val)
 			if err != nil {
 				return nil, errors.Trace(err)
 			}
@@ -131,51 +132,6 @@ func (c *DmCtx) ParsePropertyValues(driverName string, device *DeviceInfo, props
 	return res, nil
 }
 
-func parsePropertyValue(tpy string, val any) (any, error) {
-	// it is json.Number (string actually) when val is number
-	switch tpy {
-	case TypeInt16:
-		num, _ := val.(json.Number)
-		i, err := strconv.ParseInt(num.String(), 10, 16)
-		if err != nil {
-			return nil, errors.Trace(err)
-		}
-		return int16(i), nil
-	case TypeInt32:
-		num, _ := val.(json.Number)
-		i, err := strconv.ParseInt(num.String(), 10, 32)
-		if err != nil {
-			return nil, errors.Trace(err)
-		}
-		return int32(i), nil
-	case TypeInt64:
-		num, _ := val.(json.Number)
-		i, err := strconv.ParseInt(num.String(), 10, 64)
-		if err != nil {
-			return nil, errors.Trace(err)
-		}
-		return i, nil
-	case TypeFloat32:
-		num, _ := val.(json.Number)
-		f, err := strconv.ParseFloat(num.String(), 32)
-		if err != nil {
-			return nil, errors.Trace(err)
-		}
-		return float32(f), nil
-	case TypeFloat64:
-		num, _ := val.(json.Number)
-		f, err := strconv.ParseFloat(num.String(), 64)
-		if err != nil {
-			return nil, errors.Trace(err)
-		}
-		return f, nil
-	case TypeBool, TypeString, TypeEnum, TypeArray, TypeTime, TypeDate, TypeObject:
-		return val, nil
-	default:
-		return nil, errors.Trace(ErrTypeNotSupported)
-	}
-}
-
 func ParsePropertyKeys(v any) ([]string, error) {
 	properties, ok := v.([]any)
 	if !ok {
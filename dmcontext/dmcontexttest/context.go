@@ -0,0 +1,71 @@
+// Package dmcontexttest provides a device management context for unit-testing drivers.
+package dmcontexttest
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"gopkg.in/yaml.v2"
+
+	"github.com/baetyl/baetyl-go/v2/context/contexttest"
+	"github.com/baetyl/baetyl-go/v2/dmcontext"
+	"github.com/baetyl/baetyl-go/v2/errors"
+)
+
+// DriverConfig the config of a driver in memory, which is loaded by SetDriverConfig
+type DriverConfig struct {
+	Devices         []dmcontext.DeviceInfo
+	DeviceModels    map[string][]dmcontext.DeviceProperty
+	AccessTemplates map[string]dmcontext.AccessTemplate
+	DeviceServices  map[string][]dmcontext.DeviceService
+	DeviceEvents    map[string][]dmcontext.DeviceEvent
+	Driver          string
+}
+
+// Context a device management context for unit tests, which implements dmcontext.Context.
+// The fake broker, fake servers and assertion helpers are provided by Base.
+type Context struct {
+	dmcontext.Context
+	Base *contexttest.Context
+	dir  string
+}
+
+// NewContext creates a new device management context for test
+func NewContext(t testing.TB) *Context {
+	base := contexttest.NewContext(t)
+	return &Context{
+		Context: dmcontext.WrapContext(base),
+		Base:    base,
+		dir:     t.TempDir(),
+	}
+}
+
+// SetDriverConfig sets the devices, device models, access templates, services and events of a driver
+func (c *Context) SetDriverConfig(driverName string, cfg DriverConfig) error {
+	dir := filepath.Join(c.dir, driverName)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return errors.Trace(err)
+	}
+	files := map[string]interface{}{
+		dmcontext.DefaultSubDeviceConf: map[string]interface{}{
+			"devices": cfg.Devices,
+			"driver":  cfg.Driver,
+		},
+		dmcontext.DefaultDeviceModelConf:    cfg.DeviceModels,
+		dmcontext.DefaultAccessTemplateConf: cfg.AccessTemplates,
+		dmcontext.DefaultDeviceServiceConf:  cfg.DeviceServices,
+		dmcontext.DefaultDeviceEventConf:    cfg.DeviceEvents,
+	}
+	for name, v := range files {
+		data, err := yaml.Marshal(v)
+		if err != nil {
+			return errors.Trace(err)
+		}
+		if err = ioutil.WriteFile(filepath.Join(dir, name), data, 0644); err != nil {
+			return errors.Trace(err)
+		}
+	}
+	return errors.Trace(c.LoadDriverConfig(dir, driverName))
+}
@@ -0,0 +1,49 @@
+package dmcontexttest
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/baetyl/baetyl-go/v2/dmcontext"
+	"github.com/baetyl/baetyl-go/v2/errors"
+)
+
+func TestContext(t *testing.T) {
+	c := NewContext(t)
+	err := c.SetDriverConfig("modbus", DriverConfig{
+		Devices: []dmcontext.DeviceInfo{{Name: "dev1", DeviceModel: "meter", AccessTemplate: "tpl"}},
+		DeviceModels: map[string][]dmcontext.DeviceProperty{
+			"meter": {{Name: "temperature", ID: "1", Type: "float32", Mode: "ro"}},
+		},
+		AccessTemplates: map[string]dmcontext.AccessTemplate{"tpl": {Version: "v1"}},
+		Driver:          "interval: 1s",
+	})
+	assert.NoError(t, err)
+
+	dev, err := c.GetDevice("modbus", "dev1")
+	assert.NoError(t, err)
+	assert.Equal(t, "meter", dev.DeviceModel)
+	assert.Equal(t, "modbus", c.GetDriverNameByDevice("dev1"))
+	props, err := c.GetDeviceModel("modbus", dev)
+	assert.NoError(t, err)
+	assert.Equal(t, "temperature", props[0].Name)
+	vals, err := c.ParsePropertyValues("modbus", dev, map[string]any{"temperature": json.Number("21.5")})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]any{"temperature": float32(21.5)}, vals)
+	_, err = c.ParsePropertyValues("modbus", dev, map[string]any{"temperature": "hot"})
+	assert.EqualError(t, errors.Cause(err), "invalid value of temperature: is not a number")
+	tpl, err := c.GetAccessTemplates("modbus", "tpl")
+	assert.NoError(t, err)
+	assert.Equal(t, "tpl", tpl.Name)
+	assert.Equal(t, "interval: 1s", c.GetDriverConfig())
+
+	// the underlying context for test
+	cli, err := c.NewSystemBrokerClient(nil)
+	assert.NoError(t, err)
+	defer cli.Close()
+	assert.NoError(t, cli.Start(nil))
+	assert.NoError(t, cli.Publish(0, "report", []byte("r"), 0, false, false))
+	c.Base.AssertPublished(t, "report", []byte("r"))
+}
@@ -0,0 +1,14 @@
+package dmcontext
+
+// Driver accesses devices by a protocol, such as modbus, opcua or bacnet.
+// The calls to a device are serialized by the runtime, while the calls to different devices may be concurrent.
+type Driver interface {
+	// Connect connects to the device, which is called before the first access and after a failed access
+	Connect(dev *DeviceInfo) error
+	// Read reads the properties of the access template from the device, returns the values keyed by property id
+	Read(dev *DeviceInfo, props []DeviceProperty) (map[string]any, error)
+	// Write writes the values keyed by property id to the device
+	Write(dev *DeviceInfo, values map[string]any) error
+	// Close closes the connection to the device
+	Close(dev *DeviceInfo) error
+}
@@ -0,0 +1,91 @@
+package dmcontext
+
+import (
+	"math"
+	"reflect"
+	"sync"
+	"time"
+)
+
+// ReportFilter filters the properties to report of devices by the mappings of access template, so that only
+// the changes are reported. The value of a property is reported if
+//   - it is the first value of property, or the property has no mapping
+//   - the heartbeat has elapsed since it was reported last time, no matter whether it is changed
+//   - the silent window (ModelMapping.SilentWin in seconds) has elapsed since it was reported last time,
+//     and it is changed by ModelMapping.Deviation at least if numeric, or it is changed otherwise
+type ReportFilter struct {
+	heartbeat time.Duration
+	// the values reported last time keyed by device and property
+	reported map[string]map[string]reportedValue
+	now      func() time.Time
+	mu       sync.Mutex
+}
+
+type reportedValue struct {
+	value any
+	at    time.Time
+}
+
+// NewReportFilter creates a new report filter, the properties are reported at least once in the heartbeat
+// if it is positive, even if they are not changed
+func NewReportFilter(heartbeat time.Duration) *ReportFilter {
+	return &ReportFilter{
+		heartbeat: heartbeat,
+		reported:  map[string]map[string]reportedValue{},
+		now:       time.Now,
+	}
+}
+
+// Filter returns the properties of device to report, which are recorded as reported
+func (f *ReportFilter) Filter(device string, mappings []ModelMapping, props map[string]any) map[string]any {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	reported, ok := f.reported[device]
+	if !ok {
+		reported = map[string]reportedValue{}
+		f.reported[device] = reported
+	}
+	ms := make(map[string]ModelMapping, len(mappings))
+	for _, m := range mappings {
+		ms[m.Attribute] = m
+	}
+	now := f.now()
+	res := map[string]any{}
+	for name, v := range props {
+		if last, ok := reported[name]; ok {
+			if m, ok := ms[name]; ok && !f.expected(m, last, v, now) {
+				continue
+			}
+		}
+		reported[name] = reportedValue{value: v, at: now}
+		res[name] = v
+	}
+	return res
+}
+
+// Reset forgets the values reported of device, so that all properties are reported next time,
+// such as the device is online again
+func (f *ReportFilter) Reset(device string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	delete(f.reported, device)
+}
+
+// expected returns whether the value is expected to report since the last one reported
+func (f *ReportFilter) expected(m ModelMapping, last reportedValue, v any, now time.Time) bool {
+	elapsed := now.Sub(last.at)
+	if f.heartbeat > 0 && elapsed >= f.heartbeat {
+		return true
+	}
+	if elapsed < time.Duration(m.SilentWin)*time.Second {
+		return false
+	}
+	x, errX := ParseValueToFloat64(last.value)
+	y, errY := ParseValueToFloat64(v)
+	if errX != nil || errY != nil {
+		return !reflect.DeepEqual(last.value, v)
+	}
+	d := math.Abs(y - x)
+	return d > 0 && d >= m.Deviation
+}
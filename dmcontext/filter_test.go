@@ -0,0 +1,71 @@
+package dmcontext
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReportFilter(t *testing.T) {
+	now := time.Unix(0, 0)
+	f := NewReportFilter(time.Minute)
+	f.now = func() time.Time { return now }
+	mappings := []ModelMapping{
+		{Attribute: "temperature", Deviation: 0.5},
+		{Attribute: "humidity", SilentWin: 10},
+		{Attribute: "mode"},
+	}
+
+	// the first values are reported
+	props := map[string]any{"temperature": 20.0, "humidity": int32(40), "mode": "auto", "status": 1}
+	assert.Equal(t, props, f.Filter("dev1", mappings, props))
+	assert.Equal(t, props, f.Filter("dev2", mappings, props))
+
+	// the values not changed are suppressed, except the property without mapping
+	now = now.Add(time.Second)
+	assert.Equal(t, map[string]any{"status": 1}, f.Filter("dev1", mappings, props))
+
+	// deviation
+	now = now.Add(time.Second)
+	assert.Empty(t, f.Filter("dev1", mappings, map[string]any{"temperature": 20.3}))
+	assert.Empty(t, f.Filter("dev1", mappings, map[string]any{"temperature": 19.6}))
+	assert.Equal(t, map[string]any{"temperature": 20.5}, f.Filter("dev1", mappings, map[string]any{"temperature": 20.5}))
+	assert.Empty(t, f.Filter("dev1", mappings, map[string]any{"temperature": 20.1}))
+
+	// silent window
+	assert.Empty(t, f.Filter("dev1", mappings, map[string]any{"humidity": int32(41)}))
+	now = now.Add(8 * time.Second)
+	assert.Equal(t, map[string]any{"humidity": int32(41)}, f.Filter("dev1", mappings, map[string]any{"humidity": int32(41)}))
+	now = now.Add(time.Second)
+	assert.Empty(t, f.Filter("dev1", mappings, map[string]any{"humidity": int32(42)}))
+
+	// change of non-numeric value
+	assert.Empty(t, f.Filter("dev1", mappings, map[string]any{"mode": "auto"}))
+	assert.Equal(t, map[string]any{"mode": "manual"}, f.Filter("dev1", mappings, map[string]any{"mode": "manual"}))
+	arr := map[string]any{"mode": []any{1, 2}}
+	assert.Equal(t, arr, f.Filter("dev1", mappings, arr))
+	assert.Empty(t, f.Filter("dev1", mappings, map[string]any{"mode": []any{1, 2}}))
+
+	// heartbeat
+	now = now.Add(time.Minute)
+	props = map[string]any{"temperature": 20.5, "humidity": int32(41), "mode": []any{1, 2}}
+	assert.Equal(t, props, f.Filter("dev1", mappings, props))
+
+	// reset
+	assert.Empty(t, f.Filter("dev1", mappings, props))
+	f.Reset("dev1")
+	assert.Equal(t, props, f.Filter("dev1", mappings, props))
+}
+
+func TestReportFilterWithoutHeartbeat(t *testing.T) {
+	now := time.Unix(0, 0)
+	f := NewReportFilter(0)
+	f.now = func() time.Time { return now }
+	mappings := []ModelMapping{{Attribute: "switch"}}
+
+	assert.Equal(t, map[string]any{"switch": true}, f.Filter("dev1", mappings, map[string]any{"switch": true}))
+	now = now.Add(24 * time.Hour)
+	assert.Empty(t, f.Filter("dev1", mappings, map[string]any{"switch": true}))
+	assert.Equal(t, map[string]any{"switch": false}, f.Filter("dev1", mappings, map[string]any{"switch": false}))
+}
@@ -34,7 +34,7 @@ var timeFormats = map[string]string{
 	"yyyy-mm-dd": "2006-01-02",
 	"yyyy.mm.dd": "2006.01.02",
 	"yyyy/mm/dd": "2006/01/02",
-	"mm-dd-yyyy": "06-01-2020",
+	"mm-dd-yyyy": "01-02-2006",
 	"hh:mm:ss":   "15:04:05",
 	"HH:MM:SS":   "15:04:05",
 }
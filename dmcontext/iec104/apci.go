@@ -0,0 +1,141 @@
+package iec104
+
+import (
+	"io"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/baetyl/baetyl-go/v2/errors"
+)
+
+const (
+	startByte = 0x68
+	// maxAPDULength the max length of apdu after the length field
+	maxAPDULength = 253
+	// maxASDULength the max length of asdu in an i-format apdu
+	maxASDULength = maxAPDULength - 4
+	// seqModulo the modulo of send and receive sequence numbers of 15 bits
+	seqModulo = 1 << 15
+)
+
+// The formats of apdu
+const (
+	formatI = iota
+	formatS
+	formatU
+)
+
+// The functions of u-format apdu
+const (
+	uStartDTAct byte = 0x04
+	uStartDTCon byte = 0x08
+	uStopDTAct  byte = 0x10
+	uStopDTCon  byte = 0x20
+	uTestFRAct  byte = 0x40
+	uTestFRCon  byte = 0x80
+)
+
+// apdu the application protocol data unit, asdu is only present in i-format
+type apdu struct {
+	format  int
+	sendSeq uint16
+	recvSeq uint16
+	u       byte
+	asdu    []byte
+}
+
+func (a *apdu) encode() []byte {
+	buf := make([]byte, 6, 6+len(a.asdu))
+	buf[0] = startByte
+	buf[1] = byte(4 + len(a.asdu))
+	switch a.format {
+	case formatI:
+		buf[2] = byte(a.sendSeq << 1)
+		buf[3] = byte(a.sendSeq >> 7)
+		buf[4] = byte(a.recvSeq << 1)
+		buf[5] = byte(a.recvSeq >> 7)
+	case formatS:
+		buf[2] = 0x01
+		buf[4] = byte(a.recvSeq << 1)
+		buf[5] = byte(a.recvSeq >> 7)
+	case formatU:
+		buf[2] = a.u | 0x03
+	}
+	return append(buf, a.asdu...)
+}
+
+// readAPDU reads an apdu from r
+func readAPDU(r io.Reader) (*apdu, error) {
+	var header [6]byte
+	if _, err := io.ReadFull(r, header[:2]); err != nil {
+		return nil, errors.Trace(err)
+	}
+	if header[0] != startByte || header[1] < 4 || header[1] > maxAPDULength {
+		return nil, errors.Trace(ErrInvalidFrame)
+	}
+	if _, err := io.ReadFull(r, header[2:]); err != nil {
+		return nil, errors.Trace(err)
+	}
+	res := &apdu{}
+	switch {
+	case header[2]&0x01 == 0:
+		res.format = formatI
+		res.sendSeq = uint16(header[2])>>1 | uint16(header[3])<<7
+		res.recvSeq = uint16(header[4])>>1 | uint16(header[5])<<7
+	case header[2]&0x03 == 0x01:
+		res.format = formatS
+		res.recvSeq = uint16(header[4])>>1 | uint16(header[5])<<7
+	default:
+		res.format = formatU
+		res.u = header[2] &^ 0x03
+	}
+	if n := int(header[1]) - 4; n > 0 {
+		if res.format != formatI {
+			return nil, errors.Trace(ErrInvalidFrame)
+		}
+		res.asdu = make([]byte, n)
+		if _, err := io.ReadFull(r, res.asdu); err != nil {
+			return nil, errors.Trace(err)
+		}
+	} else if res.format == formatI {
+		return nil, errors.Trace(ErrInvalidFrame)
+	}
+	return res, nil
+}
+
+// seqDiff returns the number of sequence numbers from a to b
+func seqDiff(a, b uint16) int {
+	return int((b + seqModulo - a) % seqModulo)
+}
+
+// parseEndpoint parses the endpoint into the address to dial, the endpoint is host:port or tcp://host:port,
+// the default port is 2404
+func parseEndpoint(endpoint string) (string, error) {
+	if endpoint == "" {
+		return "", errors.Trace(ErrInvalidEndpoint)
+	}
+	if strings.Contains(endpoint, "://") {
+		u, err := url.Parse(endpoint)
+		if err != nil || u.Scheme != "tcp" || u.Host == "" {
+			return "", errors.Trace(ErrInvalidEndpoint)
+		}
+		endpoint = u.Host
+	}
+	host, port, err := net.SplitHostPort(endpoint)
+	if err != nil {
+		// the port is omitted
+		if strings.Contains(endpoint, ":") && !strings.HasPrefix(endpoint, "[") {
+			return "", errors.Trace(ErrInvalidEndpoint)
+		}
+		host, port = strings.Trim(endpoint, "[]"), strconv.Itoa(DefaultPort)
+	}
+	if host == "" {
+		return "", errors.Trace(ErrInvalidEndpoint)
+	}
+	if _, err = strconv.ParseUint(port, 10, 16); err != nil {
+		return "", errors.Trace(ErrInvalidEndpoint)
+	}
+	return net.JoinHostPort(host, port), nil
+}
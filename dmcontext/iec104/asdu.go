@@ -0,0 +1,314 @@
+package iec104
+
+import (
+	"encoding/binary"
+	"math"
+	"time"
+
+	"github.com/baetyl/baetyl-go/v2/errors"
+)
+
+const (
+	// asduHeaderLength the length of type, variable structure qualifier, cause of transmission and common address
+	asduHeaderLength = 6
+	ioaLength        = 3
+	cp56Length       = 7
+	maxObjects       = 0x7F
+)
+
+// ASDU the application service data unit, whose cause of transmission includes the originator address
+// and common address is of 2 octets, and information object address is of 3 octets
+type ASDU struct {
+	Type byte
+	// Sequence whether the objects are a sequence of elements addressed by the first address
+	Sequence   bool
+	Cause      byte
+	Negative   bool
+	Test       bool
+	Originator byte
+	CommonAddr uint16
+	Objects    []InformationObject
+}
+
+// InformationObject the information object of asdu. The value is a bool of single and double points and commands,
+// and a float64 of measured values and set-points. The value of a double point in indeterminate state is nil.
+type InformationObject struct {
+	IOA   uint32
+	Value any
+	// Quality the quality descriptor of monitored information
+	Quality byte
+	// Qualifier the qualifier of commands, such as select/execute and qualifier of command of SCO and DCO,
+	// the qualifier of set-point command, and the qualifier of interrogation
+	Qualifier byte
+	// Time the time tag of monitored information with CP56Time2a, zero if not tagged or invalid
+	Time time.Time
+}
+
+// elementLength returns the length of an information element of the type
+func elementLength(typ byte) (int, error) {
+	switch typ {
+	case MSpNa1, MDpNa1, CScNa1, CDcNa1, CIcNa1, MEiNa1:
+		return 1, nil
+	case MMeNa1, MMeNb1:
+		return 3, nil
+	case MMeNc1, CSeNc1:
+		return 5, nil
+	case MSpTb1, MDpTb1:
+		return 1 + cp56Length, nil
+	case MMeTd1, MMeTe1:
+		return 3 + cp56Length, nil
+	case MMeTf1:
+		return 5 + cp56Length, nil
+	}
+	return 0, errors.Trace(ErrTypeNotSupported)
+}
+
+func (a *ASDU) encode() ([]byte, error) {
+	size, err := elementLength(a.Type)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	n := len(a.Objects)
+	if n == 0 || n > maxObjects {
+		return nil, errors.Trace(ErrInvalidASDU)
+	}
+	buf := make([]byte, asduHeaderLength, maxASDULength)
+	buf[0] = a.Type
+	buf[1] = byte(n)
+	if a.Sequence {
+		buf[1] |= 0x80
+	}
+	buf[2] = a.Cause & 0x3F
+	if a.Negative {
+		buf[2] |= 0x40
+	}
+	if a.Test {
+		buf[2] |= 0x80
+	}
+	buf[3] = a.Originator
+	binary.LittleEndian.PutUint16(buf[4:], a.CommonAddr)
+	for i, o := range a.Objects {
+		if i == 0 || !a.Sequence {
+			if o.IOA > maxIOA {
+				return nil, errors.Trace(ErrInvalidASDU)
+			}
+			buf = append(buf, byte(o.IOA), byte(o.IOA>>8), byte(o.IOA>>16))
+		}
+		if buf, err = encodeElement(buf, a.Type, &o); err != nil {
+			return nil, errors.Trace(err)
+		}
+		if len(buf) > maxASDULength {
+			return nil, errors.Trace(ErrInvalidASDU)
+		}
+	}
+	if len(buf) != asduHeaderLength+size*n+ioaLength*objectAddresses(a.Sequence, n) {
+		return nil, errors.Trace(ErrInvalidASDU)
+	}
+	return buf, nil
+}
+
+func objectAddresses(sequence bool, n int) int {
+	if sequence {
+		return 1
+	}
+	return n
+}
+
+func encodeElement(buf []byte, typ byte, o *InformationObject) ([]byte, error) {
+	switch typ {
+	case MSpNa1, MSpTb1:
+		v, _ := o.Value.(bool)
+		b := o.Quality &^ 0x0F
+		if v {
+			b |= 0x01
+		}
+		buf = append(buf, b)
+	case MDpNa1, MDpTb1:
+		b := o.Quality &^ 0x0F
+		if v, ok := o.Value.(bool); ok {
+			b |= doubleState(v)
+		}
+		buf = append(buf, b)
+	case MMeNa1, MMeTd1:
+		v, _ := o.Value.(float64)
+		buf = appendUint16(buf, uint16(normalize(v)))
+		buf = append(buf, o.Quality)
+	case MMeNb1, MMeTe1:
+		v, _ := o.Value.(float64)
+		buf = appendUint16(buf, uint16(scale(v)))
+		buf = append(buf, o.Quality)
+	case MMeNc1, MMeTf1:
+		v, _ := o.Value.(float64)
+		buf = appendUint32(buf, math.Float32bits(float32(v)))
+		buf = append(buf, o.Quality)
+	case CScNa1:
+		v, _ := o.Value.(bool)
+		b := o.Qualifier &^ 0x03
+		if v {
+			b |= 0x01
+		}
+		buf = append(buf, b)
+	case CDcNa1:
+		v, _ := o.Value.(bool)
+		buf = append(buf, o.Qualifier&^0x03|doubleState(v))
+	case CSeNc1:
+		v, _ := o.Value.(float64)
+		buf = appendUint32(buf, math.Float32bits(float32(v)))
+		buf = append(buf, o.Qualifier)
+	case CIcNa1, MEiNa1:
+		buf = append(buf, o.Qualifier)
+	default:
+		return nil, errors.Trace(ErrTypeNotSupported)
+	}
+	switch typ {
+	case MSpTb1, MDpTb1, MMeTd1, MMeTe1, MMeTf1:
+		buf = appendCP56(buf, o.Time)
+	}
+	return buf, nil
+}
+
+func decodeASDU(buf []byte) (*ASDU, error) {
+	if len(buf) < asduHeaderLength {
+		return nil, errors.Trace(ErrInvalidASDU)
+	}
+	a := &ASDU{
+		Type:       buf[0],
+		Sequence:   buf[1]&0x80 != 0,
+		Cause:      buf[2] & 0x3F,
+		Negative:   buf[2]&0x40 != 0,
+		Test:       buf[2]&0x80 != 0,
+		Originator: buf[3],
+		CommonAddr: binary.LittleEndian.Uint16(buf[4:]),
+	}
+	n := int(buf[1] & 0x7F)
+	size, err := elementLength(a.Type)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	if n == 0 || len(buf) != asduHeaderLength+size*n+ioaLength*objectAddresses(a.Sequence, n) {
+		return nil, errors.Trace(ErrInvalidASDU)
+	}
+	buf = buf[asduHeaderLength:]
+	var ioa uint32
+	for i := 0; i < n; i++ {
+		if i == 0 || !a.Sequence {
+			ioa = uint32(buf[0]) | uint32(buf[1])<<8 | uint32(buf[2])<<16
+			buf = buf[ioaLength:]
+		} else {
+			ioa++
+		}
+		o := InformationObject{IOA: ioa}
+		decodeElement(a.Type, buf[:size], &o)
+		buf = buf[size:]
+		a.Objects = append(a.Objects, o)
+	}
+	return a, nil
+}
+
+func decodeElement(typ byte, buf []byte, o *InformationObject) {
+	switch typ {
+	case MSpNa1, MSpTb1:
+		o.Value = buf[0]&0x01 != 0
+		o.Quality = buf[0] &^ 0x0F
+	case MDpNa1, MDpTb1:
+		switch buf[0] & 0x03 {
+		case 0x01:
+			o.Value = false
+		case 0x02:
+			o.Value = true
+		}
+		o.Quality = buf[0] &^ 0x0F
+	case MMeNa1, MMeTd1:
+		o.Value = float64(int16(binary.LittleEndian.Uint16(buf))) / 32768
+		o.Quality = buf[2]
+	case MMeNb1, MMeTe1:
+		o.Value = float64(int16(binary.LittleEndian.Uint16(buf)))
+		o.Quality = buf[2]
+	case MMeNc1, MMeTf1:
+		o.Value = float64(math.Float32frombits(binary.LittleEndian.Uint32(buf)))
+		o.Quality = buf[4]
+	case CScNa1:
+		o.Value = buf[0]&0x01 != 0
+		o.Qualifier = buf[0] &^ 0x03
+	case CDcNa1:
+		o.Value = buf[0]&0x03 == 0x02
+		o.Qualifier = buf[0] &^ 0x03
+	case CSeNc1:
+		o.Value = float64(math.Float32frombits(binary.LittleEndian.Uint32(buf)))
+		o.Qualifier = buf[4]
+	case CIcNa1, MEiNa1:
+		o.Qualifier = buf[0]
+	}
+	switch typ {
+	case MSpTb1, MDpTb1, MMeTd1, MMeTe1, MMeTf1:
+		o.Time = decodeCP56(buf[len(buf)-cp56Length:])
+	}
+}
+
+func appendUint16(buf []byte, v uint16) []byte {
+	return append(buf, byte(v), byte(v>>8))
+}
+
+func appendUint32(buf []byte, v uint32) []byte {
+	return append(buf, byte(v), byte(v>>8), byte(v>>16), byte(v>>24))
+}
+
+// doubleState returns the double point state of on (2) or off (1)
+func doubleState(v bool) byte {
+	if v {
+		return 0x02
+	}
+	return 0x01
+}
+
+func normalize(v float64) int16 {
+	v = math.Round(v * 32768)
+	if v > math.MaxInt16 {
+		return math.MaxInt16
+	}
+	if v < math.MinInt16 {
+		return math.MinInt16
+	}
+	return int16(v)
+}
+
+func scale(v float64) int16 {
+	v = math.Round(v)
+	if v > math.MaxInt16 {
+		return math.MaxInt16
+	}
+	if v < math.MinInt16 {
+		return math.MinInt16
+	}
+	return int16(v)
+}
+
+// appendCP56 appends the time tag of CP56Time2a in the local time zone, the invalid bit is set if t is zero
+func appendCP56(buf []byte, t time.Time) []byte {
+	if t.IsZero() {
+		return append(buf, 0, 0, 0x80, 0, 0, 0, 0)
+	}
+	t = t.Local()
+	buf = appendUint16(buf, uint16(t.Second()*1000+t.Nanosecond()/int(time.Millisecond)))
+	weekday := t.Weekday()
+	if weekday == time.Sunday {
+		weekday = 7
+	}
+	return append(buf,
+		byte(t.Minute()),
+		byte(t.Hour()),
+		byte(t.Day())|byte(weekday)<<5,
+		byte(t.Month()),
+		byte(t.Year()%100),
+	)
+}
+
+// decodeCP56 decodes the time tag of CP56Time2a in the local time zone, zero is returned if it is invalid
+func decodeCP56(buf []byte) time.Time {
+	if buf[2]&0x80 != 0 {
+		return time.Time{}
+	}
+	ms := int(binary.LittleEndian.Uint16(buf))
+	return time.Date(2000+int(buf[6]&0x7F), time.Month(buf[5]&0x0F), int(buf[4]&0x1F),
+		int(buf[3]&0x1F), int(buf[2]&0x3F), ms/1000, ms%1000*int(time.Millisecond), time.Local)
+}
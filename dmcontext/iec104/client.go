@@ -0,0 +1,486 @@
+package iec104
+
+import (
+	"net"
+	"sync"
+	"time"
+
+	"github.com/baetyl/baetyl-go/v2/dmcontext"
+	"github.com/baetyl/baetyl-go/v2/errors"
+)
+
+// Client the iec104 master of an outstation, which is safe for concurrent use. Data transfer is started
+// and a general interrogation is executed once connected, then the points reported are kept up to date
+// by spontaneous transmission. The commands are executed one at a time.
+type Client struct {
+	address    string
+	commonAddr uint16
+	t0         time.Duration
+	t1         time.Duration
+	t2         time.Duration
+	t3         time.Duration
+	k          int
+	w          int
+	// giTimeout the timeout of general interrogation to be terminated
+	giTimeout time.Duration
+
+	conn net.Conn
+	done chan struct{}
+	err  error
+	// sendSeq V(S), recvSeq V(R), ackSeq the oldest send sequence number not acknowledged
+	sendSeq uint16
+	recvSeq uint16
+	ackSeq  uint16
+	// sent the times of i-format apdus sent and not acknowledged, the oldest first
+	sent []time.Time
+	// recvUnacked the number of i-format apdus received and not acknowledged, recvAt the time of the first one
+	recvUnacked int
+	recvAt      time.Time
+	lastRecv    time.Time
+	// testAt the time of test frame sent, zero if it is confirmed
+	testAt   time.Time
+	started  chan struct{}
+	commands map[commandKey]chan *ASDU
+	points   map[uint32]*Point
+	cond     *sync.Cond
+	wg       sync.WaitGroup
+	// mut protects the states of connection, cmut serializes connecting and closing, xmut serializes commands
+	mut  sync.Mutex
+	cmut sync.Mutex
+	xmut sync.Mutex
+}
+
+// Point the latest information of a point reported
+type Point struct {
+	Type    byte
+	Value   any
+	Quality byte
+	// Time the time tag, or the time received if not tagged
+	Time time.Time
+}
+
+type commandKey struct {
+	typ byte
+	ioa uint32
+}
+
+// NewClient creates a new client by the iec104 access config, the id of access config is the common address
+func NewClient(cfg *dmcontext.IEC104AccessConfig) (*Client, error) {
+	if cfg == nil {
+		return nil, errors.Trace(ErrAccessConfigInvalid)
+	}
+	address, err := parseEndpoint(cfg.Endpoint)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	c := &Client{
+		address:    address,
+		commonAddr: uint16(cfg.ID),
+		t0:         DefaultT0,
+		t1:         DefaultT1,
+		t2:         DefaultT2,
+		t3:         DefaultT3,
+		k:          DefaultK,
+		w:          DefaultW,
+		giTimeout:  DefaultInterrogationTimeout,
+		commands:   map[commandKey]chan *ASDU{},
+		points:     map[uint32]*Point{},
+	}
+	if c.commonAddr == 0 {
+		c.commonAddr = DefaultCommonAddress
+	}
+	c.cond = sync.NewCond(&c.mut)
+	return c, nil
+}
+
+// Connected returns whether the client is connected
+func (c *Client) Connected() bool {
+	c.mut.Lock()
+	defer c.mut.Unlock()
+	return c.connected()
+}
+
+func (c *Client) connected() bool {
+	if c.conn == nil {
+		return false
+	}
+	select {
+	case <-c.done:
+		return false
+	default:
+		return true
+	}
+}
+
+// Connect connects to the outstation if not connected, starts data transfer and executes a general interrogation
+func (c *Client) Connect() error {
+	c.cmut.Lock()
+	defer c.cmut.Unlock()
+	if c.Connected() {
+		return nil
+	}
+	c.closeConn()
+
+	nc, err := net.DialTimeout("tcp", c.address, c.t0)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	done, started := make(chan struct{}), make(chan struct{})
+	now := time.Now()
+	c.mut.Lock()
+	c.conn, c.done, c.err, c.started = nc, done, nil, started
+	c.sendSeq, c.recvSeq, c.ackSeq = 0, 0, 0
+	c.sent, c.recvUnacked, c.lastRecv, c.testAt = nil, 0, now, time.Time{}
+	// the points are reported again by the general interrogation
+	c.points = map[uint32]*Point{}
+	c.mut.Unlock()
+	c.wg.Add(2)
+	go c.reading(nc, done)
+	go c.keeping(done)
+
+	if err = c.start(); err != nil {
+		c.closeConn()
+		return errors.Trace(err)
+	}
+	if err = c.Interrogate(); err != nil {
+		c.closeConn()
+		return errors.Trace(err)
+	}
+	return nil
+}
+
+// start sends STARTDT act and waits for the confirmation
+func (c *Client) start() error {
+	c.mut.Lock()
+	err := c.writeAPDU(&apdu{format: formatU, u: uStartDTAct})
+	started, done := c.started, c.done
+	c.mut.Unlock()
+	if err != nil {
+		return errors.Trace(err)
+	}
+	timer := time.NewTimer(c.t1)
+	defer timer.Stop()
+	select {
+	case <-started:
+		return nil
+	case <-done:
+		return errors.Trace(c.lastErr())
+	case <-timer.C:
+		return errors.Trace(ErrTimeout)
+	}
+}
+
+// Close stops data transfer and closes the connection
+func (c *Client) Close() error {
+	c.cmut.Lock()
+	defer c.cmut.Unlock()
+	c.mut.Lock()
+	if c.connected() {
+		// the confirmation is not waited, since the connection is closed anyway
+		c.writeAPDU(&apdu{format: formatU, u: uStopDTAct})
+	}
+	c.mut.Unlock()
+	c.closeConn()
+	return nil
+}
+
+func (c *Client) closeConn() {
+	c.mut.Lock()
+	if c.conn == nil {
+		c.mut.Unlock()
+		return
+	}
+	c.fail(ErrClientClosed)
+	c.mut.Unlock()
+	c.wg.Wait()
+	c.mut.Lock()
+	c.conn = nil
+	c.mut.Unlock()
+}
+
+// fail closes the connection with the error if not closed, the mutex must be held
+func (c *Client) fail(err error) {
+	select {
+	case <-c.done:
+		return
+	default:
+	}
+	c.err = err
+	close(c.done)
+	c.conn.Close()
+	c.cond.Broadcast()
+}
+
+func (c *Client) lastErr() error {
+	c.mut.Lock()
+	defer c.mut.Unlock()
+	if c.err != nil {
+		return c.err
+	}
+	return ErrClientClosed
+}
+
+// writeAPDU writes an apdu, the mutex must be held to keep the order of sequence numbers
+func (c *Client) writeAPDU(a *apdu) error {
+	if !c.connected() {
+		return errors.Trace(ErrClientClosed)
+	}
+	if a.format != formatU {
+		a.recvSeq = c.recvSeq
+		c.recvUnacked = 0
+	}
+	if err := c.conn.SetWriteDeadline(time.Now().Add(c.t1)); err != nil {
+		return errors.Trace(err)
+	}
+	if _, err := c.conn.Write(a.encode()); err != nil {
+		c.fail(err)
+		return errors.Trace(err)
+	}
+	return nil
+}
+
+// send sends an asdu in an i-format apdu, it waits while k apdus sent are not acknowledged
+func (c *Client) send(a *ASDU) error {
+	buf, err := a.encode()
+	if err != nil {
+		return errors.Trace(err)
+	}
+	c.mut.Lock()
+	defer c.mut.Unlock()
+	for c.connected() && len(c.sent) >= c.k {
+		c.cond.Wait()
+	}
+	if err = c.writeAPDU(&apdu{format: formatI, sendSeq: c.sendSeq, asdu: buf}); err != nil {
+		return errors.Trace(err)
+	}
+	c.sendSeq = (c.sendSeq + 1) % seqModulo
+	c.sent = append(c.sent, time.Now())
+	return nil
+}
+
+func (c *Client) reading(nc net.Conn, done chan struct{}) {
+	defer c.wg.Done()
+	for {
+		a, err := readAPDU(nc)
+		c.mut.Lock()
+		if err != nil {
+			c.fail(err)
+			c.mut.Unlock()
+			return
+		}
+		c.lastRecv = time.Now()
+		var data *ASDU
+		switch a.format {
+		case formatI:
+			if a.sendSeq != c.recvSeq {
+				c.fail(errors.Trace(ErrSequenceMismatch))
+				break
+			}
+			c.recvSeq = (c.recvSeq + 1) % seqModulo
+			if c.recvUnacked == 0 {
+				c.recvAt = c.lastRecv
+			}
+			c.recvUnacked++
+			c.ack(a.recvSeq)
+			if c.recvUnacked >= c.w {
+				c.writeAPDU(&apdu{format: formatS})
+			}
+			// the asdu not supported is ignored
+			data, _ = decodeASDU(a.asdu)
+		case formatS:
+			c.ack(a.recvSeq)
+		case formatU:
+			switch a.u {
+			case uStartDTCon:
+				select {
+				case <-c.started:
+				default:
+					close(c.started)
+				}
+			case uTestFRAct:
+				c.writeAPDU(&apdu{format: formatU, u: uTestFRCon})
+			case uTestFRCon:
+				c.testAt = time.Time{}
+			}
+		}
+		c.mut.Unlock()
+		select {
+		case <-done:
+			return
+		default:
+		}
+		if data != nil {
+			c.dispatch(data)
+		}
+	}
+}
+
+// ack acknowledges the apdus sent before the receive sequence number of peer, the mutex must be held
+func (c *Client) ack(seq uint16) {
+	n := seqDiff(c.ackSeq, seq)
+	if n > len(c.sent) {
+		c.fail(errors.Trace(ErrSequenceMismatch))
+		return
+	}
+	c.sent = c.sent[n:]
+	c.ackSeq = seq
+	c.cond.Broadcast()
+}
+
+// keeping checks the timeouts of t1, t2 and t3 until the connection is closed
+func (c *Client) keeping(done chan struct{}) {
+	defer c.wg.Done()
+	tick := c.t1
+	for _, t := range []time.Duration{c.t2, c.t3} {
+		if t < tick {
+			tick = t
+		}
+	}
+	ticker := time.NewTicker(tick / 4)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+		}
+		now := time.Now()
+		c.mut.Lock()
+		switch {
+		case len(c.sent) > 0 && now.Sub(c.sent[0]) >= c.t1,
+			!c.testAt.IsZero() && now.Sub(c.testAt) >= c.t1:
+			c.fail(errors.Trace(ErrTimeout))
+		case c.recvUnacked > 0 && now.Sub(c.recvAt) >= c.t2:
+			c.writeAPDU(&apdu{format: formatS})
+		case c.testAt.IsZero() && now.Sub(c.lastRecv) >= c.t3:
+			if c.writeAPDU(&apdu{format: formatU, u: uTestFRAct}) == nil {
+				c.testAt = now
+			}
+		}
+		c.mut.Unlock()
+	}
+}
+
+// dispatch keeps the points reported, and passes the confirmations to the commands waiting
+func (c *Client) dispatch(a *ASDU) {
+	if a.CommonAddr != c.commonAddr {
+		return
+	}
+	switch a.Type {
+	case MSpNa1, MDpNa1, MMeNa1, MMeNb1, MMeNc1, MSpTb1, MDpTb1, MMeTd1, MMeTe1, MMeTf1:
+		now := time.Now()
+		c.mut.Lock()
+		for _, o := range a.Objects {
+			p := &Point{Type: a.Type, Value: o.Value, Quality: o.Quality, Time: o.Time}
+			if p.Time.IsZero() {
+				p.Time = now
+			}
+			c.points[o.IOA] = p
+		}
+		c.mut.Unlock()
+	case CScNa1, CDcNa1, CSeNc1, CIcNa1:
+		if len(a.Objects) == 0 {
+			return
+		}
+		c.mut.Lock()
+		ch, ok := c.commands[commandKey{typ: a.Type, ioa: a.Objects[0].IOA}]
+		c.mut.Unlock()
+		if !ok {
+			return
+		}
+		select {
+		case ch <- a:
+		default:
+		}
+	}
+}
+
+// Point returns the latest information of the point reported
+func (c *Client) Point(ioa uint32) (Point, bool) {
+	c.mut.Lock()
+	defer c.mut.Unlock()
+	p, ok := c.points[ioa]
+	if !ok {
+		return Point{}, false
+	}
+	return *p, true
+}
+
+// Interrogate executes a general interrogation, and waits for its termination
+func (c *Client) Interrogate() error {
+	return errors.Trace(c.command(CIcNa1, InformationObject{Qualifier: qoiStation}, true))
+}
+
+// SingleCommand executes a single command, and waits for its confirmation
+func (c *Client) SingleCommand(ioa uint32, value bool) error {
+	return errors.Trace(c.command(CScNa1, InformationObject{IOA: ioa, Value: value}, false))
+}
+
+// DoubleCommand executes a double command of on (true) or off (false), and waits for its confirmation
+func (c *Client) DoubleCommand(ioa uint32, value bool) error {
+	return errors.Trace(c.command(CDcNa1, InformationObject{IOA: ioa, Value: value}, false))
+}
+
+// SetpointCommand executes a set-point command of short floating point number, and waits for its confirmation
+func (c *Client) SetpointCommand(ioa uint32, value float64) error {
+	return errors.Trace(c.command(CSeNc1, InformationObject{IOA: ioa, Value: value}, false))
+}
+
+// command sends the command for activation, and waits for the activation confirmation,
+// and waits for the activation termination as well if term is true
+func (c *Client) command(typ byte, o InformationObject, term bool) error {
+	c.xmut.Lock()
+	defer c.xmut.Unlock()
+
+	key := commandKey{typ: typ, ioa: o.IOA}
+	ch := make(chan *ASDU, 2)
+	c.mut.Lock()
+	if !c.connected() {
+		c.mut.Unlock()
+		return errors.Trace(ErrClientClosed)
+	}
+	c.commands[key] = ch
+	done := c.done
+	c.mut.Unlock()
+	defer func() {
+		c.mut.Lock()
+		delete(c.commands, key)
+		c.mut.Unlock()
+	}()
+
+	err := c.send(&ASDU{
+		Type:       typ,
+		Cause:      CauseActivation,
+		CommonAddr: c.commonAddr,
+		Objects:    []InformationObject{o},
+	})
+	if err != nil {
+		return errors.Trace(err)
+	}
+	timer := time.NewTimer(c.t1)
+	defer timer.Stop()
+	for {
+		select {
+		case a := <-ch:
+			if a.Negative || a.Cause >= CauseUnknownType {
+				return errors.Trace(&CommandError{Type: typ, IOA: o.IOA, Cause: a.Cause})
+			}
+			switch a.Cause {
+			case CauseActivationCon:
+				if !term {
+					return nil
+				}
+				if !timer.Stop() {
+					<-timer.C
+				}
+				timer.Reset(c.giTimeout)
+			case CauseActivationTerm:
+				return nil
+			}
+		case <-done:
+			return errors.Trace(c.lastErr())
+		case <-timer.C:
+			return errors.Trace(ErrTimeout)
+		}
+	}
+}
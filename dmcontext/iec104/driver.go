@@ -0,0 +1,168 @@
+package iec104
+
+import (
+	"strings"
+	"sync"
+
+	"github.com/spf13/cast"
+
+	"github.com/baetyl/baetyl-go/v2/dmcontext"
+	"github.com/baetyl/baetyl-go/v2/errors"
+	"github.com/baetyl/baetyl-go/v2/log"
+)
+
+// Driver implements dmcontext.Driver for iec104 outstations, it keeps a client per device.
+// The properties are read from the points reported, and written by commands: a single or double
+// command to a point of do, which is decided by the type of point reported, and a set-point command to a point of ao.
+type Driver struct {
+	ctx        dmcontext.Context
+	driverName string
+	clients    map[string]*Client
+	log        *log.Logger
+	mut        sync.Mutex
+}
+
+// NewDriver creates a new iec104 driver, which is run by dmcontext.Runtime
+func NewDriver(ctx dmcontext.Context, driverName string) *Driver {
+	return &Driver{
+		ctx:        ctx,
+		driverName: driverName,
+		clients:    map[string]*Client{},
+		log:        log.L().With(log.Any("driver", driverName)),
+	}
+}
+
+func (d *Driver) client(dev *dmcontext.DeviceInfo) (*Client, error) {
+	d.mut.Lock()
+	defer d.mut.Unlock()
+	if cli, ok := d.clients[dev.Name]; ok {
+		return cli, nil
+	}
+	if dev.AccessConfig == nil {
+		return nil, errors.Trace(ErrAccessConfigInvalid)
+	}
+	cli, err := NewClient(dev.AccessConfig.IEC104)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	d.clients[dev.Name] = cli
+	return cli, nil
+}
+
+// Connect connects to the outstation, and executes a general interrogation
+func (d *Driver) Connect(dev *dmcontext.DeviceInfo) error {
+	cli, err := d.client(dev)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	return errors.Trace(cli.Connect())
+}
+
+// Read reads the properties which have iec104 visitors from the points reported.
+// The point not reported yet, or whose quality is invalid is skipped.
+func (d *Driver) Read(dev *dmcontext.DeviceInfo, props []dmcontext.DeviceProperty) (map[string]any, error) {
+	cli, err := d.client(dev)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	if !cli.Connected() {
+		return nil, errors.Trace(ErrClientClosed)
+	}
+	res := map[string]any{}
+	for _, p := range props {
+		if p.Visitor.IEC104 == nil {
+			continue
+		}
+		ioa, err := ResolveIOA(dev.AccessConfig.IEC104, p.Visitor.IEC104)
+		if err != nil {
+			d.log.Warn("property has invalid point", log.Any("device", dev.Name), log.Any("property", p.Name), log.Error(err))
+			continue
+		}
+		point, ok := cli.Point(ioa)
+		if !ok || point.Value == nil || point.Quality&QualityInvalid != 0 {
+			d.log.Debug("point is not reported or invalid", log.Any("device", dev.Name), log.Any("property", p.Name), log.Any("ioa", ioa))
+			continue
+		}
+		if res[p.ID], err = ToValue(p.Visitor.IEC104.Type, point.Value); err != nil {
+			return nil, errors.Trace(err)
+		}
+	}
+	return res, nil
+}
+
+// Write writes the values keyed by the property ids of access template by commands, one at a time
+func (d *Driver) Write(dev *dmcontext.DeviceInfo, values map[string]any) error {
+	cli, err := d.client(dev)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	tpl, err := d.ctx.GetAccessTemplates(d.driverName, dev.AccessTemplate)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	visitors := map[string]*dmcontext.IEC104Visitor{}
+	for _, p := range tpl.Properties {
+		visitors[p.ID] = p.Visitor.IEC104
+	}
+	for id, val := range values {
+		v, ok := visitors[id]
+		if !ok || v == nil {
+			return errors.Trace(dmcontext.ErrUnknownPropertyID)
+		}
+		ioa, err := ResolveIOA(dev.AccessConfig.IEC104, v)
+		if err != nil {
+			return errors.Trace(err)
+		}
+		switch strings.ToLower(v.PointType) {
+		case PointTypeDO:
+			b, err := cast.ToBoolE(val)
+			if err != nil {
+				return errors.Trace(err)
+			}
+			if point, ok := cli.Point(ioa); ok && (point.Type == MDpNa1 || point.Type == MDpTb1) {
+				err = cli.DoubleCommand(ioa, b)
+			} else {
+				err = cli.SingleCommand(ioa, b)
+			}
+			if err != nil {
+				return errors.Trace(err)
+			}
+		case PointTypeAO:
+			f, err := cast.ToFloat64E(val)
+			if err != nil {
+				return errors.Trace(err)
+			}
+			if err = cli.SetpointCommand(ioa, f); err != nil {
+				return errors.Trace(err)
+			}
+		default:
+			return errors.Trace(ErrReadOnly)
+		}
+	}
+	return nil
+}
+
+// Close closes the client of device
+func (d *Driver) Close(dev *dmcontext.DeviceInfo) error {
+	d.mut.Lock()
+	cli, ok := d.clients[dev.Name]
+	delete(d.clients, dev.Name)
+	d.mut.Unlock()
+	if !ok {
+		return nil
+	}
+	return errors.Trace(cli.Close())
+}
+
+// ToValue converts the value of point into the dmcontext type of visitor,
+// the value of a measured point is float32 and the value of a single or double point is bool if typ is empty
+func ToValue(typ string, v any) (any, error) {
+	if typ == "" {
+		if f, ok := v.(float64); ok {
+			return float32(f), nil
+		}
+		return v, nil
+	}
+	res, err := dmcontext.ParseValue(typ, v, nil)
+	return res, errors.Trace(err)
+}
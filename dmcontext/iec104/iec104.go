@@ -0,0 +1,144 @@
+// Package iec104 implements an IEC 60870-5-104 master (controlling station) to access the points of
+// outstations by dmcontext.IEC104Visitor.
+// The master keeps the values of points reported by general interrogation and spontaneous transmission,
+// and executes single, double and set-point commands.
+package iec104
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/baetyl/baetyl-go/v2/dmcontext"
+	"github.com/baetyl/baetyl-go/v2/errors"
+)
+
+// The default parameters of the protocol
+const (
+	DefaultPort = 2404
+	// DefaultT0 the timeout of connection establishment
+	DefaultT0 = 30 * time.Second
+	// DefaultT1 the timeout of send or test apdus to be acknowledged
+	DefaultT1 = 15 * time.Second
+	// DefaultT2 the timeout to acknowledge in case of no data messages
+	DefaultT2 = 10 * time.Second
+	// DefaultT3 the timeout to send test frames in case of a long idle state
+	DefaultT3 = 20 * time.Second
+	// DefaultK the max number of unacknowledged i-format apdus sent
+	DefaultK = 12
+	// DefaultW the latest acknowledge after receiving w i-format apdus
+	DefaultW = 8
+	// DefaultInterrogationTimeout the timeout of a general interrogation to be terminated
+	DefaultInterrogationTimeout = 30 * time.Second
+	// DefaultCommonAddress the common address of asdu if the id of access config is not set
+	DefaultCommonAddress = 1
+)
+
+// The type identifications supported
+const (
+	MSpNa1 byte = 1   // single-point information
+	MDpNa1 byte = 3   // double-point information
+	MMeNa1 byte = 9   // measured value, normalized value
+	MMeNb1 byte = 11  // measured value, scaled value
+	MMeNc1 byte = 13  // measured value, short floating point number
+	MSpTb1 byte = 30  // single-point information with time tag CP56Time2a
+	MDpTb1 byte = 31  // double-point information with time tag CP56Time2a
+	MMeTd1 byte = 34  // measured value, normalized value with time tag CP56Time2a
+	MMeTe1 byte = 35  // measured value, scaled value with time tag CP56Time2a
+	MMeTf1 byte = 36  // measured value, short floating point number with time tag CP56Time2a
+	CScNa1 byte = 45  // single command
+	CDcNa1 byte = 46  // double command
+	CSeNc1 byte = 50  // set-point command, short floating point number
+	MEiNa1 byte = 70  // end of initialization
+	CIcNa1 byte = 100 // interrogation command
+)
+
+// The causes of transmission used
+const (
+	CausePeriodic              byte = 1
+	CauseBackground            byte = 2
+	CauseSpontaneous           byte = 3
+	CauseInitialized           byte = 4
+	CauseRequest               byte = 5
+	CauseActivation            byte = 6
+	CauseActivationCon         byte = 7
+	CauseDeactivation          byte = 8
+	CauseActivationTerm        byte = 10
+	CauseInterrogatedByStation byte = 20
+	CauseUnknownType           byte = 44
+	CauseUnknownCause          byte = 45
+	CauseUnknownCommonAddress  byte = 46
+	CauseUnknownIOA            byte = 47
+)
+
+// The quality descriptor bits
+const (
+	QualityOverflow    byte = 0x01
+	QualityBlocked     byte = 0x10
+	QualitySubstituted byte = 0x20
+	QualityNotTopical  byte = 0x40
+	QualityInvalid     byte = 0x80
+)
+
+// The point types of visitor, the information object address of a point is the offset of its type
+// in access config plus the point number
+const (
+	PointTypeAI = "ai"
+	PointTypeDI = "di"
+	PointTypeAO = "ao"
+	PointTypeDO = "do"
+)
+
+const (
+	// qoiStation the qualifier of interrogation of station interrogation
+	qoiStation = 20
+	// maxIOA the max information object address of 3 octets
+	maxIOA = 0xFFFFFF
+)
+
+var (
+	ErrInvalidFrame        = errors.New("invalid iec104 frame")
+	ErrInvalidASDU         = errors.New("invalid iec104 asdu")
+	ErrInvalidEndpoint     = errors.New("invalid iec104 endpoint")
+	ErrInvalidPointType    = errors.New("invalid iec104 point type, must be one of ai, di, ao and do")
+	ErrTypeNotSupported    = errors.New("iec104 type identification not supported")
+	ErrClientClosed        = errors.New("iec104 client is closed")
+	ErrTimeout             = errors.New("iec104 timeout")
+	ErrSequenceMismatch    = errors.New("iec104 send sequence number mismatch")
+	ErrReadOnly            = errors.New("iec104 point is read only")
+	ErrAccessConfigInvalid = errors.New("iec104 access config is invalid")
+)
+
+// CommandError the error of a command confirmed negatively by the outstation
+type CommandError struct {
+	Type  byte
+	IOA   uint32
+	Cause byte
+}
+
+func (e *CommandError) Error() string {
+	return fmt.Sprintf("iec104 command (type %d) of ioa (%d) is confirmed negatively with cause %d", e.Type, e.IOA, e.Cause)
+}
+
+// ResolveIOA returns the information object address of the point visited, which is the offset of
+// the point type in access config plus the point number
+func ResolveIOA(cfg *dmcontext.IEC104AccessConfig, v *dmcontext.IEC104Visitor) (uint32, error) {
+	var offset uint16
+	switch strings.ToLower(v.PointType) {
+	case PointTypeAI:
+		offset = cfg.AIOffset
+	case PointTypeDI:
+		offset = cfg.DIOffset
+	case PointTypeAO:
+		offset = cfg.AOOffset
+	case PointTypeDO:
+		offset = cfg.DOOffset
+	default:
+		return 0, errors.Trace(ErrInvalidPointType)
+	}
+	ioa := uint64(offset) + uint64(v.PointNum)
+	if ioa > maxIOA {
+		return 0, errors.Errorf("iec104 ioa (%d) is out of range", ioa)
+	}
+	return uint32(ioa), nil
+}
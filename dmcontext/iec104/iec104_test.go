@@ -0,0 +1,348 @@
+package iec104
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/baetyl/baetyl-go/v2/dmcontext"
+	"github.com/baetyl/baetyl-go/v2/dmcontext/dmcontexttest"
+	"github.com/baetyl/baetyl-go/v2/errors"
+)
+
+func TestAPDU(t *testing.T) {
+	for _, a := range []*apdu{
+		{format: formatI, sendSeq: 0x1234, recvSeq: 0x7FFF, asdu: []byte{1, 2, 3}},
+		{format: formatS, recvSeq: 300},
+		{format: formatU, u: uStartDTAct},
+		{format: formatU, u: uTestFRCon},
+	} {
+		res, err := readAPDU(bytes.NewReader(a.encode()))
+		assert.NoError(t, err)
+		assert.Equal(t, a, res)
+	}
+	assert.Equal(t, []byte{0x68, 0x04, 0x07, 0x00, 0x00, 0x00}, (&apdu{format: formatU, u: uStartDTAct}).encode())
+	assert.Equal(t, []byte{0x68, 0x04, 0x01, 0x00, 0x02, 0x00}, (&apdu{format: formatS, recvSeq: 1}).encode())
+
+	for _, b := range [][]byte{
+		{0x67, 0x04, 0x07, 0x00, 0x00, 0x00},
+		{0x68, 0x03, 0x07, 0x00, 0x00},
+		{0x68, 0x04, 0x00, 0x00, 0x00, 0x00},
+		{0x68, 0x05, 0x07, 0x00, 0x00, 0x00, 0x01},
+	} {
+		_, err := readAPDU(bytes.NewReader(b))
+		assert.Equal(t, ErrInvalidFrame, errors.Cause(err), b)
+	}
+
+	assert.Equal(t, 0, seqDiff(10, 10))
+	assert.Equal(t, 2, seqDiff(seqModulo-1, 1))
+
+	for endpoint, address := range map[string]string{
+		"127.0.0.1":          "127.0.0.1:2404",
+		"127.0.0.1:2405":     "127.0.0.1:2405",
+		"tcp://station:2406": "station:2406",
+		"[::1]":              "[::1]:2404",
+	} {
+		res, err := parseEndpoint(endpoint)
+		assert.NoError(t, err, endpoint)
+		assert.Equal(t, address, res)
+	}
+	for _, endpoint := range []string{"", "udp://127.0.0.1", "127.0.0.1:port", ":2404", "127.0.0.1:70000"} {
+		_, err := parseEndpoint(endpoint)
+		assert.Equal(t, ErrInvalidEndpoint, errors.Cause(err), endpoint)
+	}
+}
+
+func TestASDU(t *testing.T) {
+	now := time.Date(2023, 5, 6, 7, 8, 9, 123000000, time.Local)
+	cases := []*ASDU{
+		{Type: MSpNa1, Cause: CauseSpontaneous, CommonAddr: 1, Objects: []InformationObject{
+			{IOA: 1, Value: true}, {IOA: 0x123456, Value: false, Quality: QualityInvalid},
+		}},
+		{Type: MDpNa1, Cause: CauseInterrogatedByStation, Sequence: true, CommonAddr: 1, Objects: []InformationObject{
+			{IOA: 10, Value: true}, {IOA: 11, Value: false}, {IOA: 12},
+		}},
+		{Type: MMeNa1, Cause: CausePeriodic, CommonAddr: 2, Objects: []InformationObject{{IOA: 100, Value: -0.5}}},
+		{Type: MMeNb1, Cause: CauseBackground, CommonAddr: 2, Objects: []InformationObject{{IOA: 100, Value: float64(-300), Quality: QualityOverflow}}},
+		{Type: MMeNc1, Cause: CauseRequest, CommonAddr: 2, Objects: []InformationObject{{IOA: 100, Value: 25.5}}},
+		{Type: MSpTb1, Cause: CauseSpontaneous, CommonAddr: 1, Objects: []InformationObject{{IOA: 1, Value: true, Time: now}}},
+		{Type: MDpTb1, Cause: CauseSpontaneous, CommonAddr: 1, Objects: []InformationObject{{IOA: 1, Value: false, Time: now}}},
+		{Type: MMeTd1, Cause: CauseSpontaneous, CommonAddr: 1, Objects: []InformationObject{{IOA: 1, Value: 0.25, Time: now}}},
+		{Type: MMeTe1, Cause: CauseSpontaneous, CommonAddr: 1, Objects: []InformationObject{{IOA: 1, Value: float64(12), Time: now}}},
+		{Type: MMeTf1, Cause: CauseSpontaneous, CommonAddr: 1, Objects: []InformationObject{{IOA: 1, Value: 1.5}}},
+		{Type: CScNa1, Cause: CauseActivation, CommonAddr: 1, Objects: []InformationObject{{IOA: 1, Value: true, Qualifier: 0x80}}},
+		{Type: CDcNa1, Cause: CauseActivationCon, Negative: true, CommonAddr: 1, Objects: []InformationObject{{IOA: 1, Value: true}}},
+		{Type: CSeNc1, Cause: CauseActivationTerm, Test: true, Originator: 3, CommonAddr: 1, Objects: []InformationObject{{IOA: 1, Value: 12.5}}},
+		{Type: CIcNa1, Cause: CauseActivation, CommonAddr: 0xFFFF, Objects: []InformationObject{{Qualifier: qoiStation}}},
+	}
+	for _, a := range cases {
+		buf, err := a.encode()
+		assert.NoError(t, err, a.Type)
+		res, err := decodeASDU(buf)
+		assert.NoError(t, err, a.Type)
+		assert.Equal(t, a, res, a.Type)
+	}
+
+	buf, err := (&ASDU{Type: MMeNc1, Cause: CauseSpontaneous, CommonAddr: 1, Objects: []InformationObject{{IOA: 1, Value: 25.5}}}).encode()
+	assert.NoError(t, err)
+	assert.Equal(t, []byte{13, 1, 3, 0, 1, 0, 1, 0, 0, 0x00, 0x00, 0xCC, 0x41, 0}, buf)
+	res, err := decodeASDU(buf[:len(buf)-1])
+	assert.Nil(t, res)
+	assert.Equal(t, ErrInvalidASDU, errors.Cause(err))
+	_, err = decodeASDU([]byte{127, 1, 3, 0, 1, 0, 1, 0, 0, 0})
+	assert.Equal(t, ErrTypeNotSupported, errors.Cause(err))
+	_, err = (&ASDU{Type: MMeNc1}).encode()
+	assert.Equal(t, ErrInvalidASDU, errors.Cause(err))
+	_, err = (&ASDU{Type: MMeNc1, Objects: make([]InformationObject, 40)}).encode()
+	assert.Equal(t, ErrInvalidASDU, errors.Cause(err))
+
+	// normalized and scaled values are limited
+	a := &ASDU{Type: MMeNa1, Objects: []InformationObject{{Value: 2.0}}}
+	buf, err = a.encode()
+	assert.NoError(t, err)
+	res, err = decodeASDU(buf)
+	assert.NoError(t, err)
+	assert.Equal(t, float64(32767)/32768, res.Objects[0].Value)
+	// the invalid time tag is decoded as zero
+	assert.True(t, decodeCP56(appendCP56(nil, time.Time{})).IsZero())
+	assert.Equal(t, now, decodeCP56(appendCP56(nil, now)))
+}
+
+func TestResolveIOA(t *testing.T) {
+	cfg := &dmcontext.IEC104AccessConfig{AIOffset: 16385, DIOffset: 1, AOOffset: 25089, DOOffset: 24577}
+	for typ, ioa := range map[string]uint32{"ai": 16387, "DI": 3, "ao": 25091, "do": 24579} {
+		res, err := ResolveIOA(cfg, &dmcontext.IEC104Visitor{PointNum: 2, PointType: typ})
+		assert.NoError(t, err)
+		assert.Equal(t, ioa, res)
+	}
+	_, err := ResolveIOA(cfg, &dmcontext.IEC104Visitor{PointType: "yc"})
+	assert.Equal(t, ErrInvalidPointType, errors.Cause(err))
+	_, err = ResolveIOA(cfg, &dmcontext.IEC104Visitor{PointNum: 0xFFFFFF, PointType: "ai"})
+	assert.EqualError(t, err, "iec104 ioa (16793600) is out of range")
+}
+
+func newOutstation(t *testing.T) *simulator {
+	sim := startSimulator(t)
+	sim.SetPoint(1, MSpNa1, true)
+	sim.SetPoint(2, MDpNa1, false)
+	sim.SetPoint(100, MMeNc1, 25.5)
+	sim.SetPoint(101, MMeNb1, float64(300))
+	sim.SetPoint(102, MMeNa1, 0.5)
+	sim.SetPoint(103, MMeTf1, 1.5)
+	sim.SetPoint(200, MMeNc1, float64(0))
+	return sim
+}
+
+func newClient(t *testing.T, sim *simulator) *Client {
+	cli, err := NewClient(&dmcontext.IEC104AccessConfig{Endpoint: sim.Endpoint()})
+	assert.NoError(t, err)
+	cli.t0, cli.t1, cli.t2, cli.t3, cli.giTimeout = time.Second, time.Second, time.Second, time.Minute, time.Second
+	return cli
+}
+
+func pointValue(cli *Client, ioa uint32) any {
+	p, _ := cli.Point(ioa)
+	return p.Value
+}
+
+func TestClient(t *testing.T) {
+	sim := newOutstation(t)
+
+	_, err := NewClient(nil)
+	assert.Equal(t, ErrAccessConfigInvalid, errors.Cause(err))
+	_, err = NewClient(&dmcontext.IEC104AccessConfig{})
+	assert.Equal(t, ErrInvalidEndpoint, errors.Cause(err))
+
+	cli := newClient(t, sim)
+	defer cli.Close()
+	assert.Equal(t, ErrClientClosed, errors.Cause(cli.SingleCommand(1, true)))
+	assert.NoError(t, cli.Connect())
+	assert.NoError(t, cli.Connect())
+	assert.True(t, cli.Connected())
+
+	// the points are reported by the general interrogation
+	p, ok := cli.Point(1)
+	assert.True(t, ok)
+	assert.Equal(t, MSpNa1, p.Type)
+	assert.Equal(t, true, p.Value)
+	assert.False(t, p.Time.IsZero())
+	assert.Equal(t, false, pointValue(cli, 2))
+	assert.Equal(t, 25.5, pointValue(cli, 100))
+	assert.Equal(t, float64(300), pointValue(cli, 101))
+	assert.Equal(t, 0.5, pointValue(cli, 102))
+	p, ok = cli.Point(103)
+	assert.True(t, ok)
+	assert.Equal(t, MMeTf1, p.Type)
+	assert.Equal(t, 1.5, p.Value)
+	_, ok = cli.Point(999)
+	assert.False(t, ok)
+
+	// spontaneous transmission
+	sim.SetPoint(100, MMeNc1, 26.0)
+	sim.SetPoint(300, MSpTb1, true)
+	assert.Eventually(t, func() bool {
+		return pointValue(cli, 100) == 26.0 && pointValue(cli, 300) == true
+	}, time.Second, 10*time.Millisecond)
+
+	// commands
+	assert.NoError(t, cli.SingleCommand(1, false))
+	assert.Equal(t, false, sim.Value(1))
+	assert.NoError(t, cli.DoubleCommand(2, true))
+	assert.Equal(t, true, sim.Value(2))
+	assert.NoError(t, cli.SetpointCommand(200, 12.5))
+	assert.Equal(t, 12.5, sim.Value(200))
+	assert.Eventually(t, func() bool {
+		return pointValue(cli, 1) == false && pointValue(cli, 2) == true && pointValue(cli, 200) == 12.5
+	}, time.Second, 10*time.Millisecond)
+
+	err = cli.SingleCommand(999, true)
+	assert.Equal(t, &CommandError{Type: CScNa1, IOA: 999, Cause: CauseUnknownIOA}, errors.Cause(err))
+	assert.EqualError(t, err, "iec104 command (type 45) of ioa (999) is confirmed negatively with cause 47")
+	err = cli.SingleCommand(2, true)
+	assert.Equal(t, &CommandError{Type: CScNa1, IOA: 2, Cause: CauseUnknownIOA}, errors.Cause(err))
+	sim.SetCommonAddress(2)
+	err = cli.SetpointCommand(200, 1)
+	assert.Equal(t, &CommandError{Type: CSeNc1, IOA: 200, Cause: CauseUnknownCommonAddress}, errors.Cause(err))
+	sim.SetCommonAddress(DefaultCommonAddress)
+	assert.NoError(t, cli.Interrogate())
+
+	assert.NoError(t, cli.Close())
+	assert.False(t, cli.Connected())
+	assert.NoError(t, cli.Close())
+	assert.Equal(t, ErrClientClosed, errors.Cause(cli.Interrogate()))
+
+	// reconnect
+	assert.NoError(t, cli.Connect())
+	assert.Equal(t, 12.5, pointValue(cli, 200))
+}
+
+func TestClientTimers(t *testing.T) {
+	sim := newOutstation(t)
+	count := func() (int, int) {
+		sim.mut.Lock()
+		defer sim.mut.Unlock()
+		return sim.tests, sim.acks
+	}
+
+	cli := newClient(t, sim)
+	defer cli.Close()
+	cli.t2 = 50 * time.Millisecond
+	cli.t3 = 100 * time.Millisecond
+	assert.NoError(t, cli.Connect())
+
+	// the i-format apdus received are acknowledged by s-format after t2
+	_, acks := count()
+	assert.Eventually(t, func() bool {
+		_, n := count()
+		return n > acks
+	}, time.Second, 10*time.Millisecond)
+	// the i-format apdus received are acknowledged by s-format after w
+	_, acks = count()
+	for i := 0; i < DefaultW; i++ {
+		sim.SetPoint(100, MMeNc1, float64(i))
+	}
+	assert.Eventually(t, func() bool {
+		_, n := count()
+		return n > acks && pointValue(cli, 100) == float64(DefaultW-1)
+	}, time.Second, 10*time.Millisecond)
+
+	// test frames are sent in idle state after t3, and the connection is kept
+	assert.Eventually(t, func() bool {
+		n, _ := count()
+		return n >= 2
+	}, time.Second, 10*time.Millisecond)
+	assert.True(t, cli.Connected())
+
+	// the connection is closed if the test frame is not confirmed in t1
+	cli.t1 = 100 * time.Millisecond
+	sim.mut.Lock()
+	sim.muted = true
+	sim.mut.Unlock()
+	assert.Eventually(t, func() bool { return !cli.Connected() }, 2*time.Second, 10*time.Millisecond)
+	assert.Equal(t, ErrTimeout, errors.Cause(cli.lastErr()))
+	assert.Equal(t, ErrClientClosed, errors.Cause(cli.SingleCommand(1, true)))
+
+	sim.mut.Lock()
+	sim.muted = false
+	sim.mut.Unlock()
+	assert.NoError(t, cli.Connect())
+	assert.NoError(t, cli.SingleCommand(1, false))
+}
+
+func TestDriver(t *testing.T) {
+	sim := newOutstation(t)
+
+	ctx := dmcontexttest.NewContext(t)
+	visitor := func(typ string, num uint, valueType string) dmcontext.PropertyVisitor {
+		return dmcontext.PropertyVisitor{IEC104: &dmcontext.IEC104Visitor{PointType: typ, PointNum: num, Type: valueType}}
+	}
+	err := ctx.SetDriverConfig("iec104", dmcontexttest.DriverConfig{
+		Devices: []dmcontext.DeviceInfo{{
+			Name:           "dev1",
+			AccessTemplate: "tpl1",
+			AccessConfig: &dmcontext.AccessConfig{IEC104: &dmcontext.IEC104AccessConfig{
+				Endpoint: sim.Endpoint(),
+				AIOffset: 100,
+				DIOffset: 1,
+				AOOffset: 200,
+				DOOffset: 1,
+			}},
+		}},
+		AccessTemplates: map[string]dmcontext.AccessTemplate{
+			"tpl1": {Properties: []dmcontext.DeviceProperty{
+				{ID: "1", Name: "temp", Type: dmcontext.TypeFloat32, Visitor: visitor("ai", 0, dmcontext.TypeFloat32)},
+				{ID: "2", Name: "pressure", Type: dmcontext.TypeFloat32, Visitor: visitor("ai", 3, "")},
+				{ID: "3", Name: "switch", Type: dmcontext.TypeBool, Visitor: visitor("di", 0, dmcontext.TypeBool)},
+				{ID: "4", Name: "breaker", Type: dmcontext.TypeBool, Visitor: visitor("di", 1, "")},
+				{ID: "5", Name: "target", Type: dmcontext.TypeFloat32, Visitor: visitor("ao", 0, dmcontext.TypeFloat32)},
+				{ID: "6", Name: "switchCtl", Type: dmcontext.TypeBool, Visitor: visitor("do", 0, dmcontext.TypeBool)},
+				{ID: "7", Name: "breakerCtl", Type: dmcontext.TypeBool, Visitor: visitor("do", 1, dmcontext.TypeBool)},
+				{ID: "8", Name: "missing", Type: dmcontext.TypeFloat32, Visitor: visitor("ai", 50, dmcontext.TypeFloat32)},
+				{ID: "9", Name: "invalid", Type: dmcontext.TypeFloat32, Visitor: visitor("yc", 0, dmcontext.TypeFloat32)},
+				{ID: "10", Name: "missingCtl", Type: dmcontext.TypeBool, Visitor: visitor("do", 98, dmcontext.TypeBool)},
+			}},
+		},
+	})
+	assert.NoError(t, err)
+	dev, err := ctx.GetDevice("iec104", "dev1")
+	assert.NoError(t, err)
+	tpl, err := ctx.GetAccessTemplates("iec104", "tpl1")
+	assert.NoError(t, err)
+
+	d := NewDriver(ctx, "iec104")
+	_, err = d.Read(dev, tpl.Properties)
+	assert.Equal(t, ErrClientClosed, errors.Cause(err))
+	assert.NoError(t, d.Connect(dev))
+	values, err := d.Read(dev, tpl.Properties)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]any{
+		"1": float32(25.5),
+		"2": float32(1.5),
+		"3": true,
+		"4": false,
+		"5": float32(0),
+		"6": true,
+		"7": false,
+	}, values)
+
+	// the do point reported as a double point is controlled by a double command
+	assert.NoError(t, d.Write(dev, map[string]any{"5": 12.5, "6": false, "7": "true"}))
+	assert.Equal(t, 12.5, sim.Value(200))
+	assert.Equal(t, false, sim.Value(1))
+	assert.Equal(t, true, sim.Value(2))
+	assert.Eventually(t, func() bool {
+		values, err := d.Read(dev, tpl.Properties)
+		return err == nil && values["3"] == false && values["4"] == true && values["5"] == float32(12.5)
+	}, time.Second, 10*time.Millisecond)
+
+	assert.Equal(t, ErrReadOnly, errors.Cause(d.Write(dev, map[string]any{"1": 1})))
+	assert.Equal(t, dmcontext.ErrUnknownPropertyID, errors.Cause(d.Write(dev, map[string]any{"11": 1})))
+	assert.Equal(t, ErrInvalidPointType, errors.Cause(d.Write(dev, map[string]any{"9": 1})))
+	err = d.Write(dev, map[string]any{"10": true})
+	assert.Equal(t, &CommandError{Type: CScNa1, IOA: 99, Cause: CauseUnknownIOA}, errors.Cause(err))
+
+	assert.NoError(t, d.Close(dev))
+	assert.NoError(t, d.Close(dev))
+}
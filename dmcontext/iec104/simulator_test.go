@@ -0,0 +1,312 @@
+package iec104
+
+import (
+	"net"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/baetyl/baetyl-go/v2/errors"
+	"github.com/baetyl/baetyl-go/v2/utils"
+)
+
+// simulator an in-process iec104 outstation for test, which reports the points by general interrogation
+// and spontaneous transmission, and executes the commands to the points of matching types
+type simulator struct {
+	listener   net.Listener
+	commonAddr uint16
+	points     map[uint32]*simulatorPoint
+	conns      map[*simulatorConn]struct{}
+	// muted does not confirm test frames, tests and acks count the test frames and s-format apdus received
+	muted bool
+	tests int
+	acks  int
+	tomb  utils.Tomb
+	mut   sync.Mutex
+}
+
+type simulatorPoint struct {
+	typ   byte
+	value any
+}
+
+type simulatorConn struct {
+	conn        net.Conn
+	started     bool
+	sendSeq     uint16
+	recvSeq     uint16
+	recvUnacked int
+}
+
+// startSimulator starts a simulator on localhost with the default common address, which is closed when the test finishes
+func startSimulator(t testing.TB) *simulator {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to start simulator: %s", err)
+	}
+	s := &simulator{
+		listener:   listener,
+		commonAddr: DefaultCommonAddress,
+		points:     map[uint32]*simulatorPoint{},
+		conns:      map[*simulatorConn]struct{}{},
+	}
+	s.tomb.Go(s.accept)
+	t.Cleanup(func() { s.Close() })
+	return s
+}
+
+// Endpoint returns the endpoint of simulator, such as 127.0.0.1:2404
+func (s *simulator) Endpoint() string {
+	return s.listener.Addr().String()
+}
+
+// SetCommonAddress sets the common address of simulator
+func (s *simulator) SetCommonAddress(addr uint16) {
+	s.mut.Lock()
+	defer s.mut.Unlock()
+	s.commonAddr = addr
+}
+
+// SetPoint sets the point with a monitored type, such as MSpNa1 with a bool value and MMeNc1 with a float64 value.
+// The point is transmitted spontaneously if data transfer is started.
+func (s *simulator) SetPoint(ioa uint32, typ byte, value any) {
+	s.mut.Lock()
+	defer s.mut.Unlock()
+	s.points[ioa] = &simulatorPoint{typ: typ, value: value}
+	s.broadcast(CauseSpontaneous, ioa)
+}
+
+// Value returns the value of point
+func (s *simulator) Value(ioa uint32) any {
+	s.mut.Lock()
+	defer s.mut.Unlock()
+	if p, ok := s.points[ioa]; ok {
+		return p.value
+	}
+	return nil
+}
+
+// Close stops serving and closes all connections
+func (s *simulator) Close() error {
+	s.tomb.Kill(nil)
+	err := s.listener.Close()
+	s.mut.Lock()
+	for c := range s.conns {
+		c.conn.Close()
+	}
+	s.mut.Unlock()
+	s.tomb.Wait()
+	return errors.Trace(err)
+}
+
+func (s *simulator) accept() error {
+	for {
+		nc, err := s.listener.Accept()
+		if err != nil {
+			if !s.tomb.Alive() {
+				return nil
+			}
+			return errors.Trace(err)
+		}
+		c := &simulatorConn{conn: nc}
+		s.mut.Lock()
+		s.conns[c] = struct{}{}
+		s.mut.Unlock()
+		s.tomb.Go(func() error {
+			s.serve(c)
+			return nil
+		})
+	}
+}
+
+func (s *simulator) serve(c *simulatorConn) {
+	defer func() {
+		s.mut.Lock()
+		delete(s.conns, c)
+		s.mut.Unlock()
+		c.conn.Close()
+	}()
+	for {
+		a, err := readAPDU(c.conn)
+		if err != nil {
+			return
+		}
+		s.mut.Lock()
+		switch a.format {
+		case formatU:
+			switch a.u {
+			case uStartDTAct:
+				c.started = true
+				err = s.write(c, &apdu{format: formatU, u: uStartDTCon})
+			case uStopDTAct:
+				c.started = false
+				err = s.write(c, &apdu{format: formatU, u: uStopDTCon})
+			case uTestFRAct:
+				s.tests++
+				if !s.muted {
+					err = s.write(c, &apdu{format: formatU, u: uTestFRCon})
+				}
+			}
+		case formatS:
+			s.acks++
+		case formatI:
+			if a.sendSeq != c.recvSeq {
+				err = ErrSequenceMismatch
+				break
+			}
+			c.recvSeq = (c.recvSeq + 1) % seqModulo
+			c.recvUnacked++
+			if c.started {
+				err = s.handle(c, a.asdu)
+			}
+			if err == nil && c.recvUnacked >= DefaultW {
+				err = s.write(c, &apdu{format: formatS})
+			}
+		}
+		s.mut.Unlock()
+		if err != nil {
+			return
+		}
+	}
+}
+
+// write writes an apdu to the connection, the mutex must be held
+func (s *simulator) write(c *simulatorConn, a *apdu) error {
+	if a.format == formatI {
+		a.sendSeq = c.sendSeq
+		c.sendSeq = (c.sendSeq + 1) % seqModulo
+	}
+	if a.format != formatU {
+		a.recvSeq = c.recvSeq
+		c.recvUnacked = 0
+	}
+	_, err := c.conn.Write(a.encode())
+	return errors.Trace(err)
+}
+
+func (s *simulator) send(c *simulatorConn, a *ASDU) error {
+	if a.CommonAddr == 0 {
+		a.CommonAddr = s.commonAddr
+	}
+	buf, err := a.encode()
+	if err != nil {
+		return errors.Trace(err)
+	}
+	return errors.Trace(s.write(c, &apdu{format: formatI, asdu: buf}))
+}
+
+// broadcast transmits the point to the connections started, the mutex must be held
+func (s *simulator) broadcast(cause byte, ioa uint32) {
+	for c := range s.conns {
+		if c.started {
+			s.send(c, s.pointASDU(cause, ioa))
+		}
+	}
+}
+
+func (s *simulator) pointASDU(cause byte, ioas ...uint32) *ASDU {
+	a := &ASDU{Type: s.points[ioas[0]].typ, Cause: cause}
+	for _, ioa := range ioas {
+		p := s.points[ioa]
+		o := InformationObject{IOA: ioa, Value: p.value}
+		if p.value == nil && p.typ != MDpNa1 && p.typ != MDpTb1 {
+			o.Quality = QualityInvalid
+		}
+		switch p.typ {
+		case MSpTb1, MDpTb1, MMeTd1, MMeTe1, MMeTf1:
+			o.Time = time.Now()
+		}
+		a.Objects = append(a.Objects, o)
+	}
+	return a
+}
+
+// handle handles the command received, the mutex must be held
+func (s *simulator) handle(c *simulatorConn, buf []byte) error {
+	a, err := decodeASDU(buf)
+	if err != nil {
+		// the asdu of unknown type is ignored
+		if errors.Cause(err) == ErrTypeNotSupported {
+			return nil
+		}
+		return errors.Trace(err)
+	}
+	if a.CommonAddr != s.commonAddr {
+		return errors.Trace(s.confirm(c, a, CauseUnknownCommonAddress, true))
+	}
+	if a.Cause != CauseActivation {
+		return errors.Trace(s.confirm(c, a, CauseUnknownCause, true))
+	}
+	o := a.Objects[0]
+	if a.Type == CIcNa1 {
+		return errors.Trace(s.interrogate(c, a))
+	}
+	p, ok := s.points[o.IOA]
+	if !ok || !commandMatches(a.Type, p.typ) {
+		return errors.Trace(s.confirm(c, a, CauseUnknownIOA, true))
+	}
+	// select (s/e bit is 1) is confirmed without execution
+	if o.Qualifier&0x80 != 0 {
+		return errors.Trace(s.confirm(c, a, CauseActivationCon, false))
+	}
+	if err = s.confirm(c, a, CauseActivationCon, false); err != nil {
+		return errors.Trace(err)
+	}
+	p.value = o.Value
+	s.broadcast(CauseSpontaneous, o.IOA)
+	return errors.Trace(s.confirm(c, a, CauseActivationTerm, false))
+}
+
+// commandMatches returns whether the command is able to control the point of the monitored type
+func commandMatches(command, point byte) bool {
+	switch command {
+	case CScNa1:
+		return point == MSpNa1 || point == MSpTb1
+	case CDcNa1:
+		return point == MDpNa1 || point == MDpTb1
+	case CSeNc1:
+		return point == MMeNa1 || point == MMeNb1 || point == MMeNc1 || point == MMeTd1 || point == MMeTe1 || point == MMeTf1
+	}
+	return false
+}
+
+// confirm responds to the command with the cause, the common address received is mirrored
+func (s *simulator) confirm(c *simulatorConn, a *ASDU, cause byte, negative bool) error {
+	return errors.Trace(s.send(c, &ASDU{Type: a.Type, Cause: cause, Negative: negative, CommonAddr: a.CommonAddr, Objects: a.Objects[:1]}))
+}
+
+// interrogate responds to the general interrogation with all points, which are grouped by type
+func (s *simulator) interrogate(c *simulatorConn, a *ASDU) error {
+	if err := s.confirm(c, a, CauseActivationCon, false); err != nil {
+		return errors.Trace(err)
+	}
+	groups := map[byte][]uint32{}
+	var types []byte
+	for ioa, p := range s.points {
+		if _, ok := groups[p.typ]; !ok {
+			types = append(types, p.typ)
+		}
+		groups[p.typ] = append(groups[p.typ], ioa)
+	}
+	sort.Slice(types, func(i, j int) bool { return types[i] < types[j] })
+	for _, typ := range types {
+		ioas := groups[typ]
+		sort.Slice(ioas, func(i, j int) bool { return ioas[i] < ioas[j] })
+		size, err := elementLength(typ)
+		if err != nil {
+			return errors.Trace(err)
+		}
+		n := (maxASDULength - asduHeaderLength) / (ioaLength + size)
+		for len(ioas) > 0 {
+			if n > len(ioas) {
+				n = len(ioas)
+			}
+			if err = s.send(c, s.pointASDU(CauseInterrogatedByStation, ioas[:n]...)); err != nil {
+				return errors.Trace(err)
+			}
+			ioas = ioas[n:]
+		}
+	}
+	return errors.Trace(s.confirm(c, a, CauseActivationTerm, false))
+}
@@ -0,0 +1,349 @@
+package modbus
+
+import (
+	"encoding/binary"
+	"sync"
+	"time"
+
+	"github.com/baetyl/baetyl-go/v2/dmcontext"
+	"github.com/baetyl/baetyl-go/v2/errors"
+)
+
+var (
+	ErrAccessConfigInvalid = errors.New("modbus access config must have tcp or rtu")
+	ErrReadOnly            = errors.New("modbus discrete inputs and input registers are read-only")
+)
+
+// Client the modbus client to access one slave over tcp or rtu, which is safe for concurrent use.
+// The connection is established on demand, and closed if idle for the idle timeout of config.
+type Client struct {
+	slaveID     byte
+	idleTimeout time.Duration
+	transporter transporter
+	idle        *time.Timer
+	mut         sync.Mutex
+}
+
+// NewClient creates a new client by the modbus access config
+func NewClient(cfg *dmcontext.ModbusAccessConfig) (*Client, error) {
+	var t transporter
+	switch {
+	case cfg == nil:
+		return nil, errors.Trace(ErrAccessConfigInvalid)
+	case cfg.TCP != nil:
+		t = newTCPTransporter(cfg.TCP, cfg.Timeout)
+	case cfg.RTU != nil:
+		t = newRTUTransporter(cfg.RTU, cfg.Timeout)
+	default:
+		return nil, errors.Trace(ErrAccessConfigInvalid)
+	}
+	return &Client{
+		slaveID:     cfg.ID,
+		idleTimeout: cfg.IdleTimeout,
+		transporter: t,
+	}, nil
+}
+
+// Connect connects to the slave if not connected
+func (c *Client) Connect() error {
+	c.mut.Lock()
+	defer c.mut.Unlock()
+	if err := c.transporter.connect(); err != nil {
+		return errors.Trace(err)
+	}
+	c.resetIdle()
+	return nil
+}
+
+// Close closes the connection, which will be reestablished by the next request
+func (c *Client) Close() error {
+	c.mut.Lock()
+	defer c.mut.Unlock()
+	if c.idle != nil {
+		c.idle.Stop()
+		c.idle = nil
+	}
+	return errors.Trace(c.transporter.close())
+}
+
+// resetIdle closes the connection after idle timeout, must be called with lock held
+func (c *Client) resetIdle() {
+	if c.idleTimeout <= 0 {
+		return
+	}
+	if c.idle != nil {
+		c.idle.Stop()
+	}
+	c.idle = time.AfterFunc(c.idleTimeout, func() {
+		c.mut.Lock()
+		defer c.mut.Unlock()
+		c.transporter.close()
+	})
+}
+
+// request sends the pdu to the slave of config
+func (c *Client) request(pdu []byte) ([]byte, error) {
+	return c.requestTo(c.slaveID, pdu)
+}
+
+// requestTo sends the pdu to the slave and checks the response, the connection is closed if failed to transport,
+// so that the next request starts with a clean connection
+func (c *Client) requestTo(slaveID byte, pdu []byte) ([]byte, error) {
+	c.mut.Lock()
+	defer c.mut.Unlock()
+	if err := c.transporter.connect(); err != nil {
+		return nil, errors.Trace(err)
+	}
+	res, err := c.transporter.send(slaveID, pdu)
+	if err != nil {
+		c.transporter.close()
+		return nil, errors.Trace(err)
+	}
+	c.resetIdle()
+	if err = checkResponse(pdu[0], res); err != nil {
+		return nil, errors.Trace(err)
+	}
+	return res, nil
+}
+
+// ReadRaw reads the quantity of bits or registers from address by the read function,
+// returns the packed bits or the registers in big-endian as responded
+func (c *Client) ReadRaw(function byte, address, quantity uint16) ([]byte, error) {
+	return c.readRaw(c.slaveID, function, address, quantity)
+}
+
+func (c *Client) readRaw(slaveID, function byte, address, quantity uint16) ([]byte, error) {
+	var size int
+	switch function {
+	case FuncReadCoils, FuncReadDiscreteInputs:
+		if quantity == 0 || quantity > MaxReadBits {
+			return nil, errors.Trace(ErrInvalidQuantity)
+		}
+		size = (int(quantity) + 7) / 8
+	case FuncReadHoldingRegisters, FuncReadInputRegisters:
+		if quantity == 0 || quantity > MaxReadRegisters {
+			return nil, errors.Trace(ErrInvalidQuantity)
+		}
+		size = int(quantity) * 2
+	default:
+		return nil, errors.Trace(&ExceptionError{Function: function, Code: ExceptionIllegalFunction})
+	}
+	res, err := c.requestTo(slaveID, readRequest(function, address, quantity))
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	if int(res[1]) != size || len(res) != size+2 {
+		return nil, errors.Trace(ErrInvalidResponse)
+	}
+	return res[2:], nil
+}
+
+// ReadCoils reads the quantity of coils from address
+func (c *Client) ReadCoils(address, quantity uint16) ([]bool, error) {
+	data, err := c.ReadRaw(FuncReadCoils, address, quantity)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	return unpackBits(data, quantity), nil
+}
+
+// ReadDiscreteInputs reads the quantity of discrete inputs from address
+func (c *Client) ReadDiscreteInputs(address, quantity uint16) ([]bool, error) {
+	data, err := c.ReadRaw(FuncReadDiscreteInputs, address, quantity)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	return unpackBits(data, quantity), nil
+}
+
+// ReadHoldingRegisters reads the quantity of holding registers from address
+func (c *Client) ReadHoldingRegisters(address, quantity uint16) ([]uint16, error) {
+	data, err := c.ReadRaw(FuncReadHoldingRegisters, address, quantity)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	return unpackRegisters(data), nil
+}
+
+// ReadInputRegisters reads the quantity of input registers from address
+func (c *Client) ReadInputRegisters(address, quantity uint16) ([]uint16, error) {
+	data, err := c.ReadRaw(FuncReadInputRegisters, address, quantity)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	return unpackRegisters(data), nil
+}
+
+// WriteSingleCoil writes a coil at address
+func (c *Client) WriteSingleCoil(address uint16, value bool) error {
+	pdu := make([]byte, 5)
+	pdu[0] = FuncWriteSingleCoil
+	binary.BigEndian.PutUint16(pdu[1:], address)
+	if value {
+		pdu[3] = 0xFF
+	}
+	_, err := c.request(pdu)
+	return errors.Trace(err)
+}
+
+// WriteSingleRegister writes a holding register at address
+func (c *Client) WriteSingleRegister(address, value uint16) error {
+	pdu := make([]byte, 5)
+	pdu[0] = FuncWriteSingleRegister
+	binary.BigEndian.PutUint16(pdu[1:], address)
+	binary.BigEndian.PutUint16(pdu[3:], value)
+	_, err := c.request(pdu)
+	return errors.Trace(err)
+}
+
+// WriteMultipleCoils writes the coils from address
+func (c *Client) WriteMultipleCoils(address uint16, values []bool) error {
+	if len(values) == 0 || len(values) > MaxWriteBits {
+		return errors.Trace(ErrInvalidQuantity)
+	}
+	data := packBits(values)
+	pdu := make([]byte, 6, 6+len(data))
+	pdu[0] = FuncWriteMultipleCoils
+	binary.BigEndian.PutUint16(pdu[1:], address)
+	binary.BigEndian.PutUint16(pdu[3:], uint16(len(values)))
+	pdu[5] = byte(len(data))
+	_, err := c.request(append(pdu, data...))
+	return errors.Trace(err)
+}
+
+// WriteMultipleRegisters writes the holding registers from address
+func (c *Client) WriteMultipleRegisters(address uint16, values []uint16) error {
+	if len(values) == 0 || len(values) > MaxWriteRegisters {
+		return errors.Trace(ErrInvalidQuantity)
+	}
+	pdu := make([]byte, 6, 6+len(values)*2)
+	pdu[0] = FuncWriteMultipleRegisters
+	binary.BigEndian.PutUint16(pdu[1:], address)
+	binary.BigEndian.PutUint16(pdu[3:], uint16(len(values)))
+	pdu[5] = byte(len(values) * 2)
+	for _, v := range values {
+		pdu = appendUint16(pdu, v)
+	}
+	_, err := c.request(pdu)
+	return errors.Trace(err)
+}
+
+// Read reads the value of property by the visitor
+func (c *Client) Read(v *dmcontext.ModbusVisitor) (any, error) {
+	address, err := ParseAddress(v.Address)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	quantity, err := Quantity(v)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	data, err := c.ReadRaw(v.Function, address, quantity)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	res, err := Decode(v, data)
+	return res, errors.Trace(err)
+}
+
+// ReadBatch reads the points by the requests planned, returns the values and the exceptions keyed by point id.
+// If a request of several points is responded with an exception, such as the gap between points is not readable,
+// the points are read one by one, so that only the points failed are reported in exceptions.
+// Other errors, such as timeout, abort reading and are returned.
+func (c *Client) ReadBatch(reqs []*Request) (map[string]any, map[string]error, error) {
+	values := map[string]any{}
+	exceptions := map[string]error{}
+	for _, req := range reqs {
+		data, err := c.readRaw(req.SlaveID, req.Function, req.Address, req.Quantity)
+		if err == nil {
+			var res map[string]any
+			res, err = req.Split(data)
+			if err != nil {
+				return nil, nil, errors.Trace(err)
+			}
+			for k, v := range res {
+				values[k] = v
+			}
+			continue
+		}
+		if _, ok := errors.Cause(err).(*ExceptionError); !ok {
+			return nil, nil, errors.Trace(err)
+		}
+		if len(req.Points) == 1 {
+			exceptions[req.Points[0].ID] = err
+			continue
+		}
+		for _, pt := range req.Points {
+			single := &Request{
+				SlaveID:  req.SlaveID,
+				Function: req.Function,
+				Address:  pt.Address,
+				Quantity: pt.Quantity,
+				Points:   []PlannedPoint{pt},
+			}
+			res, excs, err := c.ReadBatch([]*Request{single})
+			if err != nil {
+				return nil, nil, errors.Trace(err)
+			}
+			for k, v := range res {
+				values[k] = v
+			}
+			for k, v := range excs {
+				exceptions[k] = v
+			}
+		}
+	}
+	return values, exceptions, nil
+}
+
+// Write writes the value of property by the visitor, coils are written by function 5,
+// and holding registers by function 6 if one register, otherwise 16
+func (c *Client) Write(v *dmcontext.ModbusVisitor, value any) error {
+	if v.Function == FuncReadDiscreteInputs || v.Function == FuncReadInputRegisters {
+		return errors.Trace(ErrReadOnly)
+	}
+	address, err := ParseAddress(v.Address)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	data, err := Encode(v, value)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	switch v.Function {
+	case FuncReadCoils:
+		return errors.Trace(c.WriteSingleCoil(address, data[0] == 1))
+	case FuncReadHoldingRegisters:
+		if len(data) == 2 {
+			return errors.Trace(c.WriteSingleRegister(address, binary.BigEndian.Uint16(data)))
+		}
+		return errors.Trace(c.WriteMultipleRegisters(address, unpackRegisters(data)))
+	}
+	return errors.Trace(&ExceptionError{Function: v.Function, Code: ExceptionIllegalFunction})
+}
+
+func unpackBits(data []byte, quantity uint16) []bool {
+	res := make([]bool, quantity)
+	for i := range res {
+		res[i] = data[i/8]>>(i%8)&1 == 1
+	}
+	return res
+}
+
+func packBits(values []bool) []byte {
+	res := make([]byte, (len(values)+7)/8)
+	for i, v := range values {
+		if v {
+			res[i/8] |= 1 << (i % 8)
+		}
+	}
+	return res
+}
+
+func unpackRegisters(data []byte) []uint16 {
+	res := make([]uint16, len(data)/2)
+	for i := range res {
+		res[i] = binary.BigEndian.Uint16(data[i*2:])
+	}
+	return res
+}
@@ -0,0 +1,211 @@
+package modbus
+
+import (
+	"encoding/binary"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/cast"
+
+	"github.com/baetyl/baetyl-go/v2/dmcontext"
+	"github.com/baetyl/baetyl-go/v2/errors"
+)
+
+// isBitFunction returns whether the function reads bits, that is coils or discrete inputs
+func isBitFunction(function byte) bool {
+	return function == FuncReadCoils || function == FuncReadDiscreteInputs
+}
+
+// ParseAddress parses the address of visitor, which is decimal or hexadecimal with the prefix 0x
+func ParseAddress(address string) (uint16, error) {
+	v, err := strconv.ParseUint(strings.TrimSpace(address), 0, 16)
+	if err != nil {
+		return 0, errors.Trace(err)
+	}
+	return uint16(v), nil
+}
+
+// typeQuantity returns the number of registers of the type, 0 if it is determined by the visitor, such as string
+func typeQuantity(typ string) uint16 {
+	switch typ {
+	case dmcontext.TypeBool, dmcontext.TypeInt16:
+		return 1
+	case dmcontext.TypeInt32, dmcontext.TypeFloat32:
+		return 2
+	case dmcontext.TypeInt64, dmcontext.TypeFloat64:
+		return 4
+	}
+	return 0
+}
+
+// Quantity returns the number of bits or registers to read by the visitor.
+// The quantity of visitor is used if set, which must not be less than the quantity of the type.
+func Quantity(v *dmcontext.ModbusVisitor) (uint16, error) {
+	if isBitFunction(v.Function) {
+		if v.Quantity > 0 {
+			return v.Quantity, nil
+		}
+		return 1, nil
+	}
+	n := typeQuantity(v.Type)
+	switch {
+	case v.Quantity == 0 && n == 0:
+		return 0, errors.Trace(ErrInvalidQuantity)
+	case v.Quantity == 0:
+		return n, nil
+	case v.Quantity < n:
+		return 0, errors.Trace(ErrInvalidQuantity)
+	}
+	return v.Quantity, nil
+}
+
+// reorder swaps the bytes in each register, and reverses the order of registers,
+// to convert between the byte order of device and big-endian
+func reorder(data []byte, swapByte, swapRegister bool) []byte {
+	res := make([]byte, len(data))
+	copy(res, data)
+	if swapByte {
+		for i := 0; i+1 < len(res); i += 2 {
+			res[i], res[i+1] = res[i+1], res[i]
+		}
+	}
+	if swapRegister {
+		for i, j := 0, len(res)-2; i < j; i, j = i+2, j-2 {
+			res[i], res[i+1], res[j], res[j+1] = res[j], res[j+1], res[i], res[i+1]
+		}
+	}
+	return res
+}
+
+// Decode decodes the data read by the visitor into the value of visitor type.
+// The data of bits is packed as responded, and the value is multiplied by scale if set.
+func Decode(v *dmcontext.ModbusVisitor, data []byte) (any, error) {
+	if isBitFunction(v.Function) {
+		if len(data) == 0 {
+			return nil, errors.Trace(ErrInvalidResponse)
+		}
+		b := data[0]&1 == 1
+		if v.Type == "" || v.Type == dmcontext.TypeBool {
+			return b, nil
+		}
+		res, err := dmcontext.ParseValue(v.Type, b, nil)
+		return res, errors.Trace(err)
+	}
+
+	n := typeQuantity(v.Type)
+	if len(data) < int(n)*2 || len(data)%2 != 0 {
+		return nil, errors.Trace(ErrInvalidResponse)
+	}
+	data = reorder(data, v.SwapByte, v.SwapRegister)
+	var f float64
+	switch v.Type {
+	case dmcontext.TypeBool:
+		return binary.BigEndian.Uint16(data) != 0, nil
+	case dmcontext.TypeString:
+		return strings.TrimRight(string(data), "\x00"), nil
+	case dmcontext.TypeInt16:
+		f = float64(int16(binary.BigEndian.Uint16(data)))
+	case dmcontext.TypeInt32:
+		f = float64(int32(binary.BigEndian.Uint32(data)))
+	case dmcontext.TypeInt64:
+		i := int64(binary.BigEndian.Uint64(data))
+		if v.Scale == 0 || v.Scale == 1 {
+			// keep the precision of large integers
+			return i, nil
+		}
+		f = float64(i)
+	case dmcontext.TypeFloat32:
+		f = float64(math.Float32frombits(binary.BigEndian.Uint32(data)))
+	case dmcontext.TypeFloat64:
+		f = math.Float64frombits(binary.BigEndian.Uint64(data))
+	default:
+		return nil, errors.Trace(dmcontext.ErrTypeNotSupported)
+	}
+	if v.Scale != 0 && v.Scale != 1 {
+		f *= v.Scale
+		if v.Type != dmcontext.TypeFloat32 && v.Type != dmcontext.TypeFloat64 {
+			f = math.Round(f)
+		}
+	}
+	res, err := dmcontext.ParsePropertyValue(v.Type, f)
+	return res, errors.Trace(err)
+}
+
+// Encode encodes the value into the data to write by the visitor, which is divided by scale if set.
+// The value of bits is encoded into one byte, which is 1 if true, otherwise 0.
+func Encode(v *dmcontext.ModbusVisitor, value any) ([]byte, error) {
+	if isBitFunction(v.Function) || v.Type == dmcontext.TypeBool {
+		b, err := cast.ToBoolE(value)
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+		if isBitFunction(v.Function) {
+			if b {
+				return []byte{1}, nil
+			}
+			return []byte{0}, nil
+		}
+		data := make([]byte, 2)
+		if b {
+			data[1] = 1
+		}
+		return reorder(data, v.SwapByte, v.SwapRegister), nil
+	}
+
+	if v.Type == dmcontext.TypeString {
+		s, err := cast.ToStringE(value)
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+		data := []byte(s)
+		if len(data)%2 != 0 {
+			data = append(data, 0)
+		}
+		return reorder(data, v.SwapByte, v.SwapRegister), nil
+	}
+
+	var data []byte
+	if v.Type == dmcontext.TypeInt64 && (v.Scale == 0 || v.Scale == 1) {
+		i, err := cast.ToInt64E(value)
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+		data = appendUint64(nil, uint64(i))
+		return reorder(data, v.SwapByte, v.SwapRegister), nil
+	}
+	f, err := cast.ToFloat64E(value)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	if v.Scale != 0 && v.Scale != 1 {
+		f /= v.Scale
+	}
+	switch v.Type {
+	case dmcontext.TypeInt16:
+		data = appendUint16(nil, uint16(int16(math.Round(f))))
+	case dmcontext.TypeInt32:
+		data = appendUint32(nil, uint32(int32(math.Round(f))))
+	case dmcontext.TypeInt64:
+		data = appendUint64(nil, uint64(int64(math.Round(f))))
+	case dmcontext.TypeFloat32:
+		data = appendUint32(nil, math.Float32bits(float32(f)))
+	case dmcontext.TypeFloat64:
+		data = appendUint64(nil, math.Float64bits(f))
+	default:
+		return nil, errors.Trace(dmcontext.ErrTypeNotSupported)
+	}
+	return reorder(data, v.SwapByte, v.SwapRegister), nil
+}
+
+func appendUint16(buf []byte, v uint16) []byte {
+	return append(buf, byte(v>>8), byte(v))
+}
+
+func appendUint32(buf []byte, v uint32) []byte {
+	return append(buf, byte(v>>24), byte(v>>16), byte(v>>8), byte(v))
+}
+
+func appendUint64(buf []byte, v uint64) []byte {
+	return appendUint32(appendUint32(buf, uint32(v>>32)), uint32(v))
+}
@@ -0,0 +1,123 @@
+package modbus
+
+import (
+	"sync"
+
+	"github.com/baetyl/baetyl-go/v2/dmcontext"
+	"github.com/baetyl/baetyl-go/v2/errors"
+	"github.com/baetyl/baetyl-go/v2/log"
+)
+
+// Driver implements dmcontext.Driver for modbus devices, it keeps a client per device,
+// and reads the properties of a device in batch by the planner
+type Driver struct {
+	ctx        dmcontext.Context
+	driverName string
+	planner    *Planner
+	clients    map[string]*Client
+	log        *log.Logger
+	mut        sync.Mutex
+}
+
+// NewDriver creates a new modbus driver, which is run by dmcontext.Runtime
+func NewDriver(ctx dmcontext.Context, driverName string) *Driver {
+	return &Driver{
+		ctx:        ctx,
+		driverName: driverName,
+		planner:    NewPlanner(DefaultMaxGap),
+		clients:    map[string]*Client{},
+		log:        log.L().With(log.Any("driver", driverName)),
+	}
+}
+
+func (d *Driver) client(dev *dmcontext.DeviceInfo) (*Client, error) {
+	d.mut.Lock()
+	defer d.mut.Unlock()
+	if cli, ok := d.clients[dev.Name]; ok {
+		return cli, nil
+	}
+	if dev.AccessConfig == nil {
+		return nil, errors.Trace(ErrAccessConfigInvalid)
+	}
+	cli, err := NewClient(dev.AccessConfig.Modbus)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	d.clients[dev.Name] = cli
+	return cli, nil
+}
+
+// Connect connects to the device
+func (d *Driver) Connect(dev *dmcontext.DeviceInfo) error {
+	cli, err := d.client(dev)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	return errors.Trace(cli.Connect())
+}
+
+// Read reads the properties which have modbus visitors in the minimal requests. The property responded
+// with an exception is skipped, since it is misconfigured rather than the device is offline.
+func (d *Driver) Read(dev *dmcontext.DeviceInfo, props []dmcontext.DeviceProperty) (map[string]any, error) {
+	cli, err := d.client(dev)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	var points []Point
+	for _, p := range props {
+		if p.Visitor.Modbus == nil {
+			continue
+		}
+		points = append(points, Point{ID: p.ID, SlaveID: dev.AccessConfig.Modbus.ID, Visitor: p.Visitor.Modbus})
+	}
+	reqs, err := d.planner.Plan(points)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	res, exceptions, err := cli.ReadBatch(reqs)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	for id, err := range exceptions {
+		d.log.Warn("failed to read property", log.Any("device", dev.Name), log.Any("id", id), log.Error(err))
+	}
+	return res, nil
+}
+
+// Write writes the values keyed by the property ids of access template
+func (d *Driver) Write(dev *dmcontext.DeviceInfo, values map[string]any) error {
+	cli, err := d.client(dev)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	tpl, err := d.ctx.GetAccessTemplates(d.driverName, dev.AccessTemplate)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	props := map[string]*dmcontext.ModbusVisitor{}
+	for _, p := range tpl.Properties {
+		props[p.ID] = p.Visitor.Modbus
+	}
+	for id, val := range values {
+		v, ok := props[id]
+		if !ok || v == nil {
+			return errors.Trace(dmcontext.ErrUnknownPropertyID)
+		}
+		if err = cli.Write(v, val); err != nil {
+			return errors.Trace(err)
+		}
+	}
+	return nil
+}
+
+// Close closes the client of device
+func (d *Driver) Close(dev *dmcontext.DeviceInfo) error {
+	d.mut.Lock()
+	cli, ok := d.clients[dev.Name]
+	delete(d.clients, dev.Name)
+	d.mut.Unlock()
+	if !ok {
+		return nil
+	}
+	return errors.Trace(cli.Close())
+}
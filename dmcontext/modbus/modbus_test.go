@@ -0,0 +1,261 @@
+package modbus
+
+import (
+	"io"
+	"math"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/baetyl/baetyl-go/v2/dmcontext"
+	"github.com/baetyl/baetyl-go/v2/dmcontext/dmcontexttest"
+	"github.com/baetyl/baetyl-go/v2/errors"
+)
+
+func TestCodec(t *testing.T) {
+	cases := []struct {
+		visitor dmcontext.ModbusVisitor
+		data    []byte
+		value   any
+	}{
+		{dmcontext.ModbusVisitor{Function: 1, Type: dmcontext.TypeBool}, []byte{1}, true},
+		{dmcontext.ModbusVisitor{Function: 3, Type: dmcontext.TypeBool}, []byte{0, 1}, true},
+		{dmcontext.ModbusVisitor{Function: 3, Type: dmcontext.TypeInt16}, []byte{0xFF, 0xFE}, int16(-2)},
+		{dmcontext.ModbusVisitor{Function: 3, Type: dmcontext.TypeInt16, SwapByte: true}, []byte{0xFE, 0xFF}, int16(-2)},
+		{dmcontext.ModbusVisitor{Function: 3, Type: dmcontext.TypeInt16, Scale: 0.1}, []byte{0, 0xFF}, int16(26)},
+		{dmcontext.ModbusVisitor{Function: 4, Type: dmcontext.TypeInt32}, []byte{0, 1, 0, 2}, int32(65538)},
+		{dmcontext.ModbusVisitor{Function: 4, Type: dmcontext.TypeInt32, SwapRegister: true}, []byte{0, 2, 0, 1}, int32(65538)},
+		{dmcontext.ModbusVisitor{Function: 3, Type: dmcontext.TypeInt64}, []byte{0x7F, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF}, int64(math.MaxInt64)},
+		{dmcontext.ModbusVisitor{Function: 3, Type: dmcontext.TypeFloat32}, []byte{0x41, 0xC8, 0, 0}, float32(25)},
+		{dmcontext.ModbusVisitor{Function: 3, Type: dmcontext.TypeFloat32, SwapByte: true, SwapRegister: true}, []byte{0, 0, 0xC8, 0x41}, float32(25)},
+		{dmcontext.ModbusVisitor{Function: 3, Type: dmcontext.TypeFloat64, Scale: 2}, []byte{0x40, 0x09, 0x21, 0xFB, 0x54, 0x44, 0x2D, 0x18}, math.Pi * 2},
+		{dmcontext.ModbusVisitor{Function: 3, Type: dmcontext.TypeString, Quantity: 2}, []byte{'a', 'b', 'c', 0}, "abc"},
+	}
+	for _, c := range cases {
+		v, err := Decode(&c.visitor, c.data)
+		assert.NoError(t, err)
+		assert.Equal(t, c.value, v, c.visitor)
+
+		data, err := Encode(&c.visitor, c.value)
+		assert.NoError(t, err)
+		if c.visitor.Scale == 0 {
+			assert.Equal(t, c.data, data, c.visitor)
+		}
+	}
+
+	_, err := Decode(&dmcontext.ModbusVisitor{Function: 3, Type: dmcontext.TypeInt32}, []byte{0, 1})
+	assert.Equal(t, ErrInvalidResponse, errors.Cause(err))
+	_, err = Encode(&dmcontext.ModbusVisitor{Function: 3, Type: dmcontext.TypeInt32}, "abc")
+	assert.Error(t, err)
+
+	q, err := Quantity(&dmcontext.ModbusVisitor{Function: 3, Type: dmcontext.TypeFloat64})
+	assert.NoError(t, err)
+	assert.Equal(t, uint16(4), q)
+	_, err = Quantity(&dmcontext.ModbusVisitor{Function: 3, Type: dmcontext.TypeString})
+	assert.Equal(t, ErrInvalidQuantity, errors.Cause(err))
+	_, err = Quantity(&dmcontext.ModbusVisitor{Function: 3, Type: dmcontext.TypeInt32, Quantity: 1})
+	assert.Equal(t, ErrInvalidQuantity, errors.Cause(err))
+
+	a, err := ParseAddress("0x10")
+	assert.NoError(t, err)
+	assert.Equal(t, uint16(16), a)
+	_, err = ParseAddress("65536")
+	assert.Error(t, err)
+}
+
+func TestClientTCP(t *testing.T) {
+	sim := startSimulator(t)
+
+	cli, err := NewClient(&dmcontext.ModbusAccessConfig{ID: 1, Timeout: time.Second, TCP: sim.TCPConfig()})
+	assert.NoError(t, err)
+	defer cli.Close()
+	testClient(t, cli, sim)
+
+	_, err = NewClient(&dmcontext.ModbusAccessConfig{})
+	assert.Equal(t, ErrAccessConfigInvalid, errors.Cause(err))
+}
+
+func TestClientRTU(t *testing.T) {
+	sim := startSimulator(t)
+
+	client, server := net.Pipe()
+	go sim.ServeRTU(server)
+	defer server.Close()
+
+	cli := &Client{
+		slaveID: 1,
+		transporter: &rtuTransporter{
+			open: func() (io.ReadWriteCloser, error) {
+				return client, nil
+			},
+			timeout: time.Second,
+			silence: frameSilence(115200),
+		},
+	}
+	defer cli.Close()
+	testClient(t, cli, sim)
+}
+
+func testClient(t *testing.T, cli *Client, sim *simulator) {
+	assert.NoError(t, cli.Connect())
+
+	sim.SetCoil(3, true)
+	coils, err := cli.ReadCoils(0, 10)
+	assert.NoError(t, err)
+	assert.Equal(t, []bool{false, false, false, true, false, false, false, false, false, false}, coils)
+	assert.NoError(t, cli.WriteSingleCoil(9, true))
+	assert.NoError(t, cli.WriteMultipleCoils(0, []bool{true, true}))
+	coils, err = cli.ReadCoils(0, 10)
+	assert.NoError(t, err)
+	assert.Equal(t, []bool{true, true, false, true, false, false, false, false, false, true}, coils)
+
+	sim.SetDiscreteInput(1, true)
+	inputs, err := cli.ReadDiscreteInputs(0, 2)
+	assert.NoError(t, err)
+	assert.Equal(t, []bool{false, true}, inputs)
+
+	sim.SetInputRegisters(100, 1, 2)
+	registers, err := cli.ReadInputRegisters(100, 2)
+	assert.NoError(t, err)
+	assert.Equal(t, []uint16{1, 2}, registers)
+
+	assert.NoError(t, cli.WriteSingleRegister(10, 0xABCD))
+	assert.NoError(t, cli.WriteMultipleRegisters(11, []uint16{1, 2, 3}))
+	registers, err = cli.ReadHoldingRegisters(10, 4)
+	assert.NoError(t, err)
+	assert.Equal(t, []uint16{0xABCD, 1, 2, 3}, registers)
+
+	// read and write by visitors
+	v := &dmcontext.ModbusVisitor{Function: 3, Address: "0x20", Type: dmcontext.TypeFloat32, Scale: 0.5}
+	assert.NoError(t, cli.Write(v, 12.5))
+	assert.Equal(t, []uint16{0x41C8, 0}, sim.HoldingRegisters(0x20, 2))
+	val, err := cli.Read(v)
+	assert.NoError(t, err)
+	assert.Equal(t, float32(12.5), val)
+
+	v = &dmcontext.ModbusVisitor{Function: 3, Address: "40", Type: dmcontext.TypeInt16}
+	assert.NoError(t, cli.Write(v, -1))
+	assert.Equal(t, []uint16{0xFFFF}, sim.HoldingRegisters(40, 1))
+
+	v = &dmcontext.ModbusVisitor{Function: 1, Address: "5", Type: dmcontext.TypeBool}
+	assert.NoError(t, cli.Write(v, true))
+	assert.True(t, sim.Coil(5))
+	val, err = cli.Read(v)
+	assert.NoError(t, err)
+	assert.Equal(t, true, val)
+
+	err = cli.Write(&dmcontext.ModbusVisitor{Function: 4, Address: "0", Type: dmcontext.TypeInt16}, 1)
+	assert.Equal(t, ErrReadOnly, errors.Cause(err))
+
+	// exceptions
+	_, err = cli.ReadHoldingRegisters(65535, 2)
+	assert.Equal(t, &ExceptionError{Function: FuncReadHoldingRegisters, Code: ExceptionIllegalAddress}, errors.Cause(err))
+	_, err = cli.ReadHoldingRegisters(0, 126)
+	assert.Equal(t, ErrInvalidQuantity, errors.Cause(err))
+	_, err = cli.request([]byte{7, 0, 0, 0, 0})
+	assert.Equal(t, &ExceptionError{Function: 7, Code: ExceptionIllegalFunction}, errors.Cause(err))
+
+	// the client still works after exceptions
+	registers, err = cli.ReadHoldingRegisters(10, 1)
+	assert.NoError(t, err)
+	assert.Equal(t, []uint16{0xABCD}, registers)
+}
+
+func TestClientReconnect(t *testing.T) {
+	sim := startSimulator(t)
+
+	cli, err := NewClient(&dmcontext.ModbusAccessConfig{
+		Timeout:     time.Second,
+		IdleTimeout: 50 * time.Millisecond,
+		TCP:         sim.TCPConfig(),
+	})
+	assert.NoError(t, err)
+	defer cli.Close()
+
+	sim.SetHoldingRegisters(0, 7)
+	registers, err := cli.ReadHoldingRegisters(0, 1)
+	assert.NoError(t, err)
+	assert.Equal(t, []uint16{7}, registers)
+
+	// closed for idle, and reconnected by the next request
+	time.Sleep(150 * time.Millisecond)
+	cli.mut.Lock()
+	assert.Nil(t, cli.transporter.(*tcpTransporter).conn)
+	cli.mut.Unlock()
+	registers, err = cli.ReadHoldingRegisters(0, 1)
+	assert.NoError(t, err)
+	assert.Equal(t, []uint16{7}, registers)
+	assert.Equal(t, 2, sim.Requests())
+}
+
+func TestRTUFrame(t *testing.T) {
+	assert.Equal(t, uint16(0x0A84), crc16([]byte{0x01, 0x03, 0x00, 0x00, 0x00, 0x01}))
+	assert.Equal(t, 4010416*time.Nanosecond, frameSilence(9600))
+	assert.Equal(t, 1750*time.Microsecond, frameSilence(115200))
+
+	// the response with crc mismatched
+	client, server := net.Pipe()
+	defer client.Close()
+	go server.Write([]byte{0x01, 0x03, 0x02, 0x00, 0x07, 0x00, 0x00})
+	_, err := readRTUFrame(client, FuncReadHoldingRegisters, false)
+	assert.Equal(t, ErrCRCMismatch, errors.Cause(err))
+}
+
+func TestDriver(t *testing.T) {
+	sim := startSimulator(t)
+
+	ctx := dmcontexttest.NewContext(t)
+	err := ctx.SetDriverConfig("modbus", dmcontexttest.DriverConfig{
+		Devices: []dmcontext.DeviceInfo{{
+			Name:           "dev1",
+			AccessTemplate: "tpl1",
+			AccessConfig: &dmcontext.AccessConfig{Modbus: &dmcontext.ModbusAccessConfig{
+				ID:      1,
+				Timeout: time.Second,
+				TCP:     sim.TCPConfig(),
+			}},
+		}},
+		AccessTemplates: map[string]dmcontext.AccessTemplate{
+			"tpl1": {Properties: []dmcontext.DeviceProperty{
+				{ID: "1", Name: "temp", Type: dmcontext.TypeInt16, Visitor: dmcontext.PropertyVisitor{
+					Modbus: &dmcontext.ModbusVisitor{Function: 3, Address: "0", Type: dmcontext.TypeInt16},
+				}},
+				{ID: "2", Name: "switch", Type: dmcontext.TypeBool, Visitor: dmcontext.PropertyVisitor{
+					Modbus: &dmcontext.ModbusVisitor{Function: 1, Address: "0", Type: dmcontext.TypeBool},
+				}},
+				{ID: "3", Name: "missing", Type: dmcontext.TypeInt32, Visitor: dmcontext.PropertyVisitor{
+					Modbus: &dmcontext.ModbusVisitor{Function: 4, Address: "65535", Type: dmcontext.TypeInt32},
+				}},
+			}},
+		},
+	})
+	assert.NoError(t, err)
+	dev, err := ctx.GetDevice("modbus", "dev1")
+	assert.NoError(t, err)
+	tpl, err := ctx.GetAccessTemplates("modbus", "tpl1")
+	assert.NoError(t, err)
+
+	d := NewDriver(ctx, "modbus")
+	assert.NoError(t, d.Connect(dev))
+	sim.SetHoldingRegisters(0, 255)
+
+	// the property responded with an exception is skipped
+	values, err := d.Read(dev, tpl.Properties)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]any{"1": int16(255), "2": false}, values)
+
+	assert.NoError(t, d.Write(dev, map[string]any{"1": int16(300), "2": true}))
+	assert.Equal(t, []uint16{300}, sim.HoldingRegisters(0, 1))
+	assert.True(t, sim.Coil(0))
+	err = d.Write(dev, map[string]any{"4": 1})
+	assert.Equal(t, dmcontext.ErrUnknownPropertyID, errors.Cause(err))
+
+	assert.NoError(t, d.Close(dev))
+	assert.NoError(t, d.Close(dev))
+
+	// the device is offline
+	assert.NoError(t, sim.Close())
+	assert.Error(t, d.Connect(dev))
+}
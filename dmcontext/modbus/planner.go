@@ -0,0 +1,145 @@
+package modbus
+
+import (
+	"sort"
+
+	"github.com/baetyl/baetyl-go/v2/dmcontext"
+	"github.com/baetyl/baetyl-go/v2/errors"
+)
+
+// DefaultMaxGap the default max number of unused bits or registers between two points to read them in one request
+const DefaultMaxGap = 8
+
+// Point a property to read in batch
+type Point struct {
+	// ID the key of the value in results, such as the property id
+	ID      string
+	SlaveID byte
+	Visitor *dmcontext.ModbusVisitor
+}
+
+// Request a read request planned for the points of the same slave and function,
+// whose ranges are covered by the range of request
+type Request struct {
+	SlaveID  byte
+	Function byte
+	Address  uint16
+	Quantity uint16
+	Points   []PlannedPoint
+}
+
+// PlannedPoint a point planned in a request
+type PlannedPoint struct {
+	Point
+	Address  uint16
+	Quantity uint16
+}
+
+// Planner plans the minimal read requests of points. The points of the same slave and function are
+// sorted by address, and the adjacent or near-adjacent ranges are merged into one request,
+// as long as the gap is not greater than MaxGap and the quantity not greater than MaxQuantity.
+type Planner struct {
+	// MaxGap the max number of unused bits or registers between two points in one request
+	MaxGap uint16
+	// MaxQuantity the max quantity of one request, the max quantity of protocol is used if 0 or greater.
+	// Some devices accept less than the protocol allows.
+	MaxQuantity uint16
+}
+
+// NewPlanner creates a new planner with the max gap, and the max quantity of protocol
+func NewPlanner(maxGap uint16) *Planner {
+	return &Planner{MaxGap: maxGap}
+}
+
+func (p *Planner) maxQuantity(function byte) uint16 {
+	max := uint16(MaxReadRegisters)
+	if isBitFunction(function) {
+		max = MaxReadBits
+	}
+	if p.MaxQuantity > 0 && p.MaxQuantity < max {
+		return p.MaxQuantity
+	}
+	return max
+}
+
+// Plan plans the read requests of points, the requests are ordered by slave id, function and address
+func (p *Planner) Plan(points []Point) ([]*Request, error) {
+	planned := make([]PlannedPoint, 0, len(points))
+	for _, pt := range points {
+		address, err := ParseAddress(pt.Visitor.Address)
+		if err != nil {
+			return nil, errors.Errorf("point (%s) has invalid address: %s", pt.ID, err.Error())
+		}
+		quantity, err := Quantity(pt.Visitor)
+		if err != nil {
+			return nil, errors.Errorf("point (%s) has invalid quantity: %s", pt.ID, err.Error())
+		}
+		if quantity > p.maxQuantity(pt.Visitor.Function) {
+			return nil, errors.Errorf("point (%s) has invalid quantity: %s", pt.ID, ErrInvalidQuantity.Error())
+		}
+		planned = append(planned, PlannedPoint{Point: pt, Address: address, Quantity: quantity})
+	}
+	sort.SliceStable(planned, func(i, j int) bool {
+		a, b := planned[i], planned[j]
+		if a.SlaveID != b.SlaveID {
+			return a.SlaveID < b.SlaveID
+		}
+		if a.Visitor.Function != b.Visitor.Function {
+			return a.Visitor.Function < b.Visitor.Function
+		}
+		return a.Address < b.Address
+	})
+
+	var res []*Request
+	var cur *Request
+	for _, pt := range planned {
+		start, end := int(pt.Address), int(pt.Address)+int(pt.Quantity)
+		if cur != nil && cur.SlaveID == pt.SlaveID && cur.Function == pt.Visitor.Function {
+			curEnd := int(cur.Address) + int(cur.Quantity)
+			if end < curEnd {
+				end = curEnd
+			}
+			if start <= curEnd+int(p.MaxGap) && end-int(cur.Address) <= int(p.maxQuantity(cur.Function)) {
+				cur.Quantity = uint16(end - int(cur.Address))
+				cur.Points = append(cur.Points, pt)
+				continue
+			}
+			end = int(pt.Address) + int(pt.Quantity)
+		}
+		cur = &Request{
+			SlaveID:  pt.SlaveID,
+			Function: pt.Visitor.Function,
+			Address:  uint16(start),
+			Quantity: uint16(end - start),
+			Points:   []PlannedPoint{pt},
+		}
+		res = append(res, cur)
+	}
+	return res, nil
+}
+
+// Split splits the data responded to the request into the values of points keyed by point id
+func (r *Request) Split(data []byte) (map[string]any, error) {
+	res := map[string]any{}
+	for _, pt := range r.Points {
+		off := int(pt.Address - r.Address)
+		var d []byte
+		if isBitFunction(r.Function) {
+			if off/8 >= len(data) {
+				return nil, errors.Trace(ErrInvalidResponse)
+			}
+			d = []byte{data[off/8] >> (off % 8) & 1}
+		} else {
+			if (off+int(pt.Quantity))*2 > len(data) {
+				return nil, errors.Trace(ErrInvalidResponse)
+			}
+			d = data[off*2 : (off+int(pt.Quantity))*2]
+		}
+		v, err := Decode(pt.Visitor, d)
+		if err != nil {
+			return nil, errors.Errorf("failed to decode point (%s): %s", pt.ID, err.Error())
+		}
+		res[pt.ID] = v
+	}
+	return res, nil
+}
@@ -0,0 +1,137 @@
+package modbus
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/baetyl/baetyl-go/v2/dmcontext"
+	"github.com/baetyl/baetyl-go/v2/errors"
+)
+
+func point(id string, slaveID, function byte, address string, typ string) Point {
+	return Point{ID: id, SlaveID: slaveID, Visitor: &dmcontext.ModbusVisitor{Function: function, Address: address, Type: typ}}
+}
+
+func requestRanges(reqs []*Request) [][4]int {
+	var res [][4]int
+	for _, r := range reqs {
+		res = append(res, [4]int{int(r.SlaveID), int(r.Function), int(r.Address), int(r.Quantity)})
+	}
+	return res
+}
+
+func TestPlanner(t *testing.T) {
+	points := []Point{
+		point("a", 1, 3, "10", dmcontext.TypeFloat32),
+		point("b", 1, 3, "0", dmcontext.TypeInt16),
+		point("c", 1, 3, "1", dmcontext.TypeInt32),
+		// overlapped
+		point("d", 1, 3, "2", dmcontext.TypeInt16),
+		// too far to merge
+		point("e", 1, 3, "100", dmcontext.TypeInt16),
+		point("f", 1, 4, "0", dmcontext.TypeInt16),
+		point("g", 2, 3, "0", dmcontext.TypeInt16),
+		point("h", 1, 1, "7", dmcontext.TypeBool),
+		point("i", 1, 1, "0", dmcontext.TypeBool),
+	}
+	reqs, err := NewPlanner(8).Plan(points)
+	assert.NoError(t, err)
+	assert.Equal(t, [][4]int{
+		{1, 1, 0, 8},
+		{1, 3, 0, 12},
+		{1, 3, 100, 1},
+		{1, 4, 0, 1},
+		{2, 3, 0, 1},
+	}, requestRanges(reqs))
+	var ids []string
+	for _, p := range reqs[1].Points {
+		ids = append(ids, p.ID)
+	}
+	assert.Equal(t, []string{"b", "c", "d", "a"}, ids)
+
+	// no gap allowed
+	reqs, err = NewPlanner(0).Plan(points[:4])
+	assert.NoError(t, err)
+	assert.Equal(t, [][4]int{{1, 3, 0, 3}, {1, 3, 10, 2}}, requestRanges(reqs))
+
+	// split by the max quantity
+	points = nil
+	for i := 0; i < 100; i++ {
+		points = append(points, point(fmt.Sprint(i), 1, 3, fmt.Sprint(i*2), dmcontext.TypeFloat32))
+	}
+	reqs, err = NewPlanner(0).Plan(points)
+	assert.NoError(t, err)
+	assert.Equal(t, [][4]int{{1, 3, 0, 124}, {1, 3, 124, 76}}, requestRanges(reqs))
+	reqs, err = (&Planner{MaxQuantity: 64}).Plan(points)
+	assert.NoError(t, err)
+	assert.Equal(t, [][4]int{{1, 3, 0, 64}, {1, 3, 64, 64}, {1, 3, 128, 64}, {1, 3, 192, 8}}, requestRanges(reqs))
+
+	// invalid points
+	_, err = NewPlanner(0).Plan([]Point{point("x", 1, 3, "abc", dmcontext.TypeInt16)})
+	assert.EqualError(t, err, "point (x) has invalid address: strconv.ParseUint: parsing \"abc\": invalid syntax")
+	_, err = NewPlanner(0).Plan([]Point{point("y", 1, 3, "0", dmcontext.TypeString)})
+	assert.EqualError(t, err, "point (y) has invalid quantity: invalid modbus quantity")
+}
+
+func TestRequestSplit(t *testing.T) {
+	reqs, err := NewPlanner(8).Plan([]Point{
+		point("a", 1, 3, "0", dmcontext.TypeInt16),
+		point("b", 1, 3, "2", dmcontext.TypeFloat32),
+		point("c", 1, 1, "3", dmcontext.TypeBool),
+		point("d", 1, 1, "9", dmcontext.TypeBool),
+	})
+	assert.NoError(t, err)
+	assert.Len(t, reqs, 2)
+
+	values, err := reqs[0].Split([]byte{0b1000001})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]any{"c": true, "d": true}, values)
+	values, err = reqs[1].Split([]byte{0, 7, 0, 0, 0x41, 0xC8, 0, 0})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]any{"a": int16(7), "b": float32(25)}, values)
+
+	_, err = reqs[1].Split([]byte{0, 7})
+	assert.Equal(t, ErrInvalidResponse, errors.Cause(err))
+}
+
+func TestClientReadBatch(t *testing.T) {
+	sim := startSimulator(t)
+	cli, err := NewClient(&dmcontext.ModbusAccessConfig{ID: 1, Timeout: time.Second, TCP: sim.TCPConfig()})
+	assert.NoError(t, err)
+	defer cli.Close()
+
+	var points []Point
+	for i := 0; i < 200; i++ {
+		sim.SetHoldingRegisters(uint16(i), uint16(i))
+		points = append(points, point(fmt.Sprint(i), 1, 3, fmt.Sprint(i), dmcontext.TypeInt16))
+	}
+	sim.SetCoil(3, true)
+	points = append(points, point("coil", 1, 1, "3", dmcontext.TypeBool))
+	reqs, err := NewPlanner(DefaultMaxGap).Plan(points)
+	assert.NoError(t, err)
+
+	values, exceptions, err := cli.ReadBatch(reqs)
+	assert.NoError(t, err)
+	assert.Empty(t, exceptions)
+	assert.Len(t, values, 201)
+	assert.Equal(t, int16(150), values["150"])
+	assert.Equal(t, true, values["coil"])
+	assert.Equal(t, 3, sim.Requests())
+
+	// the points are read one by one if the merged request is responded with an exception
+	reqs, err = NewPlanner(DefaultMaxGap).Plan([]Point{
+		point("a", 1, 3, "65530", dmcontext.TypeInt16),
+		point("b", 1, 3, "65535", dmcontext.TypeInt32),
+	})
+	assert.NoError(t, err)
+	assert.Len(t, reqs, 1)
+	values, exceptions, err = cli.ReadBatch(reqs)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]any{"a": int16(0)}, values)
+	assert.Len(t, exceptions, 1)
+	assert.Equal(t, &ExceptionError{Function: 3, Code: ExceptionIllegalAddress}, errors.Cause(exceptions["b"]))
+	assert.Equal(t, 6, sim.Requests())
+}
@@ -0,0 +1,118 @@
+// Package modbus implements the modbus tcp and rtu protocol to access the properties of devices
+// by dmcontext.ModbusVisitor.
+package modbus
+
+import (
+	"encoding/binary"
+	"fmt"
+
+	"github.com/baetyl/baetyl-go/v2/errors"
+)
+
+// All function codes supported
+const (
+	FuncReadCoils              byte = 1
+	FuncReadDiscreteInputs     byte = 2
+	FuncReadHoldingRegisters   byte = 3
+	FuncReadInputRegisters     byte = 4
+	FuncWriteSingleCoil        byte = 5
+	FuncWriteSingleRegister    byte = 6
+	FuncWriteMultipleCoils     byte = 15
+	FuncWriteMultipleRegisters byte = 16
+)
+
+// All exception codes
+const (
+	ExceptionIllegalFunction    byte = 1
+	ExceptionIllegalAddress     byte = 2
+	ExceptionIllegalValue       byte = 3
+	ExceptionServerDeviceFailed byte = 4
+)
+
+// The max quantities of one request
+const (
+	MaxReadBits       = 2000
+	MaxReadRegisters  = 125
+	MaxWriteBits      = 1968
+	MaxWriteRegisters = 123
+)
+
+var (
+	ErrInvalidResponse = errors.New("invalid modbus response")
+	ErrInvalidQuantity = errors.New("invalid modbus quantity")
+	ErrCRCMismatch     = errors.New("modbus crc mismatch")
+	ErrNotConnected    = errors.New("modbus client is not connected")
+)
+
+// ExceptionError the exception responded by a modbus server
+type ExceptionError struct {
+	Function byte
+	Code     byte
+}
+
+func (e *ExceptionError) Error() string {
+	var reason string
+	switch e.Code {
+	case ExceptionIllegalFunction:
+		reason = "illegal function"
+	case ExceptionIllegalAddress:
+		reason = "illegal data address"
+	case ExceptionIllegalValue:
+		reason = "illegal data value"
+	case ExceptionServerDeviceFailed:
+		reason = "server device failure"
+	default:
+		reason = "unknown exception"
+	}
+	return fmt.Sprintf("modbus exception %d (%s) of function %d", e.Code, reason, e.Function)
+}
+
+// checkResponse checks the function code of response pdu, returns the exception if responded
+func checkResponse(function byte, pdu []byte) error {
+	if len(pdu) < 2 {
+		return errors.Trace(ErrInvalidResponse)
+	}
+	if pdu[0] == function|0x80 {
+		return errors.Trace(&ExceptionError{Function: function, Code: pdu[1]})
+	}
+	if pdu[0] != function {
+		return errors.Trace(ErrInvalidResponse)
+	}
+	return nil
+}
+
+// readRequest builds the pdu to read bits or registers
+func readRequest(function byte, address, quantity uint16) []byte {
+	pdu := make([]byte, 5)
+	pdu[0] = function
+	binary.BigEndian.PutUint16(pdu[1:], address)
+	binary.BigEndian.PutUint16(pdu[3:], quantity)
+	return pdu
+}
+
+// crc16 calculates the crc of modbus rtu frame
+func crc16(data []byte) uint16 {
+	crc := uint16(0xFFFF)
+	for _, b := range data {
+		crc ^= uint16(b)
+		for i := 0; i < 8; i++ {
+			if crc&1 != 0 {
+				crc = crc>>1 ^ 0xA001
+			} else {
+				crc >>= 1
+			}
+		}
+	}
+	return crc
+}
+
+// responseLength returns the length of the response pdu of function, n is the byte count for read functions
+func responseLength(function byte, n byte) int {
+	switch function {
+	case FuncReadCoils, FuncReadDiscreteInputs, FuncReadHoldingRegisters, FuncReadInputRegisters:
+		return 2 + int(n)
+	case FuncWriteSingleCoil, FuncWriteSingleRegister, FuncWriteMultipleCoils, FuncWriteMultipleRegisters:
+		return 5
+	}
+	return 0
+}
@@ -0,0 +1,70 @@
+//go:build linux
+// +build linux
+
+package modbus
+
+import (
+	"io"
+	"os"
+
+	"golang.org/x/sys/unix"
+
+	"github.com/baetyl/baetyl-go/v2/dmcontext"
+	"github.com/baetyl/baetyl-go/v2/errors"
+)
+
+var baudRates = map[int]uint32{
+	1200:   unix.B1200,
+	2400:   unix.B2400,
+	4800:   unix.B4800,
+	9600:   unix.B9600,
+	19200:  unix.B19200,
+	38400:  unix.B38400,
+	57600:  unix.B57600,
+	115200: unix.B115200,
+}
+
+var dataBits = map[int]uint32{
+	5: unix.CS5,
+	6: unix.CS6,
+	7: unix.CS7,
+	8: unix.CS8,
+}
+
+// openSerial opens the serial port in raw mode, the port supports deadlines since it is opened in non-blocking mode
+func openSerial(cfg *dmcontext.RTUConfig) (io.ReadWriteCloser, error) {
+	rate, ok := baudRates[cfg.BaudRate]
+	if !ok {
+		return nil, errors.Errorf("baud rate (%d) is not supported", cfg.BaudRate)
+	}
+	bits, ok := dataBits[cfg.DataBit]
+	if !ok {
+		return nil, errors.Errorf("data bit (%d) is not supported", cfg.DataBit)
+	}
+	fd, err := unix.Open(cfg.Port, unix.O_RDWR|unix.O_NOCTTY|unix.O_NONBLOCK|unix.O_CLOEXEC, 0)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	t := &unix.Termios{
+		Cflag:  unix.CREAD | unix.CLOCAL | rate | bits,
+		Ispeed: rate,
+		Ospeed: rate,
+	}
+	if cfg.StopBit == 2 {
+		t.Cflag |= unix.CSTOPB
+	}
+	switch cfg.Parity {
+	case "E":
+		t.Cflag |= unix.PARENB
+	case "O":
+		t.Cflag |= unix.PARENB | unix.PARODD
+	}
+	// return as soon as any byte is available
+	t.Cc[unix.VMIN] = 1
+	t.Cc[unix.VTIME] = 0
+	if err = unix.IoctlSetTermios(fd, unix.TCSETS, t); err != nil {
+		unix.Close(fd)
+		return nil, errors.Trace(err)
+	}
+	return os.NewFile(uintptr(fd), cfg.Port), nil
+}
@@ -0,0 +1,16 @@
+//go:build !linux
+// +build !linux
+
+package modbus
+
+import (
+	"io"
+	"runtime"
+
+	"github.com/baetyl/baetyl-go/v2/dmcontext"
+	"github.com/baetyl/baetyl-go/v2/errors"
+)
+
+func openSerial(_ *dmcontext.RTUConfig) (io.ReadWriteCloser, error) {
+	return nil, errors.Errorf("modbus rtu is not supported on %s", runtime.GOOS)
+}
@@ -0,0 +1,276 @@
+package modbus
+
+import (
+	"encoding/binary"
+	"io"
+	"net"
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/baetyl/baetyl-go/v2/dmcontext"
+	"github.com/baetyl/baetyl-go/v2/errors"
+	"github.com/baetyl/baetyl-go/v2/log"
+	"github.com/baetyl/baetyl-go/v2/utils"
+)
+
+// the number of coils, discrete inputs and registers of each kind in the simulator
+const simulatorSize = 0x10000
+
+// simulator an in-process modbus slave for test, which serves modbus tcp on a listener,
+// and modbus rtu on any io.ReadWriter. It responds to all slave ids.
+type simulator struct {
+	listener       net.Listener
+	coils          []bool
+	discreteInputs []bool
+	holding        []uint16
+	inputs         []uint16
+	requests       int
+	tomb           utils.Tomb
+	mut            sync.Mutex
+}
+
+// startSimulator starts a simulator serving modbus tcp on localhost, which is closed when the test finishes
+func startSimulator(t testing.TB) *simulator {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to start simulator: %s", err)
+	}
+	s := &simulator{
+		listener:       listener,
+		coils:          make([]bool, simulatorSize),
+		discreteInputs: make([]bool, simulatorSize),
+		holding:        make([]uint16, simulatorSize),
+		inputs:         make([]uint16, simulatorSize),
+	}
+	s.tomb.Go(s.accept)
+	t.Cleanup(func() { s.Close() })
+	return s
+}
+
+// Addr returns the address listened
+func (s *simulator) Addr() string {
+	return s.listener.Addr().String()
+}
+
+// TCPConfig returns the tcp config to connect to the simulator
+func (s *simulator) TCPConfig() *dmcontext.TCPConfig {
+	host, port, _ := net.SplitHostPort(s.Addr())
+	p, _ := strconv.Atoi(port)
+	return &dmcontext.TCPConfig{Address: host, Port: uint16(p)}
+}
+
+// SetCoil sets the coil at address
+func (s *simulator) SetCoil(address uint16, value bool) {
+	s.mut.Lock()
+	defer s.mut.Unlock()
+	s.coils[address] = value
+}
+
+// Coil returns the coil at address
+func (s *simulator) Coil(address uint16) bool {
+	s.mut.Lock()
+	defer s.mut.Unlock()
+	return s.coils[address]
+}
+
+// SetDiscreteInput sets the discrete input at address
+func (s *simulator) SetDiscreteInput(address uint16, value bool) {
+	s.mut.Lock()
+	defer s.mut.Unlock()
+	s.discreteInputs[address] = value
+}
+
+// SetHoldingRegisters sets the holding registers from address
+func (s *simulator) SetHoldingRegisters(address uint16, values ...uint16) {
+	s.mut.Lock()
+	defer s.mut.Unlock()
+	copy(s.holding[address:], values)
+}
+
+// HoldingRegisters returns the quantity of holding registers from address
+func (s *simulator) HoldingRegisters(address, quantity uint16) []uint16 {
+	s.mut.Lock()
+	defer s.mut.Unlock()
+	res := make([]uint16, quantity)
+	copy(res, s.holding[address:])
+	return res
+}
+
+// SetInputRegisters sets the input registers from address
+func (s *simulator) SetInputRegisters(address uint16, values ...uint16) {
+	s.mut.Lock()
+	defer s.mut.Unlock()
+	copy(s.inputs[address:], values)
+}
+
+// Requests returns the number of requests served
+func (s *simulator) Requests() int {
+	s.mut.Lock()
+	defer s.mut.Unlock()
+	return s.requests
+}
+
+// Close stops serving and closes all connections
+func (s *simulator) Close() error {
+	s.tomb.Kill(nil)
+	err := s.listener.Close()
+	s.tomb.Wait()
+	return errors.Trace(err)
+}
+
+func (s *simulator) accept() error {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			if !s.tomb.Alive() {
+				return nil
+			}
+			return errors.Trace(err)
+		}
+		s.tomb.Go(func() error {
+			return s.serveTCP(conn)
+		})
+	}
+}
+
+func (s *simulator) serveTCP(conn net.Conn) error {
+	done := make(chan struct{})
+	defer close(done)
+	defer conn.Close()
+	go func() {
+		select {
+		case <-s.tomb.Dying():
+			conn.Close()
+		case <-done:
+		}
+	}()
+	header := make([]byte, 7)
+	for {
+		if _, err := io.ReadFull(conn, header); err != nil {
+			return nil
+		}
+		length := int(binary.BigEndian.Uint16(header[4:]))
+		if length < 2 || length > maxPDULength+1 {
+			return nil
+		}
+		pdu := make([]byte, length-1)
+		if _, err := io.ReadFull(conn, pdu); err != nil {
+			return nil
+		}
+		res := s.handle(pdu)
+		adu := make([]byte, 7, 7+len(res))
+		copy(adu, header[:4])
+		binary.BigEndian.PutUint16(adu[4:], uint16(len(res)+1))
+		adu[6] = header[6]
+		if _, err := conn.Write(append(adu, res...)); err != nil {
+			log.L().Debug("failed to write modbus response", log.Error(err))
+			return nil
+		}
+	}
+}
+
+// ServeRTU serves modbus rtu on rw until failed to read or write, such as rw is closed.
+// The frame with crc mismatched is dropped without response as a real slave does.
+func (s *simulator) ServeRTU(rw io.ReadWriter) error {
+	for {
+		frame, err := readRTUFrame(rw, 0, true)
+		if err != nil {
+			if errors.Cause(err) == ErrCRCMismatch {
+				continue
+			}
+			return errors.Trace(err)
+		}
+		res := s.handle(frame[1 : len(frame)-2])
+		adu := make([]byte, 0, len(res)+3)
+		adu = append(adu, frame[0])
+		adu = append(adu, res...)
+		crc := crc16(adu)
+		if _, err = rw.Write(append(adu, byte(crc), byte(crc>>8))); err != nil {
+			return errors.Trace(err)
+		}
+	}
+}
+
+// handle handles the request pdu and returns the response pdu
+func (s *simulator) handle(pdu []byte) []byte {
+	s.mut.Lock()
+	defer s.mut.Unlock()
+	s.requests++
+
+	function := pdu[0]
+	exception := func(code byte) []byte {
+		return []byte{function | 0x80, code}
+	}
+	if len(pdu) < 5 {
+		return exception(ExceptionIllegalValue)
+	}
+	address := int(binary.BigEndian.Uint16(pdu[1:]))
+	quantity := int(binary.BigEndian.Uint16(pdu[3:]))
+
+	switch function {
+	case FuncReadCoils, FuncReadDiscreteInputs:
+		if quantity == 0 || quantity > MaxReadBits {
+			return exception(ExceptionIllegalValue)
+		}
+		if address+quantity > simulatorSize {
+			return exception(ExceptionIllegalAddress)
+		}
+		bits := s.coils
+		if function == FuncReadDiscreteInputs {
+			bits = s.discreteInputs
+		}
+		data := packBits(bits[address : address+quantity])
+		return append([]byte{function, byte(len(data))}, data...)
+	case FuncReadHoldingRegisters, FuncReadInputRegisters:
+		if quantity == 0 || quantity > MaxReadRegisters {
+			return exception(ExceptionIllegalValue)
+		}
+		if address+quantity > simulatorSize {
+			return exception(ExceptionIllegalAddress)
+		}
+		registers := s.holding
+		if function == FuncReadInputRegisters {
+			registers = s.inputs
+		}
+		res := []byte{function, byte(quantity * 2)}
+		for _, v := range registers[address : address+quantity] {
+			res = appendUint16(res, v)
+		}
+		return res
+	case FuncWriteSingleCoil:
+		switch quantity {
+		case 0xFF00:
+			s.coils[address] = true
+		case 0:
+			s.coils[address] = false
+		default:
+			return exception(ExceptionIllegalValue)
+		}
+		return pdu[:5]
+	case FuncWriteSingleRegister:
+		s.holding[address] = uint16(quantity)
+		return pdu[:5]
+	case FuncWriteMultipleCoils:
+		if quantity == 0 || quantity > MaxWriteBits || len(pdu) < 6 ||
+			int(pdu[5]) != (quantity+7)/8 || len(pdu) != 6+int(pdu[5]) {
+			return exception(ExceptionIllegalValue)
+		}
+		if address+quantity > simulatorSize {
+			return exception(ExceptionIllegalAddress)
+		}
+		copy(s.coils[address:], unpackBits(pdu[6:], uint16(quantity)))
+		return pdu[:5]
+	case FuncWriteMultipleRegisters:
+		if quantity == 0 || quantity > MaxWriteRegisters || len(pdu) < 6 ||
+			int(pdu[5]) != quantity*2 || len(pdu) != 6+int(pdu[5]) {
+			return exception(ExceptionIllegalValue)
+		}
+		if address+quantity > simulatorSize {
+			return exception(ExceptionIllegalAddress)
+		}
+		copy(s.holding[address:], unpackRegisters(pdu[6:]))
+		return pdu[:5]
+	}
+	return exception(ExceptionIllegalFunction)
+}
@@ -0,0 +1,226 @@
+package modbus
+
+import (
+	"encoding/binary"
+	"io"
+	"net"
+	"strconv"
+	"time"
+
+	"github.com/baetyl/baetyl-go/v2/dmcontext"
+	"github.com/baetyl/baetyl-go/v2/errors"
+)
+
+// the max length of modbus pdu
+const maxPDULength = 253
+
+// transporter sends a request pdu to the slave and returns the response pdu
+type transporter interface {
+	connect() error
+	send(slaveID byte, pdu []byte) ([]byte, error)
+	close() error
+}
+
+// tcpTransporter frames pdu with the mbap header over tcp
+type tcpTransporter struct {
+	address string
+	timeout time.Duration
+	conn    net.Conn
+	tid     uint16
+}
+
+func newTCPTransporter(cfg *dmcontext.TCPConfig, timeout time.Duration) *tcpTransporter {
+	return &tcpTransporter{
+		address: net.JoinHostPort(cfg.Address, strconv.Itoa(int(cfg.Port))),
+		timeout: timeout,
+	}
+}
+
+func (t *tcpTransporter) connect() error {
+	if t.conn != nil {
+		return nil
+	}
+	conn, err := net.DialTimeout("tcp", t.address, t.timeout)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	t.conn = conn
+	return nil
+}
+
+func (t *tcpTransporter) send(slaveID byte, pdu []byte) ([]byte, error) {
+	if t.conn == nil {
+		return nil, errors.Trace(ErrNotConnected)
+	}
+	if t.timeout > 0 {
+		if err := t.conn.SetDeadline(time.Now().Add(t.timeout)); err != nil {
+			return nil, errors.Trace(err)
+		}
+	}
+	t.tid++
+	adu := make([]byte, 7+len(pdu))
+	binary.BigEndian.PutUint16(adu, t.tid)
+	binary.BigEndian.PutUint16(adu[4:], uint16(len(pdu)+1))
+	adu[6] = slaveID
+	copy(adu[7:], pdu)
+	if _, err := t.conn.Write(adu); err != nil {
+		return nil, errors.Trace(err)
+	}
+
+	for {
+		header := make([]byte, 7)
+		if _, err := io.ReadFull(t.conn, header); err != nil {
+			return nil, errors.Trace(err)
+		}
+		length := int(binary.BigEndian.Uint16(header[4:]))
+		if length < 2 || length > maxPDULength+1 {
+			return nil, errors.Trace(ErrInvalidResponse)
+		}
+		res := make([]byte, length-1)
+		if _, err := io.ReadFull(t.conn, res); err != nil {
+			return nil, errors.Trace(err)
+		}
+		// skip the stale response of the request timed out
+		if binary.BigEndian.Uint16(header) != t.tid {
+			continue
+		}
+		return res, nil
+	}
+}
+
+func (t *tcpTransporter) close() error {
+	if t.conn == nil {
+		return nil
+	}
+	err := t.conn.Close()
+	t.conn = nil
+	return errors.Trace(err)
+}
+
+// rtuTransporter frames pdu with the slave id and crc over a serial line
+type rtuTransporter struct {
+	open     func() (io.ReadWriteCloser, error)
+	timeout  time.Duration
+	silence  time.Duration
+	port     io.ReadWriteCloser
+	lastUsed time.Time
+}
+
+func newRTUTransporter(cfg *dmcontext.RTUConfig, timeout time.Duration) *rtuTransporter {
+	return &rtuTransporter{
+		open: func() (io.ReadWriteCloser, error) {
+			return openSerial(cfg)
+		},
+		timeout: timeout,
+		silence: frameSilence(cfg.BaudRate),
+	}
+}
+
+// frameSilence returns the silent interval between frames, which is 3.5 characters,
+// or 1750us if the baud rate is greater than 19200
+func frameSilence(baudRate int) time.Duration {
+	if baudRate <= 0 || baudRate > 19200 {
+		return 1750 * time.Microsecond
+	}
+	// 11 bits per character
+	return time.Duration(35*11*int64(time.Second)/int64(baudRate)) / 10
+}
+
+func (t *rtuTransporter) connect() error {
+	if t.port != nil {
+		return nil
+	}
+	port, err := t.open()
+	if err != nil {
+		return errors.Trace(err)
+	}
+	t.port = port
+	return nil
+}
+
+func (t *rtuTransporter) send(slaveID byte, pdu []byte) ([]byte, error) {
+	if t.port == nil {
+		return nil, errors.Trace(ErrNotConnected)
+	}
+	if d := t.silence - time.Since(t.lastUsed); d > 0 {
+		time.Sleep(d)
+	}
+	defer func() {
+		t.lastUsed = time.Now()
+	}()
+	if d, ok := t.port.(interface{ SetDeadline(time.Time) error }); ok && t.timeout > 0 {
+		if err := d.SetDeadline(time.Now().Add(t.timeout)); err != nil {
+			return nil, errors.Trace(err)
+		}
+	}
+
+	adu := make([]byte, 0, len(pdu)+3)
+	adu = append(adu, slaveID)
+	adu = append(adu, pdu...)
+	crc := crc16(adu)
+	adu = append(adu, byte(crc), byte(crc>>8))
+	if _, err := t.port.Write(adu); err != nil {
+		return nil, errors.Trace(err)
+	}
+	res, err := readRTUFrame(t.port, pdu[0], false)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	if res[0] != slaveID {
+		return nil, errors.Trace(ErrInvalidResponse)
+	}
+	return res[1 : len(res)-2], nil
+}
+
+func (t *rtuTransporter) close() error {
+	if t.port == nil {
+		return nil
+	}
+	err := t.port.Close()
+	t.port = nil
+	return errors.Trace(err)
+}
+
+// readRTUFrame reads a frame of function, the length of which is determined by the function code.
+// The frame is a request if request is true, otherwise a response.
+func readRTUFrame(r io.Reader, function byte, request bool) ([]byte, error) {
+	frame := make([]byte, 3, maxPDULength+3)
+	if _, err := io.ReadFull(r, frame); err != nil {
+		return nil, errors.Trace(err)
+	}
+	var remaining int
+	switch {
+	case request && (frame[1] == FuncWriteMultipleCoils || frame[1] == FuncWriteMultipleRegisters):
+		// the low byte of address, quantity and byte count, which are followed by values and crc
+		head := make([]byte, 4)
+		if _, err := io.ReadFull(r, head); err != nil {
+			return nil, errors.Trace(err)
+		}
+		frame = append(frame, head...)
+		remaining = int(head[3]) + 2
+	case request:
+		// the low byte of address, quantity or value, and crc
+		remaining = 1 + 2 + 2
+	case frame[1] == function|0x80:
+		remaining = 2
+	case frame[1] == function:
+		n := responseLength(function, frame[2])
+		if n == 0 {
+			return nil, errors.Trace(ErrInvalidResponse)
+		}
+		// the function code and the third byte have been read, which are followed by crc
+		remaining = n - 2 + 2
+	default:
+		return nil, errors.Trace(ErrInvalidResponse)
+	}
+	rest := make([]byte, remaining)
+	if _, err := io.ReadFull(r, rest); err != nil {
+		return nil, errors.Trace(err)
+	}
+	frame = append(frame, rest...)
+	n := len(frame)
+	if crc16(frame[:n-2]) != uint16(frame[n-2])|uint16(frame[n-1])<<8 {
+		return nil, errors.Trace(ErrCRCMismatch)
+	}
+	return frame, nil
+}
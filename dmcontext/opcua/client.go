@@ -0,0 +1,712 @@
+package opcua
+
+import (
+	"crypto/rand"
+	"encoding/pem"
+	"net"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/baetyl/baetyl-go/v2/dmcontext"
+	"github.com/baetyl/baetyl-go/v2/errors"
+)
+
+// DefaultTimeout the default timeout of requests if not configured
+const DefaultTimeout = 10 * time.Second
+
+// the parameters requested for secure channels and subscriptions
+const (
+	channelLifetime   = uint32(time.Hour / time.Millisecond)
+	keepAliveCount    = 10
+	lifetimeCount     = 100
+	applicationURI    = "urn:baetyl:opcua:client"
+	productURI        = "urn:baetyl"
+	anonymousPolicyID = "anonymous"
+	usernamePolicyID  = "username"
+)
+
+// Client the opc ua client of a server, which is safe for concurrent use.
+// The requests are multiplexed on one secure channel and session, so that publish requests of
+// subscriptions do not block reads and writes.
+type Client struct {
+	endpoint    string
+	address     string
+	timeout     time.Duration
+	certificate []byte
+
+	conn       *conn
+	channelID  uint32
+	tokenID    uint32
+	authToken  NodeID
+	requestID  uint32
+	handle     uint32
+	pending    map[uint32]chan *message
+	subs       map[uint32]*subscription
+	publishing bool
+	done       chan struct{}
+	err        error
+	wg         sync.WaitGroup
+	// mut protects the states of connection, cmut serializes connecting and closing
+	mut  sync.Mutex
+	cmut sync.Mutex
+}
+
+type subscription struct {
+	interval time.Duration
+	nodes    []NodeID
+	handler  func(node NodeID, value *DataValue)
+}
+
+// NewClient creates a new client by the opc ua access config, the security policy and mode must be None.
+// The session is activated anonymously, since the user name token is not encrypted without security.
+func NewClient(cfg *dmcontext.OpcuaAccessConfig) (*Client, error) {
+	if cfg == nil {
+		return nil, errors.Trace(ErrInvalidEndpoint)
+	}
+	if !isSecurityNone(cfg.Security.Policy, cfg.Security.Mode) {
+		return nil, errors.Trace(ErrSecurityNotSupported)
+	}
+	if cfg.Auth != nil && cfg.Auth.Username != "" {
+		return nil, errors.Trace(ErrUserNameNotSupported)
+	}
+	address, err := parseEndpoint(cfg.Endpoint)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	c := &Client{
+		endpoint: cfg.Endpoint,
+		address:  address,
+		timeout:  cfg.Timeout,
+		pending:  map[uint32]chan *message{},
+		subs:     map[uint32]*subscription{},
+	}
+	if c.timeout <= 0 {
+		c.timeout = DefaultTimeout
+	}
+	// the certificate identifies the client in the session, which is not used to secure the channel
+	if cfg.Certificate != nil && cfg.Certificate.Cert != "" {
+		data, err := os.ReadFile(cfg.Certificate.Cert)
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+		if block, _ := pem.Decode(data); block != nil {
+			data = block.Bytes
+		}
+		c.certificate = data
+	}
+	return c, nil
+}
+
+// Connected returns whether the client is connected
+func (c *Client) Connected() bool {
+	c.mut.Lock()
+	defer c.mut.Unlock()
+	return c.connected()
+}
+
+func (c *Client) connected() bool {
+	if c.conn == nil {
+		return false
+	}
+	select {
+	case <-c.done:
+		return false
+	default:
+		return true
+	}
+}
+
+// Connect opens a secure channel and activates a session if not connected.
+// The subscriptions are lost if the connection was lost, which need to be created again.
+func (c *Client) Connect() error {
+	c.cmut.Lock()
+	defer c.cmut.Unlock()
+	if c.Connected() {
+		return nil
+	}
+	c.closeConn()
+
+	nc, err := net.DialTimeout("tcp", c.address, c.timeout)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	cn := newConn(nc)
+	lifetime, err := c.open(cn)
+	if err != nil {
+		cn.Close()
+		return errors.Trace(err)
+	}
+
+	done := make(chan struct{})
+	c.mut.Lock()
+	c.conn = cn
+	c.done = done
+	c.err = nil
+	c.authToken = NodeID{}
+	c.mut.Unlock()
+	c.wg.Add(1)
+	go c.reading(cn, done)
+	c.renewAfter(lifetime, done)
+
+	if err = c.createSession(); err != nil {
+		c.closeConn()
+		return errors.Trace(err)
+	}
+	return nil
+}
+
+// open exchanges hello and acknowledge, and opens the secure channel, returns the lifetime of security token
+func (c *Client) open(cn *conn) (uint32, error) {
+	if err := cn.SetDeadline(time.Now().Add(c.timeout)); err != nil {
+		return 0, errors.Trace(err)
+	}
+	var e encoder
+	e.u32(0)
+	e.u32(defaultBufferSize)
+	e.u32(defaultBufferSize)
+	e.u32(defaultMaxMessageSize)
+	e.u32(0)
+	e.str(c.endpoint)
+	if err := cn.writeRaw(msgHello, e.buf); err != nil {
+		return 0, errors.Trace(err)
+	}
+	msg, err := cn.readMessage()
+	if err != nil {
+		return 0, errors.Trace(err)
+	}
+	if msg.err != nil {
+		return 0, errors.Trace(msg.err)
+	}
+	if msg.typ != msgAcknowledge {
+		return 0, errors.Trace(ErrInvalidMessage)
+	}
+	d := &decoder{buf: msg.body}
+	d.u32()
+	if size := int(d.u32()); size > 0 && size < cn.sendBufferSize {
+		cn.sendBufferSize = size
+	}
+	if d.err != nil {
+		return 0, errors.Trace(d.err)
+	}
+
+	c.mut.Lock()
+	c.requestID++
+	requestID := c.requestID
+	c.mut.Unlock()
+	e = encoder{}
+	e.requestHeader(requestHeader{handle: requestID, timeoutHint: uint32(c.timeout / time.Millisecond)})
+	encodeOpenChannel(&e, false)
+	if err = cn.writeMessage(msgOpenChannel, 0, 0, requestID, idOpenSecureChannelRequest, e.buf); err != nil {
+		return 0, errors.Trace(err)
+	}
+	msg, err = cn.readMessage()
+	if err != nil {
+		return 0, errors.Trace(err)
+	}
+	d, err = checkMessage(msg, idOpenSecureChannelResponse)
+	if err != nil {
+		return 0, errors.Trace(err)
+	}
+	d.u32()
+	channelID, tokenID := d.u32(), d.u32()
+	d.time()
+	lifetime := d.u32()
+	if d.err != nil {
+		return 0, errors.Trace(d.err)
+	}
+	c.mut.Lock()
+	c.channelID, c.tokenID = channelID, tokenID
+	c.mut.Unlock()
+	return lifetime, errors.Trace(cn.SetDeadline(time.Time{}))
+}
+
+func encodeOpenChannel(e *encoder, renew bool) {
+	e.u32(0)
+	if renew {
+		e.u32(1)
+	} else {
+		e.u32(0)
+	}
+	e.u32(securityModeNoneValue)
+	e.bytes(nil)
+	e.u32(channelLifetime)
+}
+
+// renewAfter renews the security token at 75% of its lifetime, until the connection is closed
+func (c *Client) renewAfter(lifetime uint32, done chan struct{}) {
+	if lifetime == 0 {
+		return
+	}
+	c.wg.Add(1)
+	go func() {
+		defer c.wg.Done()
+		timer := time.NewTimer(time.Duration(lifetime) * time.Millisecond * 3 / 4)
+		defer timer.Stop()
+		select {
+		case <-done:
+			return
+		case <-timer.C:
+		}
+		d, err := c.call(msgOpenChannel, idOpenSecureChannelRequest, idOpenSecureChannelResponse, c.timeout, func(e *encoder) {
+			encodeOpenChannel(e, true)
+		})
+		if err != nil {
+			return
+		}
+		d.u32()
+		d.u32()
+		tokenID := d.u32()
+		d.time()
+		lifetime := d.u32()
+		if d.err != nil {
+			return
+		}
+		c.mut.Lock()
+		c.tokenID = tokenID
+		c.mut.Unlock()
+		c.renewAfter(lifetime, done)
+	}()
+}
+
+// checkMessage checks the response message, returns the decoder of the body after the response header
+func checkMessage(msg *message, typeID uint32) (*decoder, error) {
+	if msg.err != nil {
+		return nil, errors.Trace(msg.err)
+	}
+	d := &decoder{buf: msg.body}
+	status := d.responseHeader()
+	if d.err != nil {
+		return nil, errors.Trace(d.err)
+	}
+	if msg.typeID == idServiceFault || status.IsBad() {
+		if status == StatusOK {
+			status = StatusBadUnexpectedError
+		}
+		return nil, errors.Trace(status)
+	}
+	if msg.typeID != typeID {
+		return nil, errors.Trace(ErrInvalidMessage)
+	}
+	return d, nil
+}
+
+func (c *Client) reading(cn *conn, done chan struct{}) {
+	defer c.wg.Done()
+	for {
+		msg, err := cn.readMessage()
+		if err != nil {
+			c.mut.Lock()
+			c.err = err
+			close(done)
+			c.mut.Unlock()
+			return
+		}
+		c.mut.Lock()
+		ch, ok := c.pending[msg.requestID]
+		delete(c.pending, msg.requestID)
+		c.mut.Unlock()
+		if ok {
+			ch <- msg
+		}
+	}
+}
+
+// call sends a request with the request header and body, and waits for the response
+func (c *Client) call(typ string, reqID, respID uint32, timeout time.Duration, body func(e *encoder)) (*decoder, error) {
+	c.mut.Lock()
+	if !c.connected() {
+		err := c.err
+		c.mut.Unlock()
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+		return nil, errors.Trace(ErrClientClosed)
+	}
+	c.requestID++
+	c.handle++
+	requestID, cn, done := c.requestID, c.conn, c.done
+	channelID, tokenID := c.channelID, c.tokenID
+	header := requestHeader{authToken: c.authToken, handle: c.handle, timeoutHint: uint32(timeout / time.Millisecond)}
+	ch := make(chan *message, 1)
+	c.pending[requestID] = ch
+	c.mut.Unlock()
+
+	defer func() {
+		c.mut.Lock()
+		delete(c.pending, requestID)
+		c.mut.Unlock()
+	}()
+	var e encoder
+	e.requestHeader(header)
+	body(&e)
+	if err := cn.writeMessage(typ, channelID, tokenID, requestID, reqID, e.buf); err != nil {
+		return nil, errors.Trace(err)
+	}
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case msg := <-ch:
+		d, err := checkMessage(msg, respID)
+		return d, errors.Trace(err)
+	case <-done:
+		c.mut.Lock()
+		err := c.err
+		c.mut.Unlock()
+		return nil, errors.Trace(err)
+	case <-timer.C:
+		return nil, errors.Trace(StatusBadTimeout)
+	}
+}
+
+func (c *Client) createSession() error {
+	nonce := make([]byte, 32)
+	if _, err := rand.Read(nonce); err != nil {
+		return errors.Trace(err)
+	}
+	d, err := c.call(msgMessage, idCreateSessionRequest, idCreateSessionResponse, c.timeout, func(e *encoder) {
+		e.str(applicationURI)
+		e.str(productURI)
+		e.localizedText("baetyl")
+		e.u32(applicationTypeClient)
+		e.str("")
+		e.str("")
+		e.strs(nil)
+		e.str("")
+		e.str(c.endpoint)
+		e.str("baetyl-" + strconv.FormatInt(time.Now().UnixNano(), 36))
+		e.bytes(nonce)
+		e.bytes(c.certificate)
+		e.f64(defaultSessionTimeout)
+		e.u32(0)
+	})
+	if err != nil {
+		return errors.Trace(err)
+	}
+	d.nodeID()
+	authToken := d.nodeID()
+	d.f64()
+	d.bytes()
+	d.bytes()
+	policies := decodeUserTokenPolicies(d)
+	if d.err != nil {
+		return errors.Trace(d.err)
+	}
+	c.mut.Lock()
+	c.authToken = authToken
+	c.mut.Unlock()
+
+	policyID := anonymousPolicyID
+	if id, ok := policies[userTokenAnonymous]; ok {
+		policyID = id
+	}
+	var token encoder
+	token.str(policyID)
+	_, err = c.call(msgMessage, idActivateSessionRequest, idActivateSessionResponse, c.timeout, func(e *encoder) {
+		e.str("")
+		e.bytes(nil)
+		e.i32(-1)
+		e.strs(nil)
+		e.extensionObject(idAnonymousIdentityToken, token.buf)
+		e.str("")
+		e.bytes(nil)
+	})
+	return errors.Trace(err)
+}
+
+// decodeUserTokenPolicies decodes the endpoints of create session response,
+// returns the policy ids of user token types of the endpoints without security
+func decodeUserTokenPolicies(d *decoder) map[uint32]string {
+	res := map[uint32]string{}
+	n := d.length()
+	for i := 0; i < n && d.err == nil; i++ {
+		d.str()
+		decodeApplicationDescription(d)
+		d.bytes()
+		mode := d.u32()
+		policy := d.str()
+		m := d.length()
+		for j := 0; j < m && d.err == nil; j++ {
+			id := d.str()
+			typ := d.u32()
+			d.str()
+			d.str()
+			d.str()
+			if _, ok := res[typ]; !ok && mode == securityModeNoneValue && policy == SecurityPolicyNone {
+				res[typ] = id
+			}
+		}
+		d.str()
+		d.u8()
+	}
+	return res
+}
+
+func decodeApplicationDescription(d *decoder) {
+	d.str()
+	d.str()
+	d.localizedText()
+	d.u32()
+	d.str()
+	d.str()
+	d.strs()
+}
+
+// Read reads the values of nodes
+func (c *Client) Read(nodes ...NodeID) ([]*DataValue, error) {
+	d, err := c.call(msgMessage, idReadRequest, idReadResponse, c.timeout, func(e *encoder) {
+		e.f64(0)
+		e.u32(timestampsBoth)
+		e.i32(int32(len(nodes)))
+		for _, n := range nodes {
+			encodeReadValueID(e, n)
+		}
+	})
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	n := d.length()
+	if d.err == nil && n != len(nodes) {
+		return nil, errors.Trace(ErrInvalidMessage)
+	}
+	res := make([]*DataValue, 0, n)
+	for i := 0; i < n && d.err == nil; i++ {
+		res = append(res, d.dataValue())
+	}
+	if d.err != nil {
+		return nil, errors.Trace(d.err)
+	}
+	return res, nil
+}
+
+func encodeReadValueID(e *encoder, n NodeID) {
+	e.nodeID(n)
+	e.u32(attributeValue)
+	e.str("")
+	e.u16(0)
+	e.str("")
+}
+
+// Write writes the values of nodes, returns the first bad status of results if any
+func (c *Client) Write(nodes []NodeID, values []any) error {
+	if len(nodes) != len(values) {
+		return errors.Trace(StatusBadNothingToDo)
+	}
+	var body encoder
+	body.i32(int32(len(nodes)))
+	for i, n := range nodes {
+		body.nodeID(n)
+		body.u32(attributeValue)
+		body.str("")
+		if err := body.dataValue(&DataValue{Value: values[i]}); err != nil {
+			return errors.Trace(err)
+		}
+	}
+	d, err := c.call(msgMessage, idWriteRequest, idWriteResponse, c.timeout, func(e *encoder) {
+		e.buf = append(e.buf, body.buf...)
+	})
+	if err != nil {
+		return errors.Trace(err)
+	}
+	for _, s := range d.u32s() {
+		if StatusCode(s).IsBad() {
+			return errors.Trace(StatusCode(s))
+		}
+	}
+	return errors.Trace(d.err)
+}
+
+// Subscribe creates a subscription of the nodes, which are sampled and published in the interval.
+// The handler is called with the initial values and the values changed, in the goroutine of publishing.
+// It fails if any node is failed to monitor, such as the node is unknown.
+func (c *Client) Subscribe(interval time.Duration, nodes []NodeID, handler func(node NodeID, value *DataValue)) (uint32, error) {
+	ms := float64(interval) / float64(time.Millisecond)
+	d, err := c.call(msgMessage, idCreateSubscriptionRequest, idCreateSubscriptionResponse, c.timeout, func(e *encoder) {
+		e.f64(ms)
+		e.u32(lifetimeCount)
+		e.u32(keepAliveCount)
+		e.u32(0)
+		e.boolean(true)
+		e.u8(0)
+	})
+	if err != nil {
+		return 0, errors.Trace(err)
+	}
+	id := d.u32()
+	revised := d.f64()
+	if d.err != nil {
+		return 0, errors.Trace(d.err)
+	}
+	if revised > 0 {
+		interval = time.Duration(revised * float64(time.Millisecond))
+	}
+
+	d, err = c.call(msgMessage, idCreateMonitoredItemsRequest, idCreateMonitoredItemsResponse, c.timeout, func(e *encoder) {
+		e.u32(id)
+		e.u32(timestampsBoth)
+		e.i32(int32(len(nodes)))
+		for i, n := range nodes {
+			encodeReadValueID(e, n)
+			e.u32(monitoringModeReporting)
+			e.u32(uint32(i))
+			e.f64(ms)
+			e.extensionObject(0, nil)
+			e.u32(1)
+			e.boolean(true)
+		}
+	})
+	if err == nil {
+		n := d.length()
+		for i := 0; i < n && d.err == nil && err == nil; i++ {
+			if s := StatusCode(d.u32()); s.IsBad() {
+				err = errors.Errorf("failed to monitor node (%s): %s", nodes[i].String(), s.Error())
+			}
+			d.u32()
+			d.f64()
+			d.u32()
+			d.extensionObject()
+		}
+		if err == nil && d.err != nil {
+			err = errors.Trace(d.err)
+		}
+	}
+	if err != nil {
+		c.deleteSubscription(id)
+		return 0, err
+	}
+
+	c.mut.Lock()
+	c.subs[id] = &subscription{interval: interval, nodes: nodes, handler: handler}
+	start := !c.publishing
+	c.publishing = true
+	c.mut.Unlock()
+	if start {
+		c.wg.Add(1)
+		go c.publish()
+	}
+	return id, nil
+}
+
+// Unsubscribe deletes the subscription
+func (c *Client) Unsubscribe(id uint32) error {
+	c.mut.Lock()
+	delete(c.subs, id)
+	c.mut.Unlock()
+	return errors.Trace(c.deleteSubscription(id))
+}
+
+func (c *Client) deleteSubscription(id uint32) error {
+	d, err := c.call(msgMessage, idDeleteSubscriptionsRequest, idDeleteSubscriptionsResponse, c.timeout, func(e *encoder) {
+		e.u32s([]uint32{id})
+	})
+	if err != nil {
+		return errors.Trace(err)
+	}
+	for _, s := range d.u32s() {
+		if StatusCode(s).IsBad() {
+			return errors.Trace(StatusCode(s))
+		}
+	}
+	return errors.Trace(d.err)
+}
+
+// publish sends publish requests while there are subscriptions, and dispatches the notifications
+func (c *Client) publish() {
+	defer c.wg.Done()
+	var acks [][2]uint32
+	for {
+		c.mut.Lock()
+		var timeout time.Duration
+		for _, s := range c.subs {
+			if t := s.interval * keepAliveCount; t > timeout {
+				timeout = t
+			}
+		}
+		if len(c.subs) == 0 || !c.connected() {
+			c.publishing = false
+			c.mut.Unlock()
+			return
+		}
+		c.mut.Unlock()
+
+		d, err := c.call(msgMessage, idPublishRequest, idPublishResponse, timeout+c.timeout, func(e *encoder) {
+			e.i32(int32(len(acks)))
+			for _, a := range acks {
+				e.u32(a[0])
+				e.u32(a[1])
+			}
+		})
+		acks = nil
+		if err != nil {
+			if errors.Cause(err) != StatusBadTimeout {
+				// avoid busy loop if the server keeps rejecting
+				time.Sleep(c.timeout / 10)
+			}
+			continue
+		}
+		id := d.u32()
+		d.u32s()
+		d.boolean()
+		seq := d.u32()
+		d.time()
+		n := d.length()
+		c.mut.Lock()
+		sub := c.subs[id]
+		c.mut.Unlock()
+		for i := 0; i < n && d.err == nil; i++ {
+			typeID, body := d.extensionObject()
+			if typeID != idDataChangeNotification || sub == nil {
+				continue
+			}
+			nd := &decoder{buf: body}
+			m := nd.length()
+			for j := 0; j < m && nd.err == nil; j++ {
+				handle := nd.u32()
+				v := nd.dataValue()
+				if nd.err == nil && int(handle) < len(sub.nodes) {
+					sub.handler(sub.nodes[handle], v)
+				}
+			}
+		}
+		// keep-alive messages without notifications are not acknowledged
+		if n > 0 {
+			acks = append(acks, [2]uint32{id, seq})
+		}
+	}
+}
+
+// Close closes the session and the secure channel
+func (c *Client) Close() error {
+	c.cmut.Lock()
+	defer c.cmut.Unlock()
+	if c.Connected() {
+		c.call(msgMessage, idCloseSessionRequest, idCloseSessionResponse, c.timeout, func(e *encoder) {
+			e.boolean(true)
+		})
+	}
+	c.closeConn()
+	return nil
+}
+
+// closeConn closes the secure channel and the connection, and waits for the goroutines
+func (c *Client) closeConn() {
+	c.mut.Lock()
+	cn := c.conn
+	c.conn = nil
+	c.subs = map[uint32]*subscription{}
+	channelID, tokenID := c.channelID, c.tokenID
+	c.requestID++
+	requestID := c.requestID
+	c.mut.Unlock()
+	if cn != nil {
+		var e encoder
+		e.requestHeader(requestHeader{handle: requestID})
+		cn.writeMessage(msgCloseChannel, channelID, tokenID, requestID, idCloseSecureChannelRequest, e.buf)
+		cn.Close()
+	}
+	c.wg.Wait()
+	c.mut.Lock()
+	c.done = nil
+	c.mut.Unlock()
+}
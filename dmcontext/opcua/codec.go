@@ -0,0 +1,652 @@
+package opcua
+
+import (
+	"encoding/binary"
+	"math"
+	"time"
+
+	"github.com/baetyl/baetyl-go/v2/errors"
+)
+
+// the ticks of 100 nanoseconds from 1601-01-01 to 1970-01-01
+const ticksTo1970 = 116444736000000000
+
+// DataValue the value of a node with its status and timestamps
+type DataValue struct {
+	Value           any
+	Status          StatusCode
+	SourceTimestamp time.Time
+	ServerTimestamp time.Time
+}
+
+// encoder encodes values in the opc ua binary encoding
+type encoder struct {
+	buf []byte
+}
+
+func (e *encoder) u8(v byte) {
+	e.buf = append(e.buf, v)
+}
+
+func (e *encoder) u16(v uint16) {
+	e.buf = appendUint16(e.buf, v)
+}
+
+func (e *encoder) u32(v uint32) {
+	e.buf = appendUint32(e.buf, v)
+}
+
+func (e *encoder) u64(v uint64) {
+	e.buf = appendUint64(e.buf, v)
+}
+
+func (e *encoder) i32(v int32) {
+	e.u32(uint32(v))
+}
+
+func (e *encoder) f64(v float64) {
+	e.u64(math.Float64bits(v))
+}
+
+func (e *encoder) boolean(v bool) {
+	if v {
+		e.u8(1)
+	} else {
+		e.u8(0)
+	}
+}
+
+// str encodes a string, the empty string is encoded as null
+func (e *encoder) str(v string) {
+	e.bytes([]byte(v))
+}
+
+// bytes encodes a byte string, the empty byte string is encoded as null
+func (e *encoder) bytes(v []byte) {
+	if len(v) == 0 {
+		e.i32(-1)
+		return
+	}
+	e.i32(int32(len(v)))
+	e.buf = append(e.buf, v...)
+}
+
+func (e *encoder) strs(v []string) {
+	if v == nil {
+		e.i32(-1)
+		return
+	}
+	e.i32(int32(len(v)))
+	for _, s := range v {
+		e.str(s)
+	}
+}
+
+func (e *encoder) u32s(v []uint32) {
+	if v == nil {
+		e.i32(-1)
+		return
+	}
+	e.i32(int32(len(v)))
+	for _, s := range v {
+		e.u32(s)
+	}
+}
+
+func (e *encoder) time(t time.Time) {
+	if t.IsZero() {
+		e.u64(0)
+		return
+	}
+	e.u64(uint64(t.UnixNano()/100 + ticksTo1970))
+}
+
+func (e *encoder) guid(g [16]byte) {
+	e.buf = append(e.buf, g[3], g[2], g[1], g[0], g[5], g[4], g[7], g[6])
+	e.buf = append(e.buf, g[8:]...)
+}
+
+func (e *encoder) nodeID(n NodeID) {
+	switch n.IDType {
+	case IDTypeString:
+		e.u8(3)
+		e.u16(n.Namespace)
+		e.str(n.Text)
+	case IDTypeGUID:
+		e.u8(4)
+		e.u16(n.Namespace)
+		e.guid(n.GUID)
+	case IDTypeByteString:
+		e.u8(5)
+		e.u16(n.Namespace)
+		e.bytes(n.Bytes)
+	default:
+		switch {
+		case n.Namespace == 0 && n.Numeric <= 0xFF:
+			e.u8(0)
+			e.u8(byte(n.Numeric))
+		case n.Namespace <= 0xFF && n.Numeric <= 0xFFFF:
+			e.u8(1)
+			e.u8(byte(n.Namespace))
+			e.u16(uint16(n.Numeric))
+		default:
+			e.u8(2)
+			e.u16(n.Namespace)
+			e.u32(n.Numeric)
+		}
+	}
+}
+
+// extensionObject encodes the body of structure with the binary encoding id, the body is null if nil
+func (e *encoder) extensionObject(typeID uint32, body []byte) {
+	if body == nil {
+		e.nodeID(NodeID{})
+		e.u8(0)
+		return
+	}
+	e.nodeID(NewNumericNodeID(0, typeID))
+	e.u8(1)
+	e.i32(int32(len(body)))
+	e.buf = append(e.buf, body...)
+}
+
+func (e *encoder) localizedText(text string) {
+	if text == "" {
+		e.u8(0)
+		return
+	}
+	e.u8(2)
+	e.str(text)
+}
+
+// variantType returns the builtin type of a go value
+func variantType(v any) (byte, error) {
+	switch v.(type) {
+	case bool:
+		return TypeBoolean, nil
+	case int8:
+		return TypeSByte, nil
+	case uint8:
+		return TypeByte, nil
+	case int16:
+		return TypeInt16, nil
+	case uint16:
+		return TypeUInt16, nil
+	case int32:
+		return TypeInt32, nil
+	case uint32:
+		return TypeUInt32, nil
+	case int64, int:
+		return TypeInt64, nil
+	case uint64:
+		return TypeUInt64, nil
+	case float32:
+		return TypeFloat, nil
+	case float64:
+		return TypeDouble, nil
+	case string:
+		return TypeString, nil
+	case time.Time:
+		return TypeDateTime, nil
+	case []byte:
+		return TypeByteString, nil
+	}
+	return 0, errors.Trace(ErrTypeNotSupported)
+}
+
+func (e *encoder) scalar(v any) {
+	switch x := v.(type) {
+	case bool:
+		e.boolean(x)
+	case int8:
+		e.u8(byte(x))
+	case uint8:
+		e.u8(x)
+	case int16:
+		e.u16(uint16(x))
+	case uint16:
+		e.u16(x)
+	case int32:
+		e.i32(x)
+	case uint32:
+		e.u32(x)
+	case int64:
+		e.u64(uint64(x))
+	case int:
+		e.u64(uint64(x))
+	case uint64:
+		e.u64(x)
+	case float32:
+		e.u32(math.Float32bits(x))
+	case float64:
+		e.f64(x)
+	case string:
+		e.str(x)
+	case time.Time:
+		e.time(x)
+	case []byte:
+		e.bytes(x)
+	}
+}
+
+// variant encodes a go value into variant, []any is encoded as an array of the type of its first element
+func (e *encoder) variant(v any) error {
+	if v == nil {
+		e.u8(0)
+		return nil
+	}
+	if arr, ok := v.([]any); ok {
+		if len(arr) == 0 {
+			return errors.Trace(ErrTypeNotSupported)
+		}
+		typ, err := variantType(arr[0])
+		if err != nil {
+			return errors.Trace(err)
+		}
+		e.u8(typ | 0x80)
+		e.i32(int32(len(arr)))
+		for _, a := range arr {
+			if t, _ := variantType(a); t != typ {
+				return errors.Trace(ErrTypeNotSupported)
+			}
+			e.scalar(a)
+		}
+		return nil
+	}
+	typ, err := variantType(v)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	e.u8(typ)
+	e.scalar(v)
+	return nil
+}
+
+func (e *encoder) dataValue(v *DataValue) error {
+	mask := byte(0x01)
+	if v.Status != StatusOK {
+		mask |= 0x02
+	}
+	if !v.SourceTimestamp.IsZero() {
+		mask |= 0x04
+	}
+	if !v.ServerTimestamp.IsZero() {
+		mask |= 0x08
+	}
+	e.u8(mask)
+	if err := e.variant(v.Value); err != nil {
+		return errors.Trace(err)
+	}
+	if mask&0x02 != 0 {
+		e.u32(uint32(v.Status))
+	}
+	if mask&0x04 != 0 {
+		e.time(v.SourceTimestamp)
+	}
+	if mask&0x08 != 0 {
+		e.time(v.ServerTimestamp)
+	}
+	return nil
+}
+
+// requestHeader the header of service request
+type requestHeader struct {
+	authToken   NodeID
+	handle      uint32
+	timeoutHint uint32
+}
+
+func (e *encoder) requestHeader(h requestHeader) {
+	e.nodeID(h.authToken)
+	e.time(time.Now())
+	e.u32(h.handle)
+	e.u32(0)
+	e.str("")
+	e.u32(h.timeoutHint)
+	e.extensionObject(0, nil)
+}
+
+func (e *encoder) responseHeader(handle uint32, result StatusCode) {
+	e.time(time.Now())
+	e.u32(handle)
+	e.u32(uint32(result))
+	e.u8(0)
+	e.strs(nil)
+	e.extensionObject(0, nil)
+}
+
+// decoder decodes values in the opc ua binary encoding, the first error is kept and
+// the following reads return zero values
+type decoder struct {
+	buf []byte
+	err error
+}
+
+func (d *decoder) read(n int) []byte {
+	if d.err != nil {
+		return nil
+	}
+	if n < 0 || len(d.buf) < n {
+		d.err = errors.Trace(ErrInvalidMessage)
+		return nil
+	}
+	b := d.buf[:n]
+	d.buf = d.buf[n:]
+	return b
+}
+
+func (d *decoder) u8() byte {
+	if b := d.read(1); b != nil {
+		return b[0]
+	}
+	return 0
+}
+
+func (d *decoder) u16() uint16 {
+	if b := d.read(2); b != nil {
+		return binary.LittleEndian.Uint16(b)
+	}
+	return 0
+}
+
+func (d *decoder) u32() uint32 {
+	if b := d.read(4); b != nil {
+		return binary.LittleEndian.Uint32(b)
+	}
+	return 0
+}
+
+func (d *decoder) u64() uint64 {
+	if b := d.read(8); b != nil {
+		return binary.LittleEndian.Uint64(b)
+	}
+	return 0
+}
+
+func (d *decoder) i32() int32 {
+	return int32(d.u32())
+}
+
+func (d *decoder) f64() float64 {
+	return math.Float64frombits(d.u64())
+}
+
+func (d *decoder) boolean() bool {
+	return d.u8() != 0
+}
+
+// length decodes the length of string or array, -1 for null, which is checked against the remaining data
+func (d *decoder) length() int {
+	n := int(d.i32())
+	if n < 0 {
+		return -1
+	}
+	if d.err == nil && n > len(d.buf) {
+		d.err = errors.Trace(ErrInvalidMessage)
+		return -1
+	}
+	return n
+}
+
+func (d *decoder) bytes() []byte {
+	n := d.length()
+	if n < 0 {
+		return nil
+	}
+	return append([]byte{}, d.read(n)...)
+}
+
+func (d *decoder) str() string {
+	return string(d.bytes())
+}
+
+func (d *decoder) strs() []string {
+	n := d.length()
+	var res []string
+	for i := 0; i < n && d.err == nil; i++ {
+		res = append(res, d.str())
+	}
+	return res
+}
+
+func (d *decoder) u32s() []uint32 {
+	n := d.length()
+	var res []uint32
+	for i := 0; i < n && d.err == nil; i++ {
+		res = append(res, d.u32())
+	}
+	return res
+}
+
+func (d *decoder) time() time.Time {
+	v := int64(d.u64())
+	if v <= 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, (v-ticksTo1970)*100).UTC()
+}
+
+func (d *decoder) guid() [16]byte {
+	var g [16]byte
+	b := d.read(16)
+	if b == nil {
+		return g
+	}
+	g = [16]byte{b[3], b[2], b[1], b[0], b[5], b[4], b[7], b[6]}
+	copy(g[8:], b[8:])
+	return g
+}
+
+func (d *decoder) nodeID() NodeID {
+	mask := d.u8()
+	var n NodeID
+	switch mask & 0x3F {
+	case 0:
+		n = NewNumericNodeID(0, uint32(d.u8()))
+	case 1:
+		ns := d.u8()
+		n = NewNumericNodeID(uint16(ns), uint32(d.u16()))
+	case 2:
+		ns := d.u16()
+		n = NewNumericNodeID(ns, d.u32())
+	case 3:
+		ns := d.u16()
+		n = NewStringNodeID(ns, d.str())
+	case 4:
+		n = NodeID{Namespace: d.u16(), IDType: IDTypeGUID}
+		n.GUID = d.guid()
+	case 5:
+		n = NodeID{Namespace: d.u16(), IDType: IDTypeByteString}
+		n.Bytes = d.bytes()
+	default:
+		d.err = errors.Trace(ErrInvalidMessage)
+	}
+	// the namespace uri and server index of expanded node id
+	if mask&0x80 != 0 {
+		d.str()
+	}
+	if mask&0x40 != 0 {
+		d.u32()
+	}
+	return n
+}
+
+// extensionObject decodes an extension object, returns the binary encoding id and the body
+func (d *decoder) extensionObject() (uint32, []byte) {
+	typ := d.nodeID()
+	switch d.u8() {
+	case 0:
+		return typ.Numeric, nil
+	case 1, 2:
+		n := d.length()
+		if n < 0 {
+			return typ.Numeric, nil
+		}
+		return typ.Numeric, d.read(n)
+	}
+	d.err = errors.Trace(ErrInvalidMessage)
+	return 0, nil
+}
+
+func (d *decoder) localizedText() string {
+	mask := d.u8()
+	if mask&0x01 != 0 {
+		d.str()
+	}
+	if mask&0x02 != 0 {
+		return d.str()
+	}
+	return ""
+}
+
+func (d *decoder) diagnosticInfo() {
+	mask := d.u8()
+	for _, bit := range []byte{0x01, 0x02, 0x04, 0x08} {
+		if mask&bit != 0 {
+			d.i32()
+		}
+	}
+	if mask&0x10 != 0 {
+		d.str()
+	}
+	if mask&0x20 != 0 {
+		d.u32()
+	}
+	if mask&0x40 != 0 && d.err == nil {
+		d.diagnosticInfo()
+	}
+}
+
+func (d *decoder) diagnosticInfos() {
+	n := d.length()
+	for i := 0; i < n && d.err == nil; i++ {
+		d.diagnosticInfo()
+	}
+}
+
+func (d *decoder) scalar(typ byte) any {
+	switch typ {
+	case TypeBoolean:
+		return d.boolean()
+	case TypeSByte:
+		return int8(d.u8())
+	case TypeByte:
+		return d.u8()
+	case TypeInt16:
+		return int16(d.u16())
+	case TypeUInt16:
+		return d.u16()
+	case TypeInt32:
+		return d.i32()
+	case TypeUInt32:
+		return d.u32()
+	case TypeInt64:
+		return int64(d.u64())
+	case TypeUInt64:
+		return d.u64()
+	case TypeFloat:
+		return math.Float32frombits(d.u32())
+	case TypeDouble:
+		return d.f64()
+	case TypeString:
+		return d.str()
+	case TypeDateTime:
+		return d.time()
+	case 14:
+		return NodeID{IDType: IDTypeGUID, GUID: d.guid()}.String()[2:]
+	case TypeByteString:
+		return d.bytes()
+	case 16:
+		return d.str()
+	case 17:
+		return d.nodeID().String()
+	case 19:
+		return StatusCode(d.u32())
+	case 20:
+		d.u16()
+		return d.str()
+	case 21:
+		return d.localizedText()
+	}
+	d.err = errors.Trace(ErrTypeNotSupported)
+	return nil
+}
+
+// variant decodes a variant into a go value, and returns the builtin type of value, arrays are decoded into []any
+func (d *decoder) variant() (any, byte) {
+	mask := d.u8()
+	typ := mask & 0x3F
+	if typ == 0 {
+		return nil, 0
+	}
+	if mask&0x80 == 0 {
+		return d.scalar(typ), typ
+	}
+	n := d.length()
+	var res []any
+	for i := 0; i < n && d.err == nil; i++ {
+		res = append(res, d.scalar(typ))
+	}
+	if mask&0x40 != 0 {
+		d.u32s()
+	}
+	return res, typ
+}
+
+func (d *decoder) dataValue() *DataValue {
+	v := &DataValue{}
+	mask := d.u8()
+	if mask&0x01 != 0 {
+		v.Value, _ = d.variant()
+	}
+	if mask&0x02 != 0 {
+		v.Status = StatusCode(d.u32())
+	}
+	if mask&0x04 != 0 {
+		v.SourceTimestamp = d.time()
+	}
+	if mask&0x10 != 0 {
+		d.u16()
+	}
+	if mask&0x08 != 0 {
+		v.ServerTimestamp = d.time()
+	}
+	if mask&0x20 != 0 {
+		d.u16()
+	}
+	return v
+}
+
+func (d *decoder) requestHeader() requestHeader {
+	h := requestHeader{authToken: d.nodeID()}
+	d.time()
+	h.handle = d.u32()
+	d.u32()
+	d.str()
+	h.timeoutHint = d.u32()
+	d.extensionObject()
+	return h
+}
+
+// responseHeader decodes the response header, returns the service result
+func (d *decoder) responseHeader() StatusCode {
+	d.time()
+	d.u32()
+	res := StatusCode(d.u32())
+	d.diagnosticInfo()
+	d.strs()
+	d.extensionObject()
+	return res
+}
+
+func appendUint16(buf []byte, v uint16) []byte {
+	return append(buf, byte(v), byte(v>>8))
+}
+
+func appendUint32(buf []byte, v uint32) []byte {
+	return append(buf, byte(v), byte(v>>8), byte(v>>16), byte(v>>24))
+}
+
+func appendUint64(buf []byte, v uint64) []byte {
+	return appendUint32(appendUint32(buf, uint32(v)), uint32(v>>32))
+}
@@ -0,0 +1,202 @@
+package opcua
+
+import (
+	"encoding/binary"
+	"io"
+	"net"
+	"net/url"
+	"sync"
+
+	"github.com/baetyl/baetyl-go/v2/errors"
+)
+
+// The message types of opc ua connection protocol and secure conversation
+const (
+	msgHello        = "HEL"
+	msgAcknowledge  = "ACK"
+	msgError        = "ERR"
+	msgOpenChannel  = "OPN"
+	msgMessage      = "MSG"
+	msgCloseChannel = "CLO"
+)
+
+// The chunk types
+const (
+	chunkFinal        = 'F'
+	chunkIntermediate = 'C'
+	chunkAbort        = 'A'
+)
+
+// message a message of secure conversation whose chunks are reassembled
+type message struct {
+	typ       string
+	channelID uint32
+	tokenID   uint32
+	requestID uint32
+	// typeID the binary encoding id of the service of body
+	typeID uint32
+	body   []byte
+	// err the error of aborted message, or of the error message
+	err error
+}
+
+// conn frames the messages of secure conversation over tcp with the security policy None
+type conn struct {
+	net.Conn
+	// the max size of chunk to send, which is negotiated by hello and acknowledge
+	sendBufferSize int
+	seq            uint32
+	// the chunks received but not completed, keyed by request id
+	chunks map[uint32][]byte
+	wmut   sync.Mutex
+}
+
+func newConn(c net.Conn) *conn {
+	return &conn{Conn: c, sendBufferSize: defaultBufferSize, chunks: map[uint32][]byte{}}
+}
+
+// parseEndpoint returns the address to dial of the endpoint, such as opc.tcp://127.0.0.1:4840/path
+func parseEndpoint(endpoint string) (string, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil || u.Scheme != "opc.tcp" || u.Host == "" {
+		return "", errors.Trace(ErrInvalidEndpoint)
+	}
+	if u.Port() == "" {
+		return net.JoinHostPort(u.Hostname(), "4840"), nil
+	}
+	return u.Host, nil
+}
+
+// writeRaw writes a message of connection protocol, such as hello
+func (c *conn) writeRaw(typ string, body []byte) error {
+	c.wmut.Lock()
+	defer c.wmut.Unlock()
+	buf := make([]byte, 8, 8+len(body))
+	copy(buf, typ)
+	buf[3] = chunkFinal
+	binary.LittleEndian.PutUint32(buf[4:], uint32(8+len(body)))
+	_, err := c.Write(append(buf, body...))
+	return errors.Trace(err)
+}
+
+// writeMessage writes a message of secure conversation, which is split into chunks by the send buffer size
+func (c *conn) writeMessage(typ string, channelID, tokenID, requestID, typeID uint32, body []byte) error {
+	var e encoder
+	e.nodeID(NewNumericNodeID(0, typeID))
+	payload := append(e.buf, body...)
+
+	var security encoder
+	security.u32(channelID)
+	if typ == msgOpenChannel {
+		security.str(SecurityPolicyNone)
+		security.bytes(nil)
+		security.bytes(nil)
+	} else {
+		security.u32(tokenID)
+	}
+	// the message header, security header and sequence header
+	overhead := 8 + len(security.buf) + 8
+	size := c.sendBufferSize - overhead
+	if size <= 0 {
+		return errors.Trace(ErrInvalidMessage)
+	}
+
+	c.wmut.Lock()
+	defer c.wmut.Unlock()
+	for {
+		n, chunkType := len(payload), byte(chunkFinal)
+		if n > size {
+			n, chunkType = size, chunkIntermediate
+		}
+		c.seq++
+		buf := make([]byte, 8, overhead+n)
+		copy(buf, typ)
+		buf[3] = chunkType
+		binary.LittleEndian.PutUint32(buf[4:], uint32(overhead+n))
+		buf = append(buf, security.buf...)
+		buf = appendUint32(buf, c.seq)
+		buf = appendUint32(buf, requestID)
+		buf = append(buf, payload[:n]...)
+		if _, err := c.Write(buf); err != nil {
+			return errors.Trace(err)
+		}
+		payload = payload[n:]
+		if chunkType == chunkFinal {
+			return nil
+		}
+	}
+}
+
+// readMessage reads chunks until a message is completed
+func (c *conn) readMessage() (*message, error) {
+	for {
+		header := make([]byte, 8)
+		if _, err := io.ReadFull(c, header); err != nil {
+			return nil, errors.Trace(err)
+		}
+		size := int(binary.LittleEndian.Uint32(header[4:]))
+		if size < 8 || size > defaultMaxMessageSize {
+			return nil, errors.Trace(ErrInvalidMessage)
+		}
+		data := make([]byte, size-8)
+		if _, err := io.ReadFull(c, data); err != nil {
+			return nil, errors.Trace(err)
+		}
+		msg := &message{typ: string(header[:3])}
+		d := &decoder{buf: data}
+		switch msg.typ {
+		case msgHello, msgAcknowledge:
+			msg.body = data
+			return msg, nil
+		case msgError:
+			code := StatusCode(d.u32())
+			reason := d.str()
+			msg.err = errors.Errorf("%s: %s", code.Error(), reason)
+			return msg, nil
+		case msgOpenChannel:
+			msg.channelID = d.u32()
+			policy := d.str()
+			d.bytes()
+			d.bytes()
+			if d.err == nil && policy != SecurityPolicyNone {
+				return nil, errors.Trace(ErrSecurityNotSupported)
+			}
+		case msgMessage, msgCloseChannel:
+			msg.channelID = d.u32()
+			msg.tokenID = d.u32()
+		default:
+			return nil, errors.Trace(ErrInvalidMessage)
+		}
+		d.u32()
+		msg.requestID = d.u32()
+		if d.err != nil {
+			return nil, errors.Trace(d.err)
+		}
+
+		switch header[3] {
+		case chunkIntermediate:
+			if len(c.chunks[msg.requestID])+len(d.buf) > defaultMaxMessageSize {
+				return nil, errors.Trace(ErrInvalidMessage)
+			}
+			c.chunks[msg.requestID] = append(c.chunks[msg.requestID], d.buf...)
+			continue
+		case chunkAbort:
+			delete(c.chunks, msg.requestID)
+			code := StatusCode(d.u32())
+			msg.err = errors.Errorf("message aborted, %s: %s", code.Error(), d.str())
+			return msg, nil
+		case chunkFinal:
+		default:
+			return nil, errors.Trace(ErrInvalidMessage)
+		}
+		payload := append(c.chunks[msg.requestID], d.buf...)
+		delete(c.chunks, msg.requestID)
+		d = &decoder{buf: payload}
+		msg.typeID = d.nodeID().Numeric
+		if d.err != nil {
+			return nil, errors.Trace(d.err)
+		}
+		msg.body = d.buf
+		return msg, nil
+	}
+}
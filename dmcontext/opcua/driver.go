@@ -0,0 +1,222 @@
+package opcua
+
+import (
+	"sync"
+
+	"github.com/baetyl/baetyl-go/v2/dmcontext"
+	"github.com/baetyl/baetyl-go/v2/errors"
+	"github.com/baetyl/baetyl-go/v2/log"
+)
+
+// Driver implements dmcontext.Driver for opc ua devices, it keeps a client per device.
+// If subscribe is enabled in the access config, the properties are monitored once connected,
+// and read from the values published, otherwise they are polled by read requests.
+type Driver struct {
+	ctx        dmcontext.Context
+	driverName string
+	devices    map[string]*driverDevice
+	log        *log.Logger
+	mut        sync.Mutex
+}
+
+type driverDevice struct {
+	client *Client
+	cfg    *dmcontext.OpcuaAccessConfig
+	// the values published keyed by node id
+	values map[string]any
+	mut    sync.Mutex
+}
+
+// NewDriver creates a new opc ua driver, which is run by dmcontext.Runtime
+func NewDriver(ctx dmcontext.Context, driverName string) *Driver {
+	return &Driver{
+		ctx:        ctx,
+		driverName: driverName,
+		devices:    map[string]*driverDevice{},
+		log:        log.L().With(log.Any("driver", driverName)),
+	}
+}
+
+func (d *Driver) device(dev *dmcontext.DeviceInfo) (*driverDevice, error) {
+	d.mut.Lock()
+	defer d.mut.Unlock()
+	if res, ok := d.devices[dev.Name]; ok {
+		return res, nil
+	}
+	if dev.AccessConfig == nil || dev.AccessConfig.Opcua == nil {
+		return nil, errors.Trace(ErrInvalidEndpoint)
+	}
+	cli, err := NewClient(dev.AccessConfig.Opcua)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	res := &driverDevice{client: cli, cfg: dev.AccessConfig.Opcua}
+	d.devices[dev.Name] = res
+	return res, nil
+}
+
+// Connect connects to the server of device, and monitors the properties if subscribe is enabled.
+// It falls back to polling if failed to subscribe.
+func (d *Driver) Connect(dev *dmcontext.DeviceInfo) error {
+	device, err := d.device(dev)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	if err = device.client.Connect(); err != nil {
+		return errors.Trace(err)
+	}
+	device.mut.Lock()
+	device.values = nil
+	device.mut.Unlock()
+	if !device.cfg.Subscribe {
+		return nil
+	}
+	if err = d.subscribe(dev, device); err != nil {
+		d.log.Warn("failed to subscribe, to poll instead", log.Any("device", dev.Name), log.Error(err))
+	}
+	return nil
+}
+
+func (d *Driver) subscribe(dev *dmcontext.DeviceInfo, device *driverDevice) error {
+	tpl, err := d.ctx.GetAccessTemplates(d.driverName, dev.AccessTemplate)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	var nodes []NodeID
+	for _, p := range tpl.Properties {
+		if p.Visitor.Opcua == nil {
+			continue
+		}
+		node, err := ResolveNodeID(device.cfg, p.Visitor.Opcua)
+		if err != nil {
+			return errors.Errorf("property (%s) has invalid node id: %s", p.Name, err.Error())
+		}
+		nodes = append(nodes, node)
+	}
+	if len(nodes) == 0 {
+		return nil
+	}
+	device.mut.Lock()
+	device.values = map[string]any{}
+	device.mut.Unlock()
+	_, err = device.client.Subscribe(dev.AccessConfig.Interval(), nodes, func(node NodeID, value *DataValue) {
+		device.mut.Lock()
+		defer device.mut.Unlock()
+		if device.values == nil {
+			return
+		}
+		if value.Status.IsBad() {
+			delete(device.values, node.String())
+			return
+		}
+		device.values[node.String()] = value.Value
+	})
+	if err != nil {
+		device.mut.Lock()
+		device.values = nil
+		device.mut.Unlock()
+		return errors.Trace(err)
+	}
+	return nil
+}
+
+// Read reads the properties which have opc ua visitors, the values published are used if subscribed,
+// and the others are read in one request. The property whose node is bad is skipped.
+func (d *Driver) Read(dev *dmcontext.DeviceInfo, props []dmcontext.DeviceProperty) (map[string]any, error) {
+	device, err := d.device(dev)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	if !device.client.Connected() {
+		return nil, errors.Trace(ErrClientClosed)
+	}
+	res := map[string]any{}
+	var nodes []NodeID
+	var polled []dmcontext.DeviceProperty
+	for _, p := range props {
+		if p.Visitor.Opcua == nil {
+			continue
+		}
+		node, err := ResolveNodeID(device.cfg, p.Visitor.Opcua)
+		if err != nil {
+			d.log.Warn("property has invalid node id", log.Any("device", dev.Name), log.Any("property", p.Name), log.Error(err))
+			continue
+		}
+		device.mut.Lock()
+		v, ok := device.values[node.String()]
+		device.mut.Unlock()
+		if ok {
+			if res[p.ID], err = ToValue(p.Visitor.Opcua.Type, v); err != nil {
+				return nil, errors.Trace(err)
+			}
+			continue
+		}
+		nodes = append(nodes, node)
+		polled = append(polled, p)
+	}
+	if len(nodes) == 0 {
+		return res, nil
+	}
+	values, err := device.client.Read(nodes...)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	for i, v := range values {
+		p := polled[i]
+		if v.Status.IsBad() {
+			d.log.Warn("failed to read property", log.Any("device", dev.Name), log.Any("property", p.Name), log.Error(v.Status))
+			continue
+		}
+		if res[p.ID], err = ToValue(p.Visitor.Opcua.Type, v.Value); err != nil {
+			return nil, errors.Trace(err)
+		}
+	}
+	return res, nil
+}
+
+// Write writes the values keyed by the property ids of access template in one request
+func (d *Driver) Write(dev *dmcontext.DeviceInfo, values map[string]any) error {
+	device, err := d.device(dev)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	tpl, err := d.ctx.GetAccessTemplates(d.driverName, dev.AccessTemplate)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	visitors := map[string]*dmcontext.OpcuaVisitor{}
+	for _, p := range tpl.Properties {
+		visitors[p.ID] = p.Visitor.Opcua
+	}
+	var nodes []NodeID
+	var vals []any
+	for id, val := range values {
+		v, ok := visitors[id]
+		if !ok || v == nil {
+			return errors.Trace(dmcontext.ErrUnknownPropertyID)
+		}
+		node, err := ResolveNodeID(device.cfg, v)
+		if err != nil {
+			return errors.Trace(err)
+		}
+		val, err = FromValue(v.Type, val)
+		if err != nil {
+			return errors.Trace(err)
+		}
+		nodes = append(nodes, node)
+		vals = append(vals, val)
+	}
+	return errors.Trace(device.client.Write(nodes, vals))
+}
+
+// Close closes the client of device
+func (d *Driver) Close(dev *dmcontext.DeviceInfo) error {
+	d.mut.Lock()
+	device, ok := d.devices[dev.Name]
+	delete(d.devices, dev.Name)
+	d.mut.Unlock()
+	if !ok {
+		return nil
+	}
+	return errors.Trace(device.client.Close())
+}
@@ -0,0 +1,139 @@
+package opcua
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/baetyl/baetyl-go/v2/dmcontext"
+	"github.com/baetyl/baetyl-go/v2/errors"
+)
+
+// The types of node id, which are the same as dmcontext.OpcuaVisitor.IDType
+const (
+	IDTypeNumeric    = "i"
+	IDTypeString     = "s"
+	IDTypeGUID       = "g"
+	IDTypeByteString = "b"
+)
+
+// NodeID the id of a node in the address space of server
+type NodeID struct {
+	Namespace uint16
+	IDType    string
+	Numeric   uint32
+	Text      string
+	// GUID in the order of the text form
+	GUID  [16]byte
+	Bytes []byte
+}
+
+// NewNumericNodeID creates a numeric node id
+func NewNumericNodeID(ns uint16, id uint32) NodeID {
+	return NodeID{Namespace: ns, IDType: IDTypeNumeric, Numeric: id}
+}
+
+// NewStringNodeID creates a string node id
+func NewStringNodeID(ns uint16, id string) NodeID {
+	return NodeID{Namespace: ns, IDType: IDTypeString, Text: id}
+}
+
+// String returns the text form of node id, such as ns=2;s=temperature
+func (n NodeID) String() string {
+	var id string
+	switch n.IDType {
+	case IDTypeString:
+		id = "s=" + n.Text
+	case IDTypeGUID:
+		g := hex.EncodeToString(n.GUID[:])
+		id = fmt.Sprintf("g=%s-%s-%s-%s-%s", g[:8], g[8:12], g[12:16], g[16:20], g[20:])
+	case IDTypeByteString:
+		id = "b=" + base64.StdEncoding.EncodeToString(n.Bytes)
+	default:
+		id = "i=" + strconv.FormatUint(uint64(n.Numeric), 10)
+	}
+	if n.Namespace == 0 {
+		return id
+	}
+	return fmt.Sprintf("ns=%d;%s", n.Namespace, id)
+}
+
+// ParseNodeID parses the text form of node id, such as ns=2;i=1001 or s=temperature
+func ParseNodeID(s string) (NodeID, error) {
+	var ns int
+	s = strings.TrimSpace(s)
+	if strings.HasPrefix(s, "ns=") {
+		parts := strings.SplitN(s[3:], ";", 2)
+		if len(parts) != 2 {
+			return NodeID{}, errors.Trace(ErrInvalidNodeID)
+		}
+		v, err := strconv.ParseUint(parts[0], 10, 16)
+		if err != nil {
+			return NodeID{}, errors.Trace(ErrInvalidNodeID)
+		}
+		ns, s = int(v), parts[1]
+	}
+	if len(s) < 2 || s[1] != '=' {
+		return NodeID{}, errors.Trace(ErrInvalidNodeID)
+	}
+	return newNodeID(ns, s[:1], s[2:], 0)
+}
+
+// ResolveNodeID resolves the node id of visitor. The namespace is NsBase plus NsOffset of access config,
+// and the numeric id is IDBase plus IDOffset, so that the devices of the same access template
+// can be mapped to different nodes. The deprecated NodeID of visitor is used if IDBase is not set.
+func ResolveNodeID(cfg *dmcontext.OpcuaAccessConfig, v *dmcontext.OpcuaVisitor) (NodeID, error) {
+	if v.IDBase == "" {
+		if v.NodeID == "" {
+			return NodeID{}, errors.Trace(ErrInvalidNodeID)
+		}
+		return ParseNodeID(v.NodeID)
+	}
+	var nsOffset, idOffset int
+	if cfg != nil {
+		nsOffset, idOffset = cfg.NsOffset, cfg.IDOffset
+	}
+	typ := v.IDType
+	if typ == "" {
+		typ = IDTypeNumeric
+	}
+	return newNodeID(v.NsBase+nsOffset, typ, v.IDBase, idOffset)
+}
+
+func newNodeID(ns int, typ, id string, offset int) (NodeID, error) {
+	if ns < 0 || ns > 0xFFFF {
+		return NodeID{}, errors.Trace(ErrInvalidNodeID)
+	}
+	res := NodeID{Namespace: uint16(ns), IDType: typ}
+	switch typ {
+	case IDTypeNumeric:
+		v, err := strconv.ParseInt(id, 10, 64)
+		if err != nil {
+			return NodeID{}, errors.Trace(ErrInvalidNodeID)
+		}
+		v += int64(offset)
+		if v < 0 || v > 0xFFFFFFFF {
+			return NodeID{}, errors.Trace(ErrInvalidNodeID)
+		}
+		res.Numeric = uint32(v)
+	case IDTypeString:
+		res.Text = id
+	case IDTypeGUID:
+		b, err := hex.DecodeString(strings.ReplaceAll(id, "-", ""))
+		if err != nil || len(b) != 16 {
+			return NodeID{}, errors.Trace(ErrInvalidNodeID)
+		}
+		copy(res.GUID[:], b)
+	case IDTypeByteString:
+		b, err := base64.StdEncoding.DecodeString(id)
+		if err != nil {
+			return NodeID{}, errors.Trace(ErrInvalidNodeID)
+		}
+		res.Bytes = b
+	default:
+		return NodeID{}, errors.Trace(ErrInvalidNodeID)
+	}
+	return res, nil
+}
@@ -0,0 +1,142 @@
+// Package opcua implements an opc ua client over the binary protocol (opc.tcp) to access the properties
+// of devices by dmcontext.OpcuaVisitor.
+// Only the security policy None is supported with anonymous identity, the user name identity is refused
+// since its password would be sent in plaintext.
+package opcua
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/baetyl/baetyl-go/v2/errors"
+)
+
+// The security policy and mode supported
+const (
+	SecurityPolicyNone    = "http://opcfoundation.org/UA/SecurityPolicy#None"
+	SecurityModeNone      = "None"
+	securityModeNoneValue = 1
+)
+
+// The binary encoding ids of the services and structures used
+const (
+	idServiceFault                 = 397
+	idOpenSecureChannelRequest     = 446
+	idOpenSecureChannelResponse    = 449
+	idCloseSecureChannelRequest    = 452
+	idCreateSessionRequest         = 461
+	idCreateSessionResponse        = 464
+	idActivateSessionRequest       = 467
+	idActivateSessionResponse      = 470
+	idCloseSessionRequest          = 473
+	idCloseSessionResponse         = 476
+	idReadRequest                  = 631
+	idReadResponse                 = 634
+	idWriteRequest                 = 673
+	idWriteResponse                = 676
+	idCreateMonitoredItemsRequest  = 751
+	idCreateMonitoredItemsResponse = 754
+	idCreateSubscriptionRequest    = 787
+	idCreateSubscriptionResponse   = 790
+	idDataChangeNotification       = 811
+	idPublishRequest               = 826
+	idPublishResponse              = 829
+	idDeleteSubscriptionsRequest   = 847
+	idDeleteSubscriptionsResponse  = 850
+	idAnonymousIdentityToken       = 321
+	idUserNameIdentityToken        = 324
+	attributeValue                 = 13
+	timestampsBoth                 = 2
+	monitoringModeReporting        = 2
+	userTokenAnonymous             = 0
+	userTokenUserName              = 1
+	applicationTypeClient          = 1
+	applicationTypeServer          = 0
+	defaultBufferSize              = 65535
+	defaultMaxMessageSize          = 16 << 20
+	defaultSessionTimeout          = 60000
+)
+
+// The builtin types of variant
+const (
+	TypeBoolean    byte = 1
+	TypeSByte      byte = 2
+	TypeByte       byte = 3
+	TypeInt16      byte = 4
+	TypeUInt16     byte = 5
+	TypeInt32      byte = 6
+	TypeUInt32     byte = 7
+	TypeInt64      byte = 8
+	TypeUInt64     byte = 9
+	TypeFloat      byte = 10
+	TypeDouble     byte = 11
+	TypeString     byte = 12
+	TypeDateTime   byte = 13
+	TypeByteString byte = 15
+)
+
+// StatusCode the status code of opc ua
+type StatusCode uint32
+
+// The status codes used
+const (
+	StatusOK                        StatusCode = 0
+	StatusBadUnexpectedError        StatusCode = 0x80010000
+	StatusBadDecodingError          StatusCode = 0x80070000
+	StatusBadTimeout                StatusCode = 0x800A0000
+	StatusBadServiceUnsupported     StatusCode = 0x800B0000
+	StatusBadSessionIDInvalid       StatusCode = 0x80250000
+	StatusBadIdentityTokenInvalid   StatusCode = 0x80200000
+	StatusBadIdentityTokenRejected  StatusCode = 0x80210000
+	StatusBadNodeIDUnknown          StatusCode = 0x80340000
+	StatusBadSubscriptionIDInvalid  StatusCode = 0x80280000
+	StatusBadNothingToDo            StatusCode = 0x800F0000
+	StatusBadTypeMismatch           StatusCode = 0x80740000
+	StatusBadSecurityPolicyRejected StatusCode = 0x80550000
+	StatusBadNoSubscription         StatusCode = 0x80790000
+)
+
+var statusNames = map[StatusCode]string{
+	StatusOK:                        "Good",
+	StatusBadUnexpectedError:        "BadUnexpectedError",
+	StatusBadDecodingError:          "BadDecodingError",
+	StatusBadTimeout:                "BadTimeout",
+	StatusBadServiceUnsupported:     "BadServiceUnsupported",
+	StatusBadSessionIDInvalid:       "BadSessionIdInvalid",
+	StatusBadIdentityTokenInvalid:   "BadIdentityTokenInvalid",
+	StatusBadIdentityTokenRejected:  "BadIdentityTokenRejected",
+	StatusBadNodeIDUnknown:          "BadNodeIdUnknown",
+	StatusBadSubscriptionIDInvalid:  "BadSubscriptionIdInvalid",
+	StatusBadNothingToDo:            "BadNothingToDo",
+	StatusBadTypeMismatch:           "BadTypeMismatch",
+	StatusBadSecurityPolicyRejected: "BadSecurityPolicyRejected",
+	StatusBadNoSubscription:         "BadNoSubscription",
+}
+
+// IsBad returns whether the status is bad
+func (s StatusCode) IsBad() bool {
+	return s&0x80000000 != 0
+}
+
+func (s StatusCode) Error() string {
+	if name, ok := statusNames[s]; ok {
+		return fmt.Sprintf("opcua status %s (0x%08X)", name, uint32(s))
+	}
+	return fmt.Sprintf("opcua status 0x%08X", uint32(s))
+}
+
+var (
+	ErrInvalidMessage       = errors.New("invalid opcua message")
+	ErrInvalidEndpoint      = errors.New("invalid opcua endpoint")
+	ErrInvalidNodeID        = errors.New("invalid opcua node id")
+	ErrSecurityNotSupported = errors.New("opcua security policy or mode not supported, only None is supported")
+	ErrUserNameNotSupported = errors.New("opcua user name token not supported, the password would be sent in plaintext with security None")
+	ErrClientClosed         = errors.New("opcua client is closed")
+	ErrTypeNotSupported     = errors.New("opcua variant type not supported")
+)
+
+// isSecurityNone returns whether the security policy and mode of config are None, empty is regarded as None
+func isSecurityNone(policy, mode string) bool {
+	policy = strings.TrimPrefix(policy, "http://opcfoundation.org/UA/SecurityPolicy#")
+	return (policy == "" || strings.EqualFold(policy, "None")) && (mode == "" || strings.EqualFold(mode, SecurityModeNone))
+}
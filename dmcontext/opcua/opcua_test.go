@@ -0,0 +1,333 @@
+package opcua
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/baetyl/baetyl-go/v2/dmcontext"
+	"github.com/baetyl/baetyl-go/v2/dmcontext/dmcontexttest"
+	"github.com/baetyl/baetyl-go/v2/errors"
+)
+
+func TestNodeID(t *testing.T) {
+	for _, s := range []string{
+		"i=85",
+		"ns=2;i=1001",
+		"ns=3;s=Channel1.Device1.Tag1",
+		"ns=1;g=72962b91-fa75-4ae6-8d28-b404dc7daf63",
+		"ns=4;b=YWJj",
+	} {
+		n, err := ParseNodeID(s)
+		assert.NoError(t, err, s)
+		assert.Equal(t, s, n.String())
+
+		var e encoder
+		e.nodeID(n)
+		d := &decoder{buf: e.buf}
+		assert.Equal(t, n, d.nodeID(), s)
+		assert.NoError(t, d.err)
+		assert.Empty(t, d.buf)
+	}
+	for _, s := range []string{"", "ns=2", "ns=x;i=1", "x=1", "i=abc", "g=123", "b=!"} {
+		_, err := ParseNodeID(s)
+		assert.Equal(t, ErrInvalidNodeID, errors.Cause(err), s)
+	}
+
+	cfg := &dmcontext.OpcuaAccessConfig{NsOffset: 1, IDOffset: 100}
+	n, err := ResolveNodeID(cfg, &dmcontext.OpcuaVisitor{NsBase: 1, IDBase: "1000"})
+	assert.NoError(t, err)
+	assert.Equal(t, "ns=2;i=1100", n.String())
+	n, err = ResolveNodeID(cfg, &dmcontext.OpcuaVisitor{NsBase: 1, IDBase: "temperature", IDType: IDTypeString})
+	assert.NoError(t, err)
+	assert.Equal(t, "ns=2;s=temperature", n.String())
+	n, err = ResolveNodeID(nil, &dmcontext.OpcuaVisitor{NodeID: "ns=3;i=7"})
+	assert.NoError(t, err)
+	assert.Equal(t, "ns=3;i=7", n.String())
+	_, err = ResolveNodeID(cfg, &dmcontext.OpcuaVisitor{})
+	assert.Equal(t, ErrInvalidNodeID, errors.Cause(err))
+	_, err = ResolveNodeID(&dmcontext.OpcuaAccessConfig{IDOffset: -10}, &dmcontext.OpcuaVisitor{IDBase: "1"})
+	assert.Equal(t, ErrInvalidNodeID, errors.Cause(err))
+}
+
+func TestVariant(t *testing.T) {
+	now := time.Unix(1700000000, 123400).UTC()
+	for _, v := range []any{
+		true, int8(-1), uint8(1), int16(-2), uint16(2), int32(-3), uint32(3), int64(-4), uint64(4),
+		float32(1.5), 2.5, "abc", now, []byte{1, 2}, []any{int32(1), int32(2)}, nil,
+	} {
+		var e encoder
+		assert.NoError(t, e.dataValue(&DataValue{Value: v, Status: StatusBadTypeMismatch, SourceTimestamp: now}))
+		d := &decoder{buf: e.buf}
+		res := d.dataValue()
+		assert.NoError(t, d.err)
+		assert.Equal(t, &DataValue{Value: v, Status: StatusBadTypeMismatch, SourceTimestamp: now}, res)
+	}
+
+	var e encoder
+	assert.Equal(t, ErrTypeNotSupported, errors.Cause(e.variant(struct{}{})))
+	assert.Equal(t, ErrTypeNotSupported, errors.Cause(e.variant([]any{int32(1), "a"})))
+	d := &decoder{buf: []byte{1}}
+	d.u32()
+	assert.Equal(t, ErrInvalidMessage, errors.Cause(d.err))
+	d = &decoder{buf: []byte{0xFF, 0xFF, 0xFF, 0x0F}}
+	assert.Equal(t, -1, d.length())
+	assert.Equal(t, ErrInvalidMessage, errors.Cause(d.err))
+}
+
+func TestValue(t *testing.T) {
+	cases := []struct {
+		typ   string
+		value any
+		res   any
+	}{
+		{"", uint16(7), int32(7)},
+		{"", uint8(7), int16(7)},
+		{"", float32(1.5), float32(1.5)},
+		{"", []byte{1}, []byte{1}},
+		{dmcontext.TypeFloat64, int32(3), float64(3)},
+		{dmcontext.TypeString, time.Unix(0, 0).UTC(), "1970-01-01T00:00:00Z"},
+		{dmcontext.TypeBool, "true", true},
+	}
+	for _, c := range cases {
+		v, err := ToValue(c.typ, c.value)
+		assert.NoError(t, err)
+		assert.Equal(t, c.res, v)
+	}
+
+	v, err := FromValue(dmcontext.TypeInt16, 12.0)
+	assert.NoError(t, err)
+	assert.Equal(t, int16(12), v)
+	v, err = FromValue(dmcontext.TypeInt, "12")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(12), v)
+	v, err = FromValue("", uint32(1))
+	assert.NoError(t, err)
+	assert.Equal(t, uint32(1), v)
+	_, err = FromValue(dmcontext.TypeArray, 1)
+	assert.Equal(t, dmcontext.ErrTypeNotSupported, errors.Cause(err))
+}
+
+func newServer(t *testing.T) *simulator {
+	sim := startSimulator(t)
+	sim.SetValue(NewNumericNodeID(2, 1001), float64(25.5))
+	sim.SetValue(NewStringNodeID(2, "switch"), false)
+	sim.SetValue(NewNumericNodeID(2, 1003), int32(1))
+	return sim
+}
+
+func TestClient(t *testing.T) {
+	sim := newServer(t)
+
+	_, err := NewClient(&dmcontext.OpcuaAccessConfig{Endpoint: "tcp://127.0.0.1"})
+	assert.Equal(t, ErrInvalidEndpoint, errors.Cause(err))
+	_, err = NewClient(&dmcontext.OpcuaAccessConfig{
+		Endpoint: sim.Endpoint(),
+		Security: dmcontext.OpcuaSecurity{Policy: "Basic256Sha256", Mode: "SignAndEncrypt"},
+	})
+	assert.Equal(t, ErrSecurityNotSupported, errors.Cause(err))
+
+	cli, err := NewClient(&dmcontext.OpcuaAccessConfig{Endpoint: sim.Endpoint(), Timeout: time.Second})
+	assert.NoError(t, err)
+	defer cli.Close()
+	_, err = cli.Read(NewNumericNodeID(2, 1001))
+	assert.Equal(t, ErrClientClosed, errors.Cause(err))
+	assert.NoError(t, cli.Connect())
+	assert.NoError(t, cli.Connect())
+	assert.True(t, cli.Connected())
+
+	values, err := cli.Read(NewNumericNodeID(2, 1001), NewStringNodeID(2, "switch"), NewNumericNodeID(2, 9999))
+	assert.NoError(t, err)
+	assert.Len(t, values, 3)
+	assert.Equal(t, float64(25.5), values[0].Value)
+	assert.False(t, values[0].SourceTimestamp.IsZero())
+	assert.Equal(t, false, values[1].Value)
+	assert.Equal(t, StatusBadNodeIDUnknown, values[2].Status)
+
+	assert.NoError(t, cli.Write([]NodeID{NewNumericNodeID(2, 1001), NewStringNodeID(2, "switch")}, []any{float64(30), true}))
+	assert.Equal(t, float64(30), sim.Value(NewNumericNodeID(2, 1001)))
+	assert.Equal(t, true, sim.Value(NewStringNodeID(2, "switch")))
+	err = cli.Write([]NodeID{NewNumericNodeID(2, 1001)}, []any{"abc"})
+	assert.Equal(t, StatusBadTypeMismatch, errors.Cause(err))
+	err = cli.Write([]NodeID{NewNumericNodeID(2, 9999)}, []any{1})
+	assert.Equal(t, StatusBadNodeIDUnknown, errors.Cause(err))
+
+	// reconnect after the connection is lost
+	cli.mut.Lock()
+	cli.conn.Conn.Close()
+	cli.mut.Unlock()
+	assert.Eventually(t, func() bool { return !cli.Connected() }, time.Second, 10*time.Millisecond)
+	_, err = cli.Read(NewNumericNodeID(2, 1001))
+	assert.Error(t, err)
+	assert.NoError(t, cli.Connect())
+	values, err = cli.Read(NewNumericNodeID(2, 1001))
+	assert.NoError(t, err)
+	assert.Equal(t, float64(30), values[0].Value)
+
+	assert.NoError(t, cli.Close())
+	assert.False(t, cli.Connected())
+	assert.NoError(t, cli.Close())
+}
+
+func TestClientAuth(t *testing.T) {
+	sim := newServer(t)
+	sim.SetUser("admin", "secret")
+
+	cli, err := NewClient(&dmcontext.OpcuaAccessConfig{Endpoint: sim.Endpoint(), Timeout: time.Second})
+	assert.NoError(t, err)
+	assert.Equal(t, StatusBadIdentityTokenRejected, errors.Cause(cli.Connect()))
+	assert.False(t, cli.Connected())
+
+	// the password is not sent in plaintext
+	_, err = NewClient(&dmcontext.OpcuaAccessConfig{
+		Endpoint: sim.Endpoint(),
+		Timeout:  time.Second,
+		Auth:     &dmcontext.OpcuaAuth{Username: "admin", Password: "secret"},
+	})
+	assert.Equal(t, ErrUserNameNotSupported, errors.Cause(err))
+}
+
+func TestClientSubscribe(t *testing.T) {
+	sim := newServer(t)
+	cli, err := NewClient(&dmcontext.OpcuaAccessConfig{Endpoint: sim.Endpoint(), Timeout: time.Second})
+	assert.NoError(t, err)
+	defer cli.Close()
+	assert.NoError(t, cli.Connect())
+
+	var mut sync.Mutex
+	values := map[string]any{}
+	handler := func(node NodeID, value *DataValue) {
+		mut.Lock()
+		defer mut.Unlock()
+		values[node.String()] = value.Value
+	}
+	value := func(node NodeID) any {
+		mut.Lock()
+		defer mut.Unlock()
+		return values[node.String()]
+	}
+
+	_, err = cli.Subscribe(20*time.Millisecond, []NodeID{NewNumericNodeID(2, 9999)}, handler)
+	assert.EqualError(t, err, "failed to monitor node (ns=2;i=9999): opcua status BadNodeIdUnknown (0x80340000)")
+
+	id, err := cli.Subscribe(20*time.Millisecond, []NodeID{NewNumericNodeID(2, 1001), NewStringNodeID(2, "switch")}, handler)
+	assert.NoError(t, err)
+	// the initial values
+	assert.Eventually(t, func() bool {
+		return value(NewNumericNodeID(2, 1001)) == float64(25.5) && value(NewStringNodeID(2, "switch")) == false
+	}, time.Second, 10*time.Millisecond)
+
+	// the values changed, reads are not blocked by publishing
+	sim.SetValue(NewNumericNodeID(2, 1001), float64(26))
+	_, err = cli.Read(NewNumericNodeID(2, 1003))
+	assert.NoError(t, err)
+	assert.Eventually(t, func() bool {
+		return value(NewNumericNodeID(2, 1001)) == float64(26)
+	}, time.Second, 10*time.Millisecond)
+
+	assert.NoError(t, cli.Unsubscribe(id))
+	assert.Equal(t, StatusBadSubscriptionIDInvalid, errors.Cause(cli.Unsubscribe(id)))
+	sim.SetValue(NewNumericNodeID(2, 1001), float64(27))
+	time.Sleep(100 * time.Millisecond)
+	assert.Equal(t, float64(26), value(NewNumericNodeID(2, 1001)))
+}
+
+func TestDriver(t *testing.T) {
+	sim := newServer(t)
+
+	props := []dmcontext.DeviceProperty{
+		{ID: "1", Name: "temp", Type: dmcontext.TypeFloat64, Visitor: dmcontext.PropertyVisitor{
+			Opcua: &dmcontext.OpcuaVisitor{NsBase: 1, IDBase: "1", Type: dmcontext.TypeFloat64},
+		}},
+		{ID: "2", Name: "switch", Type: dmcontext.TypeBool, Visitor: dmcontext.PropertyVisitor{
+			Opcua: &dmcontext.OpcuaVisitor{NsBase: 1, IDBase: "switch", IDType: IDTypeString, Type: dmcontext.TypeBool},
+		}},
+		{ID: "3", Name: "status", Type: dmcontext.TypeInt32, Visitor: dmcontext.PropertyVisitor{
+			Opcua: &dmcontext.OpcuaVisitor{NodeID: "ns=2;i=1003", Type: dmcontext.TypeInt32},
+		}},
+		{ID: "4", Name: "unknown", Type: dmcontext.TypeInt32, Visitor: dmcontext.PropertyVisitor{
+			Opcua: &dmcontext.OpcuaVisitor{NodeID: "ns=2;i=9999", Type: dmcontext.TypeInt32},
+		}},
+	}
+	cases := []struct {
+		name       string
+		subscribe  bool
+		props      []dmcontext.DeviceProperty
+		subscribed bool
+	}{
+		{name: "poll", props: props},
+		// the unknown node fails the subscription, so it falls back to polling
+		{name: "subscribe fallback", subscribe: true, props: props},
+		{name: "subscribe", subscribe: true, props: props[:3], subscribed: true},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			ctx := dmcontexttest.NewContext(t)
+			err := ctx.SetDriverConfig("opcua", dmcontexttest.DriverConfig{
+				Devices: []dmcontext.DeviceInfo{{
+					Name:           "dev1",
+					AccessTemplate: "tpl1",
+					AccessConfig: &dmcontext.AccessConfig{Opcua: &dmcontext.OpcuaAccessConfig{
+						Endpoint:  sim.Endpoint(),
+						Timeout:   time.Second,
+						Interval:  20 * time.Millisecond,
+						Subscribe: c.subscribe,
+						NsOffset:  1,
+						IDOffset:  1000,
+					}},
+				}},
+				AccessTemplates: map[string]dmcontext.AccessTemplate{
+					"tpl1": {Properties: c.props},
+				},
+			})
+			assert.NoError(t, err)
+			dev, err := ctx.GetDevice("opcua", "dev1")
+			assert.NoError(t, err)
+
+			sim.SetValue(NewNumericNodeID(2, 1001), float64(25.5))
+			sim.SetValue(NewStringNodeID(2, "switch"), false)
+			sim.SetValue(NewNumericNodeID(2, 1003), int32(1))
+			d := NewDriver(ctx, "opcua")
+			_, err = d.Read(dev, c.props)
+			assert.Equal(t, ErrClientClosed, errors.Cause(err))
+			assert.NoError(t, d.Connect(dev))
+
+			// the unknown node is skipped
+			expected := map[string]any{"1": float64(25.5), "2": false, "3": int32(1)}
+			assert.Eventually(t, func() bool {
+				values, err := d.Read(dev, c.props)
+				return err == nil && assert.ObjectsAreEqual(expected, values)
+			}, time.Second, 10*time.Millisecond)
+			d.mut.Lock()
+			device := d.devices["dev1"]
+			d.mut.Unlock()
+			cached := func() int {
+				device.mut.Lock()
+				defer device.mut.Unlock()
+				return len(device.values)
+			}
+			if c.subscribed {
+				assert.Eventually(t, func() bool { return cached() == 3 }, time.Second, 10*time.Millisecond)
+			} else {
+				assert.Equal(t, 0, cached())
+			}
+
+			assert.NoError(t, d.Write(dev, map[string]any{"1": 30, "3": 2}))
+			assert.Equal(t, float64(30), sim.Value(NewNumericNodeID(2, 1001)))
+			assert.Equal(t, int32(2), sim.Value(NewNumericNodeID(2, 1003)))
+			sim.SetValue(NewStringNodeID(2, "switch"), true)
+			expected = map[string]any{"1": float64(30), "2": true, "3": int32(2)}
+			assert.Eventually(t, func() bool {
+				values, err := d.Read(dev, c.props)
+				return err == nil && assert.ObjectsAreEqual(expected, values)
+			}, time.Second, 10*time.Millisecond)
+			err = d.Write(dev, map[string]any{"5": 1})
+			assert.Equal(t, dmcontext.ErrUnknownPropertyID, errors.Cause(err))
+
+			assert.NoError(t, d.Close(dev))
+			assert.NoError(t, d.Close(dev))
+		})
+	}
+}
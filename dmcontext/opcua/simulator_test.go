@@ -0,0 +1,611 @@
+package opcua
+
+import (
+	"net"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/baetyl/baetyl-go/v2/errors"
+	"github.com/baetyl/baetyl-go/v2/log"
+	"github.com/baetyl/baetyl-go/v2/utils"
+)
+
+// the min publishing interval of simulator
+const simulatorMinInterval = 10 * time.Millisecond
+
+// simulator an in-process opc ua server for test, which serves the value attribute of variable nodes
+// by the binary protocol with the security policy None. Each connection has one session.
+type simulator struct {
+	listener net.Listener
+	// the username and password required, anonymous is accepted if empty
+	username string
+	password string
+	nodes    map[string]*simulatorNode
+	channels uint32
+	tomb     utils.Tomb
+	mut      sync.Mutex
+}
+
+type simulatorNode struct {
+	value   any
+	updated time.Time
+	version uint64
+}
+
+type simulatorSession struct {
+	conn      *conn
+	channelID uint32
+	tokenID   uint32
+	authToken NodeID
+	activated bool
+	subs      map[uint32]*simulatorSubscription
+	nextSubID uint32
+	seq       uint32
+	done      chan struct{}
+}
+
+type simulatorSubscription struct {
+	interval  time.Duration
+	keepAlive uint32
+	items     []*simulatorItem
+}
+
+type simulatorItem struct {
+	handle  uint32
+	key     string
+	version uint64
+}
+
+// startSimulator starts a simulator on localhost, which is closed when the test finishes
+func startSimulator(t testing.TB) *simulator {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to start simulator: %s", err)
+	}
+	s := &simulator{
+		listener: listener,
+		nodes:    map[string]*simulatorNode{},
+	}
+	s.tomb.Go(s.accept)
+	t.Cleanup(func() { s.Close() })
+	return s
+}
+
+// Endpoint returns the endpoint of simulator, such as opc.tcp://127.0.0.1:4840
+func (s *simulator) Endpoint() string {
+	return "opc.tcp://" + s.listener.Addr().String()
+}
+
+// SetUser requires the identity of username and password to activate sessions
+func (s *simulator) SetUser(username, password string) {
+	s.mut.Lock()
+	defer s.mut.Unlock()
+	s.username, s.password = username, password
+}
+
+// SetValue sets the value of node, the node is added if not exists
+func (s *simulator) SetValue(node NodeID, value any) {
+	s.mut.Lock()
+	defer s.mut.Unlock()
+	s.setValue(node.String(), value)
+}
+
+func (s *simulator) setValue(key string, value any) {
+	n, ok := s.nodes[key]
+	if !ok {
+		n = &simulatorNode{}
+		s.nodes[key] = n
+	}
+	n.value = value
+	n.updated = time.Now()
+	n.version++
+}
+
+// Value returns the value of node
+func (s *simulator) Value(node NodeID) any {
+	s.mut.Lock()
+	defer s.mut.Unlock()
+	if n, ok := s.nodes[node.String()]; ok {
+		return n.value
+	}
+	return nil
+}
+
+// Close stops serving and closes all connections
+func (s *simulator) Close() error {
+	s.tomb.Kill(nil)
+	err := s.listener.Close()
+	s.tomb.Wait()
+	return errors.Trace(err)
+}
+
+func (s *simulator) accept() error {
+	for {
+		c, err := s.listener.Accept()
+		if err != nil {
+			if !s.tomb.Alive() {
+				return nil
+			}
+			return errors.Trace(err)
+		}
+		s.tomb.Go(func() error {
+			s.serve(newConn(c))
+			return nil
+		})
+	}
+}
+
+func (s *simulator) serve(cn *conn) {
+	ss := &simulatorSession{conn: cn, subs: map[uint32]*simulatorSubscription{}, done: make(chan struct{})}
+	defer close(ss.done)
+	defer cn.Close()
+	go func() {
+		select {
+		case <-s.tomb.Dying():
+			cn.Close()
+		case <-ss.done:
+		}
+	}()
+
+	msg, err := cn.readMessage()
+	if err != nil || msg.typ != msgHello {
+		return
+	}
+	var e encoder
+	e.u32(0)
+	e.u32(defaultBufferSize)
+	e.u32(defaultBufferSize)
+	e.u32(defaultMaxMessageSize)
+	e.u32(0)
+	if err = cn.writeRaw(msgAcknowledge, e.buf); err != nil {
+		return
+	}
+	for {
+		msg, err = cn.readMessage()
+		if err != nil || msg.err != nil {
+			return
+		}
+		switch msg.typ {
+		case msgOpenChannel:
+			err = s.openChannel(ss, msg)
+		case msgMessage:
+			err = s.handle(ss, msg)
+		default:
+			return
+		}
+		if err != nil {
+			log.L().Debug("failed to serve opcua request", log.Error(err))
+			return
+		}
+	}
+}
+
+func (s *simulator) openChannel(ss *simulatorSession, msg *message) error {
+	d := &decoder{buf: msg.body}
+	h := d.requestHeader()
+	d.u32()
+	d.u32()
+	mode := d.u32()
+	d.bytes()
+	lifetime := d.u32()
+	if d.err != nil {
+		return errors.Trace(d.err)
+	}
+	if mode != securityModeNoneValue {
+		return errors.Trace(s.fault(ss, msgOpenChannel, msg.requestID, h.handle, StatusBadSecurityPolicyRejected))
+	}
+	s.mut.Lock()
+	if ss.channelID == 0 {
+		s.channels++
+		ss.channelID = s.channels
+	}
+	ss.tokenID++
+	channelID, tokenID := ss.channelID, ss.tokenID
+	s.mut.Unlock()
+	var e encoder
+	e.responseHeader(h.handle, StatusOK)
+	e.u32(0)
+	e.u32(channelID)
+	e.u32(tokenID)
+	e.time(time.Now())
+	e.u32(lifetime)
+	e.bytes(nil)
+	return errors.Trace(ss.conn.writeMessage(msgOpenChannel, channelID, 0, msg.requestID, idOpenSecureChannelResponse, e.buf))
+}
+
+func (s *simulator) fault(ss *simulatorSession, typ string, requestID, handle uint32, status StatusCode) error {
+	var e encoder
+	e.responseHeader(handle, status)
+	s.mut.Lock()
+	channelID, tokenID := ss.channelID, ss.tokenID
+	s.mut.Unlock()
+	return errors.Trace(ss.conn.writeMessage(typ, channelID, tokenID, requestID, idServiceFault, e.buf))
+}
+
+func (s *simulator) reply(ss *simulatorSession, requestID, typeID uint32, body []byte) error {
+	s.mut.Lock()
+	channelID, tokenID := ss.channelID, ss.tokenID
+	s.mut.Unlock()
+	return errors.Trace(ss.conn.writeMessage(msgMessage, channelID, tokenID, requestID, typeID, body))
+}
+
+func (s *simulator) handle(ss *simulatorSession, msg *message) error {
+	d := &decoder{buf: msg.body}
+	h := d.requestHeader()
+	if d.err != nil {
+		return errors.Trace(d.err)
+	}
+	if msg.typeID != idCreateSessionRequest {
+		s.mut.Lock()
+		valid := ss.authToken.String() == h.authToken.String() && (ss.activated || msg.typeID == idActivateSessionRequest)
+		s.mut.Unlock()
+		if !valid {
+			return errors.Trace(s.fault(ss, msgMessage, msg.requestID, h.handle, StatusBadSessionIDInvalid))
+		}
+	}
+
+	var e encoder
+	var respID uint32
+	var status StatusCode
+	switch msg.typeID {
+	case idCreateSessionRequest:
+		respID = idCreateSessionResponse
+		s.createSession(ss, &e, h.handle)
+	case idActivateSessionRequest:
+		respID = idActivateSessionResponse
+		status = s.activateSession(ss, d, &e, h.handle)
+	case idCloseSessionRequest:
+		respID = idCloseSessionResponse
+		s.mut.Lock()
+		ss.activated = false
+		ss.subs = map[uint32]*simulatorSubscription{}
+		s.mut.Unlock()
+		e.responseHeader(h.handle, StatusOK)
+	case idReadRequest:
+		respID = idReadResponse
+		s.read(d, &e, h.handle)
+	case idWriteRequest:
+		respID = idWriteResponse
+		s.write(d, &e, h.handle)
+	case idCreateSubscriptionRequest:
+		respID = idCreateSubscriptionResponse
+		s.createSubscription(ss, d, &e, h.handle)
+	case idCreateMonitoredItemsRequest:
+		respID = idCreateMonitoredItemsResponse
+		status = s.createMonitoredItems(ss, d, &e, h.handle)
+	case idDeleteSubscriptionsRequest:
+		respID = idDeleteSubscriptionsResponse
+		s.deleteSubscriptions(ss, d, &e, h.handle)
+	case idPublishRequest:
+		s.mut.Lock()
+		empty := len(ss.subs) == 0
+		s.mut.Unlock()
+		if empty {
+			status = StatusBadNoSubscription
+			break
+		}
+		go s.publish(ss, msg.requestID, h.handle)
+		return nil
+	default:
+		status = StatusBadServiceUnsupported
+	}
+	if d.err != nil {
+		status = StatusBadDecodingError
+	}
+	if status != StatusOK {
+		return errors.Trace(s.fault(ss, msgMessage, msg.requestID, h.handle, status))
+	}
+	return errors.Trace(s.reply(ss, msg.requestID, respID, e.buf))
+}
+
+func (s *simulator) createSession(ss *simulatorSession, e *encoder, handle uint32) {
+	s.mut.Lock()
+	ss.authToken = NewNumericNodeID(1, uint32(time.Now().UnixNano()))
+	ss.activated = false
+	authToken, sessionID := ss.authToken, NewNumericNodeID(1, ss.channelID)
+	s.mut.Unlock()
+
+	e.responseHeader(handle, StatusOK)
+	e.nodeID(sessionID)
+	e.nodeID(authToken)
+	e.f64(defaultSessionTimeout)
+	e.bytes(make([]byte, 32))
+	e.bytes(nil)
+	// one endpoint without security, which accepts anonymous and username
+	e.i32(1)
+	e.str(s.Endpoint())
+	e.str("urn:baetyl:opcua:simulator")
+	e.str(productURI)
+	e.localizedText("simulator")
+	e.u32(applicationTypeServer)
+	e.str("")
+	e.str("")
+	e.strs(nil)
+	e.bytes(nil)
+	e.u32(securityModeNoneValue)
+	e.str(SecurityPolicyNone)
+	e.i32(2)
+	for _, p := range []struct {
+		id  string
+		typ uint32
+	}{{anonymousPolicyID, userTokenAnonymous}, {usernamePolicyID, userTokenUserName}} {
+		e.str(p.id)
+		e.u32(p.typ)
+		e.str("")
+		e.str("")
+		e.str("")
+	}
+	e.str("http://opcfoundation.org/UA-Profile/Transport/uatcp-uasc-uabinary")
+	e.u8(0)
+	e.i32(-1)
+	e.str("")
+	e.bytes(nil)
+	e.u32(0)
+}
+
+func (s *simulator) activateSession(ss *simulatorSession, d *decoder, e *encoder, handle uint32) StatusCode {
+	d.str()
+	d.bytes()
+	n := d.length()
+	for i := 0; i < n && d.err == nil; i++ {
+		d.bytes()
+		d.bytes()
+	}
+	d.strs()
+	typeID, body := d.extensionObject()
+	if d.err != nil {
+		return StatusBadDecodingError
+	}
+
+	s.mut.Lock()
+	defer s.mut.Unlock()
+	switch typeID {
+	case idAnonymousIdentityToken:
+		if s.username != "" {
+			return StatusBadIdentityTokenRejected
+		}
+	case idUserNameIdentityToken:
+		td := &decoder{buf: body}
+		td.str()
+		username := td.str()
+		password := string(td.bytes())
+		if td.err != nil {
+			return StatusBadIdentityTokenInvalid
+		}
+		if username != s.username || password != s.password {
+			return StatusBadIdentityTokenRejected
+		}
+	default:
+		return StatusBadIdentityTokenInvalid
+	}
+	ss.activated = true
+	e.responseHeader(handle, StatusOK)
+	e.bytes(make([]byte, 32))
+	e.u32s(nil)
+	e.i32(-1)
+	return StatusOK
+}
+
+func (s *simulator) read(d *decoder, e *encoder, handle uint32) {
+	d.f64()
+	d.u32()
+	n := d.length()
+	var keys []string
+	for i := 0; i < n && d.err == nil; i++ {
+		keys = append(keys, decodeReadValueID(d))
+	}
+	e.responseHeader(handle, StatusOK)
+	e.i32(int32(len(keys)))
+	s.mut.Lock()
+	defer s.mut.Unlock()
+	for _, k := range keys {
+		node, ok := s.nodes[k]
+		if !ok {
+			e.dataValue(&DataValue{Status: StatusBadNodeIDUnknown})
+			continue
+		}
+		e.dataValue(&DataValue{Value: node.value, SourceTimestamp: node.updated, ServerTimestamp: time.Now()})
+	}
+	e.i32(-1)
+}
+
+func decodeReadValueID(d *decoder) string {
+	key := d.nodeID().String()
+	d.u32()
+	d.str()
+	d.u16()
+	d.str()
+	return key
+}
+
+func (s *simulator) write(d *decoder, e *encoder, handle uint32) {
+	n := d.length()
+	var results []uint32
+	s.mut.Lock()
+	defer s.mut.Unlock()
+	for i := 0; i < n && d.err == nil; i++ {
+		key := d.nodeID().String()
+		d.u32()
+		d.str()
+		v := d.dataValue()
+		node, ok := s.nodes[key]
+		switch {
+		case !ok:
+			results = append(results, uint32(StatusBadNodeIDUnknown))
+		case node.value != nil && reflect.TypeOf(node.value) != reflect.TypeOf(v.Value):
+			results = append(results, uint32(StatusBadTypeMismatch))
+		default:
+			s.setValue(key, v.Value)
+			results = append(results, uint32(StatusOK))
+		}
+	}
+	e.responseHeader(handle, StatusOK)
+	e.u32s(results)
+	e.i32(-1)
+}
+
+func (s *simulator) createSubscription(ss *simulatorSession, d *decoder, e *encoder, handle uint32) {
+	interval := time.Duration(d.f64() * float64(time.Millisecond))
+	lifetime := d.u32()
+	keepAlive := d.u32()
+	if interval < simulatorMinInterval {
+		interval = simulatorMinInterval
+	}
+	if keepAlive == 0 {
+		keepAlive = 1
+	}
+	s.mut.Lock()
+	ss.nextSubID++
+	id := ss.nextSubID
+	ss.subs[id] = &simulatorSubscription{interval: interval, keepAlive: keepAlive}
+	s.mut.Unlock()
+	e.responseHeader(handle, StatusOK)
+	e.u32(id)
+	e.f64(float64(interval) / float64(time.Millisecond))
+	e.u32(lifetime)
+	e.u32(keepAlive)
+}
+
+func (s *simulator) createMonitoredItems(ss *simulatorSession, d *decoder, e *encoder, handle uint32) StatusCode {
+	id := d.u32()
+	d.u32()
+	n := d.length()
+	s.mut.Lock()
+	defer s.mut.Unlock()
+	sub, ok := ss.subs[id]
+	if !ok {
+		return StatusBadSubscriptionIDInvalid
+	}
+	e.responseHeader(handle, StatusOK)
+	e.i32(int32(n))
+	for i := 0; i < n && d.err == nil; i++ {
+		key := decodeReadValueID(d)
+		d.u32()
+		clientHandle := d.u32()
+		d.f64()
+		d.extensionObject()
+		d.u32()
+		d.boolean()
+		status := StatusOK
+		if _, ok := s.nodes[key]; ok {
+			sub.items = append(sub.items, &simulatorItem{handle: clientHandle, key: key})
+		} else {
+			status = StatusBadNodeIDUnknown
+		}
+		e.u32(uint32(status))
+		e.u32(uint32(len(sub.items)))
+		e.f64(float64(sub.interval) / float64(time.Millisecond))
+		e.u32(1)
+		e.extensionObject(0, nil)
+	}
+	e.i32(-1)
+	return StatusOK
+}
+
+func (s *simulator) deleteSubscriptions(ss *simulatorSession, d *decoder, e *encoder, handle uint32) {
+	ids := d.u32s()
+	var results []uint32
+	s.mut.Lock()
+	for _, id := range ids {
+		if _, ok := ss.subs[id]; ok {
+			delete(ss.subs, id)
+			results = append(results, uint32(StatusOK))
+		} else {
+			results = append(results, uint32(StatusBadSubscriptionIDInvalid))
+		}
+	}
+	s.mut.Unlock()
+	e.responseHeader(handle, StatusOK)
+	e.u32s(results)
+	e.i32(-1)
+}
+
+// publish responds to the publish request once any monitored item is changed,
+// or with a keep-alive message after the keep-alive count of publishing intervals
+func (s *simulator) publish(ss *simulatorSession, requestID, handle uint32) {
+	var interval time.Duration
+	var keepAlive uint32
+	s.mut.Lock()
+	for _, sub := range ss.subs {
+		if interval == 0 || sub.interval < interval {
+			interval = sub.interval
+		}
+		if sub.keepAlive > keepAlive {
+			keepAlive = sub.keepAlive
+		}
+	}
+	s.mut.Unlock()
+	if interval == 0 {
+		interval = simulatorMinInterval
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for i := uint32(0); ; i++ {
+		select {
+		case <-ss.done:
+			return
+		case <-ticker.C:
+		}
+		s.mut.Lock()
+		id, body := s.changes(ss)
+		if body == nil && i+1 < keepAlive && len(ss.subs) > 0 {
+			s.mut.Unlock()
+			continue
+		}
+		ss.seq++
+		seq := ss.seq
+		s.mut.Unlock()
+
+		var e encoder
+		e.responseHeader(handle, StatusOK)
+		e.u32(id)
+		e.u32s(nil)
+		e.boolean(false)
+		e.u32(seq)
+		e.time(time.Now())
+		if body == nil {
+			e.i32(0)
+		} else {
+			e.i32(1)
+			e.extensionObject(idDataChangeNotification, body)
+		}
+		e.u32s(nil)
+		e.i32(-1)
+		s.reply(ss, requestID, idPublishResponse, e.buf)
+		return
+	}
+}
+
+// changes returns the subscription and the data change notification of the items changed, must be called with lock held
+func (s *simulator) changes(ss *simulatorSession) (uint32, []byte) {
+	var first uint32
+	for id, sub := range ss.subs {
+		if first == 0 {
+			first = id
+		}
+		var e encoder
+		var n int32
+		for _, item := range sub.items {
+			node, ok := s.nodes[item.key]
+			if !ok || node.version == item.version {
+				continue
+			}
+			item.version = node.version
+			e.u32(item.handle)
+			e.dataValue(&DataValue{Value: node.value, SourceTimestamp: node.updated, ServerTimestamp: time.Now()})
+			n++
+		}
+		if n == 0 {
+			continue
+		}
+		var body encoder
+		body.i32(n)
+		body.buf = append(body.buf, e.buf...)
+		body.i32(-1)
+		return id, body.buf
+	}
+	return first, nil
+}
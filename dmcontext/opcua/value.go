@@ -0,0 +1,78 @@
+package opcua
+
+import (
+	"time"
+
+	"github.com/spf13/cast"
+
+	"github.com/baetyl/baetyl-go/v2/dmcontext"
+	"github.com/baetyl/baetyl-go/v2/errors"
+)
+
+// DataType returns the dmcontext type of a value decoded from variant, empty if it has no counterpart.
+// The unsigned integers are widened to the signed type which holds all their values.
+func DataType(v any) string {
+	switch v.(type) {
+	case bool:
+		return dmcontext.TypeBool
+	case int8, uint8, int16:
+		return dmcontext.TypeInt16
+	case uint16, int32:
+		return dmcontext.TypeInt32
+	case uint32, int64, uint64:
+		return dmcontext.TypeInt64
+	case float32:
+		return dmcontext.TypeFloat32
+	case float64:
+		return dmcontext.TypeFloat64
+	case string, time.Time, StatusCode:
+		return dmcontext.TypeString
+	}
+	return ""
+}
+
+// ToValue converts the value read into the dmcontext type, the type of value is inferred by DataType if typ is empty
+func ToValue(typ string, v any) (any, error) {
+	if t, ok := v.(time.Time); ok {
+		v = t.Format(time.RFC3339Nano)
+	}
+	if s, ok := v.(StatusCode); ok {
+		v = s.Error()
+	}
+	if typ == "" {
+		typ = DataType(v)
+		if typ == "" {
+			return v, nil
+		}
+	}
+	res, err := dmcontext.ParseValue(typ, v, nil)
+	return res, errors.Trace(err)
+}
+
+// FromValue converts the value into the go type of variant to write by the dmcontext type,
+// the value is written as it is if typ is empty
+func FromValue(typ string, v any) (any, error) {
+	var res any
+	var err error
+	switch typ {
+	case "":
+		return v, nil
+	case dmcontext.TypeBool:
+		res, err = cast.ToBoolE(v)
+	case dmcontext.TypeInt16:
+		res, err = cast.ToInt16E(v)
+	case dmcontext.TypeInt32:
+		res, err = cast.ToInt32E(v)
+	case dmcontext.TypeInt, dmcontext.TypeInt64:
+		res, err = cast.ToInt64E(v)
+	case dmcontext.TypeFloat32:
+		res, err = cast.ToFloat32E(v)
+	case dmcontext.TypeFloat64:
+		res, err = cast.ToFloat64E(v)
+	case dmcontext.TypeString:
+		res, err = cast.ToStringE(v)
+	default:
+		return nil, errors.Trace(dmcontext.ErrTypeNotSupported)
+	}
+	return res, errors.Trace(err)
+}
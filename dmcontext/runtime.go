@@ -0,0 +1,468 @@
+package dmcontext
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/baetyl/baetyl-go/v2/errors"
+	"github.com/baetyl/baetyl-go/v2/log"
+	"github.com/baetyl/baetyl-go/v2/mqtt"
+	v1 "github.com/baetyl/baetyl-go/v2/spec/v1"
+	"github.com/baetyl/baetyl-go/v2/utils"
+)
+
+// the size of pending tasks of a device, such as deltas and property gets
+const deviceTaskSize = 16
+
+var (
+	ErrRuntimeStarted     = errors.New("runtime has been started")
+	ErrInvalidPropertyGet = errors.New("invalid property get")
+)
+
+// Runtime runs a driver for all devices of the driver. Each device is polled in the interval of its access config,
+// the values read are mapped to the properties of device model by the mappings of access template,
+// and reported to DeviceTopic.Report in blink messages. The deltas received from DeviceTopic.Delta are
+// mapped back and written to the device, and the property gets received from DeviceTopic.PropertyGet are
+// answered by reading the device at once.
+type Runtime struct {
+	ctx        Context
+	driverName string
+	driver     Driver
+	msg        Msg
+	devices    map[string]*runtimeDevice
+	// the devices keyed by the topics of delta and property get
+	topics map[string]*runtimeDevice
+	cli    *mqtt.Client
+	filter *ReportFilter
+	tomb   utils.Tomb
+	log    *log.Logger
+}
+
+type runtimeDevice struct {
+	info      *DeviceInfo
+	template  *AccessTemplate
+	model     map[string]DeviceProperty
+	interval  time.Duration
+	tasks     chan func()
+	connected bool
+	state     int
+	log       *log.Logger
+}
+
+// NewRuntime creates a new runtime of the driver, the driver config must be loaded into ctx before started
+func NewRuntime(ctx Context, driverName string, driver Driver) *Runtime {
+	return &Runtime{
+		ctx:        ctx,
+		driverName: driverName,
+		driver:     driver,
+		msg:        InitMsg(Blink),
+		devices:    map[string]*runtimeDevice{},
+		topics:     map[string]*runtimeDevice{},
+		log:        log.L().With(log.Any("driver", driverName)),
+	}
+}
+
+// Start connects to the system broker and starts to poll devices.
+// The device whose access template or device model is not found is skipped.
+func (r *Runtime) Start() error {
+	if r.cli != nil {
+		return errors.Trace(ErrRuntimeStarted)
+	}
+	var subs []mqtt.QOSTopic
+	for _, info := range r.ctx.GetAllDevices(r.driverName) {
+		dev, err := r.newDevice(info)
+		if err != nil {
+			r.log.Error("failed to load device, to skip it", log.Any("device", info.Name), log.Error(err))
+			continue
+		}
+		r.devices[info.Name] = dev
+		for _, t := range []mqtt.QOSTopic{info.DeviceTopic.Delta, info.DeviceTopic.PropertyGet} {
+			if t.Topic == "" {
+				continue
+			}
+			if _, ok := r.topics[t.Topic]; !ok {
+				subs = append(subs, t)
+			}
+			r.topics[t.Topic] = dev
+		}
+	}
+	cli, err := r.ctx.NewSystemBrokerClient(subs)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	if err = cli.Start(mqtt.NewObserverWrapper(r.onPublish, nil, r.onError)); err != nil {
+		cli.Close()
+		return errors.Trace(err)
+	}
+	r.cli = cli
+	for _, dev := range r.devices {
+		dev := dev
+		r.tomb.Go(func() error {
+			return r.serving(dev)
+		})
+	}
+	r.log.Info("driver runtime starts", log.Any("devices", len(r.devices)))
+	return nil
+}
+
+// SetReportFilter sets the filter of the properties read and pushed, so that only the changes are reported,
+// it must be set before started. The properties are not filtered by default.
+func (r *Runtime) SetReportFilter(filter *ReportFilter) {
+	r.filter = filter
+}
+
+// Report reports the properties of device model, such as the values pushed by the device subscribed
+func (r *Runtime) Report(device string, props map[string]any) error {
+	dev, ok := r.devices[device]
+	if !ok {
+		return errors.Trace(ErrDeviceNotExist)
+	}
+	if r.filter != nil {
+		props = r.filter.Filter(device, dev.template.Mappings, props)
+	}
+	return errors.Trace(r.report(dev, props))
+}
+
+// ReportEvent reports the events of device, such as alarms
+func (r *Runtime) ReportEvent(device string, events map[string]any) error {
+	dev, ok := r.devices[device]
+	if !ok {
+		return errors.Trace(ErrDeviceNotExist)
+	}
+	return errors.Trace(r.publish(dev, v1.MessageDeviceEventReport, dev.info.DeviceTopic.EventReport, r.msg.GenEventReportData(events)))
+}
+
+// Close stops polling devices, closes the connections to devices and the system broker
+func (r *Runtime) Close() error {
+	r.tomb.Kill(nil)
+	err := r.tomb.Wait()
+	if r.cli != nil {
+		r.cli.Close()
+	}
+	r.log.Info("driver runtime has stopped")
+	return errors.Trace(err)
+}
+
+func (r *Runtime) newDevice(info DeviceInfo) (*runtimeDevice, error) {
+	tpl, err := r.ctx.GetAccessTemplates(r.driverName, info.AccessTemplate)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	props, err := r.ctx.GetDeviceModel(r.driverName, &info)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	model := map[string]DeviceProperty{}
+	for _, p := range props {
+		model[p.Name] = p
+	}
+	return &runtimeDevice{
+		info:     &info,
+		template: tpl,
+		model:    model,
+		interval: info.AccessConfig.Interval(),
+		tasks:    make(chan func(), deviceTaskSize),
+		state:    DeviceUnknown,
+		log:      r.log.With(log.Any("device", info.Name)),
+	}, nil
+}
+
+func (r *Runtime) serving(dev *runtimeDevice) error {
+	defer func() {
+		if dev.connected {
+			if err := r.driver.Close(dev.info); err != nil {
+				dev.log.Warn("failed to close device", log.Error(err))
+			}
+		}
+	}()
+
+	r.poll(dev, nil, true)
+	ticker := time.NewTicker(dev.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			r.poll(dev, nil, true)
+		case task := <-dev.tasks:
+			task()
+		case <-r.tomb.Dying():
+			return nil
+		}
+	}
+}
+
+// poll reads the device and reports the properties, all properties are reported if names is empty.
+// The properties polled periodically are filtered, but not the ones requested.
+func (r *Runtime) poll(dev *runtimeDevice, names []string, periodic bool) {
+	if err := r.connect(dev); err != nil {
+		dev.log.Warn("failed to connect device", log.Error(err))
+		return
+	}
+	values, err := r.driver.Read(dev.info, dev.template.Properties)
+	if err != nil {
+		dev.log.Warn("failed to read device", log.Error(err))
+		r.disconnect(dev)
+		return
+	}
+	props := r.mapProperties(dev, values)
+	if periodic && r.filter != nil {
+		props = r.filter.Filter(dev.info.Name, dev.template.Mappings, props)
+	}
+	if len(names) > 0 {
+		filtered := map[string]any{}
+		for _, name := range names {
+			if v, ok := props[name]; ok {
+				filtered[name] = v
+			}
+		}
+		props = filtered
+	}
+	if err = r.report(dev, props); err != nil {
+		dev.log.Warn("failed to report properties", log.Error(err))
+	}
+}
+
+func (r *Runtime) report(dev *runtimeDevice, props map[string]any) error {
+	if len(props) == 0 {
+		return nil
+	}
+	return errors.Trace(r.publish(dev, v1.MessageDeviceReport, dev.info.DeviceTopic.Report, r.msg.GenPropertyReportData(props)))
+}
+
+// mapProperties maps the values keyed by property id of access template to the properties of device model,
+// the value of property id 1 is referred to as x1 in mapping expressions
+func (r *Runtime) mapProperties(dev *runtimeDevice, values map[string]any) map[string]any {
+	args := map[string]any{}
+	for id, v := range values {
+		args["x"+id] = v
+	}
+	props := map[string]any{}
+	for _, m := range dev.template.Mappings {
+		if m.Type == "" || m.Type == MappingNone {
+			continue
+		}
+		v, err := ExecExpressionWithPrecision(m.Expression, args, m.Type, m.Precision)
+		if err != nil {
+			dev.log.Debug("failed to map property", log.Any("property", m.Attribute), log.Error(err))
+			continue
+		}
+		if p, ok := dev.model[m.Attribute]; ok && p.Type != "" {
+			if v, err = ParseValue(p.Type, v, propertyArgs(p)); err != nil {
+				dev.log.Debug("failed to parse property", log.Any("property", m.Attribute), log.Error(err))
+				continue
+			}
+		}
+		props[m.Attribute] = v
+	}
+	return props
+}
+
+// write maps the properties of device model back to the values keyed by property id, and writes them to the device
+func (r *Runtime) write(dev *runtimeDevice, delta map[string]any) error {
+	props, err := r.ctx.ParsePropertyValues(r.driverName, dev.info, delta)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	values := map[string]any{}
+	names := make([]string, 0, len(props))
+	for name, val := range props {
+		if dev.model[name].Mode == ModeReadOnlyProperty {
+			return errors.Errorf("property (%s) is read only", name)
+		}
+		id, err := GetConfigIDByModelName(name, dev.template)
+		if err != nil {
+			return errors.Trace(err)
+		}
+		v, err := GetPropValueByModelName(name, val, dev.template)
+		if err != nil {
+			return errors.Trace(err)
+		}
+		for _, p := range dev.template.Properties {
+			if p.ID == id && p.Type != "" {
+				if v, err = ParseValue(p.Type, v, propertyArgs(p)); err != nil {
+					return errors.Trace(err)
+				}
+				break
+			}
+		}
+		values[id] = v
+		names = append(names, name)
+	}
+	if err = r.connect(dev); err != nil {
+		return errors.Trace(err)
+	}
+	if err = r.driver.Write(dev.info, values); err != nil {
+		r.disconnect(dev)
+		return errors.Trace(err)
+	}
+	// report the values written
+	r.poll(dev, names, false)
+	return nil
+}
+
+func (r *Runtime) connect(dev *runtimeDevice) error {
+	if dev.connected {
+		return nil
+	}
+	if err := r.driver.Connect(dev.info); err != nil {
+		r.setState(dev, DeviceOffline)
+		return errors.Trace(err)
+	}
+	dev.connected = true
+	// all properties are reported once the device is online again
+	if r.filter != nil {
+		r.filter.Reset(dev.info.Name)
+	}
+	r.setState(dev, DeviceOnline)
+	return nil
+}
+
+func (r *Runtime) disconnect(dev *runtimeDevice) {
+	if dev.connected {
+		if err := r.driver.Close(dev.info); err != nil {
+			dev.log.Warn("failed to close device", log.Error(err))
+		}
+		dev.connected = false
+	}
+	r.setState(dev, DeviceOffline)
+}
+
+// setState reports the lifecycle of device once the state is changed
+func (r *Runtime) setState(dev *runtimeDevice, state int) {
+	if dev.state == state {
+		return
+	}
+	dev.state = state
+	dev.log.Info("device state is changed", log.Any("online", state == DeviceOnline))
+	err := r.publish(dev, v1.MessageDeviceLifecycleReport, dev.info.DeviceTopic.LifecycleReport, r.msg.GenLifecycleReportData(state == DeviceOnline))
+	if err != nil {
+		dev.log.Warn("failed to report lifecycle", log.Error(err))
+	}
+}
+
+func (r *Runtime) publish(dev *runtimeDevice, kind v1.MessageKind, topic mqtt.QOSTopic, content v1.LazyValue) error {
+	if topic.Topic == "" {
+		return nil
+	}
+	msg := &v1.Message{
+		Kind: kind,
+		Metadata: map[string]string{
+			KeyDriverName:     r.driverName,
+			KeyDevice:         dev.info.Name,
+			KeyDeviceProduct:  dev.info.DeviceModel,
+			KeyAccessTemplate: dev.info.AccessTemplate,
+			KeyNode:           r.ctx.NodeName(),
+			KeyNodeProduct:    NodeProduct,
+		},
+		Content: content,
+	}
+	pld, err := json.Marshal(msg)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	return errors.Trace(r.cli.Publish(mqtt.QOS(topic.QOS), topic.Topic, pld, 0, false, false))
+}
+
+func (r *Runtime) onPublish(pkt *mqtt.Publish) error {
+	dev, ok := r.topics[pkt.Message.Topic]
+	if !ok {
+		return nil
+	}
+	var msg v1.Message
+	if err := json.Unmarshal(pkt.Message.Payload, &msg); err != nil {
+		dev.log.Warn("failed to unmarshal message", log.Any("topic", pkt.Message.Topic), log.Error(err))
+		return nil
+	}
+
+	var task func()
+	if msg.Kind == v1.MessageDeviceDelta || (msg.Kind != v1.MessageDevicePropertyGet && pkt.Message.Topic == dev.info.DeviceTopic.Delta.Topic) {
+		delta, err := parseDelta(&msg)
+		if err != nil {
+			dev.log.Warn("failed to parse delta", log.Error(err))
+			return nil
+		}
+		task = func() {
+			if err := r.write(dev, delta); err != nil {
+				dev.log.Warn("failed to write device", log.Error(err))
+			}
+		}
+	} else {
+		names, err := parsePropertyGet(&msg)
+		if err != nil {
+			dev.log.Warn("failed to parse property get", log.Error(err))
+			return nil
+		}
+		task = func() {
+			r.poll(dev, names, false)
+		}
+	}
+	select {
+	case dev.tasks <- task:
+	default:
+		dev.log.Warn("device is busy, to drop the message", log.Any("topic", pkt.Message.Topic))
+	}
+	return nil
+}
+
+func (r *Runtime) onError(err error) {
+	r.log.Error("error occurs in system broker client", log.Error(err))
+}
+
+// blinkContent returns the properties of the message content in blink, or the content itself if not in blink
+func blinkContent(msg *v1.Message) (any, error) {
+	var content ContentBlink
+	if err := msg.Content.ExactUnmarshal(&content); err == nil && content.Blink.Method != "" {
+		return content.Blink.Properties, nil
+	}
+	var v any
+	if err := msg.Content.ExactUnmarshal(&v); err != nil {
+		return nil, errors.Trace(err)
+	}
+	return v, nil
+}
+
+func parseDelta(msg *v1.Message) (map[string]any, error) {
+	v, err := blinkContent(msg)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	delta, ok := v.(map[string]any)
+	if !ok {
+		return nil, errors.Trace(ErrInvalidDelta)
+	}
+	return delta, nil
+}
+
+// parsePropertyGet returns the names of properties to get, which is empty to get all properties
+func parsePropertyGet(msg *v1.Message) ([]string, error) {
+	v, err := blinkContent(msg)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	if m, ok := v.(map[string]any); ok {
+		v = m["properties"]
+	}
+	if v == nil {
+		return nil, nil
+	}
+	names, err := ParsePropertyKeys(v)
+	if err != nil {
+		return nil, errors.Trace(ErrInvalidPropertyGet)
+	}
+	return names, nil
+}
+
+// propertyArgs returns the args of the property to parse value, such as the format of date or time
+func propertyArgs(p DeviceProperty) any {
+	switch p.Type {
+	case TypeDate, TypeTime:
+		return p.Format
+	case TypeEnum:
+		return p.EnumType
+	case TypeArray:
+		return p.ArrayType
+	case TypeObject:
+		return p.ObjectType
+	}
+	return nil
+}
@@ -0,0 +1,299 @@
+package dmcontext_test
+
+import (
+	"encoding/json"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/baetyl/baetyl-go/v2/context/contexttest"
+	"github.com/baetyl/baetyl-go/v2/dmcontext"
+	"github.com/baetyl/baetyl-go/v2/dmcontext/dmcontexttest"
+	"github.com/baetyl/baetyl-go/v2/errors"
+	"github.com/baetyl/baetyl-go/v2/mqtt"
+	v1 "github.com/baetyl/baetyl-go/v2/spec/v1"
+)
+
+type fakeDriver struct {
+	values     map[string]any
+	connectErr error
+	connects   int
+	closes     int
+	mut        sync.Mutex
+}
+
+func (d *fakeDriver) Connect(_ *dmcontext.DeviceInfo) error {
+	d.mut.Lock()
+	defer d.mut.Unlock()
+	d.connects++
+	return d.connectErr
+}
+
+func (d *fakeDriver) Read(_ *dmcontext.DeviceInfo, props []dmcontext.DeviceProperty) (map[string]any, error) {
+	d.mut.Lock()
+	defer d.mut.Unlock()
+	res := map[string]any{}
+	for _, p := range props {
+		res[p.ID] = d.values[p.ID]
+	}
+	return res, nil
+}
+
+func (d *fakeDriver) Write(_ *dmcontext.DeviceInfo, values map[string]any) error {
+	d.mut.Lock()
+	defer d.mut.Unlock()
+	for k, v := range values {
+		d.values[k] = v
+	}
+	return nil
+}
+
+func (d *fakeDriver) Close(_ *dmcontext.DeviceInfo) error {
+	d.mut.Lock()
+	defer d.mut.Unlock()
+	d.closes++
+	return nil
+}
+
+func (d *fakeDriver) value(id string) any {
+	d.mut.Lock()
+	defer d.mut.Unlock()
+	return d.values[id]
+}
+
+func newRuntimeContext(t *testing.T) *dmcontexttest.Context {
+	c := dmcontexttest.NewContext(t)
+	assert.NoError(t, c.SetDriverConfig("fake", newRuntimeDriverConfig()))
+	return c
+}
+
+func newRuntimeDriverConfig() dmcontexttest.DriverConfig {
+	return dmcontexttest.DriverConfig{
+		Devices: []dmcontext.DeviceInfo{{
+			Name:           "dev1",
+			DeviceModel:    "model1",
+			AccessTemplate: "tpl1",
+			DeviceTopic: dmcontext.DeviceTopic{
+				Delta:           mqtt.QOSTopic{QOS: 1, Topic: "thing/dev1/delta"},
+				Report:          mqtt.QOSTopic{QOS: 1, Topic: "thing/dev1/report"},
+				PropertyGet:     mqtt.QOSTopic{QOS: 1, Topic: "thing/dev1/get"},
+				LifecycleReport: mqtt.QOSTopic{QOS: 1, Topic: "thing/dev1/lifecycle"},
+			},
+			AccessConfig: &dmcontext.AccessConfig{Modbus: &dmcontext.ModbusAccessConfig{Interval: time.Hour}},
+		}, {
+			Name:           "dev2",
+			DeviceModel:    "model1",
+			AccessTemplate: "unknown",
+		}},
+		DeviceModels: map[string][]dmcontext.DeviceProperty{
+			"model1": {
+				{Name: "temperature", Type: dmcontext.TypeFloat64, Mode: dmcontext.ModeReadWriteProperty},
+				{Name: "switch", Type: dmcontext.TypeBool, Mode: dmcontext.ModeReadWriteProperty},
+				{Name: "status", Type: dmcontext.TypeInt32, Mode: dmcontext.ModeReadOnlyProperty},
+			},
+		},
+		AccessTemplates: map[string]dmcontext.AccessTemplate{
+			"tpl1": {
+				Properties: []dmcontext.DeviceProperty{
+					{ID: "1", Name: "temp-raw", Type: dmcontext.TypeInt16},
+					{ID: "2", Name: "sw", Type: dmcontext.TypeBool},
+					{ID: "3", Name: "st", Type: dmcontext.TypeInt32},
+				},
+				Mappings: []dmcontext.ModelMapping{
+					{Attribute: "temperature", Type: dmcontext.MappingCalculate, Expression: "x1/10", Precision: 1},
+					{Attribute: "switch", Type: dmcontext.MappingValue, Expression: "x2"},
+					{Attribute: "status", Type: dmcontext.MappingValue, Expression: "x3"},
+				},
+			},
+		},
+	}
+}
+
+func blinkOf(t *testing.T, msg *contexttest.Message) (*v1.Message, dmcontext.DataBlink) {
+	var m v1.Message
+	assert.NoError(t, json.Unmarshal(msg.Payload, &m))
+	var content dmcontext.ContentBlink
+	assert.NoError(t, m.Content.Unmarshal(&content))
+	return &m, content.Blink
+}
+
+func TestRuntime(t *testing.T) {
+	c := newRuntimeContext(t)
+	c.Base.SetNodeName("node1")
+	driver := &fakeDriver{values: map[string]any{"1": int16(255), "2": false, "3": int32(1)}}
+	rt := dmcontext.NewRuntime(c, "fake", driver)
+	assert.NoError(t, rt.Start())
+	defer rt.Close()
+	assert.Equal(t, dmcontext.ErrRuntimeStarted, errors.Cause(rt.Start()))
+
+	// online and the first poll
+	msg, err := c.Base.WaitPublished("thing/dev1/lifecycle", 1, time.Second)
+	assert.NoError(t, err)
+	m, blink := blinkOf(t, msg)
+	assert.Equal(t, v1.MessageDeviceLifecycleReport, m.Kind)
+	assert.Equal(t, true, blink.Params[dmcontext.KeyOnlineState])
+
+	msg, err = c.Base.WaitPublished("thing/dev1/report", 1, time.Second)
+	assert.NoError(t, err)
+	m, blink = blinkOf(t, msg)
+	assert.Equal(t, v1.MessageDeviceReport, m.Kind)
+	assert.Equal(t, map[string]string{
+		dmcontext.KeyDriverName:     "fake",
+		dmcontext.KeyDevice:         "dev1",
+		dmcontext.KeyDeviceProduct:  "model1",
+		dmcontext.KeyAccessTemplate: "tpl1",
+		dmcontext.KeyNode:           "node1",
+		dmcontext.KeyNodeProduct:    dmcontext.NodeProduct,
+	}, m.Metadata)
+	assert.Equal(t, dmcontext.MethodPropertyReport, blink.Method)
+	assert.Equal(t, map[string]any{"temperature": 25.5, "switch": false, "status": float64(1)}, blink.Properties)
+
+	// delta is mapped back and written
+	delta := v1.Message{
+		Kind:    v1.MessageDeviceDelta,
+		Content: (&dmcontext.MsgBlink{}).GenDeltaBlinkData(map[string]any{"temperature": 30, "switch": true}),
+	}
+	pld, err := json.Marshal(delta)
+	assert.NoError(t, err)
+	assert.Eventually(t, func() bool {
+		assert.NoError(t, c.Base.Broker.Publish("thing/dev1/delta", 1, pld))
+		time.Sleep(50 * time.Millisecond)
+		return driver.value("1") == int16(300) && driver.value("2") == true
+	}, 3*time.Second, 100*time.Millisecond)
+	msg, err = c.Base.WaitPublished("thing/dev1/report", 2, time.Second)
+	assert.NoError(t, err)
+	_, blink = blinkOf(t, msg)
+	assert.Equal(t, map[string]any{"temperature": float64(30), "switch": true}, blink.Properties)
+
+	// read-only property is not written
+	delta.Content = (&dmcontext.MsgBlink{}).GenDeltaBlinkData(map[string]any{"status": 2})
+	pld, err = json.Marshal(delta)
+	assert.NoError(t, err)
+	c.Base.Broker.Reset()
+	assert.NoError(t, c.Base.Broker.Publish("thing/dev1/delta", 1, pld))
+	c.Base.AssertNotPublished(t, "thing/dev1/report", 200*time.Millisecond)
+	assert.Equal(t, int32(1), driver.value("3"))
+
+	// property get is answered with the properties requested
+	get := v1.Message{
+		Kind:    v1.MessageDevicePropertyGet,
+		Content: (&dmcontext.MsgBlink{}).GenPropertyGetBlinkData([]string{"switch"}),
+	}
+	pld, err = json.Marshal(get)
+	assert.NoError(t, err)
+	assert.NoError(t, c.Base.Broker.Publish("thing/dev1/get", 1, pld))
+	msg, err = c.Base.WaitPublished("thing/dev1/report", 1, time.Second)
+	assert.NoError(t, err)
+	_, blink = blinkOf(t, msg)
+	assert.Equal(t, map[string]any{"switch": true}, blink.Properties)
+
+	// report and event by driver
+	assert.NoError(t, rt.Report("dev1", map[string]any{"switch": false}))
+	_, err = c.Base.WaitPublished("thing/dev1/report", 2, time.Second)
+	assert.NoError(t, err)
+	assert.Equal(t, dmcontext.ErrDeviceNotExist, errors.Cause(rt.Report("dev2", nil)))
+	assert.Equal(t, dmcontext.ErrDeviceNotExist, errors.Cause(rt.ReportEvent("dev2", nil)))
+
+	assert.NoError(t, rt.Close())
+	driver.mut.Lock()
+	assert.Equal(t, 1, driver.connects)
+	assert.Equal(t, 1, driver.closes)
+	driver.mut.Unlock()
+}
+
+func TestRuntimeReportFilter(t *testing.T) {
+	c := newRuntimeContext(t)
+	driver := &fakeDriver{values: map[string]any{"1": int16(255), "2": false, "3": int32(1)}}
+	rt := dmcontext.NewRuntime(c, "fake", driver)
+	rt.SetReportFilter(dmcontext.NewReportFilter(time.Hour))
+	assert.NoError(t, rt.Start())
+	defer rt.Close()
+
+	msg, err := c.Base.WaitPublished("thing/dev1/report", 1, time.Second)
+	assert.NoError(t, err)
+	_, blink := blinkOf(t, msg)
+	assert.Equal(t, map[string]any{"temperature": 25.5, "switch": false, "status": float64(1)}, blink.Properties)
+
+	// the values not changed are not reported
+	c.Base.Broker.Reset()
+	assert.NoError(t, rt.Report("dev1", map[string]any{"switch": false, "status": int32(1)}))
+	c.Base.AssertNotPublished(t, "thing/dev1/report", 100*time.Millisecond)
+	assert.NoError(t, rt.Report("dev1", map[string]any{"switch": true, "status": int32(1)}))
+	msg, err = c.Base.WaitPublished("thing/dev1/report", 1, time.Second)
+	assert.NoError(t, err)
+	_, blink = blinkOf(t, msg)
+	assert.Equal(t, map[string]any{"switch": true}, blink.Properties)
+
+	// property get is answered even if not changed
+	get := v1.Message{
+		Kind:    v1.MessageDevicePropertyGet,
+		Content: (&dmcontext.MsgBlink{}).GenPropertyGetBlinkData([]string{"status"}),
+	}
+	pld, err := json.Marshal(get)
+	assert.NoError(t, err)
+	c.Base.Broker.Reset()
+	assert.NoError(t, c.Base.Broker.Publish("thing/dev1/get", 1, pld))
+	msg, err = c.Base.WaitPublished("thing/dev1/report", 1, time.Second)
+	assert.NoError(t, err)
+	_, blink = blinkOf(t, msg)
+	assert.Equal(t, map[string]any{"status": float64(1)}, blink.Properties)
+}
+
+func TestRuntimeReportFilterGetAll(t *testing.T) {
+	c := dmcontexttest.NewContext(t)
+	cfg := newRuntimeDriverConfig()
+	tpl := cfg.AccessTemplates["tpl1"]
+	for i := range tpl.Mappings {
+		tpl.Mappings[i].SilentWin = 3600
+	}
+	assert.NoError(t, c.SetDriverConfig("fake", cfg))
+	driver := &fakeDriver{values: map[string]any{"1": int16(255), "2": false, "3": int32(1)}}
+	rt := dmcontext.NewRuntime(c, "fake", driver)
+	rt.SetReportFilter(dmcontext.NewReportFilter(0))
+	assert.NoError(t, rt.Start())
+	defer rt.Close()
+
+	_, err := c.Base.WaitPublished("thing/dev1/report", 1, time.Second)
+	assert.NoError(t, err)
+
+	// all properties are reported in the silent window if requested without names
+	get := v1.Message{
+		Kind:    v1.MessageDevicePropertyGet,
+		Content: (&dmcontext.MsgBlink{}).GenPropertyGetBlinkData(nil),
+	}
+	pld, err := json.Marshal(get)
+	assert.NoError(t, err)
+	c.Base.Broker.Reset()
+	assert.NoError(t, c.Base.Broker.Publish("thing/dev1/get", 1, pld))
+	msg, err := c.Base.WaitPublished("thing/dev1/report", 1, time.Second)
+	assert.NoError(t, err)
+	_, blink := blinkOf(t, msg)
+	assert.Equal(t, map[string]any{"temperature": 25.5, "switch": false, "status": float64(1)}, blink.Properties)
+}
+
+func TestRuntimeOffline(t *testing.T) {
+	c := newRuntimeContext(t)
+	driver := &fakeDriver{values: map[string]any{}, connectErr: errors.New("timeout")}
+	rt := dmcontext.NewRuntime(c, "fake", driver)
+	assert.NoError(t, rt.Start())
+	defer rt.Close()
+
+	msg, err := c.Base.WaitPublished("thing/dev1/lifecycle", 1, time.Second)
+	assert.NoError(t, err)
+	_, blink := blinkOf(t, msg)
+	assert.Equal(t, false, blink.Params[dmcontext.KeyOnlineState])
+	c.Base.AssertNotPublished(t, "thing/dev1/report", 100*time.Millisecond)
+}
+
+func TestAccessConfigInterval(t *testing.T) {
+	var cfg *dmcontext.AccessConfig
+	assert.Equal(t, dmcontext.DefaultPollInterval, cfg.Interval())
+	cfg = &dmcontext.AccessConfig{Opcda: &dmcontext.OpcdaAccessConfig{Interval: 3}}
+	assert.Equal(t, 3*time.Second, cfg.Interval())
+	cfg = &dmcontext.AccessConfig{Opcua: &dmcontext.OpcuaAccessConfig{Interval: time.Minute}}
+	assert.Equal(t, time.Minute, cfg.Interval())
+	cfg = &dmcontext.AccessConfig{Bacnet: &dmcontext.BacnetAccessConfig{}}
+	assert.Equal(t, dmcontext.DefaultPollInterval, cfg.Interval())
+}
@@ -0,0 +1,168 @@
+package dmcontext
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/baetyl/baetyl-go/v2/errors"
+)
+
+const (
+	CallTypeSync  = "sync"
+	CallTypeAsync = "async"
+
+	EventTypeInfo  = "info"
+	EventTypeAlert = "alert"
+	EventTypeError = "error"
+)
+
+var (
+	ErrServiceNotExist = errors.New("service not exist")
+	ErrEventNotExist   = errors.New("event not exist")
+)
+
+// ModelParam the typed param of the input and output of service, and the output of event
+type ModelParam struct {
+	ID             string                `yaml:"id,omitempty" json:"id,omitempty" binding:"nonzero"`
+	Name           string                `yaml:"name,omitempty" json:"name,omitempty"`
+	Type           string                `yaml:"type,omitempty" json:"type,omitempty" binding:"data_plus_type"`
+	Unit           string                `yaml:"unit,omitempty" json:"unit,omitempty"`
+	Required       bool                  `yaml:"required,omitempty" json:"required,omitempty"`
+	Format         string                `yaml:"format,omitempty" json:"format,omitempty"`                        // 当 Type 为 date/time 时使用
+	EnumType       EnumType              `yaml:"enumType,omitempty" json:"enumType,omitempty" binding:"dive"`     // 当 Type 为 enum 时使用
+	ArrayType      ArrayType             `yaml:"arrayType,omitempty" json:"arrayType,omitempty" binding:"dive"`   // 当 Type 为 array 时使用
+	ObjectType     map[string]ObjectType `yaml:"objectType,omitempty" json:"objectType,omitempty" binding:"dive"` // 当 Type 为 object 时使用
+	ObjectRequired []string              `yaml:"objectRequired,omitempty" json:"objectRequired,omitempty"`        // 当 Type 为 object 时, 记录必填字段
+}
+
+// DeviceService the service of device model, which is invoked by the method thing.service.{id}
+// with the input params and replied with the output params
+type DeviceService struct {
+	ID       string       `yaml:"id,omitempty" json:"id,omitempty" binding:"nonzero"`
+	Name     string       `yaml:"name,omitempty" json:"name,omitempty"`
+	CallType string       `yaml:"callType,omitempty" json:"callType,omitempty" binding:"omitempty,oneof=sync async"`
+	Input    []ModelParam `yaml:"input,omitempty" json:"input,omitempty" binding:"dive"`
+	Output   []ModelParam `yaml:"output,omitempty" json:"output,omitempty" binding:"dive"`
+}
+
+// DeviceEvent the event of device model, whose payload is the output params
+type DeviceEvent struct {
+	ID     string       `yaml:"id,omitempty" json:"id,omitempty" binding:"nonzero"`
+	Name   string       `yaml:"name,omitempty" json:"name,omitempty"`
+	Type   string       `yaml:"type,omitempty" json:"type,omitempty" binding:"omitempty,oneof=info alert error"`
+	Output []ModelParam `yaml:"output,omitempty" json:"output,omitempty" binding:"dive"`
+}
+
+// ValueError the value at the path is invalid, such as reboot.input.delay
+type ValueError struct {
+	Path   string
+	Reason string
+}
+
+func (e *ValueError) Error() string {
+	return fmt.Sprintf("invalid value of %s: %s", e.Path, e.Reason)
+}
+
+// ParseInput validates the input params of an invoke, and converts the values into their types
+func (s *DeviceService) ParseInput(params map[string]any) (map[string]any, error) {
+	return ParseParams(s.ID+".input", s.Input, params)
+}
+
+// ParseOutput validates the output params of a reply, and converts the values into their types
+func (s *DeviceService) ParseOutput(params map[string]any) (map[string]any, error) {
+	return ParseParams(s.ID+".output", s.Output, params)
+}
+
+// ParseOutput validates the payload of the event, and converts the values into their types
+func (e *DeviceEvent) ParseOutput(params map[string]any) (map[string]any, error) {
+	return ParseParams(e.ID, e.Output, params)
+}
+
+// ParseParams validates the params against the definitions and converts the values into their types,
+// the required params must be present and the params not defined are rejected, see ValidateValue
+func ParseParams(path string, defs []ModelParam, params map[string]any) (map[string]any, error) {
+	res := make(map[string]any, len(params))
+	known := make(map[string]bool, len(defs))
+	for _, def := range defs {
+		known[def.ID] = true
+		v, ok := params[def.ID]
+		if !ok || v == nil {
+			if def.Required {
+				return nil, errors.Trace(&ValueError{Path: path + "." + def.ID, Reason: "is required"})
+			}
+			continue
+		}
+		pv, err := ValidateValue(path+"."+def.ID, def.Spec(), v)
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+		res[def.ID] = pv
+	}
+	for id := range params {
+		if !known[id] {
+			return nil, errors.Trace(&ValueError{Path: path + "." + id, Reason: "is not defined"})
+		}
+	}
+	return res, nil
+}
+
+// ServiceMethod returns the blink method to invoke the service
+func ServiceMethod(service string) string {
+	return MethodServiceInvokePrefix + service
+}
+
+// ServiceReplyMethod returns the blink method to reply the invoke of service
+func ServiceReplyMethod(service string) string {
+	return MethodServiceInvokePrefix + service + MethodServiceReplySuffix
+}
+
+// ParseServiceMethod returns the service invoked by the blink method, false is returned if it is not an invoke
+func ParseServiceMethod(method string) (string, bool) {
+	service := strings.TrimPrefix(method, MethodServiceInvokePrefix)
+	if service == method || service == "" || strings.HasSuffix(service, MethodServiceReplySuffix) {
+		return "", false
+	}
+	return service, true
+}
+
+func (c *DmCtx) GetDeviceServices(driverName string, device *DeviceInfo) ([]DeviceService, error) {
+	if _, ok := c.deviceModels[driverName][device.DeviceModel]; !ok {
+		return nil, ErrDeviceModelNotExist
+	}
+	return c.deviceServices[driverName][device.DeviceModel], nil
+}
+
+func (c *DmCtx) GetDeviceEvents(driverName string, device *DeviceInfo) ([]DeviceEvent, error) {
+	if _, ok := c.deviceModels[driverName][device.DeviceModel]; !ok {
+		return nil, ErrDeviceModelNotExist
+	}
+	return c.deviceEvents[driverName][device.DeviceModel], nil
+}
+
+// ParseServiceInput validates the input params of the service invoked, see DeviceService.ParseInput
+func (c *DmCtx) ParseServiceInput(driverName string, device *DeviceInfo, service string, params map[string]any) (map[string]any, error) {
+	services, err := c.GetDeviceServices(driverName, device)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	for _, s := range services {
+		if s.ID == service {
+			return s.ParseInput(params)
+		}
+	}
+	return nil, errors.Trace(ErrServiceNotExist)
+}
+
+// ParseEventOutput validates the payload of the event reported, see DeviceEvent.ParseOutput
+func (c *DmCtx) ParseEventOutput(driverName string, device *DeviceInfo, event string, params map[string]any) (map[string]any, error) {
+	events, err := c.GetDeviceEvents(driverName, device)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	for _, e := range events {
+		if e.ID == event {
+			return e.ParseOutput(params)
+		}
+	}
+	return nil, errors.Trace(ErrEventNotExist)
+}
@@ -0,0 +1,142 @@
+package dmcontext_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/baetyl/baetyl-go/v2/dmcontext"
+	"github.com/baetyl/baetyl-go/v2/dmcontext/dmcontexttest"
+	"github.com/baetyl/baetyl-go/v2/errors"
+)
+
+func TestDeviceService(t *testing.T) {
+	ctx := dmcontexttest.NewContext(t)
+	err := ctx.SetDriverConfig("custom", dmcontexttest.DriverConfig{
+		Devices: []dmcontext.DeviceInfo{
+			{Name: "dev1", DeviceModel: "m1"},
+			{Name: "dev2", DeviceModel: "m2"},
+			{Name: "dev3", DeviceModel: "m3"},
+		},
+		DeviceModels: map[string][]dmcontext.DeviceProperty{
+			"m1": {{ID: "temp", Name: "temp", Type: dmcontext.TypeFloat32}},
+			"m2": {{ID: "temp", Name: "temp", Type: dmcontext.TypeFloat32}},
+		},
+		DeviceServices: map[string][]dmcontext.DeviceService{
+			"m1": {{
+				ID:       "reboot",
+				CallType: dmcontext.CallTypeSync,
+				Input: []dmcontext.ModelParam{
+					{ID: "delay", Type: dmcontext.TypeInt32, Required: true},
+					{ID: "force", Type: dmcontext.TypeBool},
+				},
+				Output: []dmcontext.ModelParam{{ID: "result", Type: dmcontext.TypeString}},
+			}},
+		},
+		DeviceEvents: map[string][]dmcontext.DeviceEvent{
+			"m1": {{
+				ID:     "overheat",
+				Type:   dmcontext.EventTypeAlert,
+				Output: []dmcontext.ModelParam{{ID: "temp", Type: dmcontext.TypeFloat64, Required: true}},
+			}},
+		},
+	})
+	assert.NoError(t, err)
+	sm, ok := ctx.Context.(dmcontext.ServiceModel)
+	assert.True(t, ok)
+
+	dev1, err := ctx.GetDevice("custom", "dev1")
+	assert.NoError(t, err)
+	services, err := sm.GetDeviceServices("custom", dev1)
+	assert.NoError(t, err)
+	assert.Len(t, services, 1)
+	assert.Equal(t, dmcontext.CallTypeSync, services[0].CallType)
+	events, err := sm.GetDeviceEvents("custom", dev1)
+	assert.NoError(t, err)
+	assert.Len(t, events, 1)
+
+	// model without services and events
+	dev2, err := ctx.GetDevice("custom", "dev2")
+	assert.NoError(t, err)
+	services, err = sm.GetDeviceServices("custom", dev2)
+	assert.NoError(t, err)
+	assert.Empty(t, services)
+	_, err = sm.ParseServiceInput("custom", dev2, "reboot", nil)
+	assert.Equal(t, dmcontext.ErrServiceNotExist, errors.Cause(err))
+
+	// model not exist
+	dev3, err := ctx.GetDevice("custom", "dev3")
+	assert.NoError(t, err)
+	_, err = sm.GetDeviceEvents("custom", dev3)
+	assert.Equal(t, dmcontext.ErrDeviceModelNotExist, err)
+
+	input, err := sm.ParseServiceInput("custom", dev1, "reboot", map[string]any{"delay": json.Number("5"), "force": "true"})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]any{"delay": int32(5), "force": true}, input)
+
+	_, err = sm.ParseServiceInput("custom", dev1, "reboot", map[string]any{"force": true})
+	assert.EqualError(t, errors.Cause(err), "invalid value of reboot.input.delay: is required")
+	_, err = sm.ParseServiceInput("custom", dev1, "reboot", map[string]any{"delay": "x"})
+	assert.EqualError(t, errors.Cause(err), "invalid value of reboot.input.delay: is not an integer")
+	_, err = sm.ParseServiceInput("custom", dev1, "reboot", map[string]any{"delay": 1, "mode": "x"})
+	assert.EqualError(t, errors.Cause(err), "invalid value of reboot.input.mode: is not defined")
+
+	services, err = sm.GetDeviceServices("custom", dev1)
+	assert.NoError(t, err)
+	output, err := services[0].ParseOutput(map[string]any{"result": "ok"})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]any{"result": "ok"}, output)
+
+	payload, err := sm.ParseEventOutput("custom", dev1, "overheat", map[string]any{"temp": json.Number("80.5")})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]any{"temp": 80.5}, payload)
+	_, err = sm.ParseEventOutput("custom", dev1, "overheat", map[string]any{})
+	assert.EqualError(t, errors.Cause(err), "invalid value of overheat.temp: is required")
+	_, err = sm.ParseEventOutput("custom", dev1, "unknown", nil)
+	assert.Equal(t, dmcontext.ErrEventNotExist, errors.Cause(err))
+}
+
+func TestServiceMethod(t *testing.T) {
+	assert.Equal(t, "thing.service.reboot", dmcontext.ServiceMethod("reboot"))
+	assert.Equal(t, "thing.service.reboot.reply", dmcontext.ServiceReplyMethod("reboot"))
+
+	service, ok := dmcontext.ParseServiceMethod("thing.service.reboot")
+	assert.True(t, ok)
+	assert.Equal(t, "reboot", service)
+	for _, method := range []string{"thing.service.reboot.reply", "thing.service.", dmcontext.MethodPropertyReport} {
+		_, ok = dmcontext.ParseServiceMethod(method)
+		assert.False(t, ok, method)
+	}
+}
+
+func TestGenServiceData(t *testing.T) {
+	var b dmcontext.MsgBlink
+	invoke := b.GenServiceInvokeData("reboot", map[string]any{"delay": 5}).Value.(dmcontext.ContentBlink).Blink
+	assert.NotEmpty(t, invoke.ReqID)
+	assert.Equal(t, "thing.service.reboot", invoke.Method)
+	assert.Equal(t, map[string]any{"delay": 5}, invoke.Params)
+
+	reply := b.GenServiceReplyData(invoke.ReqID, "reboot", map[string]any{"result": "ok"}, nil).Value.(dmcontext.ContentBlink).Blink
+	assert.Equal(t, invoke.ReqID, reply.ReqID)
+	assert.Equal(t, "thing.service.reboot.reply", reply.Method)
+	assert.Equal(t, http.StatusOK, reply.Code)
+	assert.Equal(t, map[string]any{"result": "ok"}, reply.Params)
+	assert.Empty(t, reply.Message)
+
+	tests := []struct {
+		err  error
+		code int
+	}{
+		{errors.Trace(dmcontext.ErrServiceNotExist), http.StatusNotFound},
+		{errors.Trace(&dmcontext.ValueError{Path: "reboot.input.delay", Reason: "is required"}), http.StatusBadRequest},
+		{errors.New("device offline"), http.StatusInternalServerError},
+	}
+	for _, tt := range tests {
+		reply = b.GenServiceReplyData("1", "reboot", map[string]any{"result": "ok"}, tt.err).Value.(dmcontext.ContentBlink).Blink
+		assert.Equal(t, tt.code, reply.Code)
+		assert.Equal(t, tt.err.Error(), reply.Message)
+		assert.Nil(t, reply.Params)
+	}
+}
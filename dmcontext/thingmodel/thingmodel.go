@@ -0,0 +1,245 @@
+// Package thingmodel imports and exports device models between dmcontext.DeviceProperty and the standard
+// thing model formats, W3C WoT Thing Description/Thing Model and Alink TSL. The fields which could not be
+// mapped in either direction are collected in a report instead of failing the whole model.
+package thingmodel
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/baetyl/baetyl-go/v2/dmcontext"
+	"github.com/baetyl/baetyl-go/v2/errors"
+)
+
+// The formats supported
+const (
+	FormatWoT = "wot"
+	FormatTSL = "tsl"
+)
+
+const (
+	// maxArrayLength the max length of array allowed by dmcontext.ArrayType
+	maxArrayLength = 20
+	// reasonNotSupported the reason of the field which has no counterpart
+	reasonNotSupported = "is not supported"
+)
+
+var (
+	ErrFormatNotSupported = errors.New("thing model format not supported")
+	ErrInvalidModel       = errors.New("thing model is not a json object")
+)
+
+// Report the fields which could not be mapped, the path is the json path of source field
+type Report struct {
+	Issues []Issue `yaml:"issues,omitempty" json:"issues,omitempty"`
+}
+
+// Issue a field which could not be mapped or is mapped with loss
+type Issue struct {
+	Path   string `yaml:"path" json:"path"`
+	Reason string `yaml:"reason" json:"reason"`
+}
+
+// Empty returns whether all fields are mapped
+func (r *Report) Empty() bool {
+	return len(r.Issues) == 0
+}
+
+func (r *Report) String() string {
+	var b strings.Builder
+	for _, i := range r.Issues {
+		fmt.Fprintf(&b, "%s: %s\n", i.Path, i.Reason)
+	}
+	return b.String()
+}
+
+func (r *Report) add(path, format string, args ...any) {
+	r.Issues = append(r.Issues, Issue{Path: path, Reason: fmt.Sprintf(format, args...)})
+}
+
+// Import imports the properties from the thing model of format
+func Import(format string, data []byte) ([]dmcontext.DeviceProperty, *Report, error) {
+	switch format {
+	case FormatWoT:
+		return ImportWoT(data)
+	case FormatTSL:
+		return ImportTSL(data)
+	}
+	return nil, nil, errors.Trace(ErrFormatNotSupported)
+}
+
+// Export exports the properties as the thing model of format, the name is the title of WoT or the product key of TSL
+func Export(format, name string, props []dmcontext.DeviceProperty) ([]byte, *Report, error) {
+	switch format {
+	case FormatWoT:
+		return ExportWoT(name, props)
+	case FormatTSL:
+		return ExportTSL(name, props)
+	}
+	return nil, nil, errors.Trace(ErrFormatNotSupported)
+}
+
+// object a json object decoded, the fields are removed once mapped so that the rest are reported
+type object map[string]any
+
+func decodeObject(data []byte) (object, error) {
+	d := json.NewDecoder(bytes.NewReader(data))
+	d.UseNumber()
+	var res map[string]any
+	if err := d.Decode(&res); err != nil {
+		return nil, errors.Trace(err)
+	}
+	if res == nil {
+		return nil, errors.Trace(ErrInvalidModel)
+	}
+	return res, nil
+}
+
+func join(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
+
+func (o object) take(key string) (any, bool) {
+	v, ok := o[key]
+	delete(o, key)
+	return v, ok
+}
+
+// drop removes the field if it is the value, which is the default written by export
+func (o object) drop(key string, value any) {
+	if v, ok := o[key]; ok && v == value {
+		delete(o, key)
+	}
+}
+
+func (o object) string(r *Report, path, key string) string {
+	v, ok := o.take(key)
+	if !ok {
+		return ""
+	}
+	s, ok := v.(string)
+	if !ok {
+		r.add(join(path, key), "is not a string")
+	}
+	return s
+}
+
+func (o object) bool(r *Report, path, key string) bool {
+	v, ok := o.take(key)
+	if !ok {
+		return false
+	}
+	b, ok := v.(bool)
+	if !ok {
+		r.add(join(path, key), "is not a boolean")
+	}
+	return b
+}
+
+// int returns the integer field, which is a json number or a string of number
+func (o object) int(r *Report, path, key string) (int64, bool) {
+	v, ok := o.take(key)
+	if !ok {
+		return 0, false
+	}
+	var s string
+	switch n := v.(type) {
+	case json.Number:
+		s = n.String()
+	case string:
+		s = n
+	}
+	i, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		r.add(join(path, key), "is not an integer")
+		return 0, false
+	}
+	return i, true
+}
+
+func (o object) object(r *Report, path, key string) object {
+	v, ok := o.take(key)
+	if !ok {
+		return nil
+	}
+	m, ok := v.(map[string]any)
+	if !ok {
+		r.add(join(path, key), "is not an object")
+	}
+	return m
+}
+
+func (o object) array(r *Report, path, key string) []any {
+	v, ok := o.take(key)
+	if !ok {
+		return nil
+	}
+	a, ok := v.([]any)
+	if !ok {
+		r.add(join(path, key), "is not an array")
+	}
+	return a
+}
+
+// rest reports the fields not mapped, except the empty ones
+func (o object) rest(r *Report, path string) {
+	for _, k := range sortedKeys(o) {
+		switch v := o[k].(type) {
+		case nil:
+			continue
+		case []any:
+			if len(v) == 0 {
+				continue
+			}
+		case map[string]any:
+			if len(v) == 0 {
+				continue
+			}
+		}
+		r.add(join(path, k), reasonNotSupported)
+	}
+}
+
+func sortedKeys(m map[string]any) []string {
+	res := make([]string, 0, len(m))
+	for k := range m {
+		res = append(res, k)
+	}
+	sort.Strings(res)
+	return res
+}
+
+// arrayMax returns the max length of array, which is limited by maxArrayLength
+func arrayMax(r *Report, path string, max int64, ok bool) int {
+	switch {
+	case !ok:
+		r.add(path, "is not set, the max length %d is used", maxArrayLength)
+	case max > maxArrayLength:
+		r.add(path, "%d exceeds the max length %d", max, maxArrayLength)
+	case max > 0:
+		return int(max)
+	}
+	return maxArrayLength
+}
+
+// enumTypes the types of enum allowed by dmcontext.EnumType
+var enumTypes = map[string]bool{
+	dmcontext.TypeInt16:  true,
+	dmcontext.TypeInt32:  true,
+	dmcontext.TypeInt64:  true,
+	dmcontext.TypeString: true,
+}
+
+func propertyName(p dmcontext.DeviceProperty) string {
+	if p.Name != "" {
+		return p.Name
+	}
+	return p.ID
+}
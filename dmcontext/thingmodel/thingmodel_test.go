@@ -0,0 +1,302 @@
+package thingmodel
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/baetyl/baetyl-go/v2/dmcontext"
+	"github.com/baetyl/baetyl-go/v2/errors"
+)
+
+var models = []dmcontext.DeviceProperty{
+	{ID: "temp", Name: "温度", Type: dmcontext.TypeFloat32, Mode: dmcontext.ModeReadOnlyProperty, Unit: "°C"},
+	{ID: "count", Name: "count", Type: dmcontext.TypeInt16, Mode: dmcontext.ModeReadWriteProperty},
+	{ID: "total", Name: "total", Type: dmcontext.TypeInt32, Mode: dmcontext.ModeReadOnlyProperty, Unit: "kWh"},
+	{ID: "ratio", Name: "ratio", Type: dmcontext.TypeFloat64, Mode: dmcontext.ModeReadWriteProperty},
+	{ID: "switch", Name: "switch", Type: dmcontext.TypeBool, Mode: dmcontext.ModeReadWriteProperty},
+	{ID: "label", Name: "label", Type: dmcontext.TypeString, Mode: dmcontext.ModeReadWriteProperty},
+	{ID: "mode", Name: "mode", Type: dmcontext.TypeEnum, Mode: dmcontext.ModeReadWriteProperty, EnumType: dmcontext.EnumType{
+		Type: dmcontext.TypeInt32,
+		Values: []dmcontext.EnumValue{
+			{Name: "auto", Value: "0", DisplayName: "auto"},
+			{Name: "manual", Value: "1", DisplayName: "manual"},
+		},
+	}},
+	{ID: "samples", Name: "samples", Type: dmcontext.TypeArray, Mode: dmcontext.ModeReadOnlyProperty, ArrayType: dmcontext.ArrayType{
+		Type: dmcontext.TypeFloat64,
+		Max:  10,
+	}},
+	{ID: "location", Name: "location", Type: dmcontext.TypeObject, Mode: dmcontext.ModeReadWriteProperty, ObjectType: map[string]dmcontext.ObjectType{
+		"lat": {DisplayName: "latitude", Type: dmcontext.TypeFloat64},
+		"lng": {DisplayName: "longitude", Type: dmcontext.TypeFloat64},
+	}},
+}
+
+const wot = `{
+  "@context": ["https://www.w3.org/2022/wot/td/v1.1", {"saref": "https://w3id.org/saref#"}],
+  "@type": "Thing",
+  "id": "urn:dev:ops:32473-WoTLamp-1234",
+  "title": "MyLampThing",
+  "securityDefinitions": {"basic_sc": {"scheme": "basic", "in": "header"}},
+  "security": "basic_sc",
+  "properties": {
+    "status": {
+      "title": "Status",
+      "type": "string",
+      "enum": ["on", "off"],
+      "readOnly": true,
+      "forms": [{"href": "https://mylamp.example.com/status"}]
+    },
+    "level": {
+      "type": "integer",
+      "oneOf": [{"const": 1, "title": "low", "description": "Low"}, {"const": 2, "title": "high"}, {"title": "invalid"}]
+    },
+    "brightness": {"type": "integer", "minimum": 0, "maximum": 100, "unit": "percent"},
+    "power": {"type": "number", "unit": "W", "readOnly": true, "observable": true},
+    "born": {"type": "string", "format": "date"},
+    "updated": {"type": "string", "format": "date-time"},
+    "colors": {"type": "array", "items": {"type": "string"}, "minItems": 1},
+    "matrix": {"type": "array", "items": {"type": "array", "items": {"type": "number"}}},
+    "config": {
+      "type": "object",
+      "properties": {
+        "on": {"type": "boolean", "title": "On"},
+        "at": {"type": "string", "format": "time"},
+        "nested": {"type": "object"}
+      },
+      "required": ["on", "nested"]
+    },
+    "password": {"type": "string", "writeOnly": true},
+    "broken": "x",
+    "nothing": {"type": "null"}
+  },
+  "actions": {"toggle": {"forms": [{"href": "https://mylamp.example.com/toggle"}]}},
+  "events": {"overheating": {"data": {"type": "string"}}}
+}`
+
+func TestImportWoT(t *testing.T) {
+	props, r, err := ImportWoT([]byte(wot))
+	assert.NoError(t, err)
+	assert.Equal(t, []dmcontext.DeviceProperty{
+		{ID: "born", Name: "born", Type: dmcontext.TypeDate, Format: "yyyy-mm-dd", Mode: dmcontext.ModeReadWriteProperty},
+		{ID: "brightness", Name: "brightness", Type: dmcontext.TypeInt64, Mode: dmcontext.ModeReadWriteProperty, Unit: "percent"},
+		{ID: "colors", Name: "colors", Type: dmcontext.TypeArray, Mode: dmcontext.ModeReadWriteProperty, ArrayType: dmcontext.ArrayType{
+			Type: dmcontext.TypeString, Min: 1, Max: 20,
+		}},
+		{ID: "config", Name: "config", Type: dmcontext.TypeObject, Mode: dmcontext.ModeReadWriteProperty, ObjectType: map[string]dmcontext.ObjectType{
+			"on": {DisplayName: "On", Type: dmcontext.TypeBool},
+			"at": {Type: dmcontext.TypeTime, Format: "hh:mm:ss"},
+		}, ObjectRequired: []string{"on"}},
+		{ID: "level", Name: "level", Type: dmcontext.TypeEnum, Mode: dmcontext.ModeReadWriteProperty, EnumType: dmcontext.EnumType{
+			Type: dmcontext.TypeInt64,
+			Values: []dmcontext.EnumValue{
+				{Name: "low", Value: "1", DisplayName: "Low"},
+				{Name: "high", Value: "2", DisplayName: "high"},
+			},
+		}},
+		{ID: "password", Name: "password", Type: dmcontext.TypeString, Mode: dmcontext.ModeReadWriteProperty},
+		{ID: "power", Name: "power", Type: dmcontext.TypeFloat64, Mode: dmcontext.ModeReadOnlyProperty, Unit: "W"},
+		{ID: "status", Name: "Status", Type: dmcontext.TypeEnum, Mode: dmcontext.ModeReadOnlyProperty, EnumType: dmcontext.EnumType{
+			Type: dmcontext.TypeString,
+			Values: []dmcontext.EnumValue{
+				{Name: "on", Value: "on", DisplayName: "on"},
+				{Name: "off", Value: "off", DisplayName: "off"},
+			},
+		}},
+		{ID: "updated", Name: "updated", Type: dmcontext.TypeString, Mode: dmcontext.ModeReadWriteProperty},
+	}, props)
+	assert.Equal(t, []Issue{
+		{Path: "properties.brightness.minimum", Reason: "is not supported"},
+		{Path: "properties.brightness.maximum", Reason: "is not supported"},
+		{Path: "properties.broken", Reason: "is not an object"},
+		{Path: "properties.colors.maxItems", Reason: "is not set, the max length 20 is used"},
+		{Path: "properties.config.properties.nested.type", Reason: "object is not supported"},
+		{Path: "properties.config.required", Reason: "nested is not a field mapped"},
+		{Path: "properties.level.oneOf[2]", Reason: "is not a const of integer"},
+		{Path: "properties.matrix.items.type", Reason: "array is not supported"},
+		{Path: "properties.matrix.items.items", Reason: "is not supported"},
+		{Path: "properties.nothing.type", Reason: "null is not supported"},
+		{Path: "properties.password.writeOnly", Reason: "is mapped to read write"},
+		{Path: "properties.power.observable", Reason: "is not supported"},
+		{Path: "properties.status.forms", Reason: "is not supported"},
+		{Path: "properties.updated.format", Reason: "date-time is mapped to string"},
+		{Path: "actions", Reason: "is not supported"},
+		{Path: "events", Reason: "is not supported"},
+	}, r.Issues)
+	assert.False(t, r.Empty())
+	assert.Contains(t, r.String(), "actions: is not supported\n")
+
+	_, _, err = ImportWoT([]byte(`[]`))
+	assert.Error(t, err)
+	_, _, err = ImportWoT([]byte(`null`))
+	assert.Equal(t, ErrInvalidModel, errors.Cause(err))
+}
+
+func TestWoT(t *testing.T) {
+	data, r, err := ExportWoT("meter", models)
+	assert.NoError(t, err)
+	assert.True(t, r.Empty(), r.String())
+	assert.Contains(t, string(data), `"@type": "tm:ThingModel"`)
+	assert.Contains(t, string(data), `"title": "meter"`)
+
+	props, r, err := ImportWoT(data)
+	assert.NoError(t, err)
+	assert.True(t, r.Empty(), r.String())
+	assert.ElementsMatch(t, models, props)
+
+	// the fields with no counterpart are reported
+	_, r, err = ExportWoT("meter", []dmcontext.DeviceProperty{
+		{Name: "noid", Type: dmcontext.TypeInt16},
+		{ID: "day", Type: dmcontext.TypeDate, Format: "mm-dd-yyyy"},
+		{ID: "unknown", Type: "uint8"},
+		{ID: "nested", Type: dmcontext.TypeArray, ArrayType: dmcontext.ArrayType{Type: dmcontext.TypeObject}},
+		{ID: "flags", Type: dmcontext.TypeEnum, EnumType: dmcontext.EnumType{Type: dmcontext.TypeInt16, Values: []dmcontext.EnumValue{{Name: "x", Value: "x"}}}},
+		{ID: "floats", Type: dmcontext.TypeEnum, EnumType: dmcontext.EnumType{Type: dmcontext.TypeFloat32}},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []Issue{
+		{Path: "[0].id", Reason: "is required"},
+		{Path: "day.format", Reason: "mm-dd-yyyy is exported as yyyy-mm-dd"},
+		{Path: "unknown.type", Reason: "uint8 is not supported"},
+		{Path: "nested.arrayType.type", Reason: "object is not supported"},
+		{Path: "flags.enumType.values[0]", Reason: "x is not a int16"},
+		{Path: "floats.enumType.type", Reason: "float32 is not supported by enum"},
+	}, r.Issues)
+}
+
+const tsl = `{
+  "schema": "https://iotx-config.oss-cn-shanghai.aliyuncs.com/schema.json",
+  "profile": {"version": "1.0", "productKey": "a1b2c3"},
+  "properties": [
+    {
+      "identifier": "PowerSwitch", "name": "电源开关", "accessMode": "rw", "required": true,
+      "dataType": {"type": "bool", "specs": {"0": "关闭", "1": "开启"}}
+    },
+    {
+      "identifier": "Temperature", "name": "温度", "accessMode": "r", "required": false,
+      "dataType": {"type": "float", "specs": {"min": "-40", "max": "120", "unit": "°C", "unitName": "摄氏度", "step": "0.1"}}
+    },
+    {
+      "identifier": "Mode", "name": "模式", "accessMode": "rw",
+      "dataType": {"type": "enum", "specs": {"2": "睡眠", "0": "自动", "1": "手动", "x": "无效"}}
+    },
+    {
+      "identifier": "Updated", "name": "更新时间", "accessMode": "r",
+      "dataType": {"type": "date", "specs": {}}
+    },
+    {
+      "identifier": "History", "name": "历史", "accessMode": "r",
+      "dataType": {"type": "array", "specs": {"size": "128", "item": {"type": "int"}}}
+    },
+    {
+      "identifier": "GeoLocation", "name": "地理位置", "accessMode": "rw",
+      "dataType": {"type": "struct", "specs": [
+        {"identifier": "Longitude", "name": "经度", "dataType": {"type": "double", "specs": {"min": "-180", "max": "180", "unit": "°"}}},
+        {"identifier": "Address", "name": "地址", "dataType": {"type": "text", "specs": {"length": "255"}}},
+        {"identifier": "Tags", "name": "标签", "dataType": {"type": "array", "specs": {"size": "2", "item": {"type": "text"}}}}
+      ]}
+    },
+    {"name": "missing"},
+    {"identifier": "Unknown", "dataType": {"type": "image"}}
+  ],
+  "events": [{"identifier": "post", "type": "info", "outputData": []}],
+  "services": []
+}`
+
+func TestImportTSL(t *testing.T) {
+	props, r, err := ImportTSL([]byte(tsl))
+	assert.NoError(t, err)
+	assert.Equal(t, []dmcontext.DeviceProperty{
+		{ID: "PowerSwitch", Name: "电源开关", Type: dmcontext.TypeBool, Mode: dmcontext.ModeReadWriteProperty},
+		{ID: "Temperature", Name: "温度", Type: dmcontext.TypeFloat32, Mode: dmcontext.ModeReadOnlyProperty, Unit: "°C"},
+		{ID: "Mode", Name: "模式", Type: dmcontext.TypeEnum, Mode: dmcontext.ModeReadWriteProperty, EnumType: dmcontext.EnumType{
+			Type: dmcontext.TypeInt32,
+			Values: []dmcontext.EnumValue{
+				{Name: "自动", Value: "0", DisplayName: "自动"},
+				{Name: "手动", Value: "1", DisplayName: "手动"},
+				{Name: "睡眠", Value: "2", DisplayName: "睡眠"},
+			},
+		}},
+		{ID: "Updated", Name: "更新时间", Type: dmcontext.TypeInt64, Mode: dmcontext.ModeReadOnlyProperty},
+		{ID: "History", Name: "历史", Type: dmcontext.TypeArray, Mode: dmcontext.ModeReadOnlyProperty, ArrayType: dmcontext.ArrayType{
+			Type: dmcontext.TypeInt32, Max: 20,
+		}},
+		{ID: "GeoLocation", Name: "地理位置", Type: dmcontext.TypeObject, Mode: dmcontext.ModeReadWriteProperty, ObjectType: map[string]dmcontext.ObjectType{
+			"Longitude": {DisplayName: "经度", Type: dmcontext.TypeFloat64},
+			"Address":   {DisplayName: "地址", Type: dmcontext.TypeString},
+		}},
+	}, props)
+	assert.Equal(t, []Issue{
+		{Path: "properties[0].dataType.specs.0", Reason: "is not supported"},
+		{Path: "properties[0].dataType.specs.1", Reason: "is not supported"},
+		{Path: "properties[0].required", Reason: "is not supported"},
+		{Path: "properties[1].dataType.specs.max", Reason: "is not supported"},
+		{Path: "properties[1].dataType.specs.min", Reason: "is not supported"},
+		{Path: "properties[1].dataType.specs.step", Reason: "is not supported"},
+		{Path: "properties[2].dataType.specs.x", Reason: "is not a label of int"},
+		{Path: "properties[3].dataType.type", Reason: "date of utc milliseconds is mapped to int64"},
+		{Path: "properties[4].dataType.specs.size", Reason: "128 exceeds the max length 20"},
+		{Path: "properties[5].dataType.specs[0].dataType.specs.max", Reason: "is not supported"},
+		{Path: "properties[5].dataType.specs[0].dataType.specs.min", Reason: "is not supported"},
+		{Path: "properties[5].dataType.specs[0].dataType.specs.unit", Reason: "is not supported"},
+		{Path: "properties[5].dataType.specs[1].dataType.specs.length", Reason: "is not supported"},
+		{Path: "properties[5].dataType.specs[2].dataType.type", Reason: "array is not supported"},
+		{Path: "properties[5].dataType.specs[2].dataType.specs.item", Reason: "is not supported"},
+		{Path: "properties[5].dataType.specs[2].dataType.specs.size", Reason: "is not supported"},
+		{Path: "properties[6].identifier", Reason: "is required"},
+		{Path: "properties[6].name", Reason: "is not supported"},
+		{Path: "properties[7].dataType.type", Reason: "image is not supported"},
+		{Path: "events", Reason: "is not supported"},
+	}, r.Issues)
+}
+
+func TestTSL(t *testing.T) {
+	data, r, err := ExportTSL("a1b2c3", models)
+	assert.NoError(t, err)
+	assert.True(t, r.Empty(), r.String())
+	assert.Contains(t, string(data), `"productKey": "a1b2c3"`)
+
+	props, r, err := ImportTSL(data)
+	assert.NoError(t, err)
+	assert.True(t, r.Empty(), r.String())
+	assert.Equal(t, models, props)
+
+	// the fields with no counterpart are reported
+	_, r, err = ExportTSL("a1b2c3", []dmcontext.DeviceProperty{
+		{ID: "big", Type: dmcontext.TypeInt64},
+		{ID: "day", Type: dmcontext.TypeDate, Format: "yyyy-mm-dd"},
+		{ID: "names", Type: dmcontext.TypeEnum, EnumType: dmcontext.EnumType{Type: dmcontext.TypeString}},
+		{ID: "flags", Type: dmcontext.TypeArray, ArrayType: dmcontext.ArrayType{Type: dmcontext.TypeBool}},
+		{ID: "points", Type: dmcontext.TypeArray, ArrayType: dmcontext.ArrayType{Type: dmcontext.TypeInt16, Min: 1}},
+		{ID: "pos", Type: dmcontext.TypeObject, ObjectType: map[string]dmcontext.ObjectType{"x": {Type: "uint8"}}, ObjectRequired: []string{"x"}},
+		{ID: "on", Type: dmcontext.TypeBool, Unit: "x"},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []Issue{
+		{Path: "big.type", Reason: "int64 is narrowed to int32"},
+		{Path: "day.type", Reason: "date is exported as text"},
+		{Path: "names.enumType.type", Reason: "string is not supported by enum, whose values are int"},
+		{Path: "flags.arrayType.type", Reason: "bool is not supported by array"},
+		{Path: "points.arrayType.min", Reason: "is not supported"},
+		{Path: "pos.objectType.x.type", Reason: "uint8 is not supported"},
+		{Path: "pos.objectRequired", Reason: "is not supported"},
+		{Path: "on.unit", Reason: "is not supported by bool"},
+	}, r.Issues)
+}
+
+func TestFormat(t *testing.T) {
+	for _, format := range []string{FormatWoT, FormatTSL} {
+		data, r, err := Export(format, "meter", models)
+		assert.NoError(t, err)
+		assert.True(t, r.Empty())
+		props, r, err := Import(format, data)
+		assert.NoError(t, err)
+		assert.True(t, r.Empty())
+		assert.ElementsMatch(t, models, props)
+	}
+	_, _, err := Import("xml", nil)
+	assert.Equal(t, ErrFormatNotSupported, errors.Cause(err))
+	_, _, err = Export("xml", "meter", models)
+	assert.Equal(t, ErrFormatNotSupported, errors.Cause(err))
+}
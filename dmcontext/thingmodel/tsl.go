@@ -0,0 +1,375 @@
+package thingmodel
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+
+	"github.com/baetyl/baetyl-go/v2/dmcontext"
+	"github.com/baetyl/baetyl-go/v2/errors"
+)
+
+const (
+	tslSchema          = "https://iotx-config.oss-cn-shanghai.aliyuncs.com/schema.json"
+	tslVersion         = "1.0"
+	tslAccessRead      = "r"
+	tslAccessReadWrite = "rw"
+	// tslTextLength the max length of text allowed by TSL
+	tslTextLength = "10240"
+)
+
+// ImportTSL imports the properties of an Alink TSL (thing specification language) model.
+// The int is int32 or int16 if it has the full range of int16, and the date of utc milliseconds is int64.
+// The events and services are reported as not supported.
+func ImportTSL(data []byte) ([]dmcontext.DeviceProperty, *Report, error) {
+	doc, err := decodeObject(data)
+	if err != nil {
+		return nil, nil, errors.Trace(err)
+	}
+	r := &Report{}
+	delete(doc, "schema")
+	delete(doc, "profile")
+	var res []dmcontext.DeviceProperty
+	for i, v := range doc.array(r, "", "properties") {
+		path := fmt.Sprintf("properties[%d]", i)
+		o, ok := v.(map[string]any)
+		if !ok {
+			r.add(path, "is not an object")
+			continue
+		}
+		if p, ok := importTSLProperty(r, path, o); ok {
+			res = append(res, p)
+		}
+	}
+	doc.rest(r, "")
+	return res, r, nil
+}
+
+func importTSLProperty(r *Report, path string, o object) (dmcontext.DeviceProperty, bool) {
+	defer o.rest(r, path)
+	p := dmcontext.DeviceProperty{ID: o.string(r, path, "identifier"), Mode: dmcontext.ModeReadWriteProperty}
+	if p.ID == "" {
+		r.add(join(path, "identifier"), "is required")
+		return p, false
+	}
+	p.Name = p.ID
+	if name := o.string(r, path, "name"); name != "" {
+		p.Name = name
+	}
+	switch mode := o.string(r, path, "accessMode"); mode {
+	case tslAccessRead:
+		p.Mode = dmcontext.ModeReadOnlyProperty
+	case tslAccessReadWrite, "":
+	default:
+		r.add(join(path, "accessMode"), "%s is mapped to rw", mode)
+	}
+	// whether the property is a standard one of the category, which is not part of the model
+	o.drop("required", false)
+	dt := o.object(r, path, "dataType")
+	if dt == nil {
+		r.add(join(path, "dataType"), "is required")
+		return p, false
+	}
+	return p, importTSLData(r, join(path, "dataType"), dt, &p)
+}
+
+func importTSLData(r *Report, path string, dt object, p *dmcontext.DeviceProperty) bool {
+	specsPath := join(path, "specs")
+	switch dt["type"] {
+	case "enum":
+		defer dt.rest(r, path)
+		delete(dt, "type")
+		specs := dt.object(r, path, "specs")
+		p.Type = dmcontext.TypeEnum
+		p.EnumType = dmcontext.EnumType{Type: dmcontext.TypeInt32}
+		values := map[int64]string{}
+		var keys []int64
+		for k, v := range specs {
+			i, err := strconv.ParseInt(k, 10, 32)
+			s, ok := v.(string)
+			if err != nil || !ok {
+				r.add(join(specsPath, k), "is not a label of int")
+				continue
+			}
+			values[i] = s
+			keys = append(keys, i)
+		}
+		sort.Slice(keys, func(i, j int) bool { return keys[i] < keys[j] })
+		for _, k := range keys {
+			p.EnumType.Values = append(p.EnumType.Values, dmcontext.EnumValue{Name: values[k], Value: strconv.FormatInt(k, 10), DisplayName: values[k]})
+		}
+		return true
+	case "array":
+		defer dt.rest(r, path)
+		delete(dt, "type")
+		specs := dt.object(r, path, "specs")
+		if specs == nil {
+			r.add(specsPath, "is required")
+			return false
+		}
+		defer specs.rest(r, specsPath)
+		size, ok := specs.int(r, specsPath, "size")
+		max := arrayMax(r, join(specsPath, "size"), size, ok)
+		itemPath := join(specsPath, "item")
+		item := specs.object(r, specsPath, "item")
+		if item == nil {
+			r.add(itemPath, "is required")
+			return false
+		}
+		t, f, ok := importTSLField(r, itemPath, item)
+		if !ok {
+			return false
+		}
+		p.Type = dmcontext.TypeArray
+		p.ArrayType = dmcontext.ArrayType{Type: t, Format: f, Max: max}
+		return true
+	case "struct":
+		defer dt.rest(r, path)
+		delete(dt, "type")
+		p.Type = dmcontext.TypeObject
+		p.ObjectType = map[string]dmcontext.ObjectType{}
+		for i, v := range dt.array(r, path, "specs") {
+			fieldPath := fmt.Sprintf("%s[%d]", specsPath, i)
+			field, ok := v.(map[string]any)
+			if !ok {
+				r.add(fieldPath, "is not an object")
+				continue
+			}
+			if k, ot, ok := importTSLStructField(r, fieldPath, field); ok {
+				p.ObjectType[k] = ot
+			}
+		}
+		return true
+	}
+	var ok bool
+	p.Type, p.Format, p.Unit, ok = importTSLPrimitive(r, path, dt)
+	return ok
+}
+
+func importTSLStructField(r *Report, path string, o object) (string, dmcontext.ObjectType, bool) {
+	defer o.rest(r, path)
+	id := o.string(r, path, "identifier")
+	if id == "" {
+		r.add(join(path, "identifier"), "is required")
+		return "", dmcontext.ObjectType{}, false
+	}
+	res := dmcontext.ObjectType{DisplayName: o.string(r, path, "name")}
+	dt := o.object(r, path, "dataType")
+	if dt == nil {
+		r.add(join(path, "dataType"), "is required")
+		return "", res, false
+	}
+	var ok bool
+	res.Type, res.Format, ok = importTSLField(r, join(path, "dataType"), dt)
+	return id, res, ok
+}
+
+// importTSLField imports the data type of the item of array or field of struct, which must be primitive and has no unit
+func importTSLField(r *Report, path string, dt object) (string, string, bool) {
+	t, f, unit, ok := importTSLPrimitive(r, path, dt)
+	if unit != "" {
+		r.add(join(path, "specs.unit"), reasonNotSupported)
+	}
+	return t, f, ok
+}
+
+// importTSLPrimitive returns the type, format and unit of the data type of primitive type
+func importTSLPrimitive(r *Report, path string, dt object) (string, string, string, bool) {
+	defer dt.rest(r, path)
+	typ := dt.string(r, path, "type")
+	specsPath := join(path, "specs")
+	specs := dt.object(r, path, "specs")
+	if specs == nil {
+		specs = object{}
+	}
+	defer specs.rest(r, specsPath)
+	unit := specs.string(r, specsPath, "unit")
+	// the display name of unit
+	delete(specs, "unitName")
+
+	switch typ {
+	case "int":
+		if specs["min"] == strconv.Itoa(math.MinInt16) && specs["max"] == strconv.Itoa(math.MaxInt16) {
+			delete(specs, "min")
+			delete(specs, "max")
+			return dmcontext.TypeInt16, "", unit, true
+		}
+		specs.drop("min", strconv.Itoa(math.MinInt32))
+		specs.drop("max", strconv.Itoa(math.MaxInt32))
+		return dmcontext.TypeInt32, "", unit, true
+	case "float":
+		return dmcontext.TypeFloat32, "", unit, true
+	case "double":
+		return dmcontext.TypeFloat64, "", unit, true
+	case "text":
+		specs.drop("length", tslTextLength)
+		return dmcontext.TypeString, "", unit, true
+	case "bool":
+		specs.drop("0", "false")
+		specs.drop("1", "true")
+		return dmcontext.TypeBool, "", unit, true
+	case "date":
+		r.add(join(path, "type"), "date of utc milliseconds is mapped to int64")
+		return dmcontext.TypeInt64, "", unit, true
+	case "":
+		r.add(join(path, "type"), "is required")
+	default:
+		r.add(join(path, "type"), "%s %s", typ, reasonNotSupported)
+	}
+	return "", "", "", false
+}
+
+// ExportTSL exports the properties as an Alink TSL model of the product key, the int and int64 are narrowed to int32.
+// The visitors and values of properties are not part of the model, which are not exported.
+func ExportTSL(productKey string, props []dmcontext.DeviceProperty) ([]byte, *Report, error) {
+	r := &Report{}
+	properties := []any{}
+	for i, p := range props {
+		if p.ID == "" {
+			r.add(fmt.Sprintf("[%d].id", i), "is required")
+			continue
+		}
+		dt, ok := exportTSLData(r, p.ID, p)
+		if !ok {
+			continue
+		}
+		mode := tslAccessReadWrite
+		if p.Mode == dmcontext.ModeReadOnlyProperty {
+			mode = tslAccessRead
+		}
+		properties = append(properties, map[string]any{
+			"identifier": p.ID,
+			"name":       propertyName(p),
+			"accessMode": mode,
+			"required":   false,
+			"dataType":   dt,
+		})
+	}
+	doc := map[string]any{
+		"schema":     tslSchema,
+		"profile":    map[string]any{"productKey": productKey, "version": tslVersion},
+		"properties": properties,
+	}
+	data, err := json.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return nil, nil, errors.Trace(err)
+	}
+	return data, r, nil
+}
+
+func exportTSLData(r *Report, path string, p dmcontext.DeviceProperty) (map[string]any, bool) {
+	switch p.Type {
+	case dmcontext.TypeEnum:
+		switch p.EnumType.Type {
+		case dmcontext.TypeInt16, dmcontext.TypeInt32, dmcontext.TypeInt64:
+		default:
+			r.add(join(path, "enumType.type"), "%s is not supported by enum, whose values are int", p.EnumType.Type)
+			return nil, false
+		}
+		specs := map[string]any{}
+		for i, v := range p.EnumType.Values {
+			k, err := strconv.ParseInt(v.Value, 10, 32)
+			if err != nil {
+				r.add(fmt.Sprintf("%s.enumType.values[%d]", path, i), "%s is not an int32", v.Value)
+				continue
+			}
+			specs[strconv.FormatInt(k, 10)] = v.Name
+		}
+		return map[string]any{"type": "enum", "specs": specs}, true
+	case dmcontext.TypeArray:
+		arrayPath := join(path, "arrayType")
+		switch p.ArrayType.Type {
+		case dmcontext.TypeBool, dmcontext.TypeDate, dmcontext.TypeTime:
+			r.add(join(arrayPath, "type"), "%s is not supported by array", p.ArrayType.Type)
+			return nil, false
+		}
+		item, ok := exportTSLPrimitive(r, arrayPath, p.ArrayType.Type, "")
+		if !ok {
+			return nil, false
+		}
+		if p.ArrayType.Min > 0 {
+			r.add(join(arrayPath, "min"), reasonNotSupported)
+		}
+		size := p.ArrayType.Max
+		if size <= 0 {
+			size = maxArrayLength
+		}
+		return map[string]any{"type": "array", "specs": map[string]any{"size": strconv.Itoa(size), "item": item}}, true
+	case dmcontext.TypeObject:
+		fields := []any{}
+		for _, k := range sortedObjectKeys(p.ObjectType) {
+			ot := p.ObjectType[k]
+			dt, ok := exportTSLPrimitive(r, join(path, "objectType."+k), ot.Type, "")
+			if !ok {
+				continue
+			}
+			name := ot.DisplayName
+			if name == "" {
+				name = k
+			}
+			fields = append(fields, map[string]any{"identifier": k, "name": name, "dataType": dt})
+		}
+		if len(p.ObjectRequired) > 0 {
+			r.add(join(path, "objectRequired"), reasonNotSupported)
+		}
+		return map[string]any{"type": "struct", "specs": fields}, true
+	}
+	return exportTSLPrimitive(r, path, p.Type, p.Unit)
+}
+
+// exportTSLPrimitive returns the data type of primitive type, see importTSLPrimitive
+func exportTSLPrimitive(r *Report, path, typ, unit string) (map[string]any, bool) {
+	specs := map[string]any{}
+	var res string
+	switch typ {
+	case dmcontext.TypeInt16:
+		res = "int"
+		specs["min"], specs["max"] = strconv.Itoa(math.MinInt16), strconv.Itoa(math.MaxInt16)
+	case dmcontext.TypeInt, dmcontext.TypeInt32, dmcontext.TypeInt64:
+		if typ != dmcontext.TypeInt32 {
+			r.add(join(path, "type"), "%s is narrowed to int32", typ)
+		}
+		res = "int"
+		specs["min"], specs["max"] = strconv.Itoa(math.MinInt32), strconv.Itoa(math.MaxInt32)
+	case dmcontext.TypeFloat32:
+		res = "float"
+	case dmcontext.TypeFloat64:
+		res = "double"
+	case dmcontext.TypeBool:
+		res = "bool"
+		specs["0"], specs["1"] = "false", "true"
+	case dmcontext.TypeString:
+		res = "text"
+		specs["length"] = tslTextLength
+	case dmcontext.TypeDate, dmcontext.TypeTime:
+		r.add(join(path, "type"), "%s is exported as text", typ)
+		res = "text"
+		specs["length"] = tslTextLength
+	case "":
+		r.add(join(path, "type"), "is required")
+		return nil, false
+	default:
+		r.add(join(path, "type"), "%s %s", typ, reasonNotSupported)
+		return nil, false
+	}
+	if unit != "" {
+		switch res {
+		case "int", "float", "double":
+			specs["unit"] = unit
+		default:
+			r.add(join(path, "unit"), "is not supported by %s", res)
+		}
+	}
+	return map[string]any{"type": res, "specs": specs}, true
+}
+
+func sortedObjectKeys(m map[string]dmcontext.ObjectType) []string {
+	res := make([]string, 0, len(m))
+	for k := range m {
+		res = append(res, k)
+	}
+	sort.Strings(res)
+	return res
+}
@@ -0,0 +1,379 @@
+package thingmodel
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"strings"
+
+	"github.com/baetyl/baetyl-go/v2/dmcontext"
+	"github.com/baetyl/baetyl-go/v2/errors"
+)
+
+const (
+	wotContext    = "https://www.w3.org/2022/wot/td/v1.1"
+	wotThingModel = "tm:ThingModel"
+	// wotFormatFloat the format of number which is a single precision float
+	wotFormatFloat = "float"
+	dateFormat     = "yyyy-mm-dd"
+	timeFormat     = "hh:mm:ss"
+)
+
+// wotMetadata the fields of thing description which describe the thing rather than its model
+var wotMetadata = []string{
+	"@context", "@type", "id", "title", "titles", "description", "descriptions", "version", "created", "modified",
+	"support", "base", "links", "forms", "securityDefinitions", "security", "profile",
+}
+
+// ImportWoT imports the properties of a W3C WoT Thing Description or Thing Model. The properties are keyed by
+// their names in the document and sorted, the actions and events are reported as not supported.
+func ImportWoT(data []byte) ([]dmcontext.DeviceProperty, *Report, error) {
+	doc, err := decodeObject(data)
+	if err != nil {
+		return nil, nil, errors.Trace(err)
+	}
+	r := &Report{}
+	for _, k := range wotMetadata {
+		delete(doc, k)
+	}
+	props := doc.object(r, "", "properties")
+	var res []dmcontext.DeviceProperty
+	for _, id := range sortedKeys(props) {
+		path := join("properties", id)
+		schema, ok := props[id].(map[string]any)
+		if !ok {
+			r.add(path, "is not an object")
+			continue
+		}
+		if p, ok := importWoTProperty(r, path, id, schema); ok {
+			res = append(res, p)
+		}
+	}
+	doc.rest(r, "")
+	return res, r, nil
+}
+
+func importWoTProperty(r *Report, path, id string, o object) (dmcontext.DeviceProperty, bool) {
+	defer o.rest(r, path)
+	p := dmcontext.DeviceProperty{ID: id, Name: id, Mode: dmcontext.ModeReadWriteProperty}
+	if title := o.string(r, path, "title"); title != "" {
+		p.Name = title
+	}
+	p.Unit = o.string(r, path, "unit")
+	if o.bool(r, path, "readOnly") {
+		p.Mode = dmcontext.ModeReadOnlyProperty
+	}
+	if o.bool(r, path, "writeOnly") {
+		r.add(join(path, "writeOnly"), "is mapped to read write")
+	}
+
+	typ := o.string(r, path, "type")
+	_, isEnum := o["enum"]
+	_, isOneOf := o["oneOf"]
+	switch {
+	case isEnum || isOneOf:
+		return p, importWoTEnum(r, path, typ, o, &p)
+	case typ == "array":
+		itemsPath := join(path, "items")
+		items := o.object(r, path, "items")
+		if items == nil {
+			r.add(itemsPath, "is required")
+			return p, false
+		}
+		defer items.rest(r, itemsPath)
+		t, f, ok := importWoTPrimitive(r, itemsPath, items.string(r, itemsPath, "type"), items)
+		if !ok {
+			return p, false
+		}
+		min, _ := o.int(r, path, "minItems")
+		max, ok := o.int(r, path, "maxItems")
+		p.Type = dmcontext.TypeArray
+		p.ArrayType = dmcontext.ArrayType{Type: t, Format: f, Min: int(min), Max: arrayMax(r, join(path, "maxItems"), max, ok)}
+		return p, true
+	case typ == "object":
+		fieldsPath := join(path, "properties")
+		fields := o.object(r, path, "properties")
+		p.Type = dmcontext.TypeObject
+		p.ObjectType = map[string]dmcontext.ObjectType{}
+		for _, k := range sortedKeys(fields) {
+			fieldPath := join(fieldsPath, k)
+			field, ok := fields[k].(map[string]any)
+			if !ok {
+				r.add(fieldPath, "is not an object")
+				continue
+			}
+			if ot, ok := importWoTField(r, fieldPath, field); ok {
+				p.ObjectType[k] = ot
+			}
+		}
+		for _, v := range o.array(r, path, "required") {
+			if k, ok := v.(string); ok {
+				if _, ok = p.ObjectType[k]; ok {
+					p.ObjectRequired = append(p.ObjectRequired, k)
+					continue
+				}
+			}
+			r.add(join(path, "required"), "%v is not a field mapped", v)
+		}
+		return p, true
+	}
+	t, f, ok := importWoTPrimitive(r, path, typ, o)
+	p.Type, p.Format = t, f
+	return p, ok
+}
+
+func importWoTField(r *Report, path string, o object) (dmcontext.ObjectType, bool) {
+	defer o.rest(r, path)
+	res := dmcontext.ObjectType{DisplayName: o.string(r, path, "title")}
+	var ok bool
+	res.Type, res.Format, ok = importWoTPrimitive(r, path, o.string(r, path, "type"), o)
+	return res, ok
+}
+
+// importWoTPrimitive returns the type and format of the data schema of primitive type. The integer is int16 or int32
+// if it has the full range of the type, and the number is float32 if its format is float.
+func importWoTPrimitive(r *Report, path, typ string, o object) (string, string, bool) {
+	switch typ {
+	case "integer":
+		min, hasMin := o.int(r, path, "minimum")
+		max, hasMax := o.int(r, path, "maximum")
+		switch {
+		case min == math.MinInt16 && max == math.MaxInt16:
+			return dmcontext.TypeInt16, "", true
+		case min == math.MinInt32 && max == math.MaxInt32:
+			return dmcontext.TypeInt32, "", true
+		}
+		if hasMin {
+			r.add(join(path, "minimum"), reasonNotSupported)
+		}
+		if hasMax {
+			r.add(join(path, "maximum"), reasonNotSupported)
+		}
+		return dmcontext.TypeInt64, "", true
+	case "number":
+		switch format := o.string(r, path, "format"); format {
+		case wotFormatFloat:
+			return dmcontext.TypeFloat32, "", true
+		case "":
+		default:
+			r.add(join(path, "format"), "%s is mapped to float64", format)
+		}
+		return dmcontext.TypeFloat64, "", true
+	case "boolean":
+		return dmcontext.TypeBool, "", true
+	case "string":
+		switch format := o.string(r, path, "format"); format {
+		case "date":
+			return dmcontext.TypeDate, dateFormat, true
+		case "time":
+			return dmcontext.TypeTime, timeFormat, true
+		case "":
+		default:
+			r.add(join(path, "format"), "%s is mapped to string", format)
+		}
+		return dmcontext.TypeString, "", true
+	case "":
+		r.add(join(path, "type"), "is required")
+	default:
+		r.add(join(path, "type"), "%s %s", typ, reasonNotSupported)
+	}
+	return "", "", false
+}
+
+// importWoTEnum imports the enum, whose values are listed by enum, or by oneOf with const and title
+func importWoTEnum(r *Report, path, typ string, o object, p *dmcontext.DeviceProperty) bool {
+	t, _, ok := importWoTPrimitive(r, path, typ, o)
+	if !ok {
+		return false
+	}
+	if !enumTypes[t] {
+		r.add(join(path, "type"), "%s is not supported by enum", typ)
+		return false
+	}
+	p.Type = dmcontext.TypeEnum
+	p.EnumType = dmcontext.EnumType{Type: t}
+	for i, v := range o.array(r, path, "enum") {
+		s, ok := enumValue(v)
+		if !ok {
+			r.add(fmt.Sprintf("%s.enum[%d]", path, i), "is not a %s", typ)
+			continue
+		}
+		p.EnumType.Values = append(p.EnumType.Values, dmcontext.EnumValue{Name: s, Value: s, DisplayName: s})
+	}
+	for i, v := range o.array(r, path, "oneOf") {
+		itemPath := fmt.Sprintf("%s.oneOf[%d]", path, i)
+		item, ok := v.(map[string]any)
+		if !ok {
+			r.add(itemPath, "is not an object")
+			continue
+		}
+		if !importWoTEnumValue(r, itemPath, item, p) {
+			r.add(itemPath, "is not a const of %s", typ)
+		}
+	}
+	return true
+}
+
+func importWoTEnumValue(r *Report, path string, o object, p *dmcontext.DeviceProperty) bool {
+	c, _ := o.take("const")
+	s, ok := enumValue(c)
+	if !ok {
+		return false
+	}
+	defer o.rest(r, path)
+	v := dmcontext.EnumValue{Name: s, Value: s, DisplayName: s}
+	if title := o.string(r, path, "title"); title != "" {
+		v.Name, v.DisplayName = title, title
+	}
+	if desc := o.string(r, path, "description"); desc != "" {
+		v.DisplayName = desc
+	}
+	p.EnumType.Values = append(p.EnumType.Values, v)
+	return true
+}
+
+func enumValue(v any) (string, bool) {
+	switch val := v.(type) {
+	case json.Number:
+		return val.String(), true
+	case string:
+		return val, true
+	}
+	return "", false
+}
+
+// ExportWoT exports the properties as a W3C WoT Thing Model titled by name. The visitors and values of properties
+// are not part of the model, which are not exported.
+func ExportWoT(name string, props []dmcontext.DeviceProperty) ([]byte, *Report, error) {
+	r := &Report{}
+	properties := map[string]any{}
+	for i, p := range props {
+		if p.ID == "" {
+			r.add(fmt.Sprintf("[%d].id", i), "is required")
+			continue
+		}
+		if s, ok := exportWoTProperty(r, p.ID, p); ok {
+			properties[p.ID] = s
+		}
+	}
+	doc := map[string]any{
+		"@context":   wotContext,
+		"@type":      wotThingModel,
+		"title":      name,
+		"properties": properties,
+	}
+	data, err := json.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return nil, nil, errors.Trace(err)
+	}
+	return data, r, nil
+}
+
+func exportWoTProperty(r *Report, path string, p dmcontext.DeviceProperty) (map[string]any, bool) {
+	var s map[string]any
+	switch p.Type {
+	case dmcontext.TypeEnum:
+		var ok bool
+		if s, ok = exportWoTPrimitive(r, join(path, "enumType.type"), p.EnumType.Type, ""); !ok {
+			return nil, false
+		}
+		if !enumTypes[p.EnumType.Type] {
+			r.add(join(path, "enumType.type"), "%s is not supported by enum", p.EnumType.Type)
+			return nil, false
+		}
+		var values []any
+		for i, v := range p.EnumType.Values {
+			c, err := dmcontext.ParseValue(p.EnumType.Type, v.Value, nil)
+			if err != nil {
+				r.add(fmt.Sprintf("%s.enumType.values[%d]", path, i), "%s is not a %s", v.Value, p.EnumType.Type)
+				continue
+			}
+			item := map[string]any{"const": c}
+			if v.Name != "" {
+				item["title"] = v.Name
+			}
+			if v.DisplayName != "" && v.DisplayName != v.Name {
+				item["description"] = v.DisplayName
+			}
+			values = append(values, item)
+		}
+		s["oneOf"] = values
+	case dmcontext.TypeArray:
+		items, ok := exportWoTPrimitive(r, join(path, "arrayType"), p.ArrayType.Type, p.ArrayType.Format)
+		if !ok {
+			return nil, false
+		}
+		s = map[string]any{"type": "array", "items": items}
+		if p.ArrayType.Min > 0 {
+			s["minItems"] = p.ArrayType.Min
+		}
+		if p.ArrayType.Max > 0 {
+			s["maxItems"] = p.ArrayType.Max
+		}
+	case dmcontext.TypeObject:
+		fields := map[string]any{}
+		for k, ot := range p.ObjectType {
+			f, ok := exportWoTPrimitive(r, join(path, "objectType."+k), ot.Type, ot.Format)
+			if !ok {
+				continue
+			}
+			if ot.DisplayName != "" {
+				f["title"] = ot.DisplayName
+			}
+			fields[k] = f
+		}
+		s = map[string]any{"type": "object", "properties": fields}
+		if len(p.ObjectRequired) > 0 {
+			s["required"] = p.ObjectRequired
+		}
+	default:
+		var ok bool
+		if s, ok = exportWoTPrimitive(r, path, p.Type, p.Format); !ok {
+			return nil, false
+		}
+	}
+	if p.Name != "" && p.Name != p.ID {
+		s["title"] = p.Name
+	}
+	if p.Unit != "" {
+		s["unit"] = p.Unit
+	}
+	if p.Mode == dmcontext.ModeReadOnlyProperty {
+		s["readOnly"] = true
+	}
+	return s, true
+}
+
+// exportWoTPrimitive returns the data schema of primitive type, see importWoTPrimitive
+func exportWoTPrimitive(r *Report, path, typ, format string) (map[string]any, bool) {
+	switch typ {
+	case dmcontext.TypeInt16:
+		return map[string]any{"type": "integer", "minimum": math.MinInt16, "maximum": math.MaxInt16}, true
+	case dmcontext.TypeInt32:
+		return map[string]any{"type": "integer", "minimum": math.MinInt32, "maximum": math.MaxInt32}, true
+	case dmcontext.TypeInt, dmcontext.TypeInt64:
+		return map[string]any{"type": "integer"}, true
+	case dmcontext.TypeFloat32:
+		return map[string]any{"type": "number", "format": wotFormatFloat}, true
+	case dmcontext.TypeFloat64:
+		return map[string]any{"type": "number"}, true
+	case dmcontext.TypeBool:
+		return map[string]any{"type": "boolean"}, true
+	case dmcontext.TypeString:
+		return map[string]any{"type": "string"}, true
+	case dmcontext.TypeDate, dmcontext.TypeTime:
+		def := dateFormat
+		if typ == dmcontext.TypeTime {
+			def = timeFormat
+		}
+		if format != "" && strings.ToLower(format) != def {
+			r.add(join(path, "format"), "%s is exported as %s", format, def)
+		}
+		return map[string]any{"type": "string", "format": typ}, true
+	case "":
+		r.add(join(path, "type"), "is required")
+	default:
+		r.add(join(path, "type"), "%s %s", typ, reasonNotSupported)
+	}
+	return nil, false
+}
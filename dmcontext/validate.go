@@ -0,0 +1,259 @@
+package dmcontext
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/spf13/cast"
+
+	"github.com/baetyl/baetyl-go/v2/errors"
+)
+
+// ValueSpec the constraints of a typed value, which is the definition of property, param or their elements
+type ValueSpec struct {
+	Type           string
+	Format         string
+	EnumType       EnumType
+	ArrayType      ArrayType
+	ObjectType     map[string]ObjectType
+	ObjectRequired []string
+}
+
+// Spec returns the constraints of the property value
+func (dp *DeviceProperty) Spec() ValueSpec {
+	return ValueSpec{
+		Type:           dp.Type,
+		Format:         dp.Format,
+		EnumType:       dp.EnumType,
+		ArrayType:      dp.ArrayType,
+		ObjectType:     dp.ObjectType,
+		ObjectRequired: dp.ObjectRequired,
+	}
+}
+
+// Spec returns the constraints of the param value
+func (p *ModelParam) Spec() ValueSpec {
+	return ValueSpec{
+		Type:           p.Type,
+		Format:         p.Format,
+		EnumType:       p.EnumType,
+		ArrayType:      p.ArrayType,
+		ObjectType:     p.ObjectType,
+		ObjectRequired: p.ObjectRequired,
+	}
+}
+
+// ValidateValue validates the value against the spec and converts it into its type, the path of the value is
+// reported by ValueError if invalid, such as temperature, points[2] or location.lat
+//   - the numeric and bool values are converted from json number, number and string
+//   - the enum value must be one of EnumType.Values, and is converted into EnumType.Type
+//   - the array value must respect ArrayType.Min and ArrayType.Max, whose elements are of ArrayType.Type
+//   - the object value only has the fields of ObjectType, and must have the fields of ObjectRequired
+//   - the time and date values must match Format, which is yyyy-mm-dd for date and hh:mm:ss for time by default
+func ValidateValue(path string, spec ValueSpec, v any) (any, error) {
+	if n, ok := v.(json.Number); ok && spec.Type != TypeString {
+		v = n.String()
+	}
+	switch spec.Type {
+	case TypeInt, TypeInt16, TypeInt32, TypeInt64:
+		return validateInt(path, spec.Type, v)
+	case TypeFloat32, TypeFloat64:
+		return validateFloat(path, spec.Type, v)
+	case TypeBool:
+		switch v.(type) {
+		case bool, string:
+			if b, err := cast.ToBoolE(v); err == nil {
+				return b, nil
+			}
+		}
+		return nil, errors.Trace(&ValueError{Path: path, Reason: "is not a bool"})
+	case TypeString:
+		if s, ok := v.(string); ok {
+			return s, nil
+		}
+		return nil, errors.Trace(&ValueError{Path: path, Reason: "is not a string"})
+	case TypeTime, TypeDate:
+		return validateTime(path, spec.Type, spec.Format, v)
+	case TypeEnum:
+		return validateEnum(path, spec.EnumType, v)
+	case TypeArray:
+		return validateArray(path, spec.ArrayType, v)
+	case TypeObject:
+		return validateObject(path, spec.ObjectType, spec.ObjectRequired, v)
+	}
+	return nil, errors.Trace(&ValueError{Path: path, Reason: "type " + spec.Type + " is not supported"})
+}
+
+var intRanges = map[string][2]int64{
+	TypeInt:   {math.MinInt, math.MaxInt},
+	TypeInt16: {math.MinInt16, math.MaxInt16},
+	TypeInt32: {math.MinInt32, math.MaxInt32},
+	TypeInt64: {math.MinInt64, math.MaxInt64},
+}
+
+func validateInt(path, typ string, v any) (any, error) {
+	var i int64
+	switch n := v.(type) {
+	case string:
+		// only decimal is allowed, such as the json number
+		var err error
+		if i, err = strconv.ParseInt(n, 10, 64); err != nil {
+			return nil, errors.Trace(&ValueError{Path: path, Reason: "is not an integer"})
+		}
+	case float32, float64:
+		// the fraction is not truncated, and the float out of int64 is not wrapped
+		f := cast.ToFloat64(n)
+		if f != math.Trunc(f) || math.IsInf(f, 0) {
+			return nil, errors.Trace(&ValueError{Path: path, Reason: "is not an integer"})
+		}
+		if f < math.MinInt64 || f >= math.MaxInt64 {
+			return nil, errors.Trace(&ValueError{Path: path, Reason: fmt.Sprintf("%v is out of range of %s", f, typ)})
+		}
+		i = int64(f)
+	case int, int8, int16, int32, int64, uint8, uint16, uint32:
+		i = cast.ToInt64(n)
+	case uint, uint64:
+		u := reflect.ValueOf(n).Uint()
+		if u > math.MaxInt64 {
+			return nil, errors.Trace(&ValueError{Path: path, Reason: fmt.Sprintf("%d is out of range of %s", u, typ)})
+		}
+		i = int64(u)
+	default:
+		return nil, errors.Trace(&ValueError{Path: path, Reason: "is not an integer"})
+	}
+	if r := intRanges[typ]; i < r[0] || i > r[1] {
+		return nil, errors.Trace(&ValueError{Path: path, Reason: fmt.Sprintf("%d is out of range of %s", i, typ)})
+	}
+	switch typ {
+	case TypeInt:
+		return int(i), nil
+	case TypeInt16:
+		return int16(i), nil
+	case TypeInt32:
+		return int32(i), nil
+	}
+	return i, nil
+}
+
+func validateFloat(path, typ string, v any) (any, error) {
+	var f float64
+	switch n := v.(type) {
+	case string:
+		var err error
+		if f, err = strconv.ParseFloat(n, 64); err != nil {
+			return nil, errors.Trace(&ValueError{Path: path, Reason: "is not a number"})
+		}
+	case float32, float64, int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64:
+		f = cast.ToFloat64(n)
+	default:
+		return nil, errors.Trace(&ValueError{Path: path, Reason: "is not a number"})
+	}
+	if math.IsNaN(f) || math.IsInf(f, 0) {
+		return nil, errors.Trace(&ValueError{Path: path, Reason: "is not a finite number"})
+	}
+	if typ == TypeFloat32 {
+		if math.Abs(f) > math.MaxFloat32 {
+			return nil, errors.Trace(&ValueError{Path: path, Reason: fmt.Sprintf("%v is out of range of %s", f, typ)})
+		}
+		return float32(f), nil
+	}
+	return f, nil
+}
+
+func validateTime(path, typ, format string, v any) (any, error) {
+	if format == "" {
+		format = "hh:mm:ss"
+		if typ == TypeDate {
+			format = "yyyy-mm-dd"
+		}
+	}
+	layout, ok := timeFormats[strings.ToLower(format)]
+	if !ok {
+		return nil, errors.Trace(&ValueError{Path: path, Reason: "format " + format + " is not supported"})
+	}
+	switch t := v.(type) {
+	case time.Time:
+		return t.Format(layout), nil
+	case string:
+		if _, err := time.ParseInLocation(layout, t, time.Local); err == nil {
+			return t, nil
+		}
+	}
+	return nil, errors.Trace(&ValueError{Path: path, Reason: "does not match the format " + format})
+}
+
+func validateEnum(path string, enum EnumType, v any) (any, error) {
+	val, err := ValidateValue(path, ValueSpec{Type: enum.Type}, v)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	values := make([]string, 0, len(enum.Values))
+	for _, ev := range enum.Values {
+		if cast.ToString(val) == ev.Value {
+			return val, nil
+		}
+		values = append(values, ev.Value)
+	}
+	return nil, errors.Trace(&ValueError{Path: path, Reason: fmt.Sprintf("is not one of [%s]", strings.Join(values, " "))})
+}
+
+func validateArray(path string, arr ArrayType, v any) (any, error) {
+	rv := reflect.ValueOf(v)
+	if v == nil || rv.Kind() != reflect.Slice && rv.Kind() != reflect.Array {
+		return nil, errors.Trace(&ValueError{Path: path, Reason: "is not an array"})
+	}
+	// the max length is not limited if it is not set
+	if rv.Len() < arr.Min || arr.Max > 0 && rv.Len() > arr.Max {
+		return nil, errors.Trace(&ValueError{Path: path, Reason: fmt.Sprintf("length %d is out of range [%d, %d]", rv.Len(), arr.Min, arr.Max)})
+	}
+	spec := ValueSpec{Type: arr.Type, Format: arr.Format}
+	res := make([]any, 0, rv.Len())
+	for i := 0; i < rv.Len(); i++ {
+		e, err := ValidateValue(fmt.Sprintf("%s[%d]", path, i), spec, rv.Index(i).Interface())
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+		res = append(res, e)
+	}
+	return res, nil
+}
+
+func validateObject(path string, fields map[string]ObjectType, required []string, v any) (any, error) {
+	obj, ok := v.(map[string]any)
+	if !ok {
+		return nil, errors.Trace(&ValueError{Path: path, Reason: "is not an object"})
+	}
+	for _, k := range required {
+		if obj[k] == nil {
+			return nil, errors.Trace(&ValueError{Path: path + "." + k, Reason: "is required"})
+		}
+	}
+	keys := make([]string, 0, len(obj))
+	for k := range obj {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	res := make(map[string]any, len(obj))
+	for _, k := range keys {
+		fv := obj[k]
+		field, ok := fields[k]
+		if !ok {
+			return nil, errors.Trace(&ValueError{Path: path + "." + k, Reason: "is not defined"})
+		}
+		if fv == nil {
+			continue
+		}
+		val, err := ValidateValue(path+"."+k, ValueSpec{Type: field.Type, Format: field.Format}, fv)
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+		res[k] = val
+	}
+	return res, nil
+}
@@ -0,0 +1,86 @@
+package dmcontext
+
+import (
+	"encoding/json"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/baetyl/baetyl-go/v2/errors"
+)
+
+func TestValidateValue(t *testing.T) {
+	enum := EnumType{Type: TypeInt32, Values: []EnumValue{{Name: "off", Value: "0"}, {Name: "on", Value: "1"}}}
+	arr := ArrayType{Type: TypeFloat32, Min: 1, Max: 3}
+	obj := map[string]ObjectType{
+		"lat":  {Type: TypeFloat64},
+		"name": {Type: TypeString},
+		"at":   {Type: TypeDate, Format: "yyyy/mm/dd"},
+	}
+	tests := []struct {
+		name string
+		spec ValueSpec
+		v    any
+		want any
+		err  string
+	}{
+		{name: "int16", spec: ValueSpec{Type: TypeInt16}, v: json.Number("12"), want: int16(12)},
+		{name: "int16 range", spec: ValueSpec{Type: TypeInt16}, v: json.Number("40000"), err: "invalid value of p: 40000 is out of range of int16"},
+		{name: "int32 fraction", spec: ValueSpec{Type: TypeInt32}, v: 1.5, err: "invalid value of p: is not an integer"},
+		{name: "int64 float", spec: ValueSpec{Type: TypeInt64}, v: float64(3), want: int64(3)},
+		{name: "int bool", spec: ValueSpec{Type: TypeInt}, v: true, err: "invalid value of p: is not an integer"},
+		{name: "int decimal", spec: ValueSpec{Type: TypeInt32}, v: "010", want: int32(10)},
+		{name: "int hex", spec: ValueSpec{Type: TypeInt32}, v: "0x10", err: "invalid value of p: is not an integer"},
+		{name: "int64 float range", spec: ValueSpec{Type: TypeInt64}, v: 1e19, err: "invalid value of p: 1e+19 is out of range of int64"},
+		{name: "int64 uint range", spec: ValueSpec{Type: TypeInt64}, v: uint64(math.MaxUint64), err: "invalid value of p: 18446744073709551615 is out of range of int64"},
+		{name: "int inf", spec: ValueSpec{Type: TypeInt}, v: math.Inf(1), err: "invalid value of p: is not an integer"},
+		{name: "float32", spec: ValueSpec{Type: TypeFloat32}, v: json.Number("1.5"), want: float32(1.5)},
+		{name: "float64 string", spec: ValueSpec{Type: TypeFloat64}, v: "x", err: "invalid value of p: is not a number"},
+		{name: "float64 nan", spec: ValueSpec{Type: TypeFloat64}, v: math.NaN(), err: "invalid value of p: is not a finite number"},
+		{name: "float64 inf", spec: ValueSpec{Type: TypeFloat64}, v: "-Inf", err: "invalid value of p: is not a finite number"},
+		{name: "float32 range", spec: ValueSpec{Type: TypeFloat32}, v: 1e39, err: "invalid value of p: 1e+39 is out of range of float32"},
+		{name: "bool", spec: ValueSpec{Type: TypeBool}, v: "true", want: true},
+		{name: "bool number", spec: ValueSpec{Type: TypeBool}, v: 1, err: "invalid value of p: is not a bool"},
+		{name: "string", spec: ValueSpec{Type: TypeString}, v: "a", want: "a"},
+		{name: "string number", spec: ValueSpec{Type: TypeString}, v: json.Number("1"), err: "invalid value of p: is not a string"},
+		{name: "date default", spec: ValueSpec{Type: TypeDate}, v: "2022-01-31", want: "2022-01-31"},
+		{name: "date format", spec: ValueSpec{Type: TypeDate, Format: "mm-dd-yyyy"}, v: "2022-01-31", err: "invalid value of p: does not match the format mm-dd-yyyy"},
+		{name: "date time", spec: ValueSpec{Type: TypeDate, Format: "yyyy.mm.dd"}, v: time.Date(2022, 1, 31, 0, 0, 0, 0, time.Local), want: "2022.01.31"},
+		{name: "time", spec: ValueSpec{Type: TypeTime, Format: "hh:mm:ss"}, v: "12:30:00", want: "12:30:00"},
+		{name: "time invalid", spec: ValueSpec{Type: TypeTime}, v: "25:00:00", err: "invalid value of p: does not match the format hh:mm:ss"},
+		{name: "time format", spec: ValueSpec{Type: TypeTime, Format: "x"}, v: "12:30:00", err: "invalid value of p: format x is not supported"},
+		{name: "enum", spec: ValueSpec{Type: TypeEnum, EnumType: enum}, v: json.Number("1"), want: int32(1)},
+		{name: "enum value", spec: ValueSpec{Type: TypeEnum, EnumType: enum}, v: json.Number("2"), err: "invalid value of p: is not one of [0 1]"},
+		{name: "enum type", spec: ValueSpec{Type: TypeEnum, EnumType: enum}, v: "on", err: "invalid value of p: is not an integer"},
+		{name: "array", spec: ValueSpec{Type: TypeArray, ArrayType: arr}, v: []any{json.Number("1"), 2.5}, want: []any{float32(1), float32(2.5)}},
+		{name: "array slice", spec: ValueSpec{Type: TypeArray, ArrayType: arr}, v: []float64{1}, want: []any{float32(1)}},
+		{name: "array element", spec: ValueSpec{Type: TypeArray, ArrayType: arr}, v: []any{1, "x"}, err: "invalid value of p[1]: is not a number"},
+		{name: "array min", spec: ValueSpec{Type: TypeArray, ArrayType: arr}, v: []any{}, err: "invalid value of p: length 0 is out of range [1, 3]"},
+		{name: "array max", spec: ValueSpec{Type: TypeArray, ArrayType: arr}, v: []any{1, 2, 3, 4}, err: "invalid value of p: length 4 is out of range [1, 3]"},
+		{name: "array type", spec: ValueSpec{Type: TypeArray, ArrayType: arr}, v: "x", err: "invalid value of p: is not an array"},
+		{
+			name: "object",
+			spec: ValueSpec{Type: TypeObject, ObjectType: obj, ObjectRequired: []string{"lat"}},
+			v:    map[string]any{"lat": json.Number("39.9"), "at": "2022/01/31"},
+			want: map[string]any{"lat": 39.9, "at": "2022/01/31"},
+		},
+		{name: "object required", spec: ValueSpec{Type: TypeObject, ObjectType: obj, ObjectRequired: []string{"lat"}}, v: map[string]any{"name": "a"}, err: "invalid value of p.lat: is required"},
+		{name: "object field", spec: ValueSpec{Type: TypeObject, ObjectType: obj}, v: map[string]any{"name": 1}, err: "invalid value of p.name: is not a string"},
+		{name: "object undefined", spec: ValueSpec{Type: TypeObject, ObjectType: obj}, v: map[string]any{"lng": 1}, err: "invalid value of p.lng: is not defined"},
+		{name: "object type", spec: ValueSpec{Type: TypeObject, ObjectType: obj}, v: []any{}, err: "invalid value of p: is not an object"},
+		{name: "type", spec: ValueSpec{Type: "xx"}, v: 1, err: "invalid value of p: type xx is not supported"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ValidateValue("p", tt.spec, tt.v)
+			if tt.err != "" {
+				assert.EqualError(t, errors.Cause(err), tt.err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
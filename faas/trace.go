@@ -0,0 +1,26 @@
+package faas
+
+import (
+	"context"
+
+	"github.com/baetyl/baetyl-go/v2/trace"
+)
+
+// InjectTrace writes the trace context carried by ctx into the metadata of message
+func InjectTrace(ctx context.Context, msg *Message) {
+	if !trace.SpanContextFromContext(ctx).IsValid() {
+		return
+	}
+	if msg.Metadata == nil {
+		msg.Metadata = map[string]string{}
+	}
+	trace.Inject(ctx, trace.MapCarrier(msg.Metadata))
+}
+
+// ExtractTrace reads the trace context from the metadata of message, returns a copy of ctx carrying it
+func ExtractTrace(ctx context.Context, msg *Message) context.Context {
+	if msg.Metadata == nil {
+		return ctx
+	}
+	return trace.Extract(ctx, trace.MapCarrier(msg.Metadata))
+}
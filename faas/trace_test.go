@@ -0,0 +1,27 @@
+package faas
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/baetyl/baetyl-go/v2/trace"
+)
+
+func TestTrace(t *testing.T) {
+	msg := &Message{}
+	InjectTrace(context.Background(), msg)
+	assert.Nil(t, msg.Metadata)
+	assert.Equal(t, context.Background(), ExtractTrace(context.Background(), msg))
+
+	ctx, span := trace.Start(context.Background(), "invoke", trace.KindClient)
+	defer span.End()
+	InjectTrace(ctx, msg)
+	assert.Equal(t, span.SpanContext().TraceParent(), msg.Metadata[trace.KeyTraceParent])
+
+	sc := trace.SpanContextFromContext(ExtractTrace(context.Background(), msg))
+	assert.True(t, sc.Remote)
+	assert.Equal(t, span.SpanContext().TraceID, sc.TraceID)
+	assert.Equal(t, span.SpanContext().SpanID, sc.SpanID)
+}
@@ -2,11 +2,13 @@ package http
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"net"
 	gohttp "net/http"
+	"strconv"
 	"strings"
 	"time"
 
@@ -15,6 +17,7 @@ import (
 
 	"github.com/baetyl/baetyl-go/v2/errors"
 	"github.com/baetyl/baetyl-go/v2/log"
+	"github.com/baetyl/baetyl-go/v2/trace"
 )
 
 var jsonHeaders = map[string]string{"Content-Type": "application/json"}
@@ -135,10 +138,29 @@ func (c *Client) PutURL(url string, body io.Reader, header ...map[string]string)
 }
 
 func (c *Client) SendUrl(method, url string, body io.Reader, header ...map[string]string) (*gohttp.Response, error) {
+	return c.SendUrlWithContext(context.Background(), method, url, body, header...)
+}
+
+// SendUrlWithContext sends the request with context. If ctx carries a span,
+// a client span is started and its trace context is injected into the request headers.
+func (c *Client) SendUrlWithContext(ctx context.Context, method, url string, body io.Reader, header ...map[string]string) (*gohttp.Response, error) {
+	return c.send(ctx, c.http, method, url, body, header...)
+}
+
+// StreamUrlWithContext sends the request as SendUrlWithContext does, except that the timeout of client,
+// which limits the time to read the whole response body as well, is not applied. It is used to download
+// large files, whose deadline is controlled by ctx.
+func (c *Client) StreamUrlWithContext(ctx context.Context, method, url string, body io.Reader, header ...map[string]string) (*gohttp.Response, error) {
+	cli := *c.http
+	cli.Timeout = 0
+	return c.send(ctx, &cli, method, url, body, header...)
+}
+
+func (c *Client) send(ctx context.Context, cli *gohttp.Client, method, url string, body io.Reader, header ...map[string]string) (*gohttp.Response, error) {
 	if !strings.HasPrefix(url, "http") {
 		url = fmt.Sprintf("%s/%s", c.ops.Address, url)
 	}
-	req, err := gohttp.NewRequest(method, url, body)
+	req, err := gohttp.NewRequestWithContext(ctx, method, url, body)
 	if err != nil {
 		return nil, err
 	}
@@ -147,7 +169,31 @@ func (c *Client) SendUrl(method, url string, body io.Reader, header ...map[strin
 			req.Header.Set(kk, vv)
 		}
 	}
-	r, err := c.http.Do(req)
+	var span *trace.Span
+	if trace.SpanContextFromContext(ctx).IsValid() {
+		ctx, span = trace.Start(ctx, "HTTP "+method, trace.KindClient)
+		defer span.End()
+		span.SetAttribute("http.method", method)
+		span.SetAttribute("http.url", url)
+		trace.Inject(ctx, trace.HeaderCarrier(req.Header))
+	}
+	start := time.Now()
+	r, err := cli.Do(req)
+	code := "error"
+	if err == nil {
+		code = strconv.Itoa(r.StatusCode)
+	}
+	metricRequestDuration.Since(start, method, code)
+	if span != nil {
+		if err != nil {
+			span.SetError(err)
+		} else {
+			span.SetAttribute("http.status_code", r.StatusCode)
+			if r.StatusCode >= gohttp.StatusBadRequest {
+				span.SetStatus(trace.StatusError, r.Status)
+			}
+		}
+	}
 	return r, errors.Trace(err)
 }
 
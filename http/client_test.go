@@ -2,12 +2,18 @@ package http
 
 import (
 	"bytes"
+	"context"
+	gohttp "net/http"
+	"net/http/httptest"
 	"testing"
 	"time"
 
+	routing "github.com/qiangxue/fasthttp-routing"
 	"github.com/stretchr/testify/assert"
+	"github.com/valyala/fasthttp"
 
 	"github.com/baetyl/baetyl-go/v2/mock"
+	"github.com/baetyl/baetyl-go/v2/trace"
 	"github.com/baetyl/baetyl-go/v2/utils"
 )
 
@@ -91,6 +97,7 @@ func TestSendURL(t *testing.T) {
 		"a": "b",
 	}
 
+	puts, _ := metricRequestDuration.Count("PUT", "200")
 	cli := NewClient(NewClientOptions())
 	res, err := cli.GetURL(ms.URL, header)
 	assert.NoError(t, err)
@@ -115,6 +122,8 @@ func TestSendURL(t *testing.T) {
 	data, err = HandleResponse(res)
 	assert.NoError(t, err)
 	assert.Equal(t, []byte("Put"), data)
+	count, _ := metricRequestDuration.Count("PUT", "200")
+	assert.Equal(t, puts+1, count)
 
 	res, err = cli.DeleteURL(ms.URL, header)
 	assert.NoError(t, err)
@@ -122,3 +131,41 @@ func TestSendURL(t *testing.T) {
 	assert.NoError(t, err)
 	assert.Equal(t, []byte("Delete"), data)
 }
+
+func TestSendURLWithTrace(t *testing.T) {
+	var traceparent string
+	ts := httptest.NewServer(gohttp.HandlerFunc(func(w gohttp.ResponseWriter, r *gohttp.Request) {
+		traceparent = r.Header.Get(trace.KeyTraceParent)
+	}))
+	defer ts.Close()
+
+	cli := NewClient(NewClientOptions())
+	_, err := cli.GetURL(ts.URL)
+	assert.NoError(t, err)
+	assert.Empty(t, traceparent)
+
+	ctx, span := trace.Start(context.Background(), "parent", trace.KindInternal)
+	defer span.End()
+	res, err := cli.SendUrlWithContext(ctx, "GET", ts.URL, nil)
+	assert.NoError(t, err)
+	res.Body.Close()
+	sc, err := trace.ParseTraceParent(traceparent)
+	assert.NoError(t, err)
+	assert.Equal(t, span.SpanContext().TraceID, sc.TraceID)
+	assert.NotEqual(t, span.SpanContext().SpanID, sc.SpanID)
+}
+
+func TestExtractTrace(t *testing.T) {
+	var c routing.Context
+	c.RequestCtx = &fasthttp.RequestCtx{}
+	c.Request.Header.SetMethod("POST")
+	c.Request.SetRequestURI("/v1/echo")
+	c.Request.Header.Set(trace.KeyTraceParent, "00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01")
+
+	ctx, span := ExtractTrace(&c)
+	defer span.End()
+	sc := trace.SpanContextFromContext(ctx)
+	assert.Equal(t, "0af7651916cd43dd8448eb211c80319c", sc.TraceID.String())
+	assert.Equal(t, span.SpanContext(), sc)
+	assert.False(t, sc.Remote)
+}
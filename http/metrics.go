@@ -0,0 +1,9 @@
+package http
+
+import (
+	"github.com/baetyl/baetyl-go/v2/metrics"
+)
+
+var (
+	metricRequestDuration = metrics.DefaultRegistry.NewHistogram("baetyl_http_client_request_duration_seconds", "The duration of requests sent by http clients, the code is 'error' if no response is received.", nil, "method", "code")
+)
@@ -0,0 +1,32 @@
+package http
+
+import (
+	"context"
+
+	routing "github.com/qiangxue/fasthttp-routing"
+	"github.com/valyala/fasthttp"
+
+	"github.com/baetyl/baetyl-go/v2/trace"
+)
+
+// ExtractTrace extracts the trace context from the request headers, and starts a server span as its child.
+// The caller should end the span after the request is handled.
+func ExtractTrace(c *routing.Context) (context.Context, *trace.Span) {
+	ctx := trace.Extract(context.Background(), requestHeaderCarrier{&c.Request.Header})
+	ctx, span := trace.Start(ctx, string(c.Method())+" "+string(c.Path()), trace.KindServer)
+	span.SetAttribute("http.method", string(c.Method()))
+	span.SetAttribute("http.target", string(c.RequestURI()))
+	return ctx, span
+}
+
+type requestHeaderCarrier struct {
+	h *fasthttp.RequestHeader
+}
+
+func (r requestHeaderCarrier) Get(key string) string {
+	return string(r.h.Peek(key))
+}
+
+func (r requestHeaderCarrier) Set(key, value string) {
+	r.h.Set(key, value)
+}
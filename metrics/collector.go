@@ -0,0 +1,123 @@
+package metrics
+
+import (
+	"sort"
+	"sync/atomic"
+	"time"
+)
+
+// Counter the metric which only increases.
+// Values of labels are passed in the order of label names, the sample is dropped if the number does not match.
+type Counter struct {
+	f *family
+}
+
+// Inc increases the counter by 1
+func (c *Counter) Inc(values ...string) {
+	c.Add(1, values...)
+}
+
+// Add increases the counter by delta, negative delta is ignored
+func (c *Counter) Add(delta float64, values ...string) {
+	if delta < 0 {
+		return
+	}
+	if s := c.f.get(values); s != nil {
+		addFloat(&s.bits, delta)
+	}
+}
+
+// Value returns the value of the counter
+func (c *Counter) Value(values ...string) float64 {
+	if s := c.f.find(values); s != nil {
+		return loadFloat(&s.bits)
+	}
+	return 0
+}
+
+// Delete removes the series of label values
+func (c *Counter) Delete(values ...string) bool {
+	return c.f.delete(values)
+}
+
+// Gauge the metric which can go up and down
+type Gauge struct {
+	f *family
+}
+
+// Set sets the gauge
+func (g *Gauge) Set(v float64, values ...string) {
+	if s := g.f.get(values); s != nil {
+		storeFloat(&s.bits, v)
+	}
+}
+
+// Add adds delta to the gauge, delta can be negative
+func (g *Gauge) Add(delta float64, values ...string) {
+	if s := g.f.get(values); s != nil {
+		addFloat(&s.bits, delta)
+	}
+}
+
+// Inc increases the gauge by 1
+func (g *Gauge) Inc(values ...string) {
+	g.Add(1, values...)
+}
+
+// Dec decreases the gauge by 1
+func (g *Gauge) Dec(values ...string) {
+	g.Add(-1, values...)
+}
+
+// Value returns the value of the gauge
+func (g *Gauge) Value(values ...string) float64 {
+	if s := g.f.find(values); s != nil {
+		return loadFloat(&s.bits)
+	}
+	return 0
+}
+
+// Delete removes the series of label values
+func (g *Gauge) Delete(values ...string) bool {
+	return g.f.delete(values)
+}
+
+// Histogram the metric which samples observations in buckets
+type Histogram struct {
+	f *family
+}
+
+// Observe adds an observation
+func (h *Histogram) Observe(v float64, values ...string) {
+	s := h.f.get(values)
+	if s == nil {
+		return
+	}
+	// the index of the first bucket whose upper bound is not less than v, or the +Inf bucket
+	i := sort.SearchFloat64s(h.f.buckets, v)
+	atomic.AddUint64(&s.counts[i], 1)
+	addFloat(&s.bits, v)
+}
+
+// Since observes the seconds elapsed since start
+func (h *Histogram) Since(start time.Time, values ...string) {
+	h.Observe(time.Since(start).Seconds(), values...)
+}
+
+// Count returns the count and sum of observations
+func (h *Histogram) Count(values ...string) (uint64, float64) {
+	s := h.f.find(values)
+	if s == nil {
+		return 0, 0
+	}
+	var count uint64
+	for i := range s.counts {
+		count += atomic.LoadUint64(&s.counts[i])
+	}
+	return count, loadFloat(&s.bits)
+}
+
+// Delete removes the series of label values
+func (h *Histogram) Delete(values ...string) bool {
+	return h.f.delete(values)
+}
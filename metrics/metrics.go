@@ -0,0 +1,327 @@
+package metrics
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/valyala/fasthttp"
+)
+
+// ContentType the content type of text exposition format
+const ContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// All metric types
+const (
+	TypeCounter   = "counter"
+	TypeGauge     = "gauge"
+	TypeHistogram = "histogram"
+)
+
+const labelSeparator = "\xff"
+
+// DefBuckets the default buckets of histogram, in seconds
+var DefBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// DefaultRegistry the registry used by the instrumented subsystems of the library
+var DefaultRegistry = NewRegistry()
+
+var nameRegexp = regexp.MustCompile(`^[a-zA-Z_:][a-zA-Z0-9_:]*$`)
+
+// Registry the registry of metrics, which can be written in the text exposition format of Prometheus
+type Registry struct {
+	families map[string]*family
+	mut      sync.RWMutex
+}
+
+// NewRegistry creates a new registry
+func NewRegistry() *Registry {
+	return &Registry{families: map[string]*family{}}
+}
+
+// NewCounter registers a counter, or returns the registered one with the same definition.
+// It panics if the name is invalid or has been registered with another definition.
+func (r *Registry) NewCounter(name, help string, labels ...string) *Counter {
+	return &Counter{r.register(name, help, TypeCounter, labels, nil)}
+}
+
+// NewGauge registers a gauge, or returns the registered one with the same definition.
+// It panics if the name is invalid or has been registered with another definition.
+func (r *Registry) NewGauge(name, help string, labels ...string) *Gauge {
+	return &Gauge{r.register(name, help, TypeGauge, labels, nil)}
+}
+
+// NewHistogram registers a histogram, or returns the registered one with the same definition.
+// DefBuckets is used if buckets is empty. It panics if the name is invalid or has been registered with another definition.
+func (r *Registry) NewHistogram(name, help string, buckets []float64, labels ...string) *Histogram {
+	if len(buckets) == 0 {
+		buckets = DefBuckets
+	}
+	bs := make([]float64, len(buckets))
+	copy(bs, buckets)
+	sort.Float64s(bs)
+	return &Histogram{r.register(name, help, TypeHistogram, labels, bs)}
+}
+
+func (r *Registry) register(name, help, typ string, labels []string, buckets []float64) *family {
+	if !nameRegexp.MatchString(name) {
+		panic(fmt.Sprintf("metrics: invalid metric name (%s)", name))
+	}
+	for _, l := range labels {
+		if !nameRegexp.MatchString(l) || strings.HasPrefix(l, "__") || (typ == TypeHistogram && l == "le") {
+			panic(fmt.Sprintf("metrics: invalid label name (%s) of metric (%s)", l, name))
+		}
+	}
+
+	r.mut.Lock()
+	defer r.mut.Unlock()
+	if f, ok := r.families[name]; ok {
+		if f.typ != typ || !equalStrings(f.labels, labels) || !equalFloats(f.buckets, buckets) {
+			panic(fmt.Sprintf("metrics: metric (%s) has been registered with another definition", name))
+		}
+		return f
+	}
+	f := &family{
+		name:    name,
+		help:    help,
+		typ:     typ,
+		labels:  append([]string{}, labels...),
+		buckets: buckets,
+		series:  map[string]*series{},
+	}
+	r.families[name] = f
+	return f
+}
+
+// Unregister removes the metric, returns false if it is not registered
+func (r *Registry) Unregister(name string) bool {
+	r.mut.Lock()
+	defer r.mut.Unlock()
+	_, ok := r.families[name]
+	delete(r.families, name)
+	return ok
+}
+
+// Write writes all metrics in the text exposition format, sorted by names and label values
+func (r *Registry) Write(w io.Writer) error {
+	r.mut.RLock()
+	fs := make([]*family, 0, len(r.families))
+	for _, f := range r.families {
+		fs = append(fs, f)
+	}
+	r.mut.RUnlock()
+	sort.Slice(fs, func(i, j int) bool {
+		return fs[i].name < fs[j].name
+	})
+
+	bw := bufio.NewWriter(w)
+	for _, f := range fs {
+		f.write(bw)
+	}
+	return bw.Flush()
+}
+
+// Handler returns the http handler which responds metrics in the text exposition format
+func (r *Registry) Handler() fasthttp.RequestHandler {
+	return func(ctx *fasthttp.RequestCtx) {
+		var buf bytes.Buffer
+		if err := r.Write(&buf); err != nil {
+			ctx.Error(err.Error(), fasthttp.StatusInternalServerError)
+			return
+		}
+		ctx.SetContentType(ContentType)
+		ctx.SetBody(buf.Bytes())
+	}
+}
+
+type family struct {
+	name    string
+	help    string
+	typ     string
+	labels  []string
+	buckets []float64
+	series  map[string]*series
+	mut     sync.RWMutex
+}
+
+type series struct {
+	values []string
+	// the bits of float64 value for counter and gauge, or the sum for histogram
+	bits uint64
+	// the count of observations in each bucket for histogram, the last one is +Inf
+	counts []uint64
+}
+
+// find returns the series of label values without creating it
+func (f *family) find(values []string) *series {
+	f.mut.RLock()
+	defer f.mut.RUnlock()
+	return f.series[strings.Join(values, labelSeparator)]
+}
+
+// get returns the series of label values, nil if the number of values does not match labels
+func (f *family) get(values []string) *series {
+	if len(values) != len(f.labels) {
+		return nil
+	}
+	key := strings.Join(values, labelSeparator)
+	f.mut.RLock()
+	s, ok := f.series[key]
+	f.mut.RUnlock()
+	if ok {
+		return s
+	}
+
+	f.mut.Lock()
+	defer f.mut.Unlock()
+	if s, ok = f.series[key]; ok {
+		return s
+	}
+	s = &series{values: append([]string{}, values...)}
+	if f.typ == TypeHistogram {
+		s.counts = make([]uint64, len(f.buckets)+1)
+	}
+	f.series[key] = s
+	return s
+}
+
+func (f *family) delete(values []string) bool {
+	key := strings.Join(values, labelSeparator)
+	f.mut.Lock()
+	defer f.mut.Unlock()
+	_, ok := f.series[key]
+	delete(f.series, key)
+	return ok
+}
+
+func (f *family) write(w *bufio.Writer) {
+	f.mut.RLock()
+	keys := make([]string, 0, len(f.series))
+	for k := range f.series {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	ss := make([]*series, 0, len(keys))
+	for _, k := range keys {
+		ss = append(ss, f.series[k])
+	}
+	f.mut.RUnlock()
+
+	if f.help != "" {
+		fmt.Fprintf(w, "# HELP %s %s\n", f.name, escapeHelp(f.help))
+	}
+	fmt.Fprintf(w, "# TYPE %s %s\n", f.name, f.typ)
+	for _, s := range ss {
+		if f.typ != TypeHistogram {
+			writeSample(w, f.name, f.labels, s.values, "", "", loadFloat(&s.bits))
+			continue
+		}
+		var cum uint64
+		for i, b := range f.buckets {
+			cum += atomic.LoadUint64(&s.counts[i])
+			writeSample(w, f.name+"_bucket", f.labels, s.values, "le", formatFloat(b), float64(cum))
+		}
+		cum += atomic.LoadUint64(&s.counts[len(f.buckets)])
+		writeSample(w, f.name+"_bucket", f.labels, s.values, "le", "+Inf", float64(cum))
+		writeSample(w, f.name+"_sum", f.labels, s.values, "", "", loadFloat(&s.bits))
+		writeSample(w, f.name+"_count", f.labels, s.values, "", "", float64(cum))
+	}
+}
+
+func writeSample(w *bufio.Writer, name string, labels, values []string, extraLabel, extraValue string, v float64) {
+	w.WriteString(name)
+	if len(labels) > 0 || extraLabel != "" {
+		w.WriteByte('{')
+		for i, l := range labels {
+			if i > 0 {
+				w.WriteByte(',')
+			}
+			fmt.Fprintf(w, `%s="%s"`, l, escapeLabel(values[i]))
+		}
+		if extraLabel != "" {
+			if len(labels) > 0 {
+				w.WriteByte(',')
+			}
+			fmt.Fprintf(w, `%s="%s"`, extraLabel, extraValue)
+		}
+		w.WriteByte('}')
+	}
+	w.WriteByte(' ')
+	w.WriteString(formatFloat(v))
+	w.WriteByte('\n')
+}
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	default:
+		return strconv.FormatFloat(v, 'g', -1, 64)
+	}
+}
+
+var (
+	helpReplacer  = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+	labelReplacer = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+)
+
+func escapeHelp(s string) string {
+	return helpReplacer.Replace(s)
+}
+
+func escapeLabel(s string) string {
+	return labelReplacer.Replace(s)
+}
+
+func loadFloat(bits *uint64) float64 {
+	return math.Float64frombits(atomic.LoadUint64(bits))
+}
+
+func storeFloat(bits *uint64, v float64) {
+	atomic.StoreUint64(bits, math.Float64bits(v))
+}
+
+func addFloat(bits *uint64, delta float64) {
+	for {
+		old := atomic.LoadUint64(bits)
+		if atomic.CompareAndSwapUint64(bits, old, math.Float64bits(math.Float64frombits(old)+delta)) {
+			return
+		}
+	}
+}
+
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func equalFloats(a, b []float64) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,109 @@
+package metrics
+
+import (
+	"bytes"
+	"math"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/valyala/fasthttp"
+)
+
+func TestRegistry(t *testing.T) {
+	r := NewRegistry()
+	c := r.NewCounter("requests_total", "The total number of requests.", "method", "code")
+	g := r.NewGauge("queue_depth", "")
+	h := r.NewHistogram("latency_seconds", "Latency\nof requests.", []float64{1, 0.1, 0.5})
+
+	c.Inc("GET", "200")
+	c.Add(2, "GET", "200")
+	c.Add(-1, "GET", "200")
+	c.Inc("POST", "a\"b\\c\nd")
+	// dropped since labels mismatch
+	c.Inc("GET")
+	assert.Equal(t, float64(3), c.Value("GET", "200"))
+	assert.Equal(t, float64(0), c.Value("PUT", "200"))
+
+	g.Inc()
+	g.Add(2.5)
+	g.Dec()
+	assert.Equal(t, 2.5, g.Value())
+
+	h.Observe(0.05)
+	h.Observe(0.5)
+	h.Observe(2)
+	count, sum := h.Count()
+	assert.Equal(t, uint64(3), count)
+	assert.Equal(t, 2.55, sum)
+
+	// registered with the same definition
+	assert.Equal(t, c.f, r.NewCounter("requests_total", "", "method", "code").f)
+	assert.Panics(t, func() { r.NewGauge("requests_total", "") })
+	assert.Panics(t, func() { r.NewCounter("requests_total", "", "method") })
+	assert.Panics(t, func() { r.NewCounter("invalid-name", "") })
+	assert.Panics(t, func() { r.NewHistogram("h", "", nil, "le") })
+
+	var buf bytes.Buffer
+	assert.NoError(t, r.Write(&buf))
+	expected := `# HELP latency_seconds Latency\nof requests.
+# TYPE latency_seconds histogram
+latency_seconds_bucket{le="0.1"} 1
+latency_seconds_bucket{le="0.5"} 2
+latency_seconds_bucket{le="1"} 2
+latency_seconds_bucket{le="+Inf"} 3
+latency_seconds_sum 2.55
+latency_seconds_count 3
+# TYPE queue_depth gauge
+queue_depth 2.5
+# HELP requests_total The total number of requests.
+# TYPE requests_total counter
+requests_total{method="GET",code="200"} 3
+requests_total{method="POST",code="a\"b\\c\nd"} 1
+`
+	assert.Equal(t, expected, buf.String())
+
+	assert.True(t, c.Delete("POST", "a\"b\\c\nd"))
+	assert.False(t, c.Delete("POST", "a\"b\\c\nd"))
+	assert.True(t, r.Unregister("latency_seconds"))
+	assert.False(t, r.Unregister("latency_seconds"))
+	buf.Reset()
+	assert.NoError(t, r.Write(&buf))
+	assert.NotContains(t, buf.String(), "latency_seconds")
+	assert.NotContains(t, buf.String(), "POST")
+
+	var ctx fasthttp.RequestCtx
+	r.Handler()(&ctx)
+	assert.Equal(t, ContentType, string(ctx.Response.Header.ContentType()))
+	assert.Equal(t, buf.String(), string(ctx.Response.Body()))
+}
+
+func TestConcurrency(t *testing.T) {
+	r := NewRegistry()
+	c := r.NewCounter("c", "", "l")
+	h := r.NewHistogram("h", "", nil)
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				c.Inc("v")
+				h.Since(time.Now())
+			}
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, float64(1000), c.Value("v"))
+	count, _ := h.Count()
+	assert.Equal(t, uint64(1000), count)
+}
+
+func TestFormatFloat(t *testing.T) {
+	assert.Equal(t, "+Inf", formatFloat(math.Inf(1)))
+	assert.Equal(t, "-Inf", formatFloat(math.Inf(-1)))
+	assert.Equal(t, "NaN", formatFloat(math.NaN()))
+	assert.Equal(t, "1e-06", formatFloat(0.000001))
+	assert.Equal(t, "42", formatFloat(42))
+}
@@ -1,12 +1,15 @@
 package mqtt
 
 import (
+	"context"
+	"sync/atomic"
 	"time"
 
 	"github.com/jpillora/backoff"
 
 	"github.com/baetyl/baetyl-go/v2/errors"
 	"github.com/baetyl/baetyl-go/v2/log"
+	"github.com/baetyl/baetyl-go/v2/trace"
 	"github.com/baetyl/baetyl-go/v2/utils"
 )
 
@@ -20,6 +23,8 @@ type Client struct {
 	log      *log.Logger
 	tomb     utils.Tomb
 	callback ReconnectCallback
+	// 1 if connected
+	connected int32
 }
 
 // NewClient creates a new client
@@ -39,6 +44,11 @@ func (c *Client) Start(obs Observer) error {
 	})
 }
 
+// Connected returns whether the client is connected to the broker
+func (c *Client) Connected() bool {
+	return atomic.LoadInt32(&c.connected) == 1
+}
+
 func (c *Client) SetReconnectCallback(callback ReconnectCallback) {
 	c.callback = callback
 }
@@ -64,6 +74,22 @@ func (c *Client) Publish(qos QOS, topic string, payload []byte, pid ID, retain b
 	return c.Send(publish)
 }
 
+// PublishWithContext sends a publish packet as Publish does. If ctx carries a span, the packet is sent as a
+// producer span, whose trace context is wrapped into the payload by WrapTrace, so the subscribers must unwrap
+// the payload by UnwrapTrace. The payload is sent as it is if ctx carries no span.
+func (c *Client) PublishWithContext(ctx context.Context, qos QOS, topic string, payload []byte, pid ID, retain bool, dup bool) error {
+	if !trace.SpanContextFromContext(ctx).IsValid() {
+		return c.Publish(qos, topic, payload, pid, retain, dup)
+	}
+	ctx, span := trace.Start(ctx, topic+" send", trace.KindProducer)
+	defer span.End()
+	span.SetAttribute("messaging.system", "mqtt")
+	span.SetAttribute("messaging.destination", topic)
+	err := c.Publish(qos, topic, WrapTrace(ctx, payload), pid, retain, dup)
+	span.SetError(err)
+	return err
+}
+
 // Publish sends a publish packet out cache size will drop
 func (c *Client) PublishWithDrop(qos QOS, topic string, payload []byte, pid ID, retain bool, dup bool) error {
 	publish := NewPublish()
@@ -111,6 +137,7 @@ func (c *Client) SendOrDrop(pkt Packet) error {
 	case <-c.tomb.Dying():
 		return errors.Trace(ErrClientAlreadyClosed)
 	default:
+		metricDropped.Inc()
 		c.log.Warn("client dropped a packet", log.Any("packet", pkt))
 		return nil
 	}
@@ -139,6 +166,7 @@ func (c *Client) Close() error {
 func (c *Client) connecting(obs Observer) error {
 	c.log.Info("client starts to keep connecting")
 	defer c.log.Info("client has stopped connecting")
+	defer atomic.StoreInt32(&c.connected, 0)
 
 	var err error
 	var curr Packet
@@ -164,6 +192,7 @@ func (c *Client) connecting(obs Observer) error {
 			}
 		}
 		if stream != nil {
+			atomic.StoreInt32(&c.connected, 0)
 			stream.close()
 			stream = nil
 			c.log.Info("client has disconnected")
@@ -182,6 +211,7 @@ func (c *Client) connecting(obs Observer) error {
 			continue
 		}
 		c.log.Info("client has connected")
+		atomic.StoreInt32(&c.connected, 1)
 		bf.Reset()
 		curr = stream.sending(curr)
 	}
@@ -249,6 +249,7 @@ func TestMqttClientPublishSubscribeQOS0(t *testing.T) {
 	ops := newClientOptions(t, port, []Subscription{{Topic: "test"}})
 	cli := NewClient(ops)
 	assert.NotNil(t, cli)
+	assert.False(t, cli.Connected())
 
 	obs := newMockObserver(t)
 	err := cli.Start(obs)
@@ -257,10 +258,12 @@ func TestMqttClientPublishSubscribeQOS0(t *testing.T) {
 	err = cli.Publish(publish.Message.QOS, publish.Message.Topic, publish.Message.Payload, publish.ID, publish.Message.Retain, publish.Dup)
 	assert.NoError(t, err)
 	obs.assertPkts(publish)
+	assert.True(t, cli.Connected())
 
 	time.Sleep(time.Second)
 
 	assert.NoError(t, cli.Close())
+	assert.False(t, cli.Connected())
 	safeReceive(done)
 }
 
@@ -355,6 +358,9 @@ func TestMqttClientPublishSubscribeQOS1(t *testing.T) {
 	cli := NewClient(ops)
 	assert.NotNil(t, cli)
 
+	acks, _ := metricAckDuration.Count()
+	published := metricPublished.Value("1")
+
 	obs := newMockObserver(t)
 	err := cli.Start(obs)
 	assert.NoError(t, err)
@@ -363,6 +369,9 @@ func TestMqttClientPublishSubscribeQOS1(t *testing.T) {
 	assert.NoError(t, err)
 
 	obs.assertPkts(puback, publish)
+	count, _ := metricAckDuration.Count()
+	assert.Equal(t, acks+1, count)
+	assert.Equal(t, published+1, metricPublished.Value("1"))
 
 	err = cli.Send(puback)
 	assert.NoError(t, err)
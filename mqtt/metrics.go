@@ -0,0 +1,12 @@
+package mqtt
+
+import (
+	"github.com/baetyl/baetyl-go/v2/metrics"
+)
+
+var (
+	metricPublished       = metrics.DefaultRegistry.NewCounter("baetyl_mqtt_client_published_total", "The total number of publish packets sent by mqtt clients.", "qos")
+	metricPublishDuration = metrics.DefaultRegistry.NewHistogram("baetyl_mqtt_client_publish_duration_seconds", "The duration of writing a publish packet to the broker.", nil)
+	metricAckDuration     = metrics.DefaultRegistry.NewHistogram("baetyl_mqtt_client_ack_duration_seconds", "The duration from sending a publish packet of QoS 1 to receiving its puback.", nil)
+	metricDropped         = metrics.DefaultRegistry.NewCounter("baetyl_mqtt_client_dropped_total", "The total number of packets dropped by mqtt clients since the cache is full.")
+)
@@ -3,6 +3,7 @@ package mqtt
 import (
 	"fmt"
 	"math"
+	"strconv"
 	"sync"
 	"time"
 
@@ -20,9 +21,12 @@ type stream struct {
 	connectFuture   *Future
 	subscribeFuture *Future
 	tracker         *Tracker
-	tomb            utils.Tomb
-	once            sync.Once
-	mu              sync.Mutex
+	// the sent time of publish packets waiting for puback
+	pending   map[ID]time.Time
+	pendingMu sync.Mutex
+	tomb      utils.Tomb
+	once      sync.Once
+	mu        sync.Mutex
 }
 
 func (c *Client) connect(obs Observer) (s *stream, err error) {
@@ -54,6 +58,7 @@ func (c *Client) connect(obs Observer) (s *stream, err error) {
 		connectFuture:   NewFuture(),
 		subscribeFuture: NewFuture(),
 		tracker:         NewTracker(c.ops.KeepAlive),
+		pending:         map[ID]time.Time{},
 	}
 	s.tomb.Go(s.receiving)
 	if c.ops.KeepAlive > 0 {
@@ -85,6 +90,14 @@ func (c *Client) connect(obs Observer) (s *stream, err error) {
 func (s *stream) send(pkt Packet, async bool) error {
 	s.tracker.Reset()
 
+	start := time.Now()
+	p, isPublish := pkt.(*Publish)
+	if isPublish && p.Message.QOS == 1 {
+		// tracked before sending, since the puback may be received before Send returns
+		s.pendingMu.Lock()
+		s.pending[p.ID] = start
+		s.pendingMu.Unlock()
+	}
 	s.mu.Lock()
 	err := s.conn.Send(pkt, async)
 	s.mu.Unlock()
@@ -92,6 +105,10 @@ func (s *stream) send(pkt Packet, async bool) error {
 		s.die("failed to send packet", err)
 		return errors.Trace(err)
 	}
+	if isPublish {
+		metricPublishDuration.Since(start)
+		metricPublished.Inc(strconv.Itoa(int(p.Message.QOS)))
+	}
 
 	if ent := s.cli.log.Check(log.DebugLevel, "client sent a packet"); ent != nil {
 		ent.Write(log.Any("pkt", fmt.Sprintf("%v", pkt)))
@@ -255,6 +272,12 @@ func (s *stream) onPublish(pkt *Publish) error {
 }
 
 func (s *stream) onPuback(pkt *Puback) error {
+	s.pendingMu.Lock()
+	if start, ok := s.pending[pkt.ID]; ok {
+		delete(s.pending, pkt.ID)
+		metricAckDuration.Since(start)
+	}
+	s.pendingMu.Unlock()
 	if s.observer == nil {
 		return nil
 	}
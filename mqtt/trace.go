@@ -0,0 +1,63 @@
+package mqtt
+
+import (
+	"bytes"
+	"context"
+
+	"github.com/baetyl/baetyl-go/v2/json"
+	"github.com/baetyl/baetyl-go/v2/trace"
+)
+
+// MQTT 3.1.1 has no user properties, so the trace context travels in a payload envelope,
+// which is marked by the envelope field to tell it from the payload of users
+const traceEnvelopeMarker = "baetyl-trace/v1"
+
+var traceEnvelopePrefix = []byte(`{"envelope":"` + traceEnvelopeMarker + `"`)
+
+type traceEnvelope struct {
+	Envelope    string `json:"envelope"`
+	TraceParent string `json:"traceparent"`
+	TraceState  string `json:"tracestate,omitempty"`
+	Payload     []byte `json:"payload"`
+}
+
+// WrapTrace wraps the payload in an envelope with the trace context carried by ctx,
+// the payload is returned as it is if ctx carries no span.
+func WrapTrace(ctx context.Context, payload []byte) []byte {
+	sc := trace.SpanContextFromContext(ctx)
+	if !sc.IsValid() {
+		return payload
+	}
+	data, err := json.Marshal(&traceEnvelope{
+		Envelope:    traceEnvelopeMarker,
+		TraceParent: sc.TraceParent(),
+		TraceState:  sc.State,
+		Payload:     payload,
+	})
+	if err != nil {
+		return payload
+	}
+	return data
+}
+
+// UnwrapTrace unwraps the payload from the envelope, returns a copy of ctx carrying the trace context.
+// ctx and payload are returned as they are if the payload is not wrapped.
+// The payload received is not unwrapped by the client, the observer calls it to continue the trace, such as
+//
+//	ctx, payload := mqtt.UnwrapTrace(context.Background(), pkt.Message.Payload)
+func UnwrapTrace(ctx context.Context, payload []byte) (context.Context, []byte) {
+	if !bytes.HasPrefix(payload, traceEnvelopePrefix) {
+		return ctx, payload
+	}
+	var env traceEnvelope
+	if err := json.Unmarshal(payload, &env); err != nil || env.Envelope != traceEnvelopeMarker {
+		return ctx, payload
+	}
+	if _, err := trace.ParseTraceParent(env.TraceParent); err != nil {
+		return ctx, payload
+	}
+	return trace.Extract(ctx, trace.MapCarrier{
+		trace.KeyTraceParent: env.TraceParent,
+		trace.KeyTraceState:  env.TraceState,
+	}), env.Payload
+}
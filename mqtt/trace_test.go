@@ -0,0 +1,72 @@
+package mqtt
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/baetyl/baetyl-go/v2/mock"
+	"github.com/baetyl/baetyl-go/v2/trace"
+)
+
+func TestTraceEnvelope(t *testing.T) {
+	payload := []byte(`{"a":1}`)
+	assert.Equal(t, payload, WrapTrace(context.Background(), payload))
+	ctx, data := UnwrapTrace(context.Background(), payload)
+	assert.Equal(t, context.Background(), ctx)
+	assert.Equal(t, payload, data)
+
+	ctx, span := trace.Start(context.Background(), "publish", trace.KindProducer)
+	defer span.End()
+	wrapped := WrapTrace(ctx, payload)
+	assert.NotEqual(t, payload, wrapped)
+
+	ctx, data = UnwrapTrace(context.Background(), wrapped)
+	assert.Equal(t, payload, data)
+	sc := trace.SpanContextFromContext(ctx)
+	assert.True(t, sc.Remote)
+	assert.Equal(t, span.SpanContext().TraceID, sc.TraceID)
+
+	// malformed envelope is returned as it is
+	for _, bad := range [][]byte{
+		[]byte(`{"envelope":"baetyl-trace/v1","traceparent":"x`),
+		[]byte(`{"envelope":"baetyl-trace/v1","traceparent":"x","payload":"e30="}`),
+	} {
+		ctx, data = UnwrapTrace(context.Background(), bad)
+		assert.Equal(t, context.Background(), ctx)
+		assert.Equal(t, bad, data)
+	}
+
+	// the payload of users is not taken as an envelope, even if it looks like one
+	user := []byte(`{"traceparent":"00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01","payload":"e30="}`)
+	ctx, data = UnwrapTrace(context.Background(), user)
+	assert.Equal(t, context.Background(), ctx)
+	assert.Equal(t, user, data)
+}
+
+func TestMqttClientPublishWithContext(t *testing.T) {
+	publish := NewPublish()
+	publish.Message.Topic = "test"
+	publish.Message.Payload = []byte("test")
+
+	// the payload is sent as it is without a parent span
+	broker := mock.NewFlow().Debug().
+		Receive(connectPacket()).
+		Send(connackPacket()).
+		Receive(publish).
+		Receive(disconnectPacket()).
+		End()
+
+	done, port := initMockBroker(t, broker)
+
+	cli := NewClient(newClientOptions(t, port, nil))
+	obs := newMockObserver(t)
+	assert.NoError(t, cli.Start(obs))
+	err := cli.PublishWithContext(context.Background(), 0, "test", []byte("test"), 0, false, false)
+	assert.NoError(t, err)
+	time.Sleep(100 * time.Millisecond)
+	assert.NoError(t, cli.Close())
+	safeReceive(done)
+}
@@ -0,0 +1,38 @@
+package native
+
+import (
+	"github.com/baetyl/baetyl-go/v2/context"
+	"github.com/baetyl/baetyl-go/v2/errors"
+)
+
+const localHost = "127.0.0.1"
+
+// Resolver resolves services on localhost by the ports in services mapping file,
+// which can be chained with the resolver of context discovery in native mode
+type Resolver struct {
+	mapping *ServiceMapping
+}
+
+// NewResolver creates a new resolver of services mapping
+func NewResolver(mapping *ServiceMapping) *Resolver {
+	return &Resolver{mapping: mapping}
+}
+
+// Resolve resolves the endpoints of a service, each port of service is an endpoint
+func (r *Resolver) Resolve(name string) ([]context.Endpoint, error) {
+	r.mapping.RLock()
+	defer r.mapping.RUnlock()
+
+	if r.mapping.error != nil {
+		return nil, errors.Trace(r.mapping.error)
+	}
+	info, ok := r.mapping.services[name]
+	if !ok || len(info.PortInfo.Ports) == 0 {
+		return nil, errors.Trace(context.ErrServiceNotFound)
+	}
+	eps := make([]context.Endpoint, 0, len(info.PortInfo.Ports))
+	for _, port := range info.PortInfo.Ports {
+		eps = append(eps, context.Endpoint{Host: localHost, Port: port})
+	}
+	return eps, nil
+}
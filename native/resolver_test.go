@@ -0,0 +1,32 @@
+package native
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/baetyl/baetyl-go/v2/context"
+	"github.com/baetyl/baetyl-go/v2/errors"
+)
+
+func TestResolver(t *testing.T) {
+	tempDir, _ := ioutil.TempDir("", t.Name())
+	defer os.RemoveAll(tempDir)
+	os.Setenv(context.KeyBaetylHostPathLib, tempDir)
+	mapping, err := NewServiceMapping()
+	assert.NoError(t, err)
+	assert.NoError(t, mapping.SetServicePorts("serviceA", []int{50010, 50011}))
+
+	r := NewResolver(mapping)
+	eps, err := r.Resolve("serviceA")
+	assert.NoError(t, err)
+	assert.Equal(t, []context.Endpoint{{Host: "127.0.0.1", Port: 50010}, {Host: "127.0.0.1", Port: 50011}}, eps)
+	_, err = r.Resolve("serviceB")
+	assert.Equal(t, context.ErrServiceNotFound, errors.Cause(err))
+
+	d := context.NewDiscovery(context.ChainResolver{r, context.StaticResolver{"serviceB": {{Host: "10.0.0.1"}}}}, 0, nil)
+	assert.Equal(t, "http://127.0.0.1:50010", d.Address("http", "serviceA", ""))
+	assert.Equal(t, "http://10.0.0.1", d.Address("http", "serviceB", ""))
+}
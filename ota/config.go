@@ -0,0 +1,20 @@
+package ota
+
+import (
+	"time"
+)
+
+// Config the config of ota manager
+type Config struct {
+	// specifies the directory to store downloaded and staged packages
+	Dir string `yaml:"dir" json:"dir" default:"var/lib/baetyl/ota"`
+	// specifies the max time to wait for the data of package during download, the download is aborted
+	// if no data is received in it, which is not limited if not positive
+	IdleTimeout time.Duration `yaml:"idleTimeout" json:"idleTimeout" default:"30s"`
+	// specifies the interval of download progress events
+	ProgressInterval time.Duration `yaml:"progressInterval" json:"progressInterval" default:"1s"`
+	// specifies the number of health checks after applying, the update is rolled back if all of them fail
+	HealthCheckRetry int `yaml:"healthCheckRetry" json:"healthCheckRetry" default:"3"`
+	// specifies the interval between health checks
+	HealthCheckInterval time.Duration `yaml:"healthCheckInterval" json:"healthCheckInterval" default:"10s"`
+}
@@ -0,0 +1,246 @@
+package ota
+
+import (
+	"context"
+	"crypto/md5"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	gohttp "net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/baetyl/baetyl-go/v2/errors"
+	v1 "github.com/baetyl/baetyl-go/v2/spec/v1"
+)
+
+const (
+	partSuffix = ".part"
+	bufferSize = 32 * 1024
+)
+
+// Download downloads the package into the ota directory and returns the file path.
+// An unfinished download left by a previous attempt is resumed by a range request.
+func (m *Manager) Download(ctx context.Context, info *v1.ApkInfo) (string, error) {
+	if info == nil || info.Url == "" {
+		return "", ErrPackageURLNotSet
+	}
+	file := m.packagePath(info)
+	part := file + partSuffix
+	if err := os.MkdirAll(m.cfg.Dir, 0755); err != nil {
+		return "", errors.Trace(err)
+	}
+
+	var offset int64
+	if fi, err := os.Stat(part); err == nil {
+		offset = fi.Size()
+	}
+	if info.Size > 0 && offset >= info.Size {
+		// the previous attempt finished downloading but failed before renaming
+		return file, errors.Trace(os.Rename(part, file))
+	}
+
+	// the request is aborted if idle, instead of limiting the time of whole download by the client timeout
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	idle := newIdleTimer(m.cfg.IdleTimeout, cancel)
+	defer idle.stop()
+	resp, err := m.request(ctx, info.Url, offset)
+	if err != nil {
+		return "", idle.wrap(err)
+	}
+	if resp.StatusCode == gohttp.StatusPartialContent && offset > 0 && contentRangeStart(resp) != offset {
+		// the content is not the range requested, download from scratch
+		resp.Body.Close()
+		offset = 0
+		if resp, err = m.request(ctx, info.Url, offset); err != nil {
+			return "", idle.wrap(err)
+		}
+	}
+	defer resp.Body.Close()
+
+	flag := os.O_CREATE | os.O_WRONLY
+	switch resp.StatusCode {
+	case gohttp.StatusPartialContent:
+		if contentRangeStart(resp) != offset {
+			return "", errors.Errorf("failed to download package (%s): unexpected content range %s", info.Url, resp.Header.Get("Content-Range"))
+		}
+		if offset > 0 {
+			flag |= os.O_APPEND
+		} else {
+			flag |= os.O_TRUNC
+		}
+	case gohttp.StatusOK:
+		// the server does not support range requests, download from scratch
+		offset = 0
+		flag |= os.O_TRUNC
+	case gohttp.StatusRequestedRangeNotSatisfiable:
+		if offset == 0 {
+			return "", errors.Errorf("failed to download package (%s): [%d] %s", info.Url, resp.StatusCode, resp.Status)
+		}
+		// nothing left to download, the checksums tell whether the file is complete
+		return file, errors.Trace(os.Rename(part, file))
+	default:
+		return "", errors.Errorf("failed to download package (%s): [%d] %s", info.Url, resp.StatusCode, resp.Status)
+	}
+
+	total := info.Size
+	if total <= 0 && resp.ContentLength > 0 {
+		total = offset + resp.ContentLength
+	}
+	f, err := os.OpenFile(part, flag, 0644)
+	if err != nil {
+		return "", errors.Trace(err)
+	}
+	downloaded, err := m.copy(ctx, f, resp.Body, info, offset, total, idle)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return "", idle.wrap(err)
+	}
+	m.emit(&Event{Type: EventDownloaded, Key: info.Key, Version: info.Version, Downloaded: downloaded, Total: total})
+	return file, errors.Trace(os.Rename(part, file))
+}
+
+// request requests the package from the offset, the whole package is requested if offset is 0
+func (m *Manager) request(ctx context.Context, url string, offset int64) (*gohttp.Response, error) {
+	var headers map[string]string
+	if offset > 0 {
+		headers = map[string]string{"Range": fmt.Sprintf("bytes=%d-", offset)}
+	}
+	resp, err := m.cli.StreamUrlWithContext(ctx, gohttp.MethodGet, url, nil, headers)
+	return resp, errors.Trace(err)
+}
+
+// contentRangeStart returns the first byte position of the partial content, such as 100 of "bytes 100-199/200",
+// or -1 if the content range is invalid
+func contentRangeStart(resp *gohttp.Response) int64 {
+	v := strings.TrimPrefix(resp.Header.Get("Content-Range"), "bytes ")
+	i := strings.Index(v, "-")
+	if i <= 0 {
+		return -1
+	}
+	start, err := strconv.ParseInt(v[:i], 10, 64)
+	if err != nil {
+		return -1
+	}
+	return start
+}
+
+// Verify checks the size and checksums of the package, a corrupted file is removed
+func (m *Manager) Verify(info *v1.ApkInfo, file string) error {
+	err := verify(info, file)
+	if err != nil {
+		os.Remove(file)
+		return errors.Trace(err)
+	}
+	m.emit(&Event{Type: EventVerified, Key: info.Key, Version: info.Version})
+	return nil
+}
+
+func (m *Manager) copy(ctx context.Context, w io.Writer, r io.Reader, info *v1.ApkInfo, offset, total int64, idle *idleTimer) (int64, error) {
+	buf := make([]byte, bufferSize)
+	downloaded := offset
+	last := time.Now()
+	for {
+		select {
+		case <-ctx.Done():
+			return downloaded, errors.Trace(ctx.Err())
+		default:
+		}
+		n, err := r.Read(buf)
+		if n > 0 {
+			idle.reset()
+			if _, werr := w.Write(buf[:n]); werr != nil {
+				return downloaded, errors.Trace(werr)
+			}
+			downloaded += int64(n)
+			if time.Since(last) >= m.cfg.ProgressInterval {
+				last = time.Now()
+				m.emit(&Event{Type: EventDownloading, Key: info.Key, Version: info.Version, Downloaded: downloaded, Total: total})
+			}
+		}
+		if err == io.EOF {
+			return downloaded, nil
+		}
+		if err != nil {
+			return downloaded, errors.Trace(err)
+		}
+	}
+}
+
+// idleTimer cancels the download if it is not reset in the timeout
+type idleTimer struct {
+	timeout time.Duration
+	timer   *time.Timer
+	fired   int32
+}
+
+func newIdleTimer(timeout time.Duration, cancel context.CancelFunc) *idleTimer {
+	t := &idleTimer{timeout: timeout}
+	if timeout > 0 {
+		t.timer = time.AfterFunc(timeout, func() {
+			atomic.StoreInt32(&t.fired, 1)
+			cancel()
+		})
+	}
+	return t
+}
+
+func (t *idleTimer) reset() {
+	if t.timer != nil {
+		t.timer.Reset(t.timeout)
+	}
+}
+
+func (t *idleTimer) stop() {
+	if t.timer != nil {
+		t.timer.Stop()
+	}
+}
+
+// wrap returns ErrDownloadIdle if the download is canceled by the timer
+func (t *idleTimer) wrap(err error) error {
+	if atomic.LoadInt32(&t.fired) == 1 {
+		return errors.Trace(ErrDownloadIdle)
+	}
+	return errors.Trace(err)
+}
+
+func verify(info *v1.ApkInfo, file string) error {
+	f, err := os.Open(file)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	defer f.Close()
+
+	md5Hasher, sha1Hasher := md5.New(), sha1.New()
+	size, err := io.Copy(io.MultiWriter(md5Hasher, sha1Hasher), f)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	if info.Size > 0 && size != info.Size {
+		return errors.Errorf("failed to verify package (%s), due to size mismatch: expect %d, actual %d", file, info.Size, size)
+	}
+	if err = checkSum("md5", info.Md5, md5Hasher); err != nil {
+		return errors.Trace(err)
+	}
+	return errors.Trace(checkSum("sha1", info.Sha1, sha1Hasher))
+}
+
+func checkSum(name, expect string, h hash.Hash) error {
+	if expect == "" {
+		return nil
+	}
+	actual := hex.EncodeToString(h.Sum(nil))
+	if !strings.EqualFold(expect, actual) {
+		return errors.Errorf("failed to verify package, due to %s mismatch: expect %s, actual %s", name, expect, actual)
+	}
+	return nil
+}
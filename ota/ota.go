@@ -0,0 +1,213 @@
+package ota
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/baetyl/baetyl-go/v2/errors"
+	"github.com/baetyl/baetyl-go/v2/http"
+	"github.com/baetyl/baetyl-go/v2/log"
+	v1 "github.com/baetyl/baetyl-go/v2/spec/v1"
+	"github.com/baetyl/baetyl-go/v2/utils"
+)
+
+var (
+	ErrPackageNotSet    = errors.New("failed to update, due to package info is not set")
+	ErrPackageURLNotSet = errors.New("failed to download package, due to url is not set")
+	ErrUpdateInProgress = errors.New("failed to update, due to another update is in progress")
+	ErrDownloadIdle     = errors.New("failed to download package, due to no data is received in the idle timeout")
+)
+
+// EventType the type of ota event
+type EventType string
+
+const (
+	EventDownloading EventType = "Downloading"
+	EventDownloaded  EventType = "Downloaded"
+	EventVerified    EventType = "Verified"
+	EventStaged      EventType = "Staged"
+	EventApplied     EventType = "Applied"
+	EventSucceeded   EventType = "Succeeded"
+	EventFailed      EventType = "Failed"
+	EventRolledBack  EventType = "RolledBack"
+)
+
+// Event the progress or outcome of an update
+type Event struct {
+	Type       EventType `json:"type,omitempty" yaml:"type,omitempty"`
+	Key        string    `json:"key,omitempty" yaml:"key,omitempty"`
+	Version    string    `json:"version,omitempty" yaml:"version,omitempty"`
+	Downloaded int64     `json:"downloaded,omitempty" yaml:"downloaded,omitempty"`
+	Total      int64     `json:"total,omitempty" yaml:"total,omitempty"`
+	Error      string    `json:"error,omitempty" yaml:"error,omitempty"`
+	Time       time.Time `json:"time,omitempty" yaml:"time,omitempty"`
+}
+
+// EventHandler handles ota events
+type EventHandler func(*Event)
+
+// Installer installs packages on a specific platform, such as an android apk installer
+type Installer interface {
+	// Stage prepares the verified package for installation
+	Stage(info *v1.ApkInfo, file string) error
+	// Apply installs the staged package
+	Apply(info *v1.ApkInfo, file string) error
+	// Rollback restores the version before the package was applied
+	Rollback(info *v1.ApkInfo) error
+}
+
+// HealthChecker checks whether the applied package works
+type HealthChecker func(info *v1.ApkInfo) error
+
+// Manager downloads, verifies and applies ota packages
+type Manager struct {
+	cfg       Config
+	cli       *http.Client
+	installer Installer
+	checker   HealthChecker
+	handler   EventHandler
+	running   bool
+	lock      sync.Mutex
+	log       *log.Logger
+}
+
+// NewManager creates a new ota manager
+func NewManager(cfg Config, cli *http.Client, installer Installer) (*Manager, error) {
+	if err := utils.SetDefaults(&cfg); err != nil {
+		return nil, errors.Trace(err)
+	}
+	return &Manager{
+		cfg:       cfg,
+		cli:       cli,
+		installer: installer,
+		log:       log.L().With(log.Any("ota", "manager")),
+	}, nil
+}
+
+// SetHealthChecker sets the checker called after the package is applied
+func (m *Manager) SetHealthChecker(checker HealthChecker) {
+	m.checker = checker
+}
+
+// SetEventHandler sets the handler to receive progress and outcome events
+func (m *Manager) SetEventHandler(handler EventHandler) {
+	m.handler = handler
+}
+
+// Update runs the whole workflow: download, verify, stage, apply and health check.
+// The update is rolled back if the health check keeps failing.
+func (m *Manager) Update(ctx context.Context, info *v1.OtaInfo) error {
+	if info == nil || info.ApkInfo == nil {
+		return ErrPackageNotSet
+	}
+	m.lock.Lock()
+	if m.running {
+		m.lock.Unlock()
+		return ErrUpdateInProgress
+	}
+	m.running = true
+	m.lock.Unlock()
+	defer func() {
+		m.lock.Lock()
+		m.running = false
+		m.lock.Unlock()
+	}()
+
+	apk := info.ApkInfo
+	err := m.update(ctx, apk)
+	if err != nil {
+		m.log.Error("failed to update package", log.Any("key", apk.Key), log.Any("version", apk.Version), log.Error(err))
+		m.emit(&Event{Type: EventFailed, Key: apk.Key, Version: apk.Version, Error: err.Error()})
+		return errors.Trace(err)
+	}
+	m.emit(&Event{Type: EventSucceeded, Key: apk.Key, Version: apk.Version})
+	return nil
+}
+
+func (m *Manager) update(ctx context.Context, apk *v1.ApkInfo) error {
+	file, err := m.Download(ctx, apk)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	if err = m.Verify(apk, file); err != nil {
+		return errors.Trace(err)
+	}
+	if err = m.installer.Stage(apk, file); err != nil {
+		return errors.Trace(err)
+	}
+	m.emit(&Event{Type: EventStaged, Key: apk.Key, Version: apk.Version})
+	if err = m.installer.Apply(apk, file); err != nil {
+		return errors.Trace(err)
+	}
+	m.emit(&Event{Type: EventApplied, Key: apk.Key, Version: apk.Version})
+
+	if err = m.check(ctx, apk); err == nil {
+		return nil
+	}
+	m.log.Warn("health check failed, roll back", log.Any("key", apk.Key), log.Error(err))
+	if rerr := m.installer.Rollback(apk); rerr != nil {
+		return errors.Errorf("failed to roll back after health check failure (%s): %s", err.Error(), rerr.Error())
+	}
+	m.emit(&Event{Type: EventRolledBack, Key: apk.Key, Version: apk.Version, Error: err.Error()})
+	return errors.Trace(err)
+}
+
+func (m *Manager) check(ctx context.Context, apk *v1.ApkInfo) error {
+	if m.checker == nil {
+		return nil
+	}
+	retry := m.cfg.HealthCheckRetry
+	if retry < 1 {
+		retry = 1
+	}
+	var err error
+	for i := 0; i < retry; i++ {
+		if i > 0 {
+			select {
+			case <-ctx.Done():
+				return errors.Trace(ctx.Err())
+			case <-time.After(m.cfg.HealthCheckInterval):
+			}
+		}
+		if err = m.checker(apk); err == nil {
+			return nil
+		}
+	}
+	return errors.Trace(err)
+}
+
+func (m *Manager) emit(e *Event) {
+	if m.handler == nil {
+		return
+	}
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	m.handler(e)
+}
+
+func (m *Manager) packagePath(info *v1.ApkInfo) string {
+	name := info.Key
+	if name == "" {
+		name = info.PackName
+	}
+	if name == "" {
+		name = filepath.Base(info.Url)
+	}
+	return filepath.Join(m.cfg.Dir, fmt.Sprintf("%s-%s", filepath.Base(name), info.Version))
+}
+
+// Clean removes the downloaded package of the given version
+func (m *Manager) Clean(info *v1.ApkInfo) error {
+	file := m.packagePath(info)
+	for _, f := range []string{file, file + partSuffix} {
+		if err := os.Remove(f); err != nil && !os.IsNotExist(err) {
+			return errors.Trace(err)
+		}
+	}
+	return nil
+}
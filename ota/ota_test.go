@@ -0,0 +1,297 @@
+package ota
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	gohttp "net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/baetyl/baetyl-go/v2/errors"
+	"github.com/baetyl/baetyl-go/v2/http"
+	v1 "github.com/baetyl/baetyl-go/v2/spec/v1"
+)
+
+type mockInstaller struct {
+	staged, applied, rolledBack int
+	applyErr                    error
+}
+
+func (i *mockInstaller) Stage(_ *v1.ApkInfo, file string) error {
+	i.staged++
+	_, err := os.Stat(file)
+	return err
+}
+
+func (i *mockInstaller) Apply(_ *v1.ApkInfo, _ string) error {
+	i.applied++
+	return i.applyErr
+}
+
+func (i *mockInstaller) Rollback(_ *v1.ApkInfo) error {
+	i.rolledBack++
+	return nil
+}
+
+type eventRecorder struct {
+	events []*Event
+	lock   sync.Mutex
+}
+
+func (r *eventRecorder) handle(e *Event) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.events = append(r.events, e)
+}
+
+func (r *eventRecorder) types() []EventType {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	var res []EventType
+	for _, e := range r.events {
+		if e.Type != EventDownloading {
+			res = append(res, e.Type)
+		}
+	}
+	return res
+}
+
+func genPackage() ([]byte, *v1.ApkInfo) {
+	data := bytes.Repeat([]byte("baetyl-ota-"), 10000)
+	m := md5.Sum(data)
+	s := sha1.Sum(data)
+	return data, &v1.ApkInfo{
+		Key:     "app",
+		Md5:     hex.EncodeToString(m[:]),
+		Sha1:    hex.EncodeToString(s[:]),
+		Size:    int64(len(data)),
+		Version: "1.0.1",
+	}
+}
+
+func newServer(data []byte, ranges *[]string) *httptest.Server {
+	return httptest.NewServer(gohttp.HandlerFunc(func(w gohttp.ResponseWriter, r *gohttp.Request) {
+		*ranges = append(*ranges, r.Header.Get("Range"))
+		gohttp.ServeContent(w, r, "app.apk", time.Time{}, bytes.NewReader(data))
+	}))
+}
+
+func newManager(t *testing.T, installer Installer) (*Manager, string) {
+	dir := t.TempDir()
+	cfg := Config{Dir: dir, HealthCheckRetry: 2, HealthCheckInterval: time.Millisecond}
+	m, err := NewManager(cfg, http.NewClient(http.NewClientOptions()), installer)
+	assert.NoError(t, err)
+	return m, dir
+}
+
+func TestUpdate(t *testing.T) {
+	data, apk := genPackage()
+	var ranges []string
+	svr := newServer(data, &ranges)
+	defer svr.Close()
+	apk.Url = svr.URL + "/app.apk"
+
+	installer := &mockInstaller{}
+	m, dir := newManager(t, installer)
+	rec := &eventRecorder{}
+	m.SetEventHandler(rec.handle)
+	m.SetHealthChecker(func(*v1.ApkInfo) error { return nil })
+
+	err := m.Update(context.Background(), &v1.OtaInfo{ApkInfo: apk})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, installer.staged)
+	assert.Equal(t, 1, installer.applied)
+	assert.Equal(t, 0, installer.rolledBack)
+	assert.Equal(t, []EventType{EventDownloaded, EventVerified, EventStaged, EventApplied, EventSucceeded}, rec.types())
+	assert.Equal(t, []string{""}, ranges)
+
+	res, err := os.ReadFile(filepath.Join(dir, "app-1.0.1"))
+	assert.NoError(t, err)
+	assert.Equal(t, data, res)
+
+	assert.NoError(t, m.Clean(apk))
+	_, err = os.Stat(filepath.Join(dir, "app-1.0.1"))
+	assert.True(t, os.IsNotExist(err))
+
+	assert.Equal(t, ErrPackageNotSet, m.Update(context.Background(), nil))
+	assert.Equal(t, ErrPackageNotSet, m.Update(context.Background(), &v1.OtaInfo{}))
+}
+
+func TestDownloadResume(t *testing.T) {
+	data, apk := genPackage()
+	var ranges []string
+	svr := newServer(data, &ranges)
+	defer svr.Close()
+	apk.Url = svr.URL + "/app.apk"
+
+	m, dir := newManager(t, &mockInstaller{})
+	part := filepath.Join(dir, "app-1.0.1"+partSuffix)
+	assert.NoError(t, os.WriteFile(part, data[:1000], 0644))
+
+	file, err := m.Download(context.Background(), apk)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"bytes=1000-"}, ranges)
+	assert.NoError(t, m.Verify(apk, file))
+
+	// completed part file is not downloaded again
+	ranges = nil
+	assert.NoError(t, os.Rename(file, part))
+	_, err = m.Download(context.Background(), apk)
+	assert.NoError(t, err)
+	assert.Len(t, ranges, 0)
+
+	_, err = m.Download(context.Background(), &v1.ApkInfo{})
+	assert.Equal(t, ErrPackageURLNotSet, err)
+}
+
+func TestDownloadContentRange(t *testing.T) {
+	data, apk := genPackage()
+	var ranges []string
+	svr := httptest.NewServer(gohttp.HandlerFunc(func(w gohttp.ResponseWriter, r *gohttp.Request) {
+		ranges = append(ranges, r.Header.Get("Range"))
+		if r.Header.Get("Range") == "" {
+			gohttp.ServeContent(w, r, "app.apk", time.Time{}, bytes.NewReader(data))
+			return
+		}
+		// the range is not the one requested
+		w.Header().Set("Content-Range", fmt.Sprintf("bytes 500-%d/%d", len(data)-1, len(data)))
+		w.WriteHeader(gohttp.StatusPartialContent)
+		w.Write(data[500:])
+	}))
+	defer svr.Close()
+	apk.Url = svr.URL + "/app.apk"
+
+	m, dir := newManager(t, &mockInstaller{})
+	part := filepath.Join(dir, "app-1.0.1"+partSuffix)
+	assert.NoError(t, os.WriteFile(part, data[:1000], 0644))
+
+	// downloaded from scratch
+	file, err := m.Download(context.Background(), apk)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"bytes=1000-", ""}, ranges)
+	assert.NoError(t, m.Verify(apk, file))
+}
+
+func TestNewManager(t *testing.T) {
+	m, err := NewManager(Config{}, http.NewClient(http.NewClientOptions()), &mockInstaller{})
+	assert.NoError(t, err)
+	assert.Equal(t, "var/lib/baetyl/ota", m.cfg.Dir)
+	assert.Equal(t, 30*time.Second, m.cfg.IdleTimeout)
+	assert.Equal(t, 3, m.cfg.HealthCheckRetry)
+}
+
+func TestDownloadTimeout(t *testing.T) {
+	data, apk := genPackage()
+	stall := make(chan struct{})
+	svr := httptest.NewServer(gohttp.HandlerFunc(func(w gohttp.ResponseWriter, r *gohttp.Request) {
+		// the package is sent slowly in chunks, and stalls at last if requested
+		chunks := 5
+		if r.URL.Path == "/stall.apk" {
+			chunks = 1
+		}
+		w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+		size := len(data) / 5
+		for i := 0; i < chunks; i++ {
+			end := (i + 1) * size
+			if i == 4 {
+				end = len(data)
+			}
+			w.Write(data[i*size : end])
+			w.(gohttp.Flusher).Flush()
+			time.Sleep(50 * time.Millisecond)
+		}
+		if chunks < 5 {
+			<-stall
+		}
+	}))
+	defer svr.Close()
+	defer close(stall)
+
+	// the client timeout does not limit the whole download
+	ops := http.NewClientOptions()
+	ops.Timeout = 100 * time.Millisecond
+	cfg := Config{Dir: t.TempDir(), IdleTimeout: time.Second}
+	m, err := NewManager(cfg, http.NewClient(ops), &mockInstaller{})
+	assert.NoError(t, err)
+	apk.Url = svr.URL + "/app.apk"
+	file, err := m.Download(context.Background(), apk)
+	assert.NoError(t, err)
+	assert.NoError(t, m.Verify(apk, file))
+
+	// no data received in the idle timeout
+	m.cfg.IdleTimeout = 200 * time.Millisecond
+	apk.Url = svr.URL + "/stall.apk"
+	_, err = m.Download(context.Background(), apk)
+	assert.Equal(t, ErrDownloadIdle, errors.Cause(err))
+
+	// canceled by the caller
+	m.cfg.IdleTimeout = 0
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	_, err = m.Download(ctx, apk)
+	assert.Equal(t, context.DeadlineExceeded, errors.Cause(err))
+}
+
+func TestVerify(t *testing.T) {
+	data, apk := genPackage()
+	m, dir := newManager(t, &mockInstaller{})
+	file := filepath.Join(dir, "app")
+
+	cases := []*v1.ApkInfo{
+		{Size: apk.Size + 1},
+		{Md5: "abc"},
+		{Sha1: "abc"},
+	}
+	for _, c := range cases {
+		assert.NoError(t, os.WriteFile(file, data, 0644))
+		assert.Error(t, m.Verify(c, file))
+		_, err := os.Stat(file)
+		assert.True(t, os.IsNotExist(err))
+	}
+
+	assert.NoError(t, os.WriteFile(file, data, 0644))
+	assert.NoError(t, m.Verify(&v1.ApkInfo{Md5: apk.Md5, Size: apk.Size}, file))
+}
+
+func TestUpdateRollback(t *testing.T) {
+	data, apk := genPackage()
+	var ranges []string
+	svr := newServer(data, &ranges)
+	defer svr.Close()
+	apk.Url = svr.URL + "/app.apk"
+
+	installer := &mockInstaller{}
+	m, _ := newManager(t, installer)
+	rec := &eventRecorder{}
+	m.SetEventHandler(rec.handle)
+	checks := 0
+	m.SetHealthChecker(func(*v1.ApkInfo) error {
+		checks++
+		return errors.New("unhealthy")
+	})
+
+	err := m.Update(context.Background(), &v1.OtaInfo{ApkInfo: apk})
+	assert.Error(t, err)
+	assert.Equal(t, 2, checks)
+	assert.Equal(t, 1, installer.rolledBack)
+	assert.Equal(t, []EventType{EventDownloaded, EventVerified, EventStaged, EventApplied, EventRolledBack, EventFailed}, rec.types())
+
+	// apply failure is reported without rollback
+	installer.applyErr = errors.New("install failed")
+	rec.events = nil
+	err = m.Update(context.Background(), &v1.OtaInfo{ApkInfo: apk})
+	assert.Error(t, err)
+	assert.Equal(t, 1, installer.rolledBack)
+	assert.Equal(t, []EventType{EventDownloaded, EventVerified, EventStaged, EventFailed}, rec.types())
+}
@@ -0,0 +1,9 @@
+package pubsub
+
+import (
+	"github.com/baetyl/baetyl-go/v2/metrics"
+)
+
+var (
+	metricDropped = metrics.DefaultRegistry.NewCounter("baetyl_pubsub_dropped_total", "The total number of messages dropped by pubsub since the subscriber is too slow.")
+)
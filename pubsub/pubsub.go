@@ -100,6 +100,7 @@ func (m *pubsub) publish(ch chan interface{}, msg interface{}) error {
 	select {
 	case ch <- msg:
 	case <-timer.C:
+		metricDropped.Inc()
 		m.log.Warn("publish message timeout")
 		return ErrPubsubTimeout
 	}
@@ -47,6 +47,19 @@ func TestPubsub(t *testing.T) {
 	assert.NoError(t, err)
 }
 
+func TestPubsubDropped(t *testing.T) {
+	pb, err := NewPubsub(0)
+	assert.NoError(t, err)
+	defer pb.Close()
+
+	_, err = pb.Subscribe("slow")
+	assert.NoError(t, err)
+	dropped := metricDropped.Value()
+	err = pb.Publish("slow", expMsg)
+	assert.EqualError(t, err, ErrPubsubTimeout.Error())
+	assert.Equal(t, dropped+1, metricDropped.Value())
+}
+
 func Reading(t *testing.T, ch <-chan interface{}) {
 	for {
 		msg := <-ch
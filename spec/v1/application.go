@@ -234,17 +234,54 @@ type ServiceFunction struct {
 	CodeDir string `json:"codedir,omitempty" yaml:"codedir,omitempty"`
 }
 
+const (
+	MissedRunSkip    = "Skip"
+	MissedRunOnce    = "RunOnce"
+	MissedRunCatchUp = "CatchUp"
+
+	ConcurrencyAllow   = "Allow"
+	ConcurrencyForbid  = "Forbid"
+	ConcurrencyReplace = "Replace"
+)
+
 type AppJobConfig struct {
 	Completions   int    `json:"completions" yaml:"completions"`
 	Parallelism   int    `json:"parallelism,omitempty" yaml:"parallelism,omitempty"`
 	BackoffLimit  int    `json:"backoffLimit,omitempty" yaml:"backoffLimit,omitempty"`
 	RestartPolicy string `json:"restartPolicy,omitempty" yaml:"restartPolicy,omitempty" default:"Never"`
+	// specifies the cron expression of the job, which is required to schedule the job by cron.JobScheduler.
+	// The job is not scheduled if empty, it runs only once as a plain job instead
+	Schedule string `json:"schedule,omitempty" yaml:"schedule,omitempty"`
+	// specifies the IANA time zone of the schedule, local time zone is used if empty
+	TimeZone string `json:"timeZone,omitempty" yaml:"timeZone,omitempty"`
+	// specifies how to handle runs missed while the scheduler is down. Skip | RunOnce | CatchUp
+	MissedRunPolicy string `json:"missedRunPolicy,omitempty" yaml:"missedRunPolicy,omitempty" default:"Skip"`
+	// specifies how to treat concurrent runs of the job. Allow | Forbid | Replace
+	ConcurrencyPolicy string `json:"concurrencyPolicy,omitempty" yaml:"concurrencyPolicy,omitempty" default:"Allow"`
+	// specifies the deadline in seconds for starting a run that was missed, only for Skip policy
+	StartingDeadlineSeconds int `json:"startingDeadlineSeconds,omitempty" yaml:"startingDeadlineSeconds,omitempty" default:"60"`
+	// specifies the number of finished runs to retain
+	HistoryLimit int `json:"historyLimit,omitempty" yaml:"historyLimit,omitempty" default:"10"`
 }
 
+const (
+	MetricTypeResource = "Resource"
+
+	MetricTargetUtilization = "Utilization"
+	MetricTargetValue       = "Value"
+	MetricTargetAverage     = "AverageValue"
+)
+
 type AutoScaleCfg struct {
 	MinReplicas int          `json:"minReplicas,omitempty" yaml:"minReplicas,omitempty"`
 	MaxReplicas int          `json:"maxReplicas,omitempty" yaml:"maxReplicas,omitempty"`
 	Metrics     []MetricSpec `json:"metrics,omitempty" yaml:"metrics,omitempty"`
+	// specifies the tolerance in percent of the usage to target ratio within which replicas are not changed
+	TolerancePercent int `json:"tolerancePercent,omitempty" yaml:"tolerancePercent,omitempty" default:"10"`
+	// specifies the window in seconds of past recommendations considered when scaling up
+	ScaleUpStabilizationSeconds int `json:"scaleUpStabilizationSeconds,omitempty" yaml:"scaleUpStabilizationSeconds,omitempty"`
+	// specifies the window in seconds of past recommendations considered when scaling down
+	ScaleDownStabilizationSeconds int `json:"scaleDownStabilizationSeconds,omitempty" yaml:"scaleDownStabilizationSeconds,omitempty" default:"300"`
 }
 
 type MetricSpec struct {
@@ -0,0 +1,24 @@
+package v1
+
+import "strings"
+
+// MetadataNamespace the key of namespace in the metadata of message, which marks the tenant of message
+const MetadataNamespace = "namespace"
+
+// NamespacedName returns the name scoped by namespace, such as <namespace>/<name>.
+// The name is returned as it is if the namespace is empty.
+func NamespacedName(namespace, name string) string {
+	if namespace == "" {
+		return name
+	}
+	return namespace + "/" + name
+}
+
+// ParseNamespacedName splits the name scoped by namespace into namespace and name,
+// the namespace is empty if the name is not scoped.
+func ParseNamespacedName(s string) (namespace, name string) {
+	if i := strings.Index(s, "/"); i >= 0 {
+		return s[:i], s[i+1:]
+	}
+	return "", s
+}
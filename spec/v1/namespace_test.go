@@ -0,0 +1,19 @@
+package v1
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNamespacedName(t *testing.T) {
+	assert.Equal(t, "app", NamespacedName("", "app"))
+	assert.Equal(t, "tenant-a/app", NamespacedName("tenant-a", "app"))
+
+	ns, name := ParseNamespacedName("tenant-a/app")
+	assert.Equal(t, "tenant-a", ns)
+	assert.Equal(t, "app", name)
+	ns, name = ParseNamespacedName("app")
+	assert.Equal(t, "", ns)
+	assert.Equal(t, "app", name)
+}
@@ -0,0 +1,84 @@
+package sts
+
+import (
+	"time"
+)
+
+const (
+	defaultRefreshWindow = 5 * time.Minute
+	defaultJitter        = 0.2
+	defaultRetryInterval = 10 * time.Second
+	defaultMaxRetry      = 5 * time.Minute
+	defaultMinInterval   = time.Second
+)
+
+// Option represents the optional function.
+type Option func(c *config)
+
+type config struct {
+	request       *stsRequest
+	refreshWindow time.Duration
+	jitter        float64
+	retryInterval time.Duration
+	maxRetry      time.Duration
+	minInterval   time.Duration
+}
+
+type stsRequest struct {
+	stsType string
+	expired time.Duration
+}
+
+// WithRequest sets the type and the expected lifetime of the requested credentials
+func WithRequest(stsType string, expiredTime time.Duration) Option {
+	return func(c *config) {
+		c.request = &stsRequest{stsType: stsType, expired: expiredTime}
+	}
+}
+
+// WithRefreshWindow sets how long before the expiration the credentials are refreshed
+func WithRefreshWindow(window time.Duration) Option {
+	return func(c *config) {
+		if window > 0 {
+			c.refreshWindow = window
+		}
+	}
+}
+
+// WithJitter sets the random extra of the refresh window, as a fraction of the window.
+// It spreads the refreshes of many nodes which get credentials at the same time.
+func WithJitter(jitter float64) Option {
+	return func(c *config) {
+		if jitter >= 0 {
+			c.jitter = jitter
+		}
+	}
+}
+
+// WithRetryInterval sets the interval to retry the background refresh after a failure
+func WithRetryInterval(interval time.Duration) Option {
+	return func(c *config) {
+		if interval > 0 {
+			c.retryInterval = interval
+		}
+	}
+}
+
+// WithMaxRetryInterval sets the max interval to retry, the retry interval is doubled after each failure up to it
+func WithMaxRetryInterval(interval time.Duration) Option {
+	return func(c *config) {
+		if interval > 0 {
+			c.maxRetry = interval
+		}
+	}
+}
+
+// WithMinInterval sets the min interval between two refreshes, so that the credentials which are
+// already expired when received, such as due to clock skew, are not refreshed back-to-back
+func WithMinInterval(interval time.Duration) Option {
+	return func(c *config) {
+		if interval > 0 {
+			c.minInterval = interval
+		}
+	}
+}
@@ -0,0 +1,261 @@
+package sts
+
+import (
+	"math/rand"
+	"sync"
+	"time"
+
+	"golang.org/x/sync/singleflight"
+
+	"github.com/baetyl/baetyl-go/v2/errors"
+	"github.com/baetyl/baetyl-go/v2/http"
+	"github.com/baetyl/baetyl-go/v2/json"
+	"github.com/baetyl/baetyl-go/v2/log"
+	v1 "github.com/baetyl/baetyl-go/v2/spec/v1"
+	"github.com/baetyl/baetyl-go/v2/utils"
+)
+
+const refreshKey = "sts"
+
+var (
+	ErrFetchNotSet     = errors.New("failed to create sts provider, due to fetch function is not set")
+	ErrEmptyCredential = errors.New("failed to fetch sts credential, due to empty response")
+)
+
+// FetchFunc fetches temporary credentials, such as from the core over http or from the cloud over websocket sync
+type FetchFunc func(req *v1.STSRequest) (*v1.STSResponse, error)
+
+// NewHTTPFetch creates a fetch function which posts the request to the url
+func NewHTTPFetch(cli *http.Client, url string) FetchFunc {
+	return func(req *v1.STSRequest) (*v1.STSResponse, error) {
+		data, err := json.Marshal(req)
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+		data, err = cli.PostJSON(url, data)
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+		res := new(v1.STSResponse)
+		if err = json.Unmarshal(data, res); err != nil {
+			return nil, errors.Trace(err)
+		}
+		return res, nil
+	}
+}
+
+// Value the S3 compatible credential value
+type Value struct {
+	AccessKeyID     string
+	SecretAccessKey string
+	SessionToken    string
+}
+
+// Credentials the S3 compatible credentials interface, which has the same methods as
+// the credential providers of the popular object storage SDKs
+type Credentials interface {
+	// Retrieve returns the credential value, refreshes it if expired
+	Retrieve() (Value, error)
+	// IsExpired returns whether the credential needs to be refreshed
+	IsExpired() bool
+}
+
+// Provider caches temporary credentials and refreshes them before they expire.
+// Concurrent refreshes are deduplicated, so only one request is sent at a time.
+type Provider struct {
+	cfg       config
+	fetch     FetchFunc
+	cred      *v1.STSResponse
+	refreshAt time.Time
+	expired   chan struct{}
+	group     singleflight.Group
+	lock      sync.RWMutex
+	tomb      utils.Tomb
+	log       *log.Logger
+}
+
+// NewProvider creates a new sts credential provider
+func NewProvider(fetch FetchFunc, opts ...Option) (*Provider, error) {
+	if fetch == nil {
+		return nil, ErrFetchNotSet
+	}
+	cfg := config{
+		refreshWindow: defaultRefreshWindow,
+		jitter:        defaultJitter,
+		retryInterval: defaultRetryInterval,
+		maxRetry:      defaultMaxRetry,
+		minInterval:   defaultMinInterval,
+	}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	return &Provider{
+		cfg:     cfg,
+		fetch:   fetch,
+		expired: make(chan struct{}, 1),
+		log:     log.With(log.Any("sts", "provider")),
+	}, nil
+}
+
+// Get returns the cached credential, refreshes it if expired.
+// If the refresh fails, the cached credential is returned as long as it does not expire yet.
+func (p *Provider) Get() (*v1.STSResponse, error) {
+	p.lock.RLock()
+	cred, refreshAt := p.cred, p.refreshAt
+	p.lock.RUnlock()
+	if cred != nil && time.Now().Before(refreshAt) {
+		return cred, nil
+	}
+
+	fresh, err := p.refresh()
+	if err == nil {
+		return fresh, nil
+	}
+	if cred != nil && time.Now().Before(cred.Expiration) {
+		p.log.Warn("failed to refresh sts credential, use the cached one", log.Error(err))
+		return cred, nil
+	}
+	return nil, errors.Trace(err)
+}
+
+// Retrieve returns the S3 compatible credential value
+func (p *Provider) Retrieve() (Value, error) {
+	cred, err := p.Get()
+	if err != nil {
+		return Value{}, errors.Trace(err)
+	}
+	return Value{
+		AccessKeyID:     cred.AK,
+		SecretAccessKey: cred.SK,
+		SessionToken:    cred.Token,
+	}, nil
+}
+
+// IsExpired returns whether the credential is absent or within its refresh window
+func (p *Provider) IsExpired() bool {
+	p.lock.RLock()
+	defer p.lock.RUnlock()
+	return p.cred == nil || !time.Now().Before(p.refreshAt)
+}
+
+// Expire drops the cached credential, such as after an access denied error,
+// the next Get refreshes it without falling back to the dropped one, and the background refresh is woken up.
+func (p *Provider) Expire() {
+	p.lock.Lock()
+	p.cred = nil
+	p.refreshAt = time.Time{}
+	p.lock.Unlock()
+	select {
+	case p.expired <- struct{}{}:
+	default:
+	}
+}
+
+// Start refreshes the credential in background before it expires
+func (p *Provider) Start() error {
+	return p.tomb.Go(p.loop)
+}
+
+// Close stops the background refresh
+func (p *Provider) Close() error {
+	p.tomb.Kill(nil)
+	return p.tomb.Wait()
+}
+
+func (p *Provider) loop() error {
+	var failures int
+	for {
+		wait := time.Duration(0)
+		if !p.IsExpired() {
+			p.lock.RLock()
+			wait = time.Until(p.refreshAt)
+			p.lock.RUnlock()
+		}
+		timer := time.NewTimer(wait)
+		select {
+		case <-p.tomb.Dying():
+			timer.Stop()
+			return nil
+		case <-p.expired:
+			timer.Stop()
+		case <-timer.C:
+		}
+		if _, err := p.refresh(); err != nil {
+			failures++
+			retry := p.retryInterval(failures)
+			p.log.Error("failed to refresh sts credential", log.Any("retry", retry), log.Error(err))
+			select {
+			case <-p.tomb.Dying():
+				return nil
+			case <-time.After(retry):
+			}
+			continue
+		}
+		failures = 0
+	}
+}
+
+// retryInterval returns the interval to retry after the failures in a row, which is doubled after each failure
+func (p *Provider) retryInterval(failures int) time.Duration {
+	retry := p.cfg.retryInterval
+	for i := 1; i < failures && retry < p.cfg.maxRetry; i++ {
+		retry *= 2
+	}
+	if retry > p.cfg.maxRetry {
+		retry = p.cfg.maxRetry
+	}
+	return retry
+}
+
+func (p *Provider) refresh() (*v1.STSResponse, error) {
+	v, err, _ := p.group.Do(refreshKey, func() (interface{}, error) {
+		req := &v1.STSRequest{}
+		if err := utils.SetDefaults(req); err != nil {
+			return nil, errors.Trace(err)
+		}
+		if r := p.cfg.request; r != nil {
+			if r.stsType != "" {
+				req.STSType = r.stsType
+			}
+			if r.expired > 0 {
+				req.ExpiredTime = r.expired
+			}
+		}
+		issued := time.Now()
+		cred, err := p.fetch(req)
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+		if cred == nil || cred.AK == "" || cred.SK == "" {
+			return nil, ErrEmptyCredential
+		}
+		p.lock.Lock()
+		p.cred = cred
+		p.refreshAt = p.nextRefresh(issued, time.Now(), cred.Expiration)
+		p.lock.Unlock()
+		p.log.Debug("sts credential refreshed", log.Any("expiration", cred.Expiration))
+		return cred, nil
+	})
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	return v.(*v1.STSResponse), nil
+}
+
+// nextRefresh returns the time to refresh, which is before the expiration by the refresh window plus a random jitter.
+// Credentials living shorter than the window are refreshed at the half of their lifetime.
+// It is not earlier than the min interval since now, even if the credential is already expired.
+func (p *Provider) nextRefresh(issued, now, expiration time.Time) time.Time {
+	window := p.cfg.refreshWindow
+	if p.cfg.jitter > 0 {
+		window += time.Duration(rand.Float64() * p.cfg.jitter * float64(window))
+	}
+	refreshAt := expiration.Add(-window)
+	if lifetime := expiration.Sub(issued); lifetime <= window {
+		refreshAt = issued.Add(lifetime / 2)
+	}
+	if earliest := now.Add(p.cfg.minInterval); refreshAt.Before(earliest) {
+		return earliest
+	}
+	return refreshAt
+}
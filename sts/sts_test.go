@@ -0,0 +1,190 @@
+package sts
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/baetyl/baetyl-go/v2/errors"
+	"github.com/baetyl/baetyl-go/v2/http"
+	"github.com/baetyl/baetyl-go/v2/mock"
+	v1 "github.com/baetyl/baetyl-go/v2/spec/v1"
+)
+
+func TestProvider(t *testing.T) {
+	_, err := NewProvider(nil)
+	assert.Equal(t, ErrFetchNotSet, err)
+
+	var calls int32
+	var lifetime = time.Hour
+	var fail bool
+	var last v1.STSRequest
+	fetch := func(req *v1.STSRequest) (*v1.STSResponse, error) {
+		atomic.AddInt32(&calls, 1)
+		last = *req
+		// make concurrent calls overlap
+		time.Sleep(10 * time.Millisecond)
+		if fail {
+			return nil, errors.New("unavailable")
+		}
+		return &v1.STSResponse{AK: "ak", SK: "sk", Token: "token", Expiration: time.Now().Add(lifetime)}, nil
+	}
+	p, err := NewProvider(fetch, WithRequest("", 2*time.Hour), WithRefreshWindow(time.Minute), WithJitter(0.5))
+	assert.NoError(t, err)
+	assert.True(t, p.IsExpired())
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			v, err := p.Retrieve()
+			assert.NoError(t, err)
+			assert.Equal(t, Value{AccessKeyID: "ak", SecretAccessKey: "sk", SessionToken: "token"}, v)
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, int32(1), atomic.LoadInt32(&calls))
+	assert.False(t, p.IsExpired())
+	assert.Equal(t, v1.STSRequest{STSType: "minio", ExpiredTime: 2 * time.Hour}, last)
+
+	// refresh window with jitter
+	p.lock.RLock()
+	left := p.cred.Expiration.Sub(p.refreshAt)
+	p.lock.RUnlock()
+	assert.True(t, left >= time.Minute && left <= 90*time.Second, left.String())
+
+	// cached
+	_, err = p.Get()
+	assert.NoError(t, err)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&calls))
+
+	// the cached credential is used if the refresh fails before expiration
+	p.lock.Lock()
+	p.refreshAt = time.Time{}
+	p.lock.Unlock()
+	assert.True(t, p.IsExpired())
+	fail = true
+	cred, err := p.Get()
+	assert.NoError(t, err)
+	assert.Equal(t, "ak", cred.AK)
+	assert.Equal(t, int32(2), atomic.LoadInt32(&calls))
+
+	// the expired credential is dropped
+	p.Expire()
+	assert.True(t, p.IsExpired())
+	_, err = p.Get()
+	assert.Error(t, err)
+	assert.Equal(t, int32(3), atomic.LoadInt32(&calls))
+
+	// no credential at all
+	p2, err := NewProvider(fetch)
+	assert.NoError(t, err)
+	_, err = p2.Retrieve()
+	assert.Error(t, err)
+	assert.Equal(t, v1.STSRequest{STSType: "minio", ExpiredTime: 12 * time.Hour}, last)
+}
+
+func TestProviderShortLifetime(t *testing.T) {
+	var calls int32
+	fetch := func(req *v1.STSRequest) (*v1.STSResponse, error) {
+		atomic.AddInt32(&calls, 1)
+		return &v1.STSResponse{AK: "ak", SK: "sk", Expiration: time.Now().Add(100 * time.Millisecond)}, nil
+	}
+	p, err := NewProvider(fetch, WithJitter(0), WithMinInterval(10*time.Millisecond))
+	assert.NoError(t, err)
+	assert.NoError(t, p.Start())
+	time.Sleep(180 * time.Millisecond)
+	assert.NoError(t, p.Close())
+	// refreshed at the half of the lifetime
+	n := atomic.LoadInt32(&calls)
+	assert.True(t, n >= 2 && n <= 6, "calls %d", n)
+}
+
+func TestProviderExpired(t *testing.T) {
+	var calls int32
+	fetch := func(req *v1.STSRequest) (*v1.STSResponse, error) {
+		atomic.AddInt32(&calls, 1)
+		// expired already when received, such as due to clock skew
+		return &v1.STSResponse{AK: "ak", SK: "sk", Expiration: time.Now().Add(-time.Minute)}, nil
+	}
+	p, err := NewProvider(fetch, WithMinInterval(100*time.Millisecond))
+	assert.NoError(t, err)
+	assert.NoError(t, p.Start())
+	time.Sleep(250 * time.Millisecond)
+	assert.NoError(t, p.Close())
+	// refreshed once in the min interval instead of back-to-back
+	n := atomic.LoadInt32(&calls)
+	assert.True(t, n >= 2 && n <= 4, "calls %d", n)
+
+	now := time.Now()
+	assert.Equal(t, now.Add(100*time.Millisecond), p.nextRefresh(now, now, now.Add(-time.Hour)))
+}
+
+func TestProviderExpire(t *testing.T) {
+	var calls int32
+	fetch := func(req *v1.STSRequest) (*v1.STSResponse, error) {
+		atomic.AddInt32(&calls, 1)
+		return &v1.STSResponse{AK: "ak", SK: "sk", Expiration: time.Now().Add(time.Hour)}, nil
+	}
+	p, err := NewProvider(fetch)
+	assert.NoError(t, err)
+	assert.NoError(t, p.Start())
+	defer p.Close()
+	time.Sleep(50 * time.Millisecond)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&calls))
+
+	// the background refresh is woken up at once
+	p.Expire()
+	time.Sleep(50 * time.Millisecond)
+	assert.Equal(t, int32(2), atomic.LoadInt32(&calls))
+	assert.False(t, p.IsExpired())
+}
+
+func TestProviderRetry(t *testing.T) {
+	var calls int32
+	fetch := func(req *v1.STSRequest) (*v1.STSResponse, error) {
+		atomic.AddInt32(&calls, 1)
+		return nil, errors.New("unavailable")
+	}
+	p, err := NewProvider(fetch, WithRetryInterval(20*time.Millisecond), WithMaxRetryInterval(80*time.Millisecond))
+	assert.NoError(t, err)
+	assert.Equal(t, 20*time.Millisecond, p.retryInterval(1))
+	assert.Equal(t, 40*time.Millisecond, p.retryInterval(2))
+	assert.Equal(t, 80*time.Millisecond, p.retryInterval(3))
+	assert.Equal(t, 80*time.Millisecond, p.retryInterval(100))
+
+	// retried at 0, 20, 60, 140, 220ms with backoff
+	assert.NoError(t, p.Start())
+	time.Sleep(250 * time.Millisecond)
+	assert.NoError(t, p.Close())
+	n := atomic.LoadInt32(&calls)
+	assert.True(t, n >= 4 && n <= 6, "calls %d", n)
+}
+
+func TestHTTPFetch(t *testing.T) {
+	ms := mock.NewServer(nil,
+		mock.NewResponse(200, []byte(`{"ak":"ak","sk":"sk","token":"token","expiration":"2030-01-01T00:00:00Z"}`)),
+		mock.NewResponse(200, []byte(`{}`)),
+		mock.NewResponse(500, []byte("error")),
+	)
+	defer ms.Close()
+	ops := http.NewClientOptions()
+	ops.Address = ms.URL
+	fetch := NewHTTPFetch(http.NewClient(ops), "sts")
+
+	res, err := fetch(&v1.STSRequest{})
+	assert.NoError(t, err)
+	assert.Equal(t, "token", res.Token)
+	assert.Equal(t, 2030, res.Expiration.Year())
+
+	p, err := NewProvider(fetch)
+	assert.NoError(t, err)
+	_, err = p.Get()
+	assert.Equal(t, ErrEmptyCredential, errors.Cause(err))
+	_, err = p.Get()
+	assert.EqualError(t, errors.Cause(err), "[500] error")
+}
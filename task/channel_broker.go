@@ -22,10 +22,13 @@ func NewChannelBroker(cache int) TaskBroker {
 }
 
 func (b *channelBroker) SendMessage(msg *BrokerMessage) error {
+	// counted before sent, otherwise the receiver may decrease it first
+	metricQueueDepth.Inc()
 	select {
 	case b.broker <- msg:
 		return nil
 	case <-time.After(time.Millisecond):
+		metricQueueDepth.Dec()
 		return SendMsgTimeout
 	}
 }
@@ -33,6 +36,9 @@ func (b *channelBroker) SendMessage(msg *BrokerMessage) error {
 func (b *channelBroker) GetMessage() (*BrokerMessage, error) {
 	select {
 	case msg := <-b.broker:
+		if msg != nil {
+			metricQueueDepth.Dec()
+		}
 		return msg, nil
 	case <-time.After(time.Millisecond):
 		return nil, GetMsgTimeout
@@ -0,0 +1,9 @@
+package task
+
+import (
+	"github.com/baetyl/baetyl-go/v2/metrics"
+)
+
+var (
+	metricQueueDepth = metrics.DefaultRegistry.NewGauge("baetyl_task_queue_depth", "The number of task messages waiting in channel brokers.")
+)
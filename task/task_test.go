@@ -154,3 +154,18 @@ func TestTaskMultiValues(t *testing.T) {
 	_, err = asyncBlank.Get(time.Millisecond)
 	assert.NotNil(t, err)
 }
+
+func TestChannelBrokerQueueDepth(t *testing.T) {
+	broker := NewChannelBroker(2)
+	depth := metricQueueDepth.Value()
+
+	assert.NoError(t, broker.SendMessage(&BrokerMessage{}))
+	assert.NoError(t, broker.SendMessage(&BrokerMessage{}))
+	assert.Equal(t, SendMsgTimeout, broker.SendMessage(&BrokerMessage{}))
+	assert.Equal(t, depth+2, metricQueueDepth.Value())
+
+	_, err := broker.GetMessage()
+	assert.NoError(t, err)
+	assert.Equal(t, depth+1, metricQueueDepth.Value())
+	assert.NoError(t, broker.Close())
+}
@@ -0,0 +1,182 @@
+package otlp
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+
+	"github.com/baetyl/baetyl-go/v2/errors"
+	"github.com/baetyl/baetyl-go/v2/http"
+	"github.com/baetyl/baetyl-go/v2/json"
+	"github.com/baetyl/baetyl-go/v2/trace"
+)
+
+const scopeName = "github.com/baetyl/baetyl-go/v2/trace"
+
+// Config the config of OTLP exporter
+type Config struct {
+	// specifies the url of the traces endpoint of OTLP/HTTP
+	URL string `yaml:"url" json:"url" default:"http://localhost:4318/v1/traces"`
+	// specifies the name of service which produces spans
+	ServiceName string `yaml:"serviceName" json:"serviceName"`
+	// specifies the attributes of resource besides service name
+	Attributes map[string]string `yaml:"attributes" json:"attributes"`
+	// specifies the headers sent with each request, such as authorization
+	Headers map[string]string `yaml:"headers" json:"headers"`
+	Client  http.ClientConfig `yaml:"client" json:"client"`
+}
+
+// Exporter exports spans in the JSON encoding of OTLP over HTTP
+type Exporter struct {
+	cfg      Config
+	cli      *http.Client
+	resource resource
+}
+
+// NewExporter creates a new exporter
+func NewExporter(cfg Config) (*Exporter, error) {
+	ops, err := cfg.Client.ToClientOptions()
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	res := resource{Attributes: []keyValue{{Key: "service.name", Value: newValue(cfg.ServiceName)}}}
+	keys := make([]string, 0, len(cfg.Attributes))
+	for k := range cfg.Attributes {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		res.Attributes = append(res.Attributes, keyValue{Key: k, Value: newValue(cfg.Attributes[k])})
+	}
+	return &Exporter{
+		cfg:      cfg,
+		cli:      http.NewClient(ops),
+		resource: res,
+	}, nil
+}
+
+// Export posts spans to the endpoint
+func (e *Exporter) Export(spans []*trace.SpanData) error {
+	if len(spans) == 0 {
+		return nil
+	}
+	req := exportRequest{ResourceSpans: []resourceSpans{{
+		Resource: e.resource,
+		ScopeSpans: []scopeSpans{{
+			Scope: scope{Name: scopeName},
+			Spans: make([]span, 0, len(spans)),
+		}},
+	}}}
+	for _, s := range spans {
+		req.ResourceSpans[0].ScopeSpans[0].Spans = append(req.ResourceSpans[0].ScopeSpans[0].Spans, newSpan(s))
+	}
+	data, err := json.Marshal(req)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	_, err = e.cli.PostJSON(e.cfg.URL, data, e.cfg.Headers)
+	return errors.Trace(err)
+}
+
+// Close closes the exporter
+func (e *Exporter) Close() error {
+	return nil
+}
+
+type exportRequest struct {
+	ResourceSpans []resourceSpans `json:"resourceSpans"`
+}
+
+type resourceSpans struct {
+	Resource   resource     `json:"resource"`
+	ScopeSpans []scopeSpans `json:"scopeSpans"`
+}
+
+type resource struct {
+	Attributes []keyValue `json:"attributes"`
+}
+
+type scopeSpans struct {
+	Scope scope  `json:"scope"`
+	Spans []span `json:"spans"`
+}
+
+type scope struct {
+	Name string `json:"name"`
+}
+
+type span struct {
+	TraceID           string     `json:"traceId"`
+	SpanID            string     `json:"spanId"`
+	TraceState        string     `json:"traceState,omitempty"`
+	ParentSpanID      string     `json:"parentSpanId,omitempty"`
+	Name              string     `json:"name"`
+	Kind              int        `json:"kind"`
+	StartTimeUnixNano string     `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string     `json:"endTimeUnixNano"`
+	Attributes        []keyValue `json:"attributes,omitempty"`
+	Status            status     `json:"status"`
+}
+
+type status struct {
+	Code    int    `json:"code,omitempty"`
+	Message string `json:"message,omitempty"`
+}
+
+type keyValue struct {
+	Key   string `json:"key"`
+	Value value  `json:"value"`
+}
+
+// value the any value of OTLP, 64-bit integers are encoded as strings in JSON
+type value struct {
+	StringValue *string  `json:"stringValue,omitempty"`
+	BoolValue   *bool    `json:"boolValue,omitempty"`
+	IntValue    *string  `json:"intValue,omitempty"`
+	DoubleValue *float64 `json:"doubleValue,omitempty"`
+}
+
+func newSpan(s *trace.SpanData) span {
+	res := span{
+		TraceID:           s.SpanContext.TraceID.String(),
+		SpanID:            s.SpanContext.SpanID.String(),
+		TraceState:        s.SpanContext.State,
+		Name:              s.Name,
+		Kind:              int(s.Kind),
+		StartTimeUnixNano: strconv.FormatInt(s.StartTime.UnixNano(), 10),
+		EndTimeUnixNano:   strconv.FormatInt(s.EndTime.UnixNano(), 10),
+		Status:            status{Code: int(s.Status.Code), Message: s.Status.Message},
+	}
+	if s.Parent.IsValid() {
+		res.ParentSpanID = s.Parent.String()
+	}
+	keys := make([]string, 0, len(s.Attributes))
+	for k := range s.Attributes {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		res.Attributes = append(res.Attributes, keyValue{Key: k, Value: newValue(s.Attributes[k])})
+	}
+	return res
+}
+
+func newValue(v interface{}) value {
+	switch t := v.(type) {
+	case string:
+		return value{StringValue: &t}
+	case bool:
+		return value{BoolValue: &t}
+	case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64:
+		s := fmt.Sprint(t)
+		return value{IntValue: &s}
+	case float32:
+		f := float64(t)
+		return value{DoubleValue: &f}
+	case float64:
+		return value{DoubleValue: &t}
+	default:
+		s := fmt.Sprint(t)
+		return value{StringValue: &s}
+	}
+}
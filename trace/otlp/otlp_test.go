@@ -0,0 +1,61 @@
+package otlp
+
+import (
+	"io/ioutil"
+	gohttp "net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/baetyl/baetyl-go/v2/trace"
+	"github.com/baetyl/baetyl-go/v2/utils"
+)
+
+func TestExporter(t *testing.T) {
+	var body []byte
+	var auth string
+	ts := httptest.NewServer(gohttp.HandlerFunc(func(w gohttp.ResponseWriter, r *gohttp.Request) {
+		auth = r.Header.Get("Authorization")
+		body, _ = ioutil.ReadAll(r.Body)
+	}))
+	defer ts.Close()
+
+	var cfg Config
+	assert.NoError(t, utils.UnmarshalYAML(nil, &cfg))
+	assert.Equal(t, "http://localhost:4318/v1/traces", cfg.URL)
+	cfg.URL = ts.URL + "/v1/traces"
+	cfg.ServiceName = "svc"
+	cfg.Attributes = map[string]string{"node": "n1"}
+	cfg.Headers = map[string]string{"Authorization": "Bearer x"}
+	e, err := NewExporter(cfg)
+	assert.NoError(t, err)
+	defer e.Close()
+
+	sc, err := trace.ParseTraceParent("00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01")
+	assert.NoError(t, err)
+	parent := sc.SpanID
+	sc.SpanID = trace.SpanID{1, 2, 3, 4, 5, 6, 7, 8}
+	start := time.Unix(1, 5)
+	assert.NoError(t, e.Export(nil))
+	assert.Nil(t, body)
+	err = e.Export([]*trace.SpanData{{
+		Name:        "op",
+		Kind:        trace.KindClient,
+		SpanContext: sc,
+		Parent:      parent,
+		StartTime:   start,
+		EndTime:     start.Add(time.Second),
+		Attributes:  map[string]interface{}{"s": "v", "b": true, "i": 3, "f": 1.5},
+		Status:      trace.Status{Code: trace.StatusError, Message: "failed"},
+	}})
+	assert.NoError(t, err)
+	assert.Equal(t, "Bearer x", auth)
+	expected := `{"resourceSpans":[{"resource":{"attributes":[{"key":"service.name","value":{"stringValue":"svc"}},{"key":"node","value":{"stringValue":"n1"}}]},` +
+		`"scopeSpans":[{"scope":{"name":"github.com/baetyl/baetyl-go/v2/trace"},"spans":[{"traceId":"0af7651916cd43dd8448eb211c80319c","spanId":"0102030405060708",` +
+		`"parentSpanId":"b7ad6b7169203331","name":"op","kind":3,"startTimeUnixNano":"1000000005","endTimeUnixNano":"2000000005",` +
+		`"attributes":[{"key":"b","value":{"boolValue":true}},{"key":"f","value":{"doubleValue":1.5}},{"key":"i","value":{"intValue":"3"}},{"key":"s","value":{"stringValue":"v"}}],` +
+		`"status":{"code":2,"message":"failed"}}]}]}]}`
+	assert.JSONEq(t, expected, string(body))
+}
@@ -0,0 +1,289 @@
+package trace
+
+import (
+	"context"
+	"io"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/baetyl/baetyl-go/v2/errors"
+	"github.com/baetyl/baetyl-go/v2/log"
+	"github.com/baetyl/baetyl-go/v2/utils"
+)
+
+// Kind the kind of span
+type Kind int
+
+// All kinds of span, the values follow OpenTelemetry
+const (
+	KindInternal Kind = iota + 1
+	KindServer
+	KindClient
+	KindProducer
+	KindConsumer
+)
+
+// StatusCode the status code of span, the values follow OpenTelemetry
+type StatusCode int
+
+// All status codes
+const (
+	StatusUnset StatusCode = iota
+	StatusOK
+	StatusError
+)
+
+// Status the status of span
+type Status struct {
+	Code    StatusCode
+	Message string
+}
+
+// SpanData the data of an ended span, which is exported
+type SpanData struct {
+	Name        string
+	Kind        Kind
+	SpanContext SpanContext
+	Parent      SpanID
+	StartTime   time.Time
+	EndTime     time.Time
+	Attributes  map[string]interface{}
+	Status      Status
+}
+
+// Exporter exports spans to a tracing backend
+type Exporter interface {
+	Export(spans []*SpanData) error
+	io.Closer
+}
+
+// Span the span of an operation, which is exported when ended if it is sampled
+type Span struct {
+	tracer *Tracer
+	data   SpanData
+	ended  bool
+	mut    sync.Mutex
+}
+
+// SpanContext returns the span context
+func (s *Span) SpanContext() SpanContext {
+	return s.data.SpanContext
+}
+
+// SetAttribute sets an attribute, value can be string, bool, integer or float
+func (s *Span) SetAttribute(key string, value interface{}) {
+	s.mut.Lock()
+	defer s.mut.Unlock()
+	if s.ended {
+		return
+	}
+	if s.data.Attributes == nil {
+		s.data.Attributes = map[string]interface{}{}
+	}
+	s.data.Attributes[key] = value
+}
+
+// SetStatus sets the status
+func (s *Span) SetStatus(code StatusCode, msg string) {
+	s.mut.Lock()
+	defer s.mut.Unlock()
+	if s.ended {
+		return
+	}
+	s.data.Status = Status{Code: code, Message: msg}
+}
+
+// SetError sets the error status if err is not nil
+func (s *Span) SetError(err error) {
+	if err != nil {
+		s.SetStatus(StatusError, err.Error())
+	}
+}
+
+// End ends the span, only the first call takes effect
+func (s *Span) End() {
+	s.mut.Lock()
+	if s.ended {
+		s.mut.Unlock()
+		return
+	}
+	s.ended = true
+	s.data.EndTime = time.Now()
+	data := s.data
+	s.mut.Unlock()
+
+	if s.tracer != nil && data.SpanContext.IsSampled() {
+		s.tracer.export(&data)
+	}
+}
+
+// Config the config of tracer
+type Config struct {
+	// specifies the ratio of root spans to sample, child spans follow their parents
+	SampleRatio float64 `yaml:"sampleRatio" json:"sampleRatio" default:"1"`
+	// specifies the max number of spans waiting to export, spans are dropped if the queue is full
+	QueueSize int `yaml:"queueSize" json:"queueSize" default:"2048"`
+	// specifies the max number of spans exported in a batch
+	BatchSize int `yaml:"batchSize" json:"batchSize" default:"512"`
+	// specifies the interval to export spans
+	Interval time.Duration `yaml:"interval" json:"interval" default:"5s"`
+}
+
+// Tracer starts spans and exports them in batches
+type Tracer struct {
+	cfg      Config
+	exporter Exporter
+	queue    chan *SpanData
+	dropped  uint64
+	log      *log.Logger
+	tomb     utils.Tomb
+	once     sync.Once
+}
+
+// NewTracer creates a new tracer, spans are only propagated but not exported if exporter is nil
+func NewTracer(cfg Config, exporter Exporter) *Tracer {
+	t := &Tracer{
+		cfg:      cfg,
+		exporter: exporter,
+		log:      log.With(log.Any("trace", "tracer")),
+	}
+	if exporter != nil {
+		if t.cfg.QueueSize <= 0 {
+			t.cfg.QueueSize = 2048
+		}
+		if t.cfg.BatchSize <= 0 {
+			t.cfg.BatchSize = 512
+		}
+		if t.cfg.Interval <= 0 {
+			t.cfg.Interval = 5 * time.Second
+		}
+		t.queue = make(chan *SpanData, t.cfg.QueueSize)
+		t.tomb.Go(t.exporting)
+	}
+	return t
+}
+
+// Start starts a span, which is the child of the span carried by ctx, or a root span if not found.
+// Returns a copy of ctx carrying the new span.
+func (t *Tracer) Start(ctx context.Context, name string, kind Kind) (context.Context, *Span) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	parent := SpanContextFromContext(ctx)
+	sc := SpanContext{SpanID: idGen.spanID()}
+	var parentID SpanID
+	if parent.IsValid() {
+		sc.TraceID = parent.TraceID
+		sc.Flags = parent.Flags
+		sc.State = parent.State
+		parentID = parent.SpanID
+	} else {
+		sc.TraceID = idGen.traceID()
+		if t.cfg.SampleRatio >= 1 || (t.cfg.SampleRatio > 0 && idGen.float64() < t.cfg.SampleRatio) {
+			sc.Flags = FlagSampled
+		}
+	}
+	s := &Span{
+		tracer: t,
+		data: SpanData{
+			Name:        name,
+			Kind:        kind,
+			SpanContext: sc,
+			Parent:      parentID,
+			StartTime:   time.Now(),
+		},
+	}
+	return ContextWithSpanContext(ctx, sc), s
+}
+
+// Dropped returns the number of spans dropped since the queue is full
+func (t *Tracer) Dropped() uint64 {
+	return atomic.LoadUint64(&t.dropped)
+}
+
+// Close exports the spans left in the queue and closes the exporter
+func (t *Tracer) Close() error {
+	if t.exporter == nil {
+		return nil
+	}
+	var err error
+	t.once.Do(func() {
+		t.tomb.Kill(nil)
+		t.tomb.Wait()
+		err = errors.Trace(t.exporter.Close())
+	})
+	return err
+}
+
+func (t *Tracer) export(data *SpanData) {
+	if t.queue == nil {
+		return
+	}
+	select {
+	case t.queue <- data:
+	default:
+		atomic.AddUint64(&t.dropped, 1)
+	}
+}
+
+func (t *Tracer) exporting() error {
+	ticker := time.NewTicker(t.cfg.Interval)
+	defer ticker.Stop()
+
+	batch := make([]*SpanData, 0, t.cfg.BatchSize)
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		if err := t.exporter.Export(batch); err != nil {
+			t.log.Warn("failed to export spans", log.Any("count", len(batch)), log.Error(err))
+		}
+		batch = make([]*SpanData, 0, t.cfg.BatchSize)
+	}
+	for {
+		select {
+		case data := <-t.queue:
+			batch = append(batch, data)
+			if len(batch) >= t.cfg.BatchSize {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		case <-t.tomb.Dying():
+			for {
+				select {
+				case data := <-t.queue:
+					batch = append(batch, data)
+					if len(batch) >= t.cfg.BatchSize {
+						flush()
+					}
+				default:
+					flush()
+					return nil
+				}
+			}
+		}
+	}
+}
+
+var global atomic.Value
+
+func init() {
+	global.Store(NewTracer(Config{SampleRatio: 1}, nil))
+}
+
+// SetTracer sets the global tracer used by Start and the instrumented subsystems
+func SetTracer(t *Tracer) {
+	global.Store(t)
+}
+
+// GetTracer returns the global tracer, which only propagates spans by default
+func GetTracer() *Tracer {
+	return global.Load().(*Tracer)
+}
+
+// Start starts a span with the global tracer
+func Start(ctx context.Context, name string, kind Kind) (context.Context, *Span) {
+	return GetTracer().Start(ctx, name, kind)
+}
@@ -0,0 +1,222 @@
+package trace
+
+import (
+	"context"
+	crand "crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"math/rand"
+	gohttp "net/http"
+	"strings"
+	"sync"
+
+	"github.com/baetyl/baetyl-go/v2/errors"
+)
+
+// The keys of W3C trace context
+const (
+	KeyTraceParent = "traceparent"
+	KeyTraceState  = "tracestate"
+)
+
+const (
+	traceVersion = "00"
+	// FlagSampled the flag of sampled trace
+	FlagSampled byte = 0x01
+)
+
+var (
+	ErrInvalidTraceParent = errors.New("invalid traceparent")
+)
+
+// TraceID the id of trace
+type TraceID [16]byte
+
+// SpanID the id of span
+type SpanID [8]byte
+
+// IsValid returns whether the id is not all zeros
+func (t TraceID) IsValid() bool {
+	return t != TraceID{}
+}
+
+// String returns the hex encoding of id
+func (t TraceID) String() string {
+	return hex.EncodeToString(t[:])
+}
+
+// IsValid returns whether the id is not all zeros
+func (s SpanID) IsValid() bool {
+	return s != SpanID{}
+}
+
+// String returns the hex encoding of id
+func (s SpanID) String() string {
+	return hex.EncodeToString(s[:])
+}
+
+// SpanContext the identity of span propagated across services
+type SpanContext struct {
+	TraceID TraceID
+	SpanID  SpanID
+	Flags   byte
+	// State the vendor-specific trace state, propagated as it is
+	State  string
+	Remote bool
+}
+
+// IsValid returns whether both trace id and span id are valid
+func (sc SpanContext) IsValid() bool {
+	return sc.TraceID.IsValid() && sc.SpanID.IsValid()
+}
+
+// IsSampled returns whether the trace is sampled
+func (sc SpanContext) IsSampled() bool {
+	return sc.Flags&FlagSampled == FlagSampled
+}
+
+// TraceParent returns the value of traceparent
+func (sc SpanContext) TraceParent() string {
+	return traceVersion + "-" + sc.TraceID.String() + "-" + sc.SpanID.String() + "-" + hex.EncodeToString([]byte{sc.Flags})
+}
+
+// ParseTraceParent parses the value of traceparent, the state is not set
+func ParseTraceParent(v string) (SpanContext, error) {
+	var sc SpanContext
+	parts := strings.Split(strings.TrimSpace(v), "-")
+	// future versions may append fields
+	if len(parts) < 4 || len(parts[0]) != 2 || parts[0] == "ff" || (parts[0] == traceVersion && len(parts) != 4) {
+		return sc, errors.Trace(ErrInvalidTraceParent)
+	}
+	if len(parts[1]) != 32 || len(parts[2]) != 16 || len(parts[3]) != 2 {
+		return sc, errors.Trace(ErrInvalidTraceParent)
+	}
+	if _, err := hex.Decode(sc.TraceID[:], []byte(parts[1])); err != nil || strings.ToLower(parts[1]) != parts[1] {
+		return sc, errors.Trace(ErrInvalidTraceParent)
+	}
+	if _, err := hex.Decode(sc.SpanID[:], []byte(parts[2])); err != nil || strings.ToLower(parts[2]) != parts[2] {
+		return sc, errors.Trace(ErrInvalidTraceParent)
+	}
+	flags, err := hex.DecodeString(parts[3])
+	if err != nil {
+		return sc, errors.Trace(ErrInvalidTraceParent)
+	}
+	sc.Flags = flags[0]
+	if !sc.IsValid() {
+		return sc, errors.Trace(ErrInvalidTraceParent)
+	}
+	return sc, nil
+}
+
+type spanContextKey struct{}
+
+// ContextWithSpanContext returns a copy of ctx carrying the span context
+func ContextWithSpanContext(ctx context.Context, sc SpanContext) context.Context {
+	return context.WithValue(ctx, spanContextKey{}, sc)
+}
+
+// SpanContextFromContext returns the span context carried by ctx, the result is invalid if not found
+func SpanContextFromContext(ctx context.Context) SpanContext {
+	if ctx == nil {
+		return SpanContext{}
+	}
+	sc, _ := ctx.Value(spanContextKey{}).(SpanContext)
+	return sc
+}
+
+// Carrier the carrier of trace context, such as http headers and message metadata
+type Carrier interface {
+	Get(key string) string
+	Set(key, value string)
+}
+
+// HeaderCarrier adapts http header to Carrier
+type HeaderCarrier gohttp.Header
+
+// Get returns the value of key
+func (h HeaderCarrier) Get(key string) string {
+	return gohttp.Header(h).Get(key)
+}
+
+// Set sets the value of key
+func (h HeaderCarrier) Set(key, value string) {
+	gohttp.Header(h).Set(key, value)
+}
+
+// MapCarrier adapts map to Carrier, such as the metadata of function message
+type MapCarrier map[string]string
+
+// Get returns the value of key
+func (m MapCarrier) Get(key string) string {
+	return m[key]
+}
+
+// Set sets the value of key
+func (m MapCarrier) Set(key, value string) {
+	m[key] = value
+}
+
+// Inject writes the span context carried by ctx into carrier, nothing is written if not found
+func Inject(ctx context.Context, carrier Carrier) {
+	sc := SpanContextFromContext(ctx)
+	if !sc.IsValid() {
+		return
+	}
+	carrier.Set(KeyTraceParent, sc.TraceParent())
+	if sc.State != "" {
+		carrier.Set(KeyTraceState, sc.State)
+	}
+}
+
+// Extract reads the span context from carrier, returns a copy of ctx carrying it as a remote parent.
+// ctx is returned as it is if the carrier has no valid trace context.
+func Extract(ctx context.Context, carrier Carrier) context.Context {
+	sc, err := ParseTraceParent(carrier.Get(KeyTraceParent))
+	if err != nil {
+		return ctx
+	}
+	sc.State = carrier.Get(KeyTraceState)
+	sc.Remote = true
+	return ContextWithSpanContext(ctx, sc)
+}
+
+var idGen = newIDGenerator()
+
+type idGenerator struct {
+	rand *rand.Rand
+	mut  sync.Mutex
+}
+
+func newIDGenerator() *idGenerator {
+	var seed int64
+	if err := binary.Read(crand.Reader, binary.LittleEndian, &seed); err != nil {
+		seed = rand.Int63()
+	}
+	return &idGenerator{rand: rand.New(rand.NewSource(seed))}
+}
+
+func (g *idGenerator) traceID() TraceID {
+	g.mut.Lock()
+	defer g.mut.Unlock()
+	var id TraceID
+	for !id.IsValid() {
+		g.rand.Read(id[:])
+	}
+	return id
+}
+
+func (g *idGenerator) spanID() SpanID {
+	g.mut.Lock()
+	defer g.mut.Unlock()
+	var id SpanID
+	for !id.IsValid() {
+		g.rand.Read(id[:])
+	}
+	return id
+}
+
+func (g *idGenerator) float64() float64 {
+	g.mut.Lock()
+	defer g.mut.Unlock()
+	return g.rand.Float64()
+}
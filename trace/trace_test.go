@@ -0,0 +1,153 @@
+package trace
+
+import (
+	"context"
+	gohttp "net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/baetyl/baetyl-go/v2/errors"
+)
+
+func TestParseTraceParent(t *testing.T) {
+	sc, err := ParseTraceParent("00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01")
+	assert.NoError(t, err)
+	assert.Equal(t, "0af7651916cd43dd8448eb211c80319c", sc.TraceID.String())
+	assert.Equal(t, "b7ad6b7169203331", sc.SpanID.String())
+	assert.True(t, sc.IsSampled())
+	assert.Equal(t, "00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01", sc.TraceParent())
+
+	// future version with extra fields
+	sc, err = ParseTraceParent("01-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-00-extra")
+	assert.NoError(t, err)
+	assert.False(t, sc.IsSampled())
+
+	invalids := []string{
+		"",
+		"00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331",
+		"00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01-extra",
+		"ff-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01",
+		"00-00000000000000000000000000000000-b7ad6b7169203331-01",
+		"00-0af7651916cd43dd8448eb211c80319c-0000000000000000-01",
+		"00-0AF7651916CD43DD8448EB211C80319C-b7ad6b7169203331-01",
+		"00-0af7651916cd43dd8448eb211c80319x-b7ad6b7169203331-01",
+		"00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-0x",
+	}
+	for _, v := range invalids {
+		_, err = ParseTraceParent(v)
+		assert.Equal(t, ErrInvalidTraceParent, errors.Cause(err), v)
+	}
+}
+
+func TestPropagation(t *testing.T) {
+	h := gohttp.Header{}
+	Inject(context.Background(), HeaderCarrier(h))
+	assert.Len(t, h, 0)
+	assert.Equal(t, context.Background(), Extract(context.Background(), HeaderCarrier(h)))
+
+	h.Set(KeyTraceParent, "00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01")
+	h.Set(KeyTraceState, "congo=t61rcWkgMzE")
+	ctx := Extract(context.Background(), HeaderCarrier(h))
+	sc := SpanContextFromContext(ctx)
+	assert.True(t, sc.IsValid())
+	assert.True(t, sc.Remote)
+	assert.Equal(t, "congo=t61rcWkgMzE", sc.State)
+
+	m := MapCarrier{}
+	Inject(ctx, m)
+	assert.Equal(t, MapCarrier{
+		KeyTraceParent: "00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01",
+		KeyTraceState:  "congo=t61rcWkgMzE",
+	}, m)
+}
+
+type mockExporter struct {
+	spans  []*SpanData
+	closed bool
+	mut    sync.Mutex
+}
+
+func (e *mockExporter) Export(spans []*SpanData) error {
+	e.mut.Lock()
+	defer e.mut.Unlock()
+	e.spans = append(e.spans, spans...)
+	return nil
+}
+
+func (e *mockExporter) Close() error {
+	e.closed = true
+	return nil
+}
+
+func TestTracer(t *testing.T) {
+	exp := &mockExporter{}
+	tr := NewTracer(Config{SampleRatio: 1, BatchSize: 2, Interval: time.Hour}, exp)
+
+	ctx, root := tr.Start(context.Background(), "root", KindServer)
+	assert.True(t, root.SpanContext().IsValid())
+	assert.True(t, root.SpanContext().IsSampled())
+	assert.Equal(t, root.SpanContext(), SpanContextFromContext(ctx))
+
+	_, child := tr.Start(ctx, "child", KindClient)
+	assert.Equal(t, root.SpanContext().TraceID, child.SpanContext().TraceID)
+	assert.NotEqual(t, root.SpanContext().SpanID, child.SpanContext().SpanID)
+	child.SetAttribute("k", "v")
+	child.SetError(errors.New("failed"))
+	child.End()
+	// ignored after ended
+	child.SetAttribute("k2", "v2")
+	child.End()
+	root.End()
+
+	// the last span is flushed when closed
+	_, last := tr.Start(context.Background(), "last", KindInternal)
+	last.End()
+	assert.NoError(t, tr.Close())
+	assert.True(t, exp.closed)
+
+	assert.Len(t, exp.spans, 3)
+	assert.Equal(t, "child", exp.spans[0].Name)
+	assert.Equal(t, KindClient, exp.spans[0].Kind)
+	assert.Equal(t, root.SpanContext().SpanID, exp.spans[0].Parent)
+	assert.Equal(t, map[string]interface{}{"k": "v"}, exp.spans[0].Attributes)
+	assert.Equal(t, Status{Code: StatusError, Message: "failed"}, exp.spans[0].Status)
+	assert.Equal(t, "root", exp.spans[1].Name)
+	assert.False(t, exp.spans[1].Parent.IsValid())
+	assert.Equal(t, "last", exp.spans[2].Name)
+	assert.Equal(t, uint64(0), tr.Dropped())
+}
+
+func TestTracerSampling(t *testing.T) {
+	exp := &mockExporter{}
+	tr := NewTracer(Config{SampleRatio: 0, QueueSize: 1, BatchSize: 1, Interval: time.Hour}, exp)
+	ctx, s := tr.Start(context.Background(), "unsampled", KindInternal)
+	assert.False(t, s.SpanContext().IsSampled())
+	// child follows the parent
+	_, c := tr.Start(ctx, "child", KindInternal)
+	assert.False(t, c.SpanContext().IsSampled())
+	c.End()
+	s.End()
+	assert.NoError(t, tr.Close())
+	assert.Len(t, exp.spans, 0)
+}
+
+func TestGlobalTracer(t *testing.T) {
+	old := GetTracer()
+	defer SetTracer(old)
+
+	ctx, s := Start(context.Background(), "propagated", KindInternal)
+	assert.True(t, SpanContextFromContext(ctx).IsValid())
+	s.End()
+
+	exp := &mockExporter{}
+	tr := NewTracer(Config{SampleRatio: 1}, exp)
+	SetTracer(tr)
+	assert.Equal(t, tr, GetTracer())
+	_, s = Start(context.Background(), "exported", KindInternal)
+	s.End()
+	assert.NoError(t, tr.Close())
+	assert.Len(t, exp.spans, 1)
+}
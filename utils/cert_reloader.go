@@ -0,0 +1,159 @@
+package utils
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sync"
+
+	"github.com/baetyl/baetyl-go/v2/errors"
+)
+
+// CertReloader loads the key pair from files, and reloads it once the files are changed.
+// It serves certificates for tls config by GetCertificate and GetClientCertificate callbacks,
+// so that the connections established after rotation use the new certificate without restart.
+type CertReloader struct {
+	cert       string
+	key        string
+	passphrase string
+	pair       *tls.Certificate
+	stamp      string
+	mut        sync.Mutex
+}
+
+// NewCertReloader creates a new reloader of the key pair, the files are loaded at once
+func NewCertReloader(cert, key, passphrase string) (*CertReloader, error) {
+	r := &CertReloader{cert: cert, key: key, passphrase: passphrase}
+	if err := r.Reload(); err != nil {
+		return nil, errors.Trace(err)
+	}
+	return r, nil
+}
+
+// Reload reloads the key pair if the files are changed,
+// the last good key pair is kept if failed to load the new one.
+func (r *CertReloader) Reload() error {
+	stamp, err := fileStamp(r.cert, r.key)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	r.mut.Lock()
+	defer r.mut.Unlock()
+	if r.pair != nil && stamp == r.stamp {
+		return nil
+	}
+	pair, err := loadKeyPair(r.cert, r.key, r.passphrase)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	r.pair = pair
+	r.stamp = stamp
+	return nil
+}
+
+// Certificate returns the latest key pair, it is reloaded if the files are changed
+func (r *CertReloader) Certificate() *tls.Certificate {
+	// the old key pair still works until it expires, even if the new one is broken
+	_ = r.Reload()
+	r.mut.Lock()
+	defer r.mut.Unlock()
+	return r.pair
+}
+
+// Leaf returns the parsed leaf certificate of the latest key pair
+func (r *CertReloader) Leaf() *x509.Certificate {
+	return r.Certificate().Leaf
+}
+
+// GetCertificate the callback of tls config for server
+func (r *CertReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	return r.Certificate(), nil
+}
+
+// GetClientCertificate the callback of tls config for client
+func (r *CertReloader) GetClientCertificate(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+	return r.Certificate(), nil
+}
+
+// NewTLSConfigServerWithReload loads tls config for server, the certificate is reloaded once the files are changed
+func NewTLSConfigServerWithReload(c Certificate) (*tls.Config, error) {
+	cfg, err := NewTLSConfigServer(c)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	r, err := NewCertReloader(c.Cert, c.Key, c.Passphrase)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	cfg.Certificates = nil
+	cfg.GetCertificate = r.GetCertificate
+	return cfg, nil
+}
+
+// NewTLSConfigClientWithReload loads tls config for client, the certificate is reloaded once the files are changed.
+// It is the same as NewTLSConfigClientWithPassphrase if the certificate is not set.
+func NewTLSConfigClientWithReload(c Certificate) (*tls.Config, error) {
+	cfg, err := NewTLSConfigClientWithPassphrase(c)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	if c.Cert == "" || c.Key == "" {
+		return cfg, nil
+	}
+	r, err := NewCertReloader(c.Cert, c.Key, c.Passphrase)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	SetClientCertReloader(cfg, r)
+	return cfg, nil
+}
+
+// SetClientCertReloader sets the reloader to serve the client certificate of tls config
+func SetClientCertReloader(cfg *tls.Config, r *CertReloader) {
+	cfg.Certificates = nil
+	cfg.GetClientCertificate = r.GetClientCertificate
+}
+
+func fileStamp(files ...string) (string, error) {
+	var stamp string
+	for _, f := range files {
+		info, err := os.Stat(f)
+		if err != nil {
+			return "", errors.Trace(err)
+		}
+		stamp += fmt.Sprintf("%d/%d;", info.ModTime().UnixNano(), info.Size())
+	}
+	return stamp, nil
+}
+
+func loadKeyPair(certFile, keyFile, passphrase string) (*tls.Certificate, error) {
+	crt, err := ioutil.ReadFile(certFile)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	key, err := ioutil.ReadFile(keyFile)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	if passphrase != "" {
+		if block, _ := pem.Decode(key); block != nil && x509.IsEncryptedPEMBlock(block) {
+			der, err := x509.DecryptPEMBlock(block, []byte(passphrase))
+			if err != nil {
+				return nil, errors.Trace(err)
+			}
+			key = pem.EncodeToMemory(&pem.Block{Type: block.Type, Bytes: der})
+		}
+	}
+	pair, err := tls.X509KeyPair(crt, key)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	pair.Leaf, err = x509.ParseCertificate(pair.Certificate[0])
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	return &pair, nil
+}
@@ -0,0 +1,128 @@
+package utils
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func genKeyPair(t *testing.T, serial int64) ([]byte, []byte) {
+	priv, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+	tpl := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: "localhost"},
+		DNSNames:     []string{"localhost"},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tpl, tpl, &priv.PublicKey, priv)
+	assert.NoError(t, err)
+	key, err := x509.MarshalECPrivateKey(priv)
+	assert.NoError(t, err)
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: key})
+}
+
+func writeKeyPair(t *testing.T, dir string, crt, key []byte) {
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, "crt.pem"), crt, 0600))
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, "key.pem"), key, 0600))
+	// make sure the modification time is changed
+	later := time.Now().Add(time.Duration(len(crt)) * time.Millisecond)
+	assert.NoError(t, os.Chtimes(filepath.Join(dir, "crt.pem"), later, later))
+}
+
+func TestCertReloader(t *testing.T) {
+	dir := t.TempDir()
+	crtFile, keyFile := filepath.Join(dir, "crt.pem"), filepath.Join(dir, "key.pem")
+
+	_, err := NewCertReloader(crtFile, keyFile, "")
+	assert.Error(t, err)
+
+	crt1, key1 := genKeyPair(t, 1)
+	writeKeyPair(t, dir, crt1, key1)
+	r, err := NewCertReloader(crtFile, keyFile, "")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), r.Leaf().SerialNumber.Int64())
+
+	// the last good key pair is kept if the new one is broken
+	crt2, key2 := genKeyPair(t, 2)
+	writeKeyPair(t, dir, crt2, key1)
+	assert.Error(t, r.Reload())
+	c, err := r.GetClientCertificate(nil)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), c.Leaf.SerialNumber.Int64())
+
+	writeKeyPair(t, dir, crt2, key2)
+	c, err = r.GetCertificate(nil)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), c.Leaf.SerialNumber.Int64())
+}
+
+func TestTLSConfigWithReload(t *testing.T) {
+	dir := t.TempDir()
+	crt1, key1 := genKeyPair(t, 1)
+	writeKeyPair(t, dir, crt1, key1)
+	c := Certificate{Cert: filepath.Join(dir, "crt.pem"), Key: filepath.Join(dir, "key.pem")}
+
+	svr, err := NewTLSConfigServerWithReload(c)
+	assert.NoError(t, err)
+	assert.Nil(t, svr.Certificates)
+	svr.ClientAuth = tls.RequireAnyClientCert
+	cli, err := NewTLSConfigClientWithReload(c)
+	assert.NoError(t, err)
+	assert.Nil(t, cli.Certificates)
+	cli.InsecureSkipVerify = true
+
+	ln, err := tls.Listen("tcp", "127.0.0.1:0", svr)
+	assert.NoError(t, err)
+	defer ln.Close()
+	serials := make(chan int64, 2)
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			tc := conn.(*tls.Conn)
+			if tc.Handshake() == nil {
+				serials <- tc.ConnectionState().PeerCertificates[0].SerialNumber.Int64()
+			}
+			conn.Close()
+		}
+	}()
+
+	handshake := func() int64 {
+		conn, err := tls.Dial("tcp", ln.Addr().String(), cli)
+		assert.NoError(t, err)
+		defer conn.Close()
+		assert.NoError(t, conn.Handshake())
+		assert.Equal(t, <-serials, conn.ConnectionState().PeerCertificates[0].SerialNumber.Int64())
+		return conn.ConnectionState().PeerCertificates[0].SerialNumber.Int64()
+	}
+	assert.Equal(t, int64(1), handshake())
+
+	crt2, key2 := genKeyPair(t, 2)
+	writeKeyPair(t, dir, crt2, key2)
+	assert.Equal(t, int64(2), handshake())
+
+	cli, err = NewTLSConfigClientWithReload(Certificate{})
+	assert.NoError(t, err)
+	assert.Nil(t, cli.GetClientCertificate)
+}